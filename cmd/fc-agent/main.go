@@ -24,6 +24,21 @@ func main() {
 		fcSocketPath    = flag.String("fc-socket", "/tmp/firecracker.socket", "path to firecracker API socket")
 		logLevel        = flag.String("log-level", "info", "log level (debug, info, warn, error)")
 		showVersion     = flag.Bool("version", false, "show version and exit")
+		cpuOvercommit   = flag.Float64("cpu-overcommit", 4, "vCPUs allowed per Linux VM CPU")
+		memOvercommit   = flag.Float64("memory-overcommit", 1, "microVM memory allowed per MiB of Linux VM memory")
+		memReserve      = flag.Int("memory-reserve", 256, "MiB of Linux VM memory kept back from microVMs")
+		jailerPath      = flag.String("jailer", "", "run microVMs under this jailer binary (e.g. /usr/local/bin/jailer)")
+		jailerChroot    = flag.String("jailer-chroot-base", "/srv/jailer", "base directory for jailer chroots")
+		jailerUID       = flag.Int("jailer-uid", 10000, "first uid for jailed microVMs; each gets its own")
+		jailerGID       = flag.Int("jailer-gid", 10000, "gid for jailed microVMs")
+		tokenFile       = flag.String("token-file", "", "file holding the bearer token clients must present")
+		tlsCert         = flag.String("tls-cert", "", "TLS certificate file (serves HTTPS when set)")
+		tlsKey          = flag.String("tls-key", "", "TLS private key file")
+		tokenStore      = flag.String("tokens", "/etc/fc-agent/tokens.json", "file holding named, scoped API tokens")
+		auditLog        = flag.String("audit-log", "/var/log/fc-agent/audit.jsonl", "audit log of mutating and denied requests (\"off\" disables)")
+		auditMaxMiB     = flag.Int("audit-max-size", 10, "MiB at which the audit log is rotated")
+		auditMaxFiles   = flag.Int("audit-max-files", 5, "rotated audit logs to keep")
+		unversioned     = flag.Bool("unversioned-routes", true, "also serve the API at its deprecated paths without the /v1 prefix")
 	)
 	flag.Parse()
 
@@ -44,12 +59,50 @@ func main() {
 
 	logrus.Infof("fc-agent version %s starting", version)
 
+	var token string
+	if *tokenFile != "" {
+		token, err = agent.LoadToken(*tokenFile)
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		logrus.Fatal("-tls-cert and -tls-key must be given together")
+	}
+
+	var jailer *agent.JailerConfig
+	if *jailerPath != "" {
+		jailer = &agent.JailerConfig{
+			Bin:           *jailerPath,
+			ChrootBaseDir: *jailerChroot,
+			UIDBase:       *jailerUID,
+			GID:           *jailerGID,
+		}
+	}
+
 	// Create agent
 	agentInstance := agent.New(&agent.Config{
 		HTTPPort:       *httpPort,
 		VsockPort:      uint32(*vsockPort),
 		FirecrackerBin: *fcPath,
 		SocketPath:     *fcSocketPath,
+
+		CPUOvercommitRatio:    *cpuOvercommit,
+		MemoryOvercommitRatio: *memOvercommit,
+		MemoryReserveMiB:      *memReserve,
+		Jailer:                jailer,
+
+		AuthToken:   token,
+		TLSCertFile: *tlsCert,
+		TLSKeyFile:  *tlsKey,
+		TokenFile:   *tokenStore,
+
+		AuditLog:      *auditLog,
+		AuditMaxBytes: int64(*auditMaxMiB) << 20,
+		AuditMaxFiles: *auditMaxFiles,
+
+		Version:                  version,
+		DisableUnversionedRoutes: !*unversioned,
 	})
 
 	// Set up context with signal handling
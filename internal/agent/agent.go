@@ -3,7 +3,10 @@ package agent
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -18,6 +21,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/anthropics/fc-macos/pkg/agentclient"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,56 +30,96 @@ type Config struct {
 	HTTPPort       int
 	VsockPort      uint32
 	FirecrackerBin string
-	SocketPath     string // Legacy single-VM socket path
-	MaxMicroVMs    int    // Maximum allowed microVMs (default: 10)
+	SocketPath     string        // Legacy single-VM socket path
+	MaxMicroVMs    int           // Maximum allowed microVMs (default: 10)
+	ReapInterval   time.Duration // How often TTL/idle expiry is checked (default: 10s)
+
+	// Admission control
+	CPUOvercommitRatio    float64 // vCPUs allowed per host CPU (default: 4)
+	MemoryOvercommitRatio float64 // microVM memory allowed per MiB of host memory (default: 1)
+	MemoryReserveMiB      int     // Host memory kept back for the Linux VM itself (default: 256)
+	ProcRoot              string  // Where to read host resources from (default: /proc)
+
+	CgroupRoot string // Parent cgroup for microVMs (default: /sys/fs/cgroup/fc-agent.slice)
+
+	// Jailer, if set, runs each microVM under Firecracker's jailer with its
+	// own chroot, uid/gid and network namespace.
+	Jailer *JailerConfig
+
+	// API security. Without a token every request is accepted; without a
+	// certificate the API is served over plain HTTP.
+	AuthToken   string
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TokenFile persists named, scoped tokens (default: /etc/fc-agent/tokens.json).
+	TokenFile string
+
+	// Audit log of mutating and denied requests
+	AuditLog      string // JSON-lines file (default: /var/log/fc-agent/audit.jsonl, "off" disables)
+	AuditMaxBytes int64  // Size at which the log is rotated (default: 10 MiB)
+	AuditMaxFiles int    // Rotated files kept (default: 5)
+
+	// Version is the fc-agent release reported by /version.
+	Version string
+
+	// DisableUnversionedRoutes serves the API only under /v1. The
+	// unversioned routes are deprecated and kept for older clients.
+	DisableUnversionedRoutes bool
 }
 
 // MicroVMConfig holds per-microVM configuration.
-type MicroVMConfig struct {
-	VCPUs     int    `json:"vcpus"`
-	MemoryMiB int    `json:"memory_mib"`
-	Kernel    string `json:"kernel"`
-	Rootfs    string `json:"rootfs"`
-	BootArgs  string `json:"boot_args"`
-}
+type MicroVMConfig = agentclient.MicroVMConfig
 
 // MicroVM represents a single Firecracker microVM instance.
 type MicroVM struct {
 	ID         string         `json:"id"`
-	Name       string         `json:"name"`
-	SocketPath string         `json:"socket_path"`
-	Config     *MicroVMConfig `json:"config,omitempty"`
-	CreatedAt  time.Time      `json:"created_at"`
+	Name       string            `json:"name"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	SocketPath string            `json:"socket_path"`
+	VsockPath  string            `json:"vsock_path,omitempty"`
+	GuestCID   uint32            `json:"guest_cid,omitempty"`
+	Network    *NetworkInfo      `json:"network,omitempty"`
+	Config     *MicroVMConfig    `json:"config,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+
+	// Lifetime limits enforced by the reaper
+	ExpiresAt   *time.Time    `json:"expires_at,omitempty"`
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+
+	// Cgroup limits for the Firecracker process (nil for the legacy VM)
+	Resources *ResourceLimits `json:"resources,omitempty"`
+
+	jail *jail // Set when running under the jailer
+
+	ownedRootfs string // A clone's rootfs copy, removed with the microVM
+
+	lastActivity atomic.Int64 // UnixNano of last console/vsock activity
+
+	startedAt   time.Time   // When Firecracker was last started
+	starts      int         // Times Firecracker has been started
+	fcMetrics   *fcCounters // Totals read from the metrics FIFO
+	metricsPath string
+	metricsFIFO *os.File
+	logPath     string // Firecracker's log file, on the agent's filesystem
+	stats       *statsHistory
 
 	fcProcess  *exec.Cmd
 	proxy      *httputil.ReverseProxy
 	consoleIn  io.WriteCloser
 	consoleOut io.ReadCloser
 	started    bool
+	paused     bool // Set while paused through the agent
+	cloning    bool // Set while a clone has it paused or is copying it
+	pausing    bool // Set while a pause or resume is in flight
 	mu         sync.Mutex
 }
 
 // MicroVMInfo is the JSON response for microVM status.
-type MicroVMInfo struct {
-	ID           string         `json:"id"`
-	Name         string         `json:"name"`
-	Running      bool           `json:"running"`
-	PID          int            `json:"pid,omitempty"`
-	CreatedAt    time.Time      `json:"created_at"`
-	Config       *MicroVMConfig `json:"config,omitempty"`
-	CPUPercent   float64        `json:"cpu_percent,omitempty"`
-	MemoryUsedMB int            `json:"memory_used_mb,omitempty"`
-}
+type MicroVMInfo = agentclient.MicroVMInfo
 
 // CreateMicroVMRequest is the request body for creating a microVM.
-type CreateMicroVMRequest struct {
-	Name      string `json:"name,omitempty"`
-	Kernel    string `json:"kernel"`
-	Rootfs    string `json:"rootfs"`
-	VCPUs     int    `json:"vcpus"`
-	MemoryMiB int    `json:"memory_mib"`
-	BootArgs  string `json:"boot_args,omitempty"`
-}
+type CreateMicroVMRequest = agentclient.CreateMicroVMRequest
 
 // Agent is the fc-agent that proxies requests to Firecracker.
 type Agent struct {
@@ -85,6 +129,37 @@ type Agent struct {
 	microVMs  map[string]*MicroVM
 	vmMu      sync.RWMutex
 	idCounter uint64
+	networks  *networkManager
+	cgroups   cgroupManager
+	jailer    *jailer // nil unless jailer mode is enabled
+	tokens    *tokenStore
+	audit     *auditLog // nil when auditing is off
+
+	// Names taken by microVMs that are still being created, so concurrent
+	// creates cannot both claim one. Guarded by vmMu.
+	pendingNames map[string]bool
+
+	// Held while a create with an Idempotency-Key is checked and started, so
+	// a retry racing the original finds its operation
+	idempotencyMu sync.Mutex
+
+	// Held while a drive swap checks that its file is free and patches it
+	// in, so two swaps cannot claim one file
+	swapMu sync.Mutex
+
+	// Creates and deletes running in the background
+	operations *operationStore
+
+	httpMetrics *httpMetrics
+
+	// Firecracker's version, looked up on first use
+	fcVersionOnce sync.Once
+	fcVersion     string
+
+	// Resources held by microVMs that are still being created
+	capMu            sync.Mutex
+	pendingVCPUs     int
+	pendingMemoryMiB int
 
 	// Legacy single-VM support (for backward compatibility)
 	legacyVM *MicroVM
@@ -101,22 +176,128 @@ func New(cfg *Config) *Agent {
 	if cfg.SocketPath == "" {
 		cfg.SocketPath = "/tmp/firecracker.socket"
 	}
-	return &Agent{
+	if cfg.ReapInterval == 0 {
+		cfg.ReapInterval = 10 * time.Second
+	}
+	if cfg.CPUOvercommitRatio == 0 {
+		cfg.CPUOvercommitRatio = 4
+	}
+	if cfg.MemoryOvercommitRatio == 0 {
+		cfg.MemoryOvercommitRatio = 1
+	}
+	if cfg.MemoryReserveMiB == 0 {
+		cfg.MemoryReserveMiB = 256
+	}
+	if cfg.ProcRoot == "" {
+		cfg.ProcRoot = "/proc"
+	}
+	if cfg.CgroupRoot == "" {
+		cfg.CgroupRoot = "/sys/fs/cgroup/fc-agent.slice"
+	}
+	if cfg.TokenFile == "" {
+		cfg.TokenFile = "/etc/fc-agent/tokens.json"
+	}
+	if cfg.AuditLog == "" {
+		cfg.AuditLog = "/var/log/fc-agent/audit.jsonl"
+	}
+	if cfg.AuditMaxBytes == 0 {
+		cfg.AuditMaxBytes = 10 << 20
+	}
+	if cfg.AuditMaxFiles == 0 {
+		cfg.AuditMaxFiles = 5
+	}
+	a := &Agent{
 		config:   cfg,
 		microVMs: make(map[string]*MicroVM),
+		networks: newNetworkManager(),
+		cgroups:  newCgroupManager(cfg.CgroupRoot),
+		tokens:   newTokenStore(cfg.TokenFile),
+
+		pendingNames: make(map[string]bool),
+
+		operations: newOperationStore(),
+
+		httpMetrics: newHTTPMetrics(),
+	}
+	if cfg.Jailer != nil && cfg.Jailer.Bin != "" {
+		a.jailer = newJailer(cfg.Jailer, cfg.FirecrackerBin)
 	}
+	if cfg.AuditLog != "off" {
+		a.audit = newAuditLog(cfg.AuditLog, cfg.AuditMaxBytes, cfg.AuditMaxFiles)
+	}
+	return a
 }
 
 // Run starts the agent and listens for HTTP requests.
 func (a *Agent) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", a.config.HTTPPort),
+		Handler: a.Handler(),
+	}
+
+	if a.config.AuthToken == "" {
+		logrus.Warn("No API token configured; fc-agent accepts unauthenticated requests")
+	}
+
+	// Stop microVMs whose TTL or idle timeout has passed
+	go a.runReaper(ctx)
+
+	// Keep resource history for /agent/microvms/{id}/stats
+	go a.runStatsCollector(ctx)
+
+	// Graceful shutdown
+	go func() {
+		<-ctx.Done()
+		logrus.Info("Shutting down HTTP server...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+		a.stopAllMicroVMs()
+		if a.audit != nil {
+			a.audit.Close()
+		}
+	}()
+
+	var err error
+	if a.config.TLSCertFile != "" {
+		logrus.Infof("Agent listening on :%d (TLS)", a.config.HTTPPort)
+		err = server.ListenAndServeTLS(a.config.TLSCertFile, a.config.TLSKeyFile)
+	} else {
+		logrus.Infof("Agent listening on :%d", a.config.HTTPPort)
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		return fmt.Errorf("server error: %w", err)
+	}
+	return nil
+}
+
+// Handler returns the agent's HTTP API, wrapped in its versioning, metrics,
+// audit and auth middleware. Run serves it; tests can serve it with httptest.
+func (a *Agent) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	// Health check endpoint
 	mux.HandleFunc("/health", a.handleHealth)
+	mux.HandleFunc("/version", a.handleVersion)
+	mux.HandleFunc("/openapi.json", a.handleOpenAPI)
 
 	// Multi-microVM management endpoints
 	mux.HandleFunc("/agent/microvms", a.handleMicroVMs)
 	mux.HandleFunc("/agent/microvms/", a.handleMicroVMByID)
+	mux.HandleFunc("/agent/microvms:batch", a.handleBatchCreate)
+	mux.HandleFunc("/agent/capacity", a.handleCapacity)
+	mux.HandleFunc("/agent/stats", a.handleStats)
+	mux.HandleFunc("/agent/operations", a.handleOperations)
+	mux.HandleFunc("/agent/operations/", a.handleOperationByID)
+
+	// Token management (admin only)
+	mux.HandleFunc("/agent/tokens", a.handleTokens)
+	mux.HandleFunc("/agent/tokens/", a.handleTokenByName)
+	mux.HandleFunc("/agent/audit", a.handleAudit)
+
+	// Prometheus metrics. /metrics itself is Firecracker's and is proxied.
+	mux.HandleFunc("/agent/metrics", a.handleMetrics)
 
 	// Legacy single-VM endpoints (backward compatibility)
 	mux.HandleFunc("/agent/start", a.handleLegacyStart)
@@ -127,31 +308,12 @@ func (a *Agent) Run(ctx context.Context) error {
 	// Proxy to Firecracker (handles both legacy and multi-VM)
 	mux.HandleFunc("/", a.handleProxy)
 
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", a.config.HTTPPort),
-		Handler: mux,
-	}
-
-	// Graceful shutdown
-	go func() {
-		<-ctx.Done()
-		logrus.Info("Shutting down HTTP server...")
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		server.Shutdown(shutdownCtx)
-		a.stopAllMicroVMs()
-	}()
-
-	logrus.Infof("Agent listening on :%d", a.config.HTTPPort)
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		return fmt.Errorf("server error: %w", err)
-	}
-	return nil
+	return a.withAPIVersion(a.withMetrics(a.withAudit(a.withAuth(a.withAuditBody(mux)))))
 }
 
 func (a *Agent) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "api_version": APIVersion})
 }
 
 // ==================== Multi-MicroVM Handlers ====================
@@ -168,25 +330,32 @@ func (a *Agent) handleMicroVMs(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *Agent) listMicroVMs(w http.ResponseWriter, r *http.Request) {
+	selector, err := ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := identityFrom(r.Context())
+
 	a.vmMu.RLock()
 	defer a.vmMu.RUnlock()
 
 	vms := make([]MicroVMInfo, 0, len(a.microVMs))
 	for _, vm := range a.microVMs {
+		if !selector.Matches(vm.Labels) || !id.allows(vm.Labels) {
+			continue
+		}
 		vm.mu.Lock()
-		info := MicroVMInfo{
-			ID:        vm.ID,
-			Name:      vm.Name,
-			Running:   vm.started,
-			CreatedAt: vm.CreatedAt,
-			Config:    vm.Config,
-		}
-		if vm.fcProcess != nil && vm.fcProcess.Process != nil {
-			info.PID = vm.fcProcess.Process.Pid
-			// Get resource usage
-			cpu, mem := getProcessStats(info.PID)
-			info.CPUPercent = cpu
-			info.MemoryUsedMB = mem
+		info := vm.info()
+		if info.PID > 0 {
+			// Get resource usage, from the cgroup where there is one
+			if stats, err := a.cgroups.Stats(vm.ID); err == nil {
+				info.CPUPercent = stats.CPUPercent
+				info.MemoryUsedMB = stats.MemoryUsedMB
+			} else {
+				info.CPUPercent, info.MemoryUsedMB = getProcessStats(info.PID)
+			}
 		}
 		vm.mu.Unlock()
 		vms = append(vms, info)
@@ -201,7 +370,8 @@ func (a *Agent) listMicroVMs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(vms)
 }
 
-// getProcessStats returns CPU percentage and memory usage in MB for a process
+// getProcessStats returns CPU percentage and memory usage in MB for a process.
+// It is only used when cgroups are unavailable.
 // Uses ps command for accurate real-time stats
 func getProcessStats(pid int) (cpuPercent float64, memoryMB int) {
 	// Use ps to get real-time CPU and memory usage
@@ -225,21 +395,75 @@ func getProcessStats(pid int) (cpuPercent float64, memoryMB int) {
 
 func (a *Agent) createMicroVM(w http.ResponseWriter, r *http.Request) {
 	var req CreateMicroVMRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+	if !decodeRequest(w, r, "CreateMicroVMRequest", &req) {
 		return
 	}
 
-	// Validate required fields
-	if req.Kernel == "" {
-		http.Error(w, "kernel is required", http.StatusBadRequest)
+	// A retried create gets the operation of the original back
+	var idempotencyKey, requestHash string
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		a.idempotencyMu.Lock()
+		defer a.idempotencyMu.Unlock()
+
+		// Keys are per token, so one caller cannot see another's microVM
+		if id := identityFrom(r.Context()); id != nil {
+			idempotencyKey = id.Name + "/"
+		}
+		idempotencyKey += key
+		body, _ := json.Marshal(req)
+		sum := sha256.Sum256(body)
+		requestHash = hex.EncodeToString(sum[:])
+
+		if op := a.operations.byIdempotencyKey(idempotencyKey); op != nil {
+			if op.requestHash != requestHash {
+				http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+				return
+			}
+			acceptOperation(w, op)
+			return
+		}
+	}
+
+	if !a.checkCreate(w, r, &req, "") {
 		return
 	}
-	if req.Rootfs == "" {
-		http.Error(w, "rootfs is required", http.StatusBadRequest)
+	vm, release, status, err := a.newMicroVM(&req, req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), status)
 		return
 	}
 
+	// Boot it in the background; the client polls the operation
+	op := a.operations.start("create", vm, true, func(ctx context.Context) (*MicroVMInfo, error) {
+		defer release()
+		return a.bootMicroVM(ctx, vm, req.Network, requestDuration(req.TTL))
+	})
+	if idempotencyKey != "" {
+		a.operations.setIdempotencyKey(op, idempotencyKey, requestHash)
+	}
+	acceptOperation(w, op)
+}
+
+// checkCreate checks the caller may create what req asks for and fills in
+// defaults, or writes an error response. fieldPrefix is put in front of the
+// field names in validation errors.
+func (a *Agent) checkCreate(w http.ResponseWriter, r *http.Request, req *CreateMicroVMRequest, fieldPrefix string) bool {
+	if req.FCLogLevel != "" {
+		level, err := parseFCLogLevel(req.FCLogLevel)
+		if err != nil {
+			writeFieldErrors(w, FieldError{Field: fieldPrefix + "fc_log_level", Message: "must be one of " + strings.Join(fcLogLevels, ", ")})
+			return false
+		}
+		req.FCLogLevel = level
+	}
+
+	if id := identityFrom(r.Context()); !id.allows(req.Labels) {
+		reason := fmt.Sprintf("labels must match %s", id.selector.String())
+		a.auditDenied(r, id.Name, reason)
+		http.Error(w, "Forbidden: "+reason, http.StatusForbidden)
+		return false
+	}
+
 	// Set defaults
 	if req.VCPUs == 0 {
 		req.VCPUs = 1
@@ -250,33 +474,45 @@ func (a *Agent) createMicroVM(w http.ResponseWriter, r *http.Request) {
 	if req.BootArgs == "" {
 		req.BootArgs = "console=ttyS0 reboot=k panic=1 pci=off"
 	}
+	return true
+}
 
-	// Check max VMs limit
-	a.vmMu.RLock()
-	if len(a.microVMs) >= a.config.MaxMicroVMs {
-		a.vmMu.RUnlock()
-		http.Error(w, fmt.Sprintf("Maximum microVMs limit reached (%d)", a.config.MaxMicroVMs), http.StatusTooManyRequests)
-		return
-	}
-	a.vmMu.RUnlock()
+// requestDuration parses a duration from a request. The schema has checked
+// it is empty or a positive duration.
+func requestDuration(s string) time.Duration {
+	d, _ := time.ParseDuration(s)
+	return d
+}
 
+// newMicroVM builds a microVM from a checked request, claims its name and
+// reserves the vCPUs and memory it needs. An empty name is generated.
+// release gives the name and resources back, and must be called once the
+// microVM has booted or failed to. On error, status is the HTTP status to
+// fail the create with.
+func (a *Agent) newMicroVM(req *CreateMicroVMRequest, name string) (_ *MicroVM, release func(), status int, _ error) {
 	// Generate ID and name
-	id := a.generateID()
-	name := req.Name
+	id, n := a.generateID()
 	if name == "" {
-		name = fmt.Sprintf("microvm-%d", atomic.LoadUint64(&a.idCounter))
+		name = fmt.Sprintf("microvm-%d", n)
 	}
 
-	// Check for name collision
-	a.vmMu.RLock()
-	for _, existing := range a.microVMs {
-		if existing.Name == name {
-			a.vmMu.RUnlock()
-			http.Error(w, fmt.Sprintf("microVM with name '%s' already exists", name), http.StatusConflict)
-			return
+	// Claim the name before anything slow happens
+	if status, err := a.reserveName(name); err != nil {
+		return nil, nil, status, err
+	}
+
+	// Check the Linux VM has room for it
+	releaseCapacity, err := a.reserveCapacity(req.VCPUs, req.MemoryMiB)
+	if err != nil {
+		a.releaseName(name)
+		status := http.StatusInternalServerError
+		var capErr *capacityError
+		if errors.As(err, &capErr) {
+			status = capErr.Status
 		}
+		logrus.Warnf("Rejected microVM create: %v", err)
+		return nil, nil, status, err
 	}
-	a.vmMu.RUnlock()
 
 	// Create socket path
 	socketPath := fmt.Sprintf("/tmp/firecracker-%s.socket", id)
@@ -284,6 +520,7 @@ func (a *Agent) createMicroVM(w http.ResponseWriter, r *http.Request) {
 	vm := &MicroVM{
 		ID:         id,
 		Name:       name,
+		Labels:     req.Labels,
 		SocketPath: socketPath,
 		CreatedAt:  time.Now(),
 		Config: &MicroVMConfig{
@@ -292,39 +529,140 @@ func (a *Agent) createMicroVM(w http.ResponseWriter, r *http.Request) {
 			Kernel:    req.Kernel,
 			Rootfs:    req.Rootfs,
 			BootArgs:  req.BootArgs,
+
+			FCLogLevel: req.FCLogLevel,
 		},
 	}
 
+	vm.IdleTimeout = requestDuration(req.IdleTimeout)
+	vm.Resources = resolveLimits(vm.Config, req.Resources)
+	vm.touch()
+
+	if req.Vsock {
+		vm.VsockPath = fmt.Sprintf("/tmp/firecracker-%s.vsock", id)
+		vm.GuestCID = firstGuestCID + uint32(n)
+	}
+
+	release = func() {
+		releaseCapacity()
+		a.releaseName(name)
+	}
+	return vm, release, 0, nil
+}
+
+// reserveName claims name for a microVM that is about to be created, and
+// counts it against MaxMicroVMs. It returns the HTTP status to fail the
+// create with if the name is taken or there is no room.
+func (a *Agent) reserveName(name string) (int, error) {
+	a.vmMu.Lock()
+	defer a.vmMu.Unlock()
+
+	if len(a.microVMs)+len(a.pendingNames) >= a.config.MaxMicroVMs {
+		return http.StatusTooManyRequests, fmt.Errorf("Maximum microVMs limit reached (%d)", a.config.MaxMicroVMs)
+	}
+	if a.pendingNames[name] {
+		return http.StatusConflict, fmt.Errorf("microVM with name '%s' already exists", name)
+	}
+	for _, existing := range a.microVMs {
+		if existing.Name == name {
+			return http.StatusConflict, fmt.Errorf("microVM with name '%s' already exists", name)
+		}
+	}
+	a.pendingNames[name] = true
+	return 0, nil
+}
+
+// releaseName gives up a name claimed by reserveName. A microVM that booted
+// holds its name through a.microVMs from then on.
+func (a *Agent) releaseName(name string) {
+	a.vmMu.Lock()
+	delete(a.pendingNames, name)
+	a.vmMu.Unlock()
+}
+
+// bootMicroVM prepares vm's jail and network, starts and configures
+// Firecracker, and registers vm once it is running. On failure, or if ctx is
+// cancelled first, everything it set up is torn down again.
+func (a *Agent) bootMicroVM(ctx context.Context, vm *MicroVM, network *NetworkConfig, ttl time.Duration) (_ *MicroVMInfo, err error) {
+	op := operationFrom(ctx)
+	started := false
+	defer func() {
+		if err == nil {
+			return
+		}
+		if started {
+			a.stopFirecrackerForVM(vm)
+			vm.removeLog()
+			a.cgroups.Remove(vm.ID)
+		}
+		a.networks.detach(vm.Network, vm.ID)
+		a.jailer.cleanup(vm)
+	}()
+
+	// Build the chroot and network namespace
+	if a.jailer != nil {
+		op.step("Preparing jail")
+		if err := a.jailer.prepare(vm); err != nil {
+			return nil, fmt.Errorf("failed to prepare jail: %w", err)
+		}
+	}
+
+	// Attach to a shared network
+	if network != nil && network.Name != "" {
+		op.step("Attaching network")
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		netInfo, err := a.networks.attach(network.Name, vm.ID, vm.jail)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach network: %w", err)
+		}
+		vm.Network = netInfo
+		vm.Config.BootArgs = vm.Config.BootArgs + " " + kernelIPArg(netInfo)
+	}
+
 	// Start Firecracker process
+	op.step("Starting Firecracker")
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if err := a.startFirecrackerForVM(vm); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to start Firecracker: %v", err), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to start Firecracker: %w", err)
 	}
+	started = true
 
 	// Configure and start the microVM
-	if err := a.configureAndStartVM(r.Context(), vm); err != nil {
-		a.stopFirecrackerForVM(vm)
-		http.Error(w, fmt.Sprintf("Failed to configure microVM: %v", err), http.StatusInternalServerError)
-		return
+	if err := a.configureAndStartVM(ctx, vm); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to configure microVM: %w", err)
+	}
+
+	return a.registerMicroVM(vm, ttl), nil
+}
+
+// registerMicroVM adds vm, now running, to the registry, where it takes over
+// its name from the reservation, and starts its TTL.
+func (a *Agent) registerMicroVM(vm *MicroVM, ttl time.Duration) *MicroVMInfo {
+	// The TTL runs from when the microVM is actually up
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		vm.ExpiresAt = &expiresAt
 	}
+	vm.touch()
 
-	// Register the VM
 	a.vmMu.Lock()
-	a.microVMs[id] = vm
+	a.microVMs[vm.ID] = vm
+	delete(a.pendingNames, vm.Name)
 	a.vmMu.Unlock()
 
 	logrus.Infof("Created microVM: %s (%s)", vm.Name, vm.ID)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(MicroVMInfo{
-		ID:        vm.ID,
-		Name:      vm.Name,
-		Running:   vm.started,
-		PID:       vm.fcProcess.Process.Pid,
-		CreatedAt: vm.CreatedAt,
-		Config:    vm.Config,
-	})
+	vm.mu.Lock()
+	info := vm.info()
+	vm.mu.Unlock()
+	return &info
 }
 
 func (a *Agent) handleMicroVMByID(w http.ResponseWriter, r *http.Request) {
@@ -339,7 +677,11 @@ func (a *Agent) handleMicroVMByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get VM by ID or name
-	vm := a.getVMByIDOrName(vmID)
+	vm, err := a.requestVM(r, vmID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if vm == nil {
 		http.Error(w, fmt.Sprintf("microVM not found: %s", vmID), http.StatusNotFound)
 		return
@@ -351,6 +693,27 @@ func (a *Agent) handleMicroVMByID(w http.ResponseWriter, r *http.Request) {
 		case "console":
 			a.handleVMConsole(w, r, vm)
 			return
+		case "exec":
+			a.handleVMExec(w, r, vm)
+			return
+		case "extend":
+			a.handleVMExtend(w, r, vm)
+			return
+		case "clone":
+			a.handleVMClone(w, r, vm)
+			return
+		case "pause", "resume":
+			a.handleVMPause(w, r, vm, parts[1] == "pause")
+			return
+		case "swap-drive":
+			a.handleVMSwapDrive(w, r, vm)
+			return
+		case "firecracker-logs":
+			a.handleVMFirecrackerLogs(w, r, vm)
+			return
+		case "stats":
+			a.handleVMStats(w, r, vm)
+			return
 		default:
 			// Proxy to Firecracker API for this VM
 			a.proxyToVM(w, r, vm, "/"+parts[1])
@@ -372,16 +735,7 @@ func (a *Agent) getMicroVMStatus(w http.ResponseWriter, vm *MicroVM) {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
 
-	info := MicroVMInfo{
-		ID:        vm.ID,
-		Name:      vm.Name,
-		Running:   vm.started,
-		CreatedAt: vm.CreatedAt,
-		Config:    vm.Config,
-	}
-	if vm.fcProcess != nil && vm.fcProcess.Process != nil {
-		info.PID = vm.fcProcess.Process.Pid
-	}
+	info := vm.info()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(info)
@@ -390,9 +744,34 @@ func (a *Agent) getMicroVMStatus(w http.ResponseWriter, vm *MicroVM) {
 func (a *Agent) deleteMicroVM(w http.ResponseWriter, r *http.Request, vm *MicroVM) {
 	force := r.URL.Query().Get("force") == "true"
 
+	// Stopping cannot be undone halfway, so deletes are not cancellable
+	op := a.operations.start("delete", vm, false, func(ctx context.Context) (*MicroVMInfo, error) {
+		operationFrom(ctx).step("Stopping Firecracker")
+		if err := a.removeMicroVM(vm, force); err != nil {
+			return nil, fmt.Errorf("failed to stop microVM: %w", err)
+		}
+		return nil, nil
+	})
+	acceptOperation(w, op)
+}
+
+// removeMicroVM stops a microVM, releases its resources and removes it from
+// the registry. Unless force is set, a failure to stop leaves it registered.
+func (a *Agent) removeMicroVM(vm *MicroVM, force bool) error {
 	if err := a.stopFirecrackerForVM(vm); err != nil && !force {
-		http.Error(w, fmt.Sprintf("Failed to stop microVM: %v", err), http.StatusInternalServerError)
-		return
+		return err
+	}
+	vm.removeLog()
+
+	if err := a.cgroups.Remove(vm.ID); err != nil {
+		logrus.Warnf("Failed to remove cgroup for %s: %v", vm.Name, err)
+	}
+	a.networks.detach(vm.Network, vm.ID)
+	a.jailer.cleanup(vm)
+	if vm.ownedRootfs != "" {
+		if err := os.Remove(vm.ownedRootfs); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("Failed to remove rootfs copy for %s: %v", vm.Name, err)
+		}
 	}
 
 	// Remove from registry
@@ -401,9 +780,7 @@ func (a *Agent) deleteMicroVM(w http.ResponseWriter, r *http.Request, vm *MicroV
 	a.vmMu.Unlock()
 
 	logrus.Infof("Deleted microVM: %s (%s)", vm.Name, vm.ID)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "id": vm.ID})
+	return nil
 }
 
 func (a *Agent) handleVMConsole(w http.ResponseWriter, r *http.Request, vm *MicroVM) {
@@ -457,6 +834,7 @@ func (a *Agent) handleVMConsole(w http.ResponseWriter, r *http.Request, vm *Micr
 				return
 			}
 			if n > 0 {
+				vm.touch()
 				if _, err := conn.Write(buf[:n]); err != nil {
 					return
 				}
@@ -473,6 +851,7 @@ func (a *Agent) handleVMConsole(w http.ResponseWriter, r *http.Request, vm *Micr
 				return
 			}
 			if n > 0 {
+				vm.touch()
 				if _, err := consoleIn.Write(buf[:n]); err != nil {
 					return
 				}
@@ -593,7 +972,11 @@ func (a *Agent) handleProxy(w http.ResponseWriter, r *http.Request) {
 		parts := strings.SplitN(path, "/", 2)
 		vmID := parts[0]
 
-		vm := a.getVMByIDOrName(vmID)
+		vm, err := a.requestVM(r, vmID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		if vm == nil {
 			http.Error(w, fmt.Sprintf("microVM not found: %s", vmID), http.StatusNotFound)
 			return
@@ -609,7 +992,11 @@ func (a *Agent) handleProxy(w http.ResponseWriter, r *http.Request) {
 
 	// Check for X-MicroVM-ID header
 	if vmID := r.Header.Get("X-MicroVM-ID"); vmID != "" {
-		vm := a.getVMByIDOrName(vmID)
+		vm, err := a.requestVM(r, vmID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		if vm == nil {
 			http.Error(w, fmt.Sprintf("microVM not found: %s", vmID), http.StatusNotFound)
 			return
@@ -670,33 +1057,90 @@ func (a *Agent) proxyToVM(w http.ResponseWriter, r *http.Request, vm *MicroVM, p
 
 // ==================== Firecracker Management ====================
 
-func (a *Agent) generateID() string {
+// generateID returns a new microVM ID and the counter value in it.
+func (a *Agent) generateID() (string, uint64) {
 	counter := atomic.AddUint64(&a.idCounter, 1)
-	return fmt.Sprintf("vm-%d-%d", time.Now().Unix(), counter)
+	return fmt.Sprintf("vm-%d-%d", time.Now().Unix(), counter), counter
+}
+
+// info builds the API view of the microVM. Callers must hold vm.mu.
+func (vm *MicroVM) info() MicroVMInfo {
+	info := MicroVMInfo{
+		ID:        vm.ID,
+		Name:      vm.Name,
+		Labels:    vm.Labels,
+		Running:   vm.started,
+		Paused:    vm.paused,
+		CreatedAt: vm.CreatedAt,
+		Config:    vm.Config,
+		Network:   vm.Network,
+		Vsock:     vm.VsockPath != "",
+		ExpiresAt: vm.ExpiresAt,
+		Resources: vm.Resources,
+		Jailed:    vm.jail != nil,
+	}
+	if vm.IdleTimeout > 0 {
+		lastActive := vm.lastActive()
+		idleExpiresAt := lastActive.Add(vm.IdleTimeout)
+		info.IdleTimeout = vm.IdleTimeout.String()
+		info.LastActivity = &lastActive
+		info.IdleExpiresAt = &idleExpiresAt
+	}
+	if vm.fcProcess != nil && vm.fcProcess.Process != nil {
+		info.PID = vm.fcProcess.Process.Pid
+	}
+	return info
 }
 
+// getVMByIDOrName returns the microVM lookupVM finds, or nil if there is
+// none or the reference is ambiguous.
 func (a *Agent) getVMByIDOrName(idOrName string) *MicroVM {
+	vm, _ := a.lookupVM(idOrName)
+	return vm
+}
+
+// errAmbiguousVM is returned for an ID prefix that matches several microVMs.
+var errAmbiguousVM = errors.New("ambiguous microVM ID prefix")
+
+// lookupVM finds a microVM by exact ID, name or unique ID prefix, in that
+// order. It returns nil if none matches.
+func (a *Agent) lookupVM(idOrName string) (*MicroVM, error) {
 	a.vmMu.RLock()
 	defer a.vmMu.RUnlock()
 
 	// Check by exact ID
 	if vm, ok := a.microVMs[idOrName]; ok {
-		return vm
+		return vm, nil
+	}
+
+	// Check by name
+	for _, vm := range a.microVMs {
+		if vm.Name == idOrName {
+			return vm, nil
+		}
 	}
 
-	// Check by name or ID prefix
+	// Check by ID prefix, which must not match more than one
+	var match *MicroVM
 	for id, vm := range a.microVMs {
-		if vm.Name == idOrName || strings.HasPrefix(id, idOrName) {
-			return vm
+		if !strings.HasPrefix(id, idOrName) {
+			continue
 		}
+		if match != nil {
+			return nil, fmt.Errorf("%w %q: matches %s and %s", errAmbiguousVM, idOrName, match.Name, vm.Name)
+		}
+		match = vm
+	}
+	if match != nil {
+		return match, nil
 	}
 
 	// Check legacy VM
 	if a.legacyVM != nil && (a.legacyVM.ID == idOrName || a.legacyVM.Name == idOrName) {
-		return a.legacyVM
+		return a.legacyVM, nil
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (a *Agent) startFirecrackerForVM(vm *MicroVM) error {
@@ -717,10 +1161,20 @@ func (a *Agent) startFirecrackerForVM(vm *MicroVM) error {
 		return fmt.Errorf("firecracker binary not found at %s", a.config.FirecrackerBin)
 	}
 
-	vm.fcProcess = exec.Command(a.config.FirecrackerBin,
-		"--api-sock", vm.SocketPath,
-		"--level", "Warning",
-	)
+	if vm.jail != nil {
+		if _, err := os.Stat(a.config.Jailer.Bin); os.IsNotExist(err) {
+			return fmt.Errorf("jailer binary not found at %s", a.config.Jailer.Bin)
+		}
+		vm.fcProcess = a.jailer.command(vm)
+	} else {
+		args := []string{"--api-sock", vm.SocketPath}
+		if vm.Config == nil {
+			// The legacy microVM is configured by the caller, who may never
+			// set up a logger
+			args = append(args, "--level", "Warning")
+		}
+		vm.fcProcess = exec.Command(a.config.FirecrackerBin, args...)
+	}
 
 	// Create pipes for console I/O
 	var err error
@@ -734,13 +1188,30 @@ func (a *Agent) startFirecrackerForVM(vm *MicroVM) error {
 	}
 	vm.fcProcess.Stderr = os.Stderr
 
+	if vm.Resources != nil {
+		if err := a.cgroups.Create(vm.ID, vm.Resources); err != nil {
+			a.cgroups.Remove(vm.ID)
+			return fmt.Errorf("failed to set up cgroup: %w", err)
+		}
+	}
+
 	if err := vm.fcProcess.Start(); err != nil {
+		a.cgroups.Remove(vm.ID)
 		return fmt.Errorf("failed to start Firecracker: %w", err)
 	}
 
+	if vm.Resources != nil {
+		if err := a.cgroups.AddProcess(vm.ID, vm.fcProcess.Process.Pid); err != nil {
+			vm.fcProcess.Process.Kill()
+			a.cgroups.Remove(vm.ID)
+			return fmt.Errorf("failed to move Firecracker into cgroup: %w", err)
+		}
+	}
+
 	// Wait for socket
 	if err := a.waitForSocketPath(vm.SocketPath, 30*time.Second); err != nil {
 		vm.fcProcess.Process.Kill()
+		a.cgroups.Remove(vm.ID)
 		return err
 	}
 
@@ -762,6 +1233,11 @@ func (a *Agent) startFirecrackerForVM(vm *MicroVM) error {
 	}
 
 	vm.started = true
+	vm.startedAt = time.Now()
+	vm.starts++
+	if vm.fcMetrics == nil {
+		vm.fcMetrics = newFCCounters()
+	}
 	logrus.Infof("Firecracker started for %s with PID %d", vm.Name, vm.fcProcess.Process.Pid)
 
 	// Monitor process
@@ -773,7 +1249,9 @@ func (a *Agent) startFirecrackerForVM(vm *MicroVM) error {
 		}
 		vm.mu.Lock()
 		vm.started = false
+		vm.paused = false
 		vm.proxy = nil
+		vm.closeMetricsFIFO()
 		vm.mu.Unlock()
 	}()
 
@@ -785,18 +1263,21 @@ func (a *Agent) configureAndStartVM(ctx context.Context, vm *MicroVM) error {
 		return fmt.Errorf("no configuration provided")
 	}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				return net.Dial("unix", vm.SocketPath)
-			},
-		},
-		Timeout: 10 * time.Second,
+	op := operationFrom(ctx)
+	op.step("Configuring microVM")
+	client := unixClient(vm.SocketPath, 10*time.Second)
+
+	// Jailed microVMs see paths relative to their chroot
+	kernel, rootfs, vsockPath := vm.firecrackerPaths()
+
+	// Log to a per-microVM file first so configuration errors land in it
+	if err := a.setupLogger(client, vm); err != nil {
+		logrus.Warnf("Firecracker log unavailable for %s: %v", vm.Name, err)
 	}
 
 	// Configure boot source
 	bootSource := map[string]interface{}{
-		"kernel_image_path": vm.Config.Kernel,
+		"kernel_image_path": kernel,
 		"boot_args":         vm.Config.BootArgs,
 	}
 	if err := a.putJSON(client, "http://localhost/boot-source", bootSource); err != nil {
@@ -806,7 +1287,7 @@ func (a *Agent) configureAndStartVM(ctx context.Context, vm *MicroVM) error {
 	// Configure rootfs drive
 	drive := map[string]interface{}{
 		"drive_id":       "rootfs",
-		"path_on_host":   vm.Config.Rootfs,
+		"path_on_host":   rootfs,
 		"is_root_device": true,
 		"is_read_only":   false,
 	}
@@ -823,7 +1304,40 @@ func (a *Agent) configureAndStartVM(ctx context.Context, vm *MicroVM) error {
 		return fmt.Errorf("failed to set machine config: %w", err)
 	}
 
-	// Start the instance
+	// Configure network interface
+	if vm.Network != nil {
+		iface := map[string]interface{}{
+			"iface_id":      "eth0",
+			"guest_mac":     vm.Network.MAC,
+			"host_dev_name": vm.Network.TapDevice,
+		}
+		if err := a.putJSON(client, "http://localhost/network-interfaces/eth0", iface); err != nil {
+			return fmt.Errorf("failed to set network interface: %w", err)
+		}
+	}
+
+	// Configure vsock device
+	if vm.VsockPath != "" {
+		os.Remove(vm.VsockPath)
+		vsock := map[string]interface{}{
+			"guest_cid": vm.GuestCID,
+			"uds_path":  vsockPath,
+		}
+		if err := a.putJSON(client, "http://localhost/vsock", vsock); err != nil {
+			return fmt.Errorf("failed to set vsock device: %w", err)
+		}
+	}
+
+	// Metrics are optional; the microVM boots without them
+	if err := a.setupMetricsFIFO(client, vm); err != nil {
+		logrus.Warnf("Firecracker metrics unavailable for %s: %v", vm.Name, err)
+	}
+
+	// Start the instance, unless the create was cancelled meanwhile
+	op.step("Booting microVM")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	action := map[string]interface{}{
 		"action_type": "InstanceStart",
 	}
@@ -889,11 +1403,16 @@ func (a *Agent) stopFirecrackerForVM(vm *MicroVM) error {
 	}
 
 	vm.started = false
+	vm.paused = false
 	vm.fcProcess = nil
 	vm.proxy = nil
+	vm.closeMetricsFIFO()
 
-	// Clean up socket
+	// Clean up sockets
 	os.Remove(vm.SocketPath)
+	if vm.VsockPath != "" {
+		os.Remove(vm.VsockPath)
+	}
 
 	return nil
 }
@@ -919,6 +1438,10 @@ func (a *Agent) stopAllMicroVMs() {
 
 	for _, vm := range a.microVMs {
 		a.stopFirecrackerForVM(vm)
+		vm.removeLog()
+		a.cgroups.Remove(vm.ID)
+		a.networks.detach(vm.Network, vm.ID)
+		a.jailer.cleanup(vm)
 	}
 
 	if a.legacyVM != nil {
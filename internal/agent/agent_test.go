@@ -0,0 +1,322 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anthropics/fc-macos/internal/fctest"
+	"github.com/anthropics/fc-macos/pkg/firecracker"
+)
+
+// newTestAgent serves an agent that runs the fake firecracker, with room for
+// a few microVMs and no cgroups.
+func newTestAgent(t *testing.T) (*Agent, *httptest.Server) {
+	t.Helper()
+	a := New(&Config{
+		FirecrackerBin: fctest.Build(t),
+		ProcRoot:       fakeProc(t, 4, 8192, 8192),
+		CgroupRoot:     t.TempDir(),
+		AuditLog:       "off",
+	})
+	srv := httptest.NewServer(a.Handler())
+	t.Cleanup(func() {
+		srv.Close()
+		a.stopAllMicroVMs()
+	})
+	return a, srv
+}
+
+// guestImages returns an empty kernel and rootfs.
+func guestImages(t *testing.T) (kernel, rootfs string) {
+	t.Helper()
+	dir := t.TempDir()
+	kernel = filepath.Join(dir, "vmlinux")
+	rootfs = filepath.Join(dir, "rootfs.ext4")
+	require.NoError(t, os.WriteFile(kernel, nil, 0600))
+	require.NoError(t, os.WriteFile(rootfs, nil, 0600))
+	return kernel, rootfs
+}
+
+func postJSON(t *testing.T, url string, body interface{}) *http.Response {
+	t.Helper()
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	resp, err := http.Post(url, "application/json", strings.NewReader(string(data)))
+	require.NoError(t, err)
+	return resp
+}
+
+// waitOperation decodes the operation a 202 response started and polls it
+// until it finishes.
+func waitOperation(t *testing.T, srvURL string, resp *http.Response) Operation {
+	t.Helper()
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var op Operation
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&op))
+	assert.Equal(t, "/v1/agent/operations/"+op.ID, resp.Header.Get("Location"))
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(srvURL + "/agent/operations/" + op.ID)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		// A fresh value each time: omitted fields must not keep old values
+		op = Operation{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&op))
+		return op.Done()
+	}, 10*time.Second, 10*time.Millisecond)
+	return op
+}
+
+func TestMicroVMLifecycle(t *testing.T) {
+	a, srv := newTestAgent(t)
+	kernel, rootfs := guestImages(t)
+
+	resp := postJSON(t, srv.URL+"/agent/microvms", CreateMicroVMRequest{
+		Name:      "web",
+		Kernel:    kernel,
+		Rootfs:    rootfs,
+		VCPUs:     2,
+		MemoryMiB: 256,
+	})
+	op := waitOperation(t, srv.URL, resp)
+	require.Equal(t, OperationSucceeded, op.Status, op.Error)
+	var steps []string
+	for _, step := range op.Steps {
+		steps = append(steps, step.Name)
+		assert.Equal(t, OperationSucceeded, step.Status, step.Name)
+	}
+	assert.Equal(t, []string{"Starting Firecracker", "Configuring microVM", "Booting microVM"}, steps)
+	info := op.Result
+	require.NotNil(t, info)
+	assert.Equal(t, "web", info.Name)
+	assert.True(t, info.Running)
+	assert.NotZero(t, info.PID)
+	socket := a.getVMByIDOrName("web").SocketPath
+
+	t.Run("console", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		io.WriteString(conn, "GET /agent/microvms/web/console HTTP/1.1\r\nHost: agent\r\n\r\n")
+		r := bufio.NewReader(conn)
+		status, err := r.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+
+		io.WriteString(conn, "hello from the host\n")
+		var out strings.Builder
+		for !strings.Contains(out.String(), "hello from the host\r\n") {
+			line, err := r.ReadString('\n')
+			out.WriteString(line)
+			require.NoError(t, err, "console output so far: %q", out.String())
+		}
+		assert.Contains(t, out.String(), "Linux version")
+	})
+
+	t.Run("proxy", func(t *testing.T) {
+		ctx := context.Background()
+		c := firecracker.NewAt(srv.Client(), srv.URL+"/agent/microvms/web")
+
+		cfg, err := c.GetMachineConfig(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, cfg.VCPUCount)
+		assert.Equal(t, 256, cfg.MemSizeMib)
+
+		// Firecracker's own validation comes back through the proxy
+		err = c.SetMachineConfig(ctx, cfg)
+		require.Error(t, err)
+		assert.Equal(t, "API error (400): The requested operation is not supported after starting the microVM.", err.Error())
+
+		require.NoError(t, c.PauseInstance(ctx))
+		require.NoError(t, c.ResumeInstance(ctx))
+	})
+
+	t.Run("firecracker-logs", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/agent/microvms/web/firecracker-logs")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(body), "Successfully started microvm")
+	})
+
+	req, err := http.NewRequest(http.MethodDelete, srv.URL+"/agent/microvms/web", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	op = waitOperation(t, srv.URL, resp)
+	assert.Equal(t, OperationSucceeded, op.Status, op.Error)
+	assert.Equal(t, "delete", op.Type)
+
+	resp, err = http.Get(srv.URL + "/agent/microvms/web")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Firecracker removes its socket when it exits
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(socket)
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCreateMicroVMFirecrackerError(t *testing.T) {
+	a, srv := newTestAgent(t)
+	_, rootfs := guestImages(t)
+
+	resp := postJSON(t, srv.URL+"/agent/microvms", CreateMicroVMRequest{
+		Name:   "broken",
+		Kernel: "/nonexistent/vmlinux",
+		Rootfs: rootfs,
+	})
+	op := waitOperation(t, srv.URL, resp)
+
+	assert.Equal(t, OperationFailed, op.Status)
+	assert.Contains(t, op.Error, "failed to set boot source")
+	assert.Contains(t, op.Error, "Unable to open the kernel file /nonexistent/vmlinux")
+	assert.Equal(t, OperationFailed, op.Steps[len(op.Steps)-1].Status)
+	assert.Nil(t, a.getVMByIDOrName("broken"))
+}
+
+// createConcurrently sends n copies of a create at once, with the given
+// Idempotency-Key if it is set, and returns the responses.
+func createConcurrently(t *testing.T, srvURL string, n int, req CreateMicroVMRequest, key string) []*http.Response {
+	t.Helper()
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+
+	resps := make([]*http.Response, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			httpReq, _ := http.NewRequest("POST", srvURL+"/agent/microvms", bytes.NewReader(body))
+			if key != "" {
+				httpReq.Header.Set("Idempotency-Key", key)
+			}
+			resps[i], errs[i] = http.DefaultClient.Do(httpReq)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	return resps
+}
+
+func TestCreateMicroVMConcurrentNames(t *testing.T) {
+	a, srv := newTestAgent(t)
+	kernel, rootfs := guestImages(t)
+
+	resps := createConcurrently(t, srv.URL, 8, CreateMicroVMRequest{Name: "web", Kernel: kernel, Rootfs: rootfs}, "")
+
+	var accepted *http.Response
+	for _, resp := range resps {
+		if resp.StatusCode == http.StatusAccepted {
+			require.Nil(t, accepted, "two creates of the same name were accepted")
+			accepted = resp
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Contains(t, string(body), "microVM with name 'web' already exists")
+	}
+	require.NotNil(t, accepted)
+	op := waitOperation(t, srv.URL, accepted)
+	require.Equal(t, OperationSucceeded, op.Status, op.Error)
+
+	a.vmMu.RLock()
+	assert.Len(t, a.microVMs, 1)
+	assert.Empty(t, a.pendingNames)
+	a.vmMu.RUnlock()
+
+	// The name stays taken by the running microVM
+	resp := postJSON(t, srv.URL+"/agent/microvms", CreateMicroVMRequest{Name: "web", Kernel: kernel, Rootfs: rootfs})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestCreateMicroVMConcurrentLimit(t *testing.T) {
+	a, srv := newTestAgent(t)
+	a.config.MaxMicroVMs = 3
+	kernel, rootfs := guestImages(t)
+
+	resps := createConcurrently(t, srv.URL, 6, CreateMicroVMRequest{Kernel: kernel, Rootfs: rootfs, Vsock: true}, "")
+
+	names := make(map[string]bool)
+	cids := make(map[uint32]bool)
+	for _, resp := range resps {
+		if resp.StatusCode != http.StatusAccepted {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+			continue
+		}
+		op := waitOperation(t, srv.URL, resp)
+		require.Equal(t, OperationSucceeded, op.Status, op.Error)
+		names[op.MicroVM] = true
+		cids[a.getVMByIDOrName(op.MicroVMID).GuestCID] = true
+	}
+	assert.Len(t, names, 3, "auto-generated names must be unique")
+	assert.Len(t, cids, 3, "guest CIDs must be unique")
+}
+
+func TestCreateMicroVMIdempotencyKey(t *testing.T) {
+	a, srv := newTestAgent(t)
+	kernel, rootfs := guestImages(t)
+	req := CreateMicroVMRequest{Kernel: kernel, Rootfs: rootfs}
+
+	// Retries, even concurrent ones, get the original operation
+	resps := createConcurrently(t, srv.URL, 4, req, "retry-1")
+	var ops []Operation
+	for _, resp := range resps {
+		ops = append(ops, waitOperation(t, srv.URL, resp))
+	}
+	for _, op := range ops {
+		assert.Equal(t, ops[0].ID, op.ID)
+		assert.Equal(t, OperationSucceeded, op.Status, op.Error)
+		require.NotNil(t, op.Result)
+		assert.Equal(t, ops[0].Result.ID, op.Result.ID)
+	}
+	a.vmMu.RLock()
+	assert.Len(t, a.microVMs, 1)
+	a.vmMu.RUnlock()
+
+	// A retry after the microVM is up gets it too
+	resp := createConcurrently(t, srv.URL, 1, req, "retry-1")[0]
+	op := waitOperation(t, srv.URL, resp)
+	assert.Equal(t, ops[0].ID, op.ID)
+
+	// Reusing the key for something else is refused
+	other := req
+	other.MemoryMiB = 256
+	resp = createConcurrently(t, srv.URL, 1, other, "retry-1")[0]
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	// Another key is another microVM
+	resp = createConcurrently(t, srv.URL, 1, req, "retry-2")[0]
+	op = waitOperation(t, srv.URL, resp)
+	assert.NotEqual(t, ops[0].ID, op.ID)
+	assert.NotEqual(t, ops[0].Result.ID, op.Result.ID)
+}
@@ -0,0 +1,418 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxAuditBody bounds how much of a request body is buffered for hashing.
+// Larger bodies are rejected rather than passed through unaudited.
+const maxAuditBody = 16 << 20
+
+// AuditEntry is one line of the audit log.
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Remote     string    `json:"remote"`
+	Token      string    `json:"token,omitempty"` // Token name; empty when auth is off or the token was invalid
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	MicroVM    string    `json:"microvm,omitempty"`
+	BodySHA256 string    `json:"body_sha256,omitempty"`
+	Status     int       `json:"status"`
+	Denied     string    `json:"denied,omitempty"`    // Why the request was refused
+	Operation  string    `json:"operation,omitempty"` // The background operation a 202 started
+	Outcome    string    `json:"outcome,omitempty"`   // Its final status, on the entry written when it finishes
+}
+
+// AuditQuery filters audit entries. Zero fields match everything.
+type AuditQuery struct {
+	Since   time.Time
+	Token   string
+	MicroVM string
+	Limit   int // Most recent entries to return (default: 100)
+}
+
+func (q *AuditQuery) matches(e *AuditEntry) bool {
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if q.Token != "" && e.Token != q.Token {
+		return false
+	}
+	if q.MicroVM != "" && e.MicroVM != q.MicroVM {
+		return false
+	}
+	return true
+}
+
+// auditLog appends entries to a JSON-lines file, rotating it by size as
+// <path>.1 ... <path>.<maxFiles>.
+type auditLog struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func newAuditLog(path string, maxBytes int64, maxFiles int) *auditLog {
+	return &auditLog{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+}
+
+func (l *auditLog) write(e *AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		if err := l.openLocked(); err != nil {
+			return err
+		}
+	}
+	if l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+func (l *auditLog) openLocked() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+	l.size = info.Size()
+	return nil
+}
+
+func (l *auditLog) rotateLocked() error {
+	l.f.Close()
+	l.f = nil
+
+	os.Remove(l.rotatedPath(l.maxFiles))
+	for i := l.maxFiles - 1; i >= 1; i-- {
+		os.Rename(l.rotatedPath(i), l.rotatedPath(i+1))
+	}
+	if err := os.Rename(l.path, l.rotatedPath(1)); err != nil {
+		logrus.Warnf("Failed to rotate audit log: %v", err)
+	}
+	return l.openLocked()
+}
+
+func (l *auditLog) rotatedPath(n int) string {
+	return l.path + "." + strconv.Itoa(n)
+}
+
+// query returns the most recent entries matching q, oldest first.
+func (l *auditLog) query(q *AuditQuery) ([]AuditEntry, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []AuditEntry
+	// Oldest rotated file first so results come out in order
+	for i := l.maxFiles; i >= 0; i-- {
+		path := l.path
+		if i > 0 {
+			path = l.rotatedPath(i)
+		}
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			var e AuditEntry
+			if json.Unmarshal(scanner.Bytes(), &e) != nil || !q.matches(&e) {
+				continue
+			}
+			entries = append(entries, e)
+			if len(entries) > limit {
+				entries = entries[1:]
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func (l *auditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+type auditKey struct{}
+
+// auditEntryFrom returns the entry being built for the request, if any.
+func auditEntryFrom(ctx context.Context) *AuditEntry {
+	e, _ := ctx.Value(auditKey{}).(*AuditEntry)
+	return e
+}
+
+// withAudit records every non-GET request, and every denied request, to the
+// audit log once it has been handled. Requests that start an operation get
+// a second entry with its outcome when it finishes. The body is hashed by
+// withAuditBody, once the caller has authenticated.
+func (a *Agent) withAudit(next http.Handler) http.Handler {
+	if a.audit == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := &AuditEntry{
+			Time:    time.Now().UTC(),
+			Remote:  r.RemoteAddr,
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			MicroVM: targetRef(r),
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), auditKey{}, entry)))
+
+		if r.Method == http.MethodGet && entry.Denied == "" {
+			return
+		}
+		entry.Status = rec.status()
+		var op *operation
+		if entry.Status == http.StatusAccepted {
+			if op = a.operations.get(path.Base(rec.Header().Get("Location"))); op != nil {
+				entry.Operation = op.op.ID
+			}
+		}
+		a.writeAudit(entry)
+		if op != nil {
+			go a.auditOutcome(*entry, op)
+		}
+	})
+}
+
+// withAuditBody hashes the body of each non-GET request for its audit entry
+// and resolves the microVM it names to an ID. It sits behind withAuth so
+// that callers without a valid token cannot make the agent buffer bodies.
+func (a *Agent) withAuditBody(next http.Handler) http.Handler {
+	if a.audit == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := auditEntryFrom(r.Context())
+		if entry == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ref := targetRef(r); ref != "" {
+			if vm, _ := a.requestVM(r, ref); vm != nil {
+				entry.MicroVM = vm.ID
+			}
+		}
+
+		if r.Method != http.MethodGet && r.Body != nil {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBody+1))
+			r.Body.Close()
+			if err != nil || len(body) > maxAuditBody {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if len(body) > 0 {
+				sum := sha256.Sum256(body)
+				entry.BodySHA256 = hex.EncodeToString(sum[:])
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if entry.MicroVM == "" && (r.URL.Path == "/agent/microvms" || r.URL.Path == "/agent/microvms:batch") {
+				var req struct {
+					Name string `json:"name"`
+				}
+				json.Unmarshal(body, &req)
+				entry.MicroVM = req.Name
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// auditOutcome writes entry again with op's final status once op finishes.
+func (a *Agent) auditOutcome(entry AuditEntry, op *operation) {
+	<-op.done
+	op.mu.Lock()
+	entry.Outcome = op.op.Status
+	if op.op.MicroVMID != "" {
+		entry.MicroVM = op.op.MicroVMID
+	}
+	op.mu.Unlock()
+	entry.Time = time.Now().UTC()
+	a.writeAudit(&entry)
+}
+
+func (a *Agent) writeAudit(entry *AuditEntry) {
+	if err := a.audit.write(entry); err != nil {
+		logrus.Errorf("Failed to write audit log: %v", err)
+	}
+}
+
+// statusRecorder captures the response status while still letting handlers
+// hijack the connection for consoles.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) status() int {
+	if s.code == 0 {
+		// Hijacked connections report 200 themselves
+		return http.StatusOK
+	}
+	return s.code
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking not supported")
+	}
+	return hj.Hijack()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// handleAudit serves GET /agent/audit?since=&token=&microvm=&limit=.
+func (a *Agent) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.audit == nil {
+		http.Error(w, "audit log is disabled", http.StatusNotFound)
+		return
+	}
+
+	params := r.URL.Query()
+	q := &AuditQuery{
+		Token:   params.Get("token"),
+		MicroVM: params.Get("microvm"),
+	}
+	if since := params.Get("since"); since != "" {
+		t, err := parseSince(since, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.Since = t
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", limit), http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+	if q.MicroVM != "" {
+		if vm := a.getVMByIDOrName(q.MicroVM); vm != nil {
+			q.MicroVM = vm.ID
+		}
+	}
+
+	entries, err := a.audit.query(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// parseSince accepts an RFC 3339 timestamp or a duration before now.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q: want a duration or RFC 3339 time", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogRotationAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := newAuditLog(path, 300, 2)
+	defer l.Close()
+
+	start := time.Now().UTC()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.write(&AuditEntry{
+			Time:    start.Add(time.Duration(i) * time.Second),
+			Token:   []string{"ci", "dev"}[i%2],
+			Method:  "DELETE",
+			Path:    "/agent/microvms/vm-1",
+			MicroVM: "vm-1",
+			Status:  200,
+		}))
+	}
+
+	assert.FileExists(t, path+".1")
+	assert.FileExists(t, path+".2")
+	assert.NoFileExists(t, path+".3", "only maxFiles rotations are kept")
+
+	all, err := l.query(&AuditQuery{Limit: 1000})
+	require.NoError(t, err)
+	require.NotEmpty(t, all)
+	assert.Less(t, len(all), 10, "oldest entries rotated away")
+	for i := 1; i < len(all); i++ {
+		assert.True(t, all[i-1].Time.Before(all[i].Time), "entries are oldest first")
+	}
+	assert.Equal(t, start.Add(9*time.Second), all[len(all)-1].Time)
+
+	ci, err := l.query(&AuditQuery{Token: "ci", Limit: 1000})
+	require.NoError(t, err)
+	for _, e := range ci {
+		assert.Equal(t, "ci", e.Token)
+	}
+
+	last, err := l.query(&AuditQuery{Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, last, 2)
+
+	recent, err := l.query(&AuditQuery{Since: start.Add(8 * time.Second)})
+	require.NoError(t, err)
+	assert.Len(t, recent, 2)
+}
+
+func auditTestAgent(t *testing.T) (*Agent, http.Handler) {
+	dir := t.TempDir()
+	a := New(&Config{
+		AuthToken: "admin-secret",
+		TokenFile: filepath.Join(dir, "tokens.json"),
+		AuditLog:  filepath.Join(dir, "audit.jsonl"),
+	})
+	t.Cleanup(func() { a.audit.Close() })
+	a.microVMs["vm-1"] = &MicroVM{ID: "vm-1", Name: "worker", Labels: map[string]string{"team": "ci"}}
+
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return a, a.withAudit(a.withAuth(a.withAuditBody(inner)))
+}
+
+func TestWithAuditRecordsMutations(t *testing.T) {
+	a, h := auditTestAgent(t)
+
+	body := `{"ttl":"1h"}`
+	req := httptest.NewRequest("POST", "/agent/microvms/worker/extend", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	req.RemoteAddr = "192.168.64.1:50000"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Reads are not audited
+	req = httptest.NewRequest("GET", "/agent/microvms", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries, err := a.audit.query(&AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	sum := sha256.Sum256([]byte(body))
+	e := entries[0]
+	assert.Equal(t, "admin", e.Token)
+	assert.Equal(t, "192.168.64.1:50000", e.Remote)
+	assert.Equal(t, "POST", e.Method)
+	assert.Equal(t, "/agent/microvms/worker/extend", e.Path)
+	assert.Equal(t, "vm-1", e.MicroVM)
+	assert.Equal(t, hex.EncodeToString(sum[:]), e.BodySHA256)
+	assert.Equal(t, http.StatusAccepted, e.Status)
+	assert.Empty(t, e.Denied)
+}
+
+func TestWithAuditRecordsDenials(t *testing.T) {
+	a, h := auditTestAgent(t)
+	viewer, err := a.tokens.create(&CreateTokenRequest{Name: "viewer", Scopes: []string{ScopeRead}})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/agent/microvms", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("DELETE", "/agent/microvms/vm-1", nil)
+	req.Header.Set("Authorization", "Bearer "+viewer.Token)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries, err := a.audit.query(&AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, http.StatusUnauthorized, entries[0].Status)
+	assert.Empty(t, entries[0].Token)
+	assert.NotEmpty(t, entries[0].Denied)
+
+	assert.Equal(t, http.StatusForbidden, entries[1].Status)
+	assert.Equal(t, "viewer", entries[1].Token)
+	assert.Contains(t, entries[1].Denied, "write")
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestWithAuditReadsBodiesAfterAuth(t *testing.T) {
+	a, h := auditTestAgent(t)
+
+	body := &countingReader{r: strings.NewReader(strings.Repeat("x", maxAuditBody+1))}
+	req := httptest.NewRequest("POST", "/agent/microvms", body)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Zero(t, body.n, "the body of an unauthenticated request was read")
+
+	entries, err := a.audit.query(&AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Empty(t, entries[0].BodySHA256)
+}
+
+func TestWithAuditRecordsOperationOutcome(t *testing.T) {
+	a, _ := auditTestAgent(t)
+	release := make(chan struct{})
+	h := a.withAudit(a.withAuth(a.withAuditBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := a.operations.start("create", &MicroVM{ID: "vm-2", Name: "web"}, false, func(ctx context.Context) (*MicroVMInfo, error) {
+			<-release
+			return nil, nil
+		})
+		acceptOperation(w, op)
+	}))))
+
+	req := httptest.NewRequest("POST", "/agent/microvms", strings.NewReader(`{"name":"web"}`))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries, err := a.audit.query(&AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, http.StatusAccepted, entries[0].Status)
+	assert.Equal(t, "web", entries[0].MicroVM)
+	require.NotEmpty(t, entries[0].Operation)
+	assert.Empty(t, entries[0].Outcome)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		entries, err = a.audit.query(&AuditQuery{})
+		return err == nil && len(entries) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, entries[0].Operation, entries[1].Operation)
+	assert.Equal(t, OperationSucceeded, entries[1].Outcome)
+	assert.Equal(t, "vm-2", entries[1].MicroVM)
+	assert.Equal(t, "admin", entries[1].Token)
+}
+
+func TestHandleAudit(t *testing.T) {
+	a, h := auditTestAgent(t)
+	for _, path := range []string{"/agent/microvms/vm-1", "/agent/microvms/other"} {
+		req := httptest.NewRequest("DELETE", path, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	a.handleAudit(rec, httptest.NewRequest("GET", "/agent/audit?microvm=worker&since=1h", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var entries []AuditEntry
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "vm-1", entries[0].MicroVM)
+
+	rec = httptest.NewRecorder()
+	a.handleAudit(rec, httptest.NewRequest("GET", "/agent/audit?since=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAuditLogFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := newAuditLog(path, 1<<20, 1)
+	defer l.Close()
+	require.NoError(t, l.write(&AuditEntry{Time: time.Now(), Method: "POST"}))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// unauthenticatedPaths can be reached without a token so that liveness
+// checks keep working and clients can be generated from the API document.
+var unauthenticatedPaths = map[string]bool{
+	"/health":       true,
+	"/openapi.json": true,
+}
+
+// LoadToken reads a bearer token from path, ignoring surrounding whitespace.
+func LoadToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	h := r.Header.Get("Authorization")
+	if len(h) < len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(h[len(prefix):])
+}
+
+type identityKey struct{}
+
+// identityFrom returns the caller a request was authenticated as, or nil when
+// authentication is disabled.
+func identityFrom(ctx context.Context) *identity {
+	id, _ := ctx.Value(identityKey{}).(*identity)
+	return id
+}
+
+// authenticate maps a bearer token to an identity: the -token-file token is
+// the admin, anything else must be a named token.
+func (a *Agent) authenticate(token string) *identity {
+	if token == "" {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.config.AuthToken)) == 1 {
+		return adminIdentity()
+	}
+	if t := a.tokens.lookup(token); t != nil {
+		return t.identity()
+	}
+	return nil
+}
+
+// requiredScope returns the scope needed to serve r.
+func requiredScope(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/agent/tokens"), path == "/agent/audit":
+		return ScopeAdmin
+	case path == "/agent/microvms":
+		if r.Method == http.MethodGet {
+			return ScopeRead
+		}
+		return ScopeWrite
+	case path == "/agent/microvms:batch":
+		return ScopeWrite
+	case strings.HasPrefix(path, "/agent/microvms/"):
+		parts := strings.SplitN(strings.TrimPrefix(path, "/agent/microvms/"), "/", 2)
+		if len(parts) == 1 {
+			if r.Method == http.MethodGet {
+				return ScopeRead
+			}
+			return ScopeWrite
+		}
+		switch parts[1] {
+		case "console", "exec":
+			return ScopeConsole
+		case "extend", "clone", "pause", "resume", "swap-drive":
+			return ScopeWrite
+		case "firecracker-logs", "stats":
+			return ScopeRead
+		}
+		return ScopeProxy
+	case path == "/agent/capacity", path == "/agent/status", path == "/agent/stats":
+		return ScopeRead
+	case strings.HasPrefix(path, "/agent/operations"):
+		if r.Method == http.MethodGet {
+			return ScopeRead
+		}
+		return ScopeWrite
+	case path == "/agent/metrics", path == "/version":
+		return ScopeRead
+	case path == "/agent/start", path == "/agent/stop":
+		return ScopeWrite
+	case path == "/console":
+		return ScopeConsole
+	}
+	return ScopeProxy
+}
+
+// targetVM returns the microVM a request names and the ID or name it was
+// named by. ref is empty when the request does not name one (list, create and
+// legacy endpoints); vm is nil when no such microVM exists. An ID prefix
+// that matches several microVMs is an error.
+func (a *Agent) targetVM(r *http.Request) (vm *MicroVM, ref string, err error) {
+	if ref = targetRef(r); ref == "" {
+		return nil, "", nil
+	}
+	vm, err = a.lookupVM(ref)
+	return vm, ref, err
+}
+
+// targetRef returns the ID or name of the microVM a request names, without
+// looking it up.
+func targetRef(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/agent/microvms/"):
+		return strings.SplitN(strings.TrimPrefix(r.URL.Path, "/agent/microvms/"), "/", 2)[0]
+	case strings.HasPrefix(r.URL.Path, "/microvms/"):
+		return strings.SplitN(strings.TrimPrefix(r.URL.Path, "/microvms/"), "/", 2)[0]
+	}
+	return r.Header.Get("X-MicroVM-ID")
+}
+
+type targetKey struct{}
+
+// target is the microVM withAuth resolved a request's reference to.
+type target struct {
+	vm  *MicroVM
+	ref string
+}
+
+// requestVM returns the microVM ref names. Within a request withAuth has
+// authorized, that is the microVM it checked, so the handler cannot act on
+// a different one than the token was allowed.
+func (a *Agent) requestVM(r *http.Request, ref string) (*MicroVM, error) {
+	if t, ok := r.Context().Value(targetKey{}).(*target); ok && t.ref == ref {
+		return t.vm, nil
+	}
+	return a.lookupVM(ref)
+}
+
+// authorize checks id may serve r, which names the microVM vm by ref,
+// returning the reason if not.
+func (a *Agent) authorize(id *identity, r *http.Request, vm *MicroVM, ref string) (ok bool, reason string) {
+	scope := requiredScope(r)
+	if !id.can(scope) {
+		return false, fmt.Sprintf("token lacks %q scope", scope)
+	}
+	if !id.restricted() {
+		return true, ""
+	}
+
+	// Label-restricted tokens only reach microVMs their selector matches.
+	// List, create, batch create, stats and operations apply the selector
+	// themselves.
+	switch {
+	case r.URL.Path == "/agent/microvms", r.URL.Path == "/agent/microvms:batch",
+		r.URL.Path == "/agent/capacity", r.URL.Path == "/agent/stats",
+		r.URL.Path == "/agent/operations", strings.HasPrefix(r.URL.Path, "/agent/operations/"):
+		return true, ""
+	}
+	if ref == "" {
+		return false, "token is restricted to microVMs matching " + id.selector.String()
+	}
+	// Unknown microVMs fall through to a 404 from the handler
+	if vm != nil && !id.allows(vm.Labels) {
+		return false, fmt.Sprintf("microVM %s does not match %s", vm.Name, id.selector.String())
+	}
+	return true, ""
+}
+
+// withAuth authenticates requests and enforces token scopes. With no admin
+// token configured every request is let through.
+func (a *Agent) withAuth(next http.Handler) http.Handler {
+	if a.config.AuthToken == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unauthenticatedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id := a.authenticate(bearerToken(r))
+		if entry := auditEntryFrom(r.Context()); entry != nil && id != nil {
+			entry.Token = id.Name
+		}
+		if id == nil {
+			a.auditDenied(r, "", "missing or invalid token")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fc-agent"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// The microVM is resolved once, so the one authorized is the one
+		// the handler acts on
+		vm, ref, err := a.targetVM(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if entry := auditEntryFrom(r.Context()); entry != nil && vm != nil {
+			entry.MicroVM = vm.ID
+		}
+
+		if ok, reason := a.authorize(id, r, vm, ref); !ok {
+			a.auditDenied(r, id.Name, reason)
+			http.Error(w, "Forbidden: "+reason, http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), identityKey{}, id)
+		ctx = context.WithValue(ctx, targetKey{}, &target{vm: vm, ref: ref})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// auditDenied records a rejected request. The audit middleware writes it to
+// the audit log once the response has been sent.
+func (a *Agent) auditDenied(r *http.Request, token, reason string) {
+	if entry := auditEntryFrom(r.Context()); entry != nil {
+		entry.Denied = reason
+	}
+	logrus.WithFields(logrus.Fields{
+		"audit":  "denied",
+		"token":  token,
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"remote": r.RemoteAddr,
+	}).Warnf("Denied request: %s", reason)
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func authTestHandler(token string) http.Handler {
+	a := New(&Config{AuthToken: token})
+	return a.withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestWithAuth(t *testing.T) {
+	h := authTestHandler("s3cret")
+
+	tests := []struct {
+		path   string
+		header string
+		want   int
+	}{
+		{"/health", "", http.StatusOK},
+		{"/agent/microvms", "", http.StatusUnauthorized},
+		{"/agent/microvms", "Bearer wrong", http.StatusUnauthorized},
+		{"/agent/microvms", "Basic s3cret", http.StatusUnauthorized},
+		{"/agent/microvms", "Bearer s3cret", http.StatusOK},
+		{"/agent/microvms", "bearer s3cret", http.StatusOK},
+		{"/machine-config", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, tt.want, rec.Code, "%s with %q", tt.path, tt.header)
+		if rec.Code == http.StatusUnauthorized {
+			assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Bearer")
+		}
+	}
+}
+
+func TestWithAuthDisabled(t *testing.T) {
+	h := authTestHandler("")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("DELETE", "/agent/microvms/vm-1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestLoadToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("  abc123\n"), 0600))
+
+	token, err := LoadToken(path)
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", token)
+
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0600))
+	_, err = LoadToken(path)
+	assert.Error(t, err)
+}
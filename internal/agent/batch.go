@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/sirupsen/logrus"
+)
+
+// BatchCreateRequest creates several microVMs from one template.
+type BatchCreateRequest = agentclient.BatchCreateRequest
+
+// defaultBatchParallelism is how many microVMs of a batch boot at once
+// unless the request says otherwise.
+const defaultBatchParallelism = 4
+
+// batchName returns the name of the nth microVM of a batch.
+func batchName(pattern string, n int) string {
+	return strings.ReplaceAll(pattern, "{n}", strconv.Itoa(n))
+}
+
+// handleBatchCreate serves POST /agent/microvms:batch.
+func (a *Agent) handleBatchCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BatchCreateRequest
+	if !decodeRequest(w, r, "BatchCreateRequest", &req) {
+		return
+	}
+	if req.Template.Name != "" {
+		writeFieldErrors(w, FieldError{Field: "template.name", Message: "must be empty; name is the pattern for the batch"})
+		return
+	}
+	if req.Count > a.config.MaxMicroVMs {
+		writeFieldErrors(w, FieldError{Field: "count", Message: fmt.Sprintf("must be at most %d, the microVM limit", a.config.MaxMicroVMs)})
+		return
+	}
+	if !a.checkCreate(w, r, &req.Template, "template.") {
+		return
+	}
+
+	parallelism := req.Parallelism
+	if parallelism == 0 {
+		parallelism = defaultBatchParallelism
+	}
+
+	op := a.operations.newOperation("batch", &MicroVM{Name: req.Name, Labels: req.Template.Labels})
+	op.op.Items = make([]BatchItem, req.Count)
+	for i := range op.op.Items {
+		op.op.Items[i] = BatchItem{Name: batchName(req.Name, i+1), Status: OperationPending}
+	}
+	a.operations.launch(op, true, func(ctx context.Context) (*MicroVMInfo, error) {
+		return nil, a.runBatch(ctx, &req, parallelism)
+	})
+	acceptOperation(w, op)
+}
+
+// runBatch creates the microVMs of a batch operation, parallelism at a
+// time, recording each in the operation's items. It fails if any of them
+// does. With req.Rollback, the first failure cancels the creates still
+// running and those that succeeded are stopped again.
+func (a *Agent) runBatch(ctx context.Context, req *BatchCreateRequest, parallelism int) error {
+	op := operationFrom(ctx)
+	batchCtx, cancelBatch := context.WithCancel(ctx)
+	defer cancelBatch()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created []int
+		failed  []string
+	)
+	slots := make(chan struct{}, parallelism)
+	for i := 0; i < req.Count; i++ {
+		name := batchName(req.Name, i+1)
+		select {
+		case slots <- struct{}{}:
+		case <-batchCtx.Done():
+		}
+		if err := batchCtx.Err(); err != nil {
+			op.setItem(i, BatchItem{Name: name, Status: OperationCancelled, Error: "cancelled"})
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			op.setItem(i, BatchItem{Name: name, Status: OperationRunning})
+			info, err := a.createBatchItem(batchCtx, &req.Template, name)
+			item := BatchItem{Name: name, Status: operationStatus(err), Result: info}
+			switch item.Status {
+			case OperationCancelled:
+				item.Error = "cancelled"
+			case OperationFailed:
+				item.Error = err.Error()
+			}
+			op.setItem(i, item)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch item.Status {
+			case OperationSucceeded:
+				created = append(created, i)
+			case OperationFailed:
+				failed = append(failed, name)
+				if req.Rollback {
+					cancelBatch()
+				}
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	var err error
+	switch {
+	case ctx.Err() != nil:
+		err = ctx.Err()
+	case len(failed) > 0:
+		err = fmt.Errorf("%d of %d microVMs failed to start (first: %s)", len(failed), req.Count, failed[0])
+	}
+	if err != nil && req.Rollback {
+		reason := "the batch was cancelled"
+		if len(failed) > 0 {
+			reason = failed[0] + " failed"
+		}
+		for _, i := range created {
+			a.rollBackBatchItem(op, i, reason)
+		}
+	}
+	return err
+}
+
+// createBatchItem creates and boots one microVM of a batch.
+func (a *Agent) createBatchItem(ctx context.Context, template *CreateMicroVMRequest, name string) (*MicroVMInfo, error) {
+	vm, release, _, err := a.newMicroVM(template, name)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return a.bootMicroVM(ctx, vm, template.Network, requestDuration(template.TTL))
+}
+
+// rollBackBatchItem stops the microVM of item i of a batch, and records
+// why.
+func (a *Agent) rollBackBatchItem(op *operation, i int, reason string) {
+	op.mu.Lock()
+	item := op.op.Items[i]
+	op.mu.Unlock()
+
+	if vm := a.getVMByIDOrName(item.Result.ID); vm != nil {
+		if err := a.removeMicroVM(vm, true); err != nil {
+			logrus.Warnf("Failed to roll back %s: %v", item.Name, err)
+		}
+	}
+	item.Status = OperationCancelled
+	item.Error = "rolled back because " + reason
+	item.Result = nil
+	op.setItem(i, item)
+}
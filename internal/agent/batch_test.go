@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchCreate(t *testing.T) {
+	a, srv := newTestAgent(t)
+	kernel, rootfs := guestImages(t)
+
+	resp := postJSON(t, srv.URL+"/agent/microvms:batch", BatchCreateRequest{
+		Name:        "worker-{n}",
+		Count:       3,
+		Parallelism: 2,
+		Template:    CreateMicroVMRequest{Kernel: kernel, Rootfs: rootfs, Labels: map[string]string{"team": "ci"}},
+	})
+	op := waitOperation(t, srv.URL, resp)
+
+	require.Equal(t, OperationSucceeded, op.Status, op.Error)
+	assert.Equal(t, "batch", op.Type)
+	assert.Equal(t, "worker-{n}", op.MicroVM)
+	require.Len(t, op.Items, 3)
+	for i, item := range op.Items {
+		name := batchName("worker-{n}", i+1)
+		assert.Equal(t, name, item.Name)
+		assert.Equal(t, OperationSucceeded, item.Status)
+		require.NotNil(t, item.Result)
+		assert.Equal(t, "ci", item.Result.Labels["team"])
+
+		vm := a.getVMByIDOrName(name)
+		require.NotNil(t, vm, name)
+		assert.Equal(t, item.Result.ID, vm.ID)
+	}
+}
+
+func TestBatchCreatePartialFailure(t *testing.T) {
+	a, srv := newTestAgent(t)
+	kernel, rootfs := guestImages(t)
+	template := CreateMicroVMRequest{Kernel: kernel, Rootfs: rootfs}
+
+	// The second microVM of each batch collides with an existing one
+	for _, name := range []string{"web-2", "db-2"} {
+		req := template
+		req.Name = name
+		op := waitOperation(t, srv.URL, postJSON(t, srv.URL+"/agent/microvms", req))
+		require.Equal(t, OperationSucceeded, op.Status, op.Error)
+	}
+
+	// Without rollback, the others are left running
+	op := waitOperation(t, srv.URL, postJSON(t, srv.URL+"/agent/microvms:batch", BatchCreateRequest{
+		Name: "web-{n}", Count: 3, Template: template,
+	}))
+	assert.Equal(t, OperationFailed, op.Status)
+	assert.Equal(t, "1 of 3 microVMs failed to start (first: web-2)", op.Error)
+	require.Len(t, op.Items, 3)
+	assert.Equal(t, OperationSucceeded, op.Items[0].Status)
+	assert.Equal(t, OperationFailed, op.Items[1].Status)
+	assert.Equal(t, "microVM with name 'web-2' already exists", op.Items[1].Error)
+	assert.Equal(t, OperationSucceeded, op.Items[2].Status)
+	assert.NotNil(t, a.getVMByIDOrName("web-1"))
+	assert.NotNil(t, a.getVMByIDOrName("web-3"))
+
+	// With rollback, the first failure undoes the batch
+	op = waitOperation(t, srv.URL, postJSON(t, srv.URL+"/agent/microvms:batch", BatchCreateRequest{
+		Name: "db-{n}", Count: 3, Parallelism: 1, Rollback: true, Template: template,
+	}))
+	assert.Equal(t, OperationFailed, op.Status)
+	require.Len(t, op.Items, 3)
+	assert.Equal(t, BatchItem{Name: "db-1", Status: OperationCancelled, Error: "rolled back because db-2 failed"}, op.Items[0])
+	assert.Equal(t, OperationFailed, op.Items[1].Status)
+	assert.Equal(t, BatchItem{Name: "db-3", Status: OperationCancelled, Error: "cancelled"}, op.Items[2])
+	assert.Nil(t, a.getVMByIDOrName("db-1"))
+	assert.Nil(t, a.getVMByIDOrName("db-3"))
+	assert.NotNil(t, a.getVMByIDOrName("db-2"), "the microVM the batch collided with is not touched")
+}
+
+func TestBatchCreateValidation(t *testing.T) {
+	a := New(&Config{ProcRoot: fakeProc(t, 4, 8192, 8192), AuditLog: "off"})
+
+	tests := []struct {
+		name string
+		body string
+		want []FieldError
+	}{
+		{"no pattern", `{"name":"worker","count":2,"template":{"kernel":"/k","rootfs":"/r"}}`, []FieldError{
+			{Field: "name", Message: `must match ^(?:[A-Za-z0-9][A-Za-z0-9._-]*)?\{n\}(?:[A-Za-z0-9._-]|\{n\})*$`},
+		}},
+		{"bad name", `{"name":"-worker {n}","count":2,"template":{"kernel":"/k","rootfs":"/r"}}`, []FieldError{
+			{Field: "name", Message: `must match ^(?:[A-Za-z0-9][A-Za-z0-9._-]*)?\{n\}(?:[A-Za-z0-9._-]|\{n\})*$`},
+		}},
+		{"no count", `{"name":"worker-{n}","count":0,"template":{"kernel":"/k","rootfs":"/r"}}`, []FieldError{
+			{Field: "count", Message: "must be at least 1"},
+		}},
+		{"template", `{"name":"worker-{n}","count":2,"template":{"rootfs":"/r"}}`, []FieldError{
+			{Field: "template.kernel", Message: "is required"},
+		}},
+		{"template name", `{"name":"worker-{n}","count":2,"template":{"name":"web","kernel":"/k","rootfs":"/r"}}`, []FieldError{
+			{Field: "template.name", Message: "must be empty; name is the pattern for the batch"},
+		}},
+		{"over the limit", `{"name":"worker-{n}","count":11,"template":{"kernel":"/k","rootfs":"/r"}}`, []FieldError{
+			{Field: "count", Message: "must be at most 10, the microVM limit"},
+		}},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/v1/agent/microvms:batch", strings.NewReader(tt.body)))
+		require.Equal(t, http.StatusBadRequest, rec.Code, tt.name)
+
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), tt.name)
+		assert.Equal(t, tt.want, resp.Fields, tt.name)
+	}
+}
@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+)
+
+// Capacity is the JSON response for GET /agent/capacity.
+type Capacity = agentclient.Capacity
+
+// hostResources is what the Linux VM has, read from /proc.
+type hostResources struct {
+	CPUs               int
+	MemoryMiB          int
+	AvailableMemoryMiB int
+}
+
+// capacityError is returned when a create would exceed capacity. Status is
+// 507 when the request can never fit on this host and 409 when it only
+// conflicts with microVMs that are already running.
+type capacityError struct {
+	Status int
+	Msg    string
+}
+
+func (e *capacityError) Error() string { return e.Msg }
+
+// readHostResources reads CPU count and memory from procRoot (normally /proc).
+func readHostResources(procRoot string) (hostResources, error) {
+	var res hostResources
+
+	stat, err := os.Open(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return res, fmt.Errorf("failed to read CPU count: %w", err)
+	}
+	defer stat.Close()
+
+	scanner := bufio.NewScanner(stat)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Per-CPU lines are "cpuN ..."; the aggregate line is "cpu  ..."
+		if len(line) > 3 && strings.HasPrefix(line, "cpu") && line[3] >= '0' && line[3] <= '9' {
+			res.CPUs++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return res, fmt.Errorf("failed to read CPU count: %w", err)
+	}
+
+	meminfo, err := os.Open(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return res, fmt.Errorf("failed to read memory info: %w", err)
+	}
+	defer meminfo.Close()
+
+	scanner = bufio.NewScanner(meminfo)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			res.MemoryMiB = kb / 1024
+		case "MemAvailable:":
+			res.AvailableMemoryMiB = kb / 1024
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return res, fmt.Errorf("failed to read memory info: %w", err)
+	}
+
+	if res.CPUs == 0 || res.MemoryMiB == 0 {
+		return res, fmt.Errorf("could not determine CPU count or memory from %s", procRoot)
+	}
+	return res, nil
+}
+
+// capacity computes the current capacity snapshot. Callers must hold capMu.
+func (a *Agent) capacity() (*Capacity, error) {
+	host, err := readHostResources(a.config.ProcRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Capacity{
+		HostCPUs:               host.CPUs,
+		HostMemoryMiB:          host.MemoryMiB,
+		HostAvailableMemoryMiB: host.AvailableMemoryMiB,
+		CPUOvercommitRatio:     a.config.CPUOvercommitRatio,
+		MemoryOvercommitRatio:  a.config.MemoryOvercommitRatio,
+		MemoryReserveMiB:       a.config.MemoryReserveMiB,
+		VCPULimit:              int(float64(host.CPUs) * a.config.CPUOvercommitRatio),
+		MemoryLimitMiB:         int(float64(host.MemoryMiB-a.config.MemoryReserveMiB) * a.config.MemoryOvercommitRatio),
+		ReservedVCPUs:          a.pendingVCPUs,
+		ReservedMemoryMiB:      a.pendingMemoryMiB,
+		MaxMicroVMs:            a.config.MaxMicroVMs,
+	}
+	if c.MemoryLimitMiB < 0 {
+		c.MemoryLimitMiB = 0
+	}
+
+	a.vmMu.RLock()
+	for _, vm := range a.microVMs {
+		if vm.Config != nil {
+			c.ReservedVCPUs += vm.Config.VCPUs
+			c.ReservedMemoryMiB += vm.Config.MemoryMiB
+		}
+	}
+	c.MicroVMs = len(a.microVMs)
+	a.vmMu.RUnlock()
+
+	return c, nil
+}
+
+// reserveCapacity admits a microVM of the given size or returns a
+// *capacityError explaining why it does not fit. On success the resources
+// are held as pending until release is called, which callers should do once
+// the microVM is registered (or creation has failed).
+func (a *Agent) reserveCapacity(vcpus, memoryMiB int) (release func(), err error) {
+	a.capMu.Lock()
+	defer a.capMu.Unlock()
+
+	c, err := a.capacity()
+	if err != nil {
+		return nil, err
+	}
+
+	if vcpus > c.VCPULimit {
+		return nil, &capacityError{http.StatusInsufficientStorage, fmt.Sprintf(
+			"requested %d vCPUs but this host allows at most %d (%d CPUs x %.1f overcommit)",
+			vcpus, c.VCPULimit, c.HostCPUs, c.CPUOvercommitRatio)}
+	}
+	if memoryMiB > c.MemoryLimitMiB {
+		return nil, &capacityError{http.StatusInsufficientStorage, fmt.Sprintf(
+			"requested %d MiB but this host allows at most %d MiB for microVMs",
+			memoryMiB, c.MemoryLimitMiB)}
+	}
+	if c.ReservedVCPUs+vcpus > c.VCPULimit {
+		return nil, &capacityError{http.StatusConflict, fmt.Sprintf(
+			"insufficient vCPU capacity: requested %d, %d of %d already reserved",
+			vcpus, c.ReservedVCPUs, c.VCPULimit)}
+	}
+	if c.ReservedMemoryMiB+memoryMiB > c.MemoryLimitMiB {
+		return nil, &capacityError{http.StatusConflict, fmt.Sprintf(
+			"insufficient memory capacity: requested %d MiB, %d of %d MiB already reserved",
+			memoryMiB, c.ReservedMemoryMiB, c.MemoryLimitMiB)}
+	}
+	// Without overcommit, also refuse when the kernel reports the memory
+	// is not actually there (e.g. page cache or other processes).
+	if a.config.MemoryOvercommitRatio <= 1 && memoryMiB > c.HostAvailableMemoryMiB-a.config.MemoryReserveMiB {
+		return nil, &capacityError{http.StatusConflict, fmt.Sprintf(
+			"insufficient free memory: requested %d MiB, %d MiB available after %d MiB reserve",
+			memoryMiB, c.HostAvailableMemoryMiB-a.config.MemoryReserveMiB, a.config.MemoryReserveMiB)}
+	}
+
+	a.pendingVCPUs += vcpus
+	a.pendingMemoryMiB += memoryMiB
+
+	released := false
+	return func() {
+		a.capMu.Lock()
+		defer a.capMu.Unlock()
+		if released {
+			return
+		}
+		released = true
+		a.pendingVCPUs -= vcpus
+		a.pendingMemoryMiB -= memoryMiB
+	}, nil
+}
+
+func (a *Agent) handleCapacity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	a.capMu.Lock()
+	c, err := a.capacity()
+	a.capMu.Unlock()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read capacity: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProc writes minimal stat and meminfo files for a host with the given
+// CPUs and memory, and returns the directory.
+func fakeProc(t *testing.T, cpus, totalMiB, availableMiB int) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	stat := "cpu  100 0 100 1000 0 0 0 0 0 0\n"
+	for i := 0; i < cpus; i++ {
+		stat += fmt.Sprintf("cpu%d 10 0 10 100 0 0 0 0 0 0\n", i)
+	}
+	stat += "intr 12345\nctxt 6789\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644))
+
+	meminfo := fmt.Sprintf("MemTotal:       %d kB\nMemFree:        1024 kB\nMemAvailable:   %d kB\n",
+		totalMiB*1024, availableMiB*1024)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "meminfo"), []byte(meminfo), 0644))
+
+	return dir
+}
+
+func TestReadHostResources(t *testing.T) {
+	res, err := readHostResources(fakeProc(t, 4, 4096, 3000))
+	require.NoError(t, err)
+	assert.Equal(t, 4, res.CPUs)
+	assert.Equal(t, 4096, res.MemoryMiB)
+	assert.Equal(t, 3000, res.AvailableMemoryMiB)
+
+	_, err = readHostResources(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestReserveCapacity(t *testing.T) {
+	a := New(&Config{
+		ProcRoot:           fakeProc(t, 2, 2048, 2048),
+		CPUOvercommitRatio: 2,
+		MemoryReserveMiB:   512,
+	})
+
+	// 4 vCPUs and 1536 MiB available in total
+	release, err := a.reserveCapacity(2, 1024)
+	require.NoError(t, err)
+
+	c, err := a.capacity()
+	require.NoError(t, err)
+	assert.Equal(t, 4, c.VCPULimit)
+	assert.Equal(t, 1536, c.MemoryLimitMiB)
+	assert.Equal(t, 2, c.ReservedVCPUs)
+	assert.Equal(t, 1024, c.ReservedMemoryMiB)
+
+	// Fits on the host, but not next to the pending reservation
+	_, err = a.reserveCapacity(1, 1024)
+	assertCapacityStatus(t, err, http.StatusConflict)
+
+	// Can never fit
+	_, err = a.reserveCapacity(8, 128)
+	assertCapacityStatus(t, err, http.StatusInsufficientStorage)
+	_, err = a.reserveCapacity(1, 4096)
+	assertCapacityStatus(t, err, http.StatusInsufficientStorage)
+
+	release()
+	release() // idempotent
+	_, err = a.reserveCapacity(1, 1024)
+	assert.NoError(t, err)
+}
+
+func TestReserveCapacityCountsRegisteredMicroVMs(t *testing.T) {
+	a := New(&Config{ProcRoot: fakeProc(t, 1, 1024, 1024), CPUOvercommitRatio: 1})
+	a.microVMs["vm-1"] = &MicroVM{ID: "vm-1", Config: &MicroVMConfig{VCPUs: 1, MemoryMiB: 128}}
+
+	_, err := a.reserveCapacity(1, 128)
+	assertCapacityStatus(t, err, http.StatusConflict)
+	assert.Contains(t, err.Error(), "vCPU")
+}
+
+func TestReserveCapacityChecksAvailableMemory(t *testing.T) {
+	// Plenty of total memory, but most of it is in use outside of microVMs
+	a := New(&Config{ProcRoot: fakeProc(t, 4, 8192, 512)})
+
+	_, err := a.reserveCapacity(1, 1024)
+	assertCapacityStatus(t, err, http.StatusConflict)
+	assert.Contains(t, err.Error(), "free memory")
+}
+
+func assertCapacityStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	var capErr *capacityError
+	require.True(t, errors.As(err, &capErr), "expected capacityError, got %v", err)
+	assert.Equal(t, status, capErr.Status)
+}
@@ -0,0 +1,275 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// cpuPeriodUsec is the cpu.max period; quotas are expressed against it.
+	cpuPeriodUsec = 100000
+
+	// vmmOverheadMiB is added to guest memory for Firecracker's own usage
+	// when deriving memory.max.
+	vmmOverheadMiB = 64
+)
+
+// ResourceLimits are the cgroup limits applied to a microVM's Firecracker
+// process.
+type ResourceLimits = agentclient.ResourceLimits
+
+// resolveLimits fills in the limits not set in overrides from cfg.
+func resolveLimits(cfg *MicroVMConfig, overrides *ResourceLimits) *ResourceLimits {
+	limits := &ResourceLimits{}
+	if overrides != nil {
+		*limits = *overrides
+	}
+	if limits.CPUPercent == 0 {
+		limits.CPUPercent = cfg.VCPUs * 100
+	}
+	if limits.MemoryMaxMiB == 0 {
+		limits.MemoryMaxMiB = cfg.MemoryMiB + vmmOverheadMiB
+	}
+	if hasIO(limits) && limits.IODevice == "" {
+		if dev, err := blockDeviceFor(cfg.Rootfs); err == nil {
+			limits.IODevice = dev
+		}
+	}
+	return limits
+}
+
+// hasIO reports whether l limits I/O.
+func hasIO(l *ResourceLimits) bool {
+	return l.IOReadBPS > 0 || l.IOWriteBPS > 0 || l.IOReadIOPS > 0 || l.IOWriteIOPS > 0
+}
+
+// cgroupStats is resource usage read from a microVM's cgroup.
+type cgroupStats struct {
+	CPUPercent   float64
+	MemoryUsedMB int
+}
+
+// cgroupManager places Firecracker processes in per-microVM cgroups.
+type cgroupManager interface {
+	// Create makes the cgroup for vmID and applies limits.
+	Create(vmID string, limits *ResourceLimits) error
+	// AddProcess moves pid into vmID's cgroup.
+	AddProcess(vmID string, pid int) error
+	// Stats returns usage since the previous call (or since Create).
+	Stats(vmID string) (cgroupStats, error)
+	// Remove deletes vmID's cgroup. Removing a missing cgroup is not an error.
+	Remove(vmID string) error
+}
+
+// newCgroupManager returns a cgroup v2 manager rooted at root, or a no-op
+// manager if the unified hierarchy is not mounted.
+func newCgroupManager(root string) cgroupManager {
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "cgroup.controllers")); err != nil {
+		return noopCgroups{}
+	}
+	return newCgroupV2(root)
+}
+
+// cgroupV2 manages cgroups as directories under root, one per microVM.
+// It only reads and writes interface files, so tests can point it at a
+// temp dir.
+type cgroupV2 struct {
+	root string
+
+	mu      sync.Mutex
+	samples map[string]cpuSample
+}
+
+type cpuSample struct {
+	usageUsec int64
+	at        time.Time
+}
+
+func newCgroupV2(root string) *cgroupV2 {
+	return &cgroupV2{root: root, samples: make(map[string]cpuSample)}
+}
+
+func (c *cgroupV2) path(vmID string) string {
+	return filepath.Join(c.root, "microvm-"+vmID)
+}
+
+// ensureRoot creates the parent cgroup and delegates the controllers we
+// need to its children.
+func (c *cgroupV2) ensureRoot() error {
+	if err := os.MkdirAll(c.root, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup %s: %w", c.root, err)
+	}
+	for _, dir := range []string{filepath.Dir(c.root), c.root} {
+		if err := writeCgroupFile(dir, "cgroup.subtree_control", "+cpu +memory +io"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cgroupV2) Create(vmID string, limits *ResourceLimits) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ensureRoot(); err != nil {
+		return err
+	}
+
+	dir := c.path(vmID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup %s: %w", dir, err)
+	}
+
+	if limits.CPUPercent > 0 {
+		quota := limits.CPUPercent * cpuPeriodUsec / 100
+		if err := writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriodUsec)); err != nil {
+			return err
+		}
+	}
+	if limits.MemoryMaxMiB > 0 {
+		if err := writeCgroupFile(dir, "memory.max", strconv.Itoa(limits.MemoryMaxMiB*1024*1024)); err != nil {
+			return err
+		}
+	}
+	if hasIO(limits) {
+		if limits.IODevice == "" {
+			return fmt.Errorf("I/O limits requested but no block device could be determined")
+		}
+		if err := writeCgroupFile(dir, "io.max", ioMaxLine(limits)); err != nil {
+			return err
+		}
+	}
+
+	c.samples[vmID] = cpuSample{at: time.Now()}
+	return nil
+}
+
+func (c *cgroupV2) AddProcess(vmID string, pid int) error {
+	return writeCgroupFile(c.path(vmID), "cgroup.procs", strconv.Itoa(pid))
+}
+
+func (c *cgroupV2) Stats(vmID string) (cgroupStats, error) {
+	var stats cgroupStats
+	dir := c.path(vmID)
+
+	usage, err := readCPUUsageUsec(dir)
+	if err != nil {
+		return stats, err
+	}
+	mem, err := os.ReadFile(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return stats, fmt.Errorf("failed to read memory.current: %w", err)
+	}
+	if bytes, err := strconv.ParseInt(strings.TrimSpace(string(mem)), 10, 64); err == nil {
+		stats.MemoryUsedMB = int(bytes / (1024 * 1024))
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	prev, ok := c.samples[vmID]
+	c.samples[vmID] = cpuSample{usageUsec: usage, at: now}
+	c.mu.Unlock()
+
+	if ok {
+		if elapsed := now.Sub(prev.at).Microseconds(); elapsed > 0 && usage >= prev.usageUsec {
+			stats.CPUPercent = float64(usage-prev.usageUsec) / float64(elapsed) * 100
+		}
+	}
+	return stats, nil
+}
+
+func (c *cgroupV2) Remove(vmID string) error {
+	c.mu.Lock()
+	delete(c.samples, vmID)
+	c.mu.Unlock()
+
+	// On cgroupfs this is a plain rmdir; RemoveAll also copes with the
+	// regular files a temp-dir hierarchy has.
+	if err := os.RemoveAll(c.path(vmID)); err != nil {
+		return fmt.Errorf("failed to remove cgroup: %w", err)
+	}
+	return nil
+}
+
+// readCPUUsageUsec returns usage_usec from dir's cpu.stat.
+func readCPUUsageUsec(dir string) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cpu.stat: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("usage_usec not found in cpu.stat")
+}
+
+func ioMaxLine(l *ResourceLimits) string {
+	parts := []string{l.IODevice}
+	for _, kv := range []struct {
+		key   string
+		value int64
+	}{
+		{"rbps", l.IOReadBPS},
+		{"wbps", l.IOWriteBPS},
+		{"riops", l.IOReadIOPS},
+		{"wiops", l.IOWriteIOPS},
+	} {
+		if kv.value > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", kv.key, kv.value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to write %s to %s: %w", value, filepath.Join(dir, name), err)
+	}
+	return nil
+}
+
+// blockDeviceFor returns the "major:minor" of the disk holding path. io.max
+// only accepts whole disks, so partitions are resolved to their parent.
+func blockDeviceFor(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+	dev := fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+
+	sysDir, err := filepath.EvalSymlinks(filepath.Join("/sys/dev/block", dev))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(sysDir, "partition")); err == nil {
+		parent, err := os.ReadFile(filepath.Join(filepath.Dir(sysDir), "dev"))
+		if err != nil {
+			return "", err
+		}
+		dev = strings.TrimSpace(string(parent))
+	}
+	return dev, nil
+}
+
+// noopCgroups is used when cgroup v2 is unavailable. Firecracker then runs
+// unconstrained and usage falls back to ps.
+type noopCgroups struct{}
+
+func (noopCgroups) Create(string, *ResourceLimits) error { return nil }
+func (noopCgroups) AddProcess(string, int) error         { return nil }
+func (noopCgroups) Stats(string) (cgroupStats, error) {
+	return cgroupStats{}, fmt.Errorf("cgroups not available")
+}
+func (noopCgroups) Remove(string) error { return nil }
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestResolveLimits(t *testing.T) {
+	cfg := &MicroVMConfig{VCPUs: 2, MemoryMiB: 512}
+
+	limits := resolveLimits(cfg, nil)
+	assert.Equal(t, 200, limits.CPUPercent)
+	assert.Equal(t, 512+vmmOverheadMiB, limits.MemoryMaxMiB)
+	assert.False(t, hasIO(limits))
+
+	limits = resolveLimits(cfg, &ResourceLimits{CPUPercent: 50, IOWriteBPS: 1 << 20, IODevice: "8:0"})
+	assert.Equal(t, 50, limits.CPUPercent)
+	assert.Equal(t, 512+vmmOverheadMiB, limits.MemoryMaxMiB)
+	assert.Equal(t, "8:0", limits.IODevice)
+}
+
+func TestCgroupV2Lifecycle(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "fc-agent.slice")
+	cg := newCgroupV2(root)
+
+	err := cg.Create("vm-1", &ResourceLimits{
+		CPUPercent:   150,
+		MemoryMaxMiB: 256,
+		IOReadBPS:    1048576,
+		IOWriteIOPS:  100,
+		IODevice:     "8:0",
+	})
+	require.NoError(t, err)
+
+	dir := filepath.Join(root, "microvm-vm-1")
+	assert.Equal(t, "+cpu +memory +io", readFile(t, filepath.Join(root, "cgroup.subtree_control")))
+	assert.Equal(t, "150000 100000", readFile(t, filepath.Join(dir, "cpu.max")))
+	assert.Equal(t, "268435456", readFile(t, filepath.Join(dir, "memory.max")))
+	assert.Equal(t, "8:0 rbps=1048576 wiops=100", readFile(t, filepath.Join(dir, "io.max")))
+
+	require.NoError(t, cg.AddProcess("vm-1", 4242))
+	assert.Equal(t, "4242", readFile(t, filepath.Join(dir, "cgroup.procs")))
+
+	// The kernel would maintain these; fake some usage
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cpu.stat"), []byte("usage_usec 1000\nuser_usec 800\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.current"), []byte("134217728\n"), 0644))
+
+	stats, err := cg.Stats("vm-1")
+	require.NoError(t, err)
+	assert.Equal(t, 128, stats.MemoryUsedMB)
+	assert.Greater(t, stats.CPUPercent, 0.0)
+
+	require.NoError(t, cg.Remove("vm-1"))
+	assert.NoDirExists(t, dir)
+	assert.NoError(t, cg.Remove("vm-1"), "removing twice is fine")
+}
+
+func TestCgroupV2IOLimitsNeedDevice(t *testing.T) {
+	cg := newCgroupV2(filepath.Join(t.TempDir(), "fc-agent.slice"))
+	err := cg.Create("vm-1", &ResourceLimits{IOReadBPS: 1024})
+	assert.Error(t, err)
+}
+
+func TestNoopCgroupsStatsFails(t *testing.T) {
+	var cg cgroupManager = noopCgroups{}
+	assert.NoError(t, cg.Create("vm-1", &ResourceLimits{}))
+	_, err := cg.Stats("vm-1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,364 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/anthropics/fc-macos/pkg/api"
+	"github.com/anthropics/fc-macos/pkg/firecracker"
+	"github.com/sirupsen/logrus"
+)
+
+// CloneMicroVMRequest is the request body for cloning a running microVM.
+type CloneMicroVMRequest = agentclient.CloneMicroVMRequest
+
+// firecrackerFor returns a client for vm's Firecracker API socket.
+func firecrackerFor(vm *MicroVM) *firecracker.Client {
+	return firecracker.NewAt(unixClient(vm.SocketPath, 30*time.Second), "http://localhost")
+}
+
+// handleVMClone serves POST /agent/microvms/{id}/clone.
+func (a *Agent) handleVMClone(w http.ResponseWriter, r *http.Request, src *MicroVM) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CloneMicroVMRequest
+	if !decodeRequest(w, r, "CloneMicroVMRequest", &req) {
+		return
+	}
+
+	src.mu.Lock()
+	running, jailed, pausing := src.started, src.jail != nil, src.pausing
+	src.mu.Unlock()
+	switch {
+	case src.Config == nil:
+		http.Error(w, "the legacy microVM cannot be cloned", http.StatusConflict)
+		return
+	case !running:
+		http.Error(w, "microVM not running", http.StatusServiceUnavailable)
+		return
+	case jailed:
+		http.Error(w, "cloning jailed microVMs is not supported", http.StatusNotImplemented)
+		return
+	case pausing:
+		http.Error(w, fmt.Sprintf("microVM %s is being paused or resumed", src.Name), http.StatusConflict)
+		return
+	case src.Network != nil && req.ExecPort == 0:
+		writeFieldErrors(w, FieldError{Field: "exec_port", Message: "is required to readdress the clone of a microVM on a network"})
+		return
+	case src.Network != nil && src.VsockPath == "":
+		http.Error(w, fmt.Sprintf("microVM %s has no vsock device to readdress its clone over", src.Name), http.StatusConflict)
+		return
+	}
+
+	// Only the rootfs is copied, so any other drive the guest can write to
+	// would be shared by both microVMs
+	cfg, err := firecrackerFor(src).GetVMConfig(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read drives: %v", err), http.StatusBadGateway)
+		return
+	}
+	for _, d := range cfg.Drives {
+		if d.DriveID != "rootfs" && !d.IsReadOnly {
+			http.Error(w, fmt.Sprintf("microVM %s cannot be cloned: drive %s (%s) is writable and would be shared with the clone", src.Name, d.DriveID, d.PathOnHost), http.StatusConflict)
+			return
+		}
+	}
+
+	// The clone is created like any other microVM, from the source's config
+	create := CreateMicroVMRequest{
+		Name:      req.Name,
+		Labels:    req.Labels,
+		Kernel:    src.Config.Kernel,
+		Rootfs:    src.Config.Rootfs,
+		VCPUs:     src.Config.VCPUs,
+		MemoryMiB: src.Config.MemoryMiB,
+		BootArgs:  src.Config.BootArgs,
+		Vsock:     src.VsockPath != "",
+		Resources: src.Resources,
+
+		FCLogLevel: src.Config.FCLogLevel,
+	}
+	if create.Labels == nil {
+		create.Labels = src.Labels
+	}
+	if src.IdleTimeout > 0 {
+		create.IdleTimeout = src.IdleTimeout.String()
+	}
+	if !a.checkCreate(w, r, &create, "") {
+		return
+	}
+
+	// Only one clone at a time can pause the source
+	src.mu.Lock()
+	if src.cloning {
+		src.mu.Unlock()
+		http.Error(w, fmt.Sprintf("microVM %s is already being cloned", src.Name), http.StatusConflict)
+		return
+	}
+	if src.pausing {
+		src.mu.Unlock()
+		http.Error(w, fmt.Sprintf("microVM %s is being paused or resumed", src.Name), http.StatusConflict)
+		return
+	}
+	src.cloning = true
+	src.mu.Unlock()
+	doneCloning := func() {
+		src.mu.Lock()
+		src.cloning = false
+		src.mu.Unlock()
+	}
+
+	vm, release, status, err := a.newMicroVM(&create, create.Name)
+	if err != nil {
+		doneCloning()
+		http.Error(w, err.Error(), status)
+		return
+	}
+	// The guest keeps its CID across the snapshot
+	vm.GuestCID = src.GuestCID
+	vm.Config.Rootfs = clonePath(src.Config.Rootfs, vm.Name)
+	vm.ownedRootfs = vm.Config.Rootfs
+
+	op := a.operations.start("clone", vm, true, func(ctx context.Context) (*MicroVMInfo, error) {
+		defer release()
+		return a.cloneMicroVM(ctx, src, vm, doneCloning, req.ExecPort, requestDuration(req.TTL))
+	})
+	acceptOperation(w, op)
+}
+
+// clonePath returns where the rootfs of the clone called name is copied to:
+// next to the source's, with the clone's name added.
+func clonePath(rootfs, name string) string {
+	ext := filepath.Ext(rootfs)
+	return strings.TrimSuffix(rootfs, ext) + "-" + name + ext
+}
+
+// cloneMicroVM snapshots src and copies its rootfs, then restores the
+// snapshot into vm with its own rootfs, tap device and address. doneCloning
+// is called once src is running again. On failure, or if ctx is cancelled
+// first, everything set up for vm is torn down again.
+func (a *Agent) cloneMicroVM(ctx context.Context, src, vm *MicroVM, doneCloning func(), execPort uint32, ttl time.Duration) (_ *MicroVMInfo, err error) {
+	op := operationFrom(ctx)
+
+	dir, err := os.MkdirTemp("", "fc-clone-")
+	if err != nil {
+		doneCloning()
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	snap := &api.SnapshotCreate{
+		SnapshotPath: filepath.Join(dir, "vmstate"),
+		MemFilePath:  filepath.Join(dir, "memory"),
+		SnapshotType: "Full",
+	}
+
+	err = a.snapshotMicroVM(ctx, src, snap, vm.Config.Rootfs)
+	doneCloning()
+	if err != nil {
+		return nil, err
+	}
+
+	started := false
+	defer func() {
+		if err == nil {
+			return
+		}
+		if started {
+			a.stopFirecrackerForVM(vm)
+			vm.removeLog()
+			a.cgroups.Remove(vm.ID)
+		}
+		a.networks.detach(vm.Network, vm.ID)
+		os.Remove(vm.ownedRootfs)
+	}()
+
+	// The clone gets its own tap device and address on the source's network
+	if src.Network != nil {
+		op.step("Attaching network")
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		netInfo, err := a.networks.attach(src.Network.Name, vm.ID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach network: %w", err)
+		}
+		vm.Network = netInfo
+		vm.Config.BootArgs = strings.Replace(vm.Config.BootArgs, kernelIPArg(src.Network), kernelIPArg(netInfo), 1)
+	}
+
+	op.step("Starting Firecracker")
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := a.startFirecrackerForVM(vm); err != nil {
+		return nil, fmt.Errorf("failed to start Firecracker: %w", err)
+	}
+	started = true
+
+	op.step("Restoring snapshot")
+	client := unixClient(vm.SocketPath, 10*time.Second)
+	if err := a.setupLogger(client, vm); err != nil {
+		logrus.Warnf("Firecracker log unavailable for %s: %v", vm.Name, err)
+	}
+	if err := a.setupMetricsFIFO(client, vm); err != nil {
+		logrus.Warnf("Firecracker metrics unavailable for %s: %v", vm.Name, err)
+	}
+	load := &api.SnapshotLoad{SnapshotPath: snap.SnapshotPath, MemFilePath: snap.MemFilePath}
+	if vm.Network != nil {
+		load.NetworkOverrides = []api.NetworkOverride{{IfaceID: "eth0", HostDevName: vm.Network.TapDevice, GuestMAC: vm.Network.MAC}}
+	}
+	if err := a.restoreSnapshot(ctx, src, vm, load); err != nil {
+		return nil, fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+
+	// The snapshot still points at the source's rootfs
+	fc := firecrackerFor(vm)
+	if err := fc.PatchDrive(ctx, "rootfs", vm.Config.Rootfs, nil); err != nil {
+		return nil, fmt.Errorf("failed to switch to the rootfs copy: %w", err)
+	}
+
+	op.step("Resuming microVM")
+	if err := fc.ResumeInstance(ctx); err != nil {
+		return nil, fmt.Errorf("failed to resume clone: %w", err)
+	}
+
+	// Firecracker has the clone's MAC now, but the guest still has the
+	// source's MAC and address until told otherwise
+	if vm.Network != nil {
+		op.step("Readdressing guest")
+		execCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if _, err := vsockExec(execCtx, vm.VsockPath, execPort, readdressCommand(vm.Network)); err != nil {
+			return nil, fmt.Errorf("failed to readdress clone: %w", err)
+		}
+	}
+
+	return a.registerMicroVM(vm, ttl), nil
+}
+
+// snapshotMicroVM pauses vm, writes its snapshot and copies its rootfs to
+// rootfsCopy, and resumes it again however that went. A microVM paused
+// through the agent is left paused.
+func (a *Agent) snapshotMicroVM(ctx context.Context, vm *MicroVM, snap *api.SnapshotCreate, rootfsCopy string) (err error) {
+	op := operationFrom(ctx)
+	fc := firecrackerFor(vm)
+
+	vm.mu.Lock()
+	paused := vm.paused
+	vm.mu.Unlock()
+	if !paused {
+		op.step("Pausing " + vm.Name)
+		if err := fc.PauseInstance(ctx); err != nil {
+			return fmt.Errorf("failed to pause %s: %w", vm.Name, err)
+		}
+		defer func() {
+			op.step("Resuming " + vm.Name)
+			// Resume even if the clone was cancelled
+			if rerr := fc.ResumeInstance(context.Background()); rerr != nil && err == nil {
+				err = fmt.Errorf("failed to resume %s: %w", vm.Name, rerr)
+			}
+		}()
+	}
+
+	op.step("Snapshotting " + vm.Name)
+	if err := fc.CreateSnapshot(ctx, snap); err != nil {
+		return fmt.Errorf("failed to snapshot %s: %w", vm.Name, err)
+	}
+
+	// The guest is paused, so the disk matches the memory snapshot
+	op.step("Copying rootfs")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := copyRootfs(vm.Config.Rootfs, rootfsCopy); err != nil {
+		return fmt.Errorf("failed to copy rootfs: %w", err)
+	}
+	return nil
+}
+
+// restoreSnapshot loads a snapshot of src into vm's Firecracker.
+// Firecracker binds the vsock socket at the path saved in the snapshot,
+// which is src's, so src's socket is moved aside meanwhile and vm's moved
+// to its own path after. src's guest keeps its connections, but new ones
+// from the host fail for that moment.
+func (a *Agent) restoreSnapshot(ctx context.Context, src, vm *MicroVM, load *api.SnapshotLoad) error {
+	fc := firecrackerFor(vm)
+	if vm.VsockPath == "" {
+		return fc.LoadSnapshot(ctx, load)
+	}
+
+	aside := src.VsockPath + ".clone"
+	if err := renameSocket(src.VsockPath, aside); err != nil {
+		return err
+	}
+	defer func() {
+		if err := renameSocket(aside, src.VsockPath); err != nil {
+			logrus.Warnf("Failed to restore vsock socket of %s: %v", src.Name, err)
+		}
+	}()
+
+	if err := fc.LoadSnapshot(ctx, load); err != nil {
+		return err
+	}
+	return renameSocket(src.VsockPath, vm.VsockPath)
+}
+
+// renameSocket moves a Unix socket, which keeps serving at its new path. A
+// socket that does not exist is left alone.
+func renameSocket(from, to string) error {
+	if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move vsock socket: %w", err)
+	}
+	return nil
+}
+
+// copyRootfs copies src to dst, which must not exist yet, as a reflink if
+// the filesystem supports them.
+func copyRootfs(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	if reflink(out, in) == nil {
+		return nil
+	}
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// readdressCommand returns the guest shell command that moves eth0 to the
+// MAC and address of info.
+func readdressCommand(info *NetworkInfo) string {
+	return fmt.Sprintf("ip link set eth0 down && ip link set eth0 address %s && ip addr flush dev eth0 && "+
+		"ip addr add %s/24 dev eth0 && ip link set eth0 up && ip route replace default via %s",
+		info.MAC, info.IP, info.Gateway)
+}
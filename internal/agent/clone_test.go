@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anthropics/fc-macos/internal/fctest"
+	"github.com/anthropics/fc-macos/pkg/api"
+	"github.com/anthropics/fc-macos/pkg/firecracker"
+)
+
+// firecrackerState returns the instance state vm's Firecracker reports.
+func firecrackerState(t *testing.T, vm *MicroVM) string {
+	t.Helper()
+	resp, err := unixClient(vm.SocketPath, 0).Get("http://localhost/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var info api.InstanceInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	return info.State
+}
+
+func TestCloneMicroVM(t *testing.T) {
+	a, srv := newTestAgent(t)
+	kernel, rootfs := guestImages(t)
+	require.NoError(t, os.WriteFile(rootfs, []byte("guest data"), 0600))
+
+	op := waitOperation(t, srv.URL, postJSON(t, srv.URL+"/agent/microvms", CreateMicroVMRequest{
+		Name: "web", Kernel: kernel, Rootfs: rootfs, MemoryMiB: 64, Vsock: true,
+		Labels: map[string]string{"team": "ci"},
+	}))
+	require.Equal(t, OperationSucceeded, op.Status, op.Error)
+	src := a.getVMByIDOrName("web")
+
+	op = waitOperation(t, srv.URL, postJSON(t, srv.URL+"/agent/microvms/web/clone", CloneMicroVMRequest{Name: "web-debug"}))
+	require.Equal(t, OperationSucceeded, op.Status, op.Error)
+	assert.Equal(t, "clone", op.Type)
+	var steps []string
+	for _, step := range op.Steps {
+		steps = append(steps, step.Name)
+	}
+	assert.Equal(t, []string{
+		"Pausing web", "Snapshotting web", "Copying rootfs", "Resuming web",
+		"Starting Firecracker", "Restoring snapshot", "Resuming microVM",
+	}, steps)
+
+	info := op.Result
+	require.NotNil(t, info)
+	assert.Equal(t, "web-debug", info.Name)
+	assert.True(t, info.Running)
+	assert.True(t, info.Vsock)
+	assert.Equal(t, "ci", info.Labels["team"])
+	assert.Equal(t, 64, info.Config.MemoryMiB)
+
+	// The clone runs on its own copy of the rootfs
+	copyPath := clonePath(rootfs, "web-debug")
+	assert.Equal(t, copyPath, info.Config.Rootfs)
+	data, err := os.ReadFile(copyPath)
+	require.NoError(t, err)
+	assert.Equal(t, "guest data", string(data))
+
+	clone := a.getVMByIDOrName("web-debug")
+	require.NotNil(t, clone)
+	assert.Equal(t, src.GuestCID, clone.GuestCID)
+	assert.Equal(t, fctest.Running, firecrackerState(t, clone))
+	assert.Equal(t, fctest.Running, firecrackerState(t, src), "the source is resumed")
+
+	resp, err := unixClient(clone.SocketPath, 0).Get("http://localhost/vm/config")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var cfg fctest.Config
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&cfg))
+	require.Len(t, cfg.Drives, 1)
+	assert.Equal(t, copyPath, cfg.Drives[0].PathOnHost)
+
+	// The name and the rootfs copy are taken now
+	resp = postJSON(t, srv.URL+"/agent/microvms/web/clone", CloneMicroVMRequest{Name: "web-debug"})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Deleting the clone removes its copy, so the name can be cloned again
+	req, err := http.NewRequest(http.MethodDelete, srv.URL+"/agent/microvms/web-debug", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	op = waitOperation(t, srv.URL, resp)
+	require.Equal(t, OperationSucceeded, op.Status, op.Error)
+	_, err = os.Stat(copyPath)
+	assert.True(t, os.IsNotExist(err), "rootfs copy still exists: %v", err)
+	_, err = os.Stat(rootfs)
+	assert.NoError(t, err, "the source's rootfs is kept")
+
+	op = waitOperation(t, srv.URL, postJSON(t, srv.URL+"/agent/microvms/web/clone", CloneMicroVMRequest{Name: "web-debug"}))
+	require.Equal(t, OperationSucceeded, op.Status, op.Error)
+	assert.FileExists(t, copyPath)
+}
+
+func TestCloneMicroVMValidation(t *testing.T) {
+	_, srv := newTestAgent(t)
+
+	resp := postJSON(t, srv.URL+"/agent/microvms/nope/clone", CloneMicroVMRequest{})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	kernel, rootfs := guestImages(t)
+	op := waitOperation(t, srv.URL, postJSON(t, srv.URL+"/agent/microvms", CreateMicroVMRequest{Name: "web", Kernel: kernel, Rootfs: rootfs}))
+	require.Equal(t, OperationSucceeded, op.Status, op.Error)
+
+	resp = postJSON(t, srv.URL+"/agent/microvms/web/clone", CloneMicroVMRequest{Name: "../escape"})
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	var errResp ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+	require.Len(t, errResp.Fields, 1)
+	assert.Equal(t, "name", errResp.Fields[0].Field)
+}
+
+func TestCloneMicroVMWritableDrive(t *testing.T) {
+	a, srv := newTestAgent(t)
+	kernel, rootfs := guestImages(t)
+	seed := filepath.Join(t.TempDir(), "seed.ext4")
+	data := filepath.Join(t.TempDir(), "data.ext4")
+	for _, path := range []string{seed, data} {
+		require.NoError(t, os.WriteFile(path, nil, 0600))
+	}
+
+	// The agent only gives microVMs a rootfs, so boot one with more drives
+	// by hand
+	_, socket := fctest.Start(t)
+	fc := firecracker.NewAt(unixClient(socket, 0), "http://localhost")
+	ctx := t.Context()
+	require.NoError(t, fc.SetBootSource(ctx, &api.BootSource{KernelImagePath: kernel}))
+	require.NoError(t, fc.SetDrive(ctx, "rootfs", &api.Drive{DriveID: "rootfs", PathOnHost: rootfs, IsRootDevice: true}))
+	require.NoError(t, fc.SetDrive(ctx, "seed", &api.Drive{DriveID: "seed", PathOnHost: seed, IsReadOnly: true}))
+	require.NoError(t, fc.SetDrive(ctx, "data", &api.Drive{DriveID: "data", PathOnHost: data}))
+	require.NoError(t, fc.StartInstance(ctx))
+	a.microVMs["vm-1"] = &MicroVM{
+		ID: "vm-1", Name: "db", SocketPath: socket,
+		Config:  &MicroVMConfig{Kernel: kernel, Rootfs: rootfs, MemoryMiB: 64},
+		started: true,
+	}
+
+	resp := postJSON(t, srv.URL+"/agent/microvms/db/clone", CloneMicroVMRequest{Name: "db-copy"})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "drive data ("+data+") is writable")
+	assert.NotContains(t, string(body), "seed", "read-only drives can be shared")
+	assert.Nil(t, a.getVMByIDOrName("db-copy"))
+}
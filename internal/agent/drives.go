@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/sirupsen/logrus"
+)
+
+// SwapDriveRequest is the request body for swapping a drive's backing file.
+type SwapDriveRequest = agentclient.SwapDriveRequest
+
+// handleVMSwapDrive serves POST /agent/microvms/{id}/swap-drive.
+func (a *Agent) handleVMSwapDrive(w http.ResponseWriter, r *http.Request, vm *MicroVM) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SwapDriveRequest
+	if !decodeRequest(w, r, "SwapDriveRequest", &req) {
+		return
+	}
+	path := filepath.Clean(req.PathOnHost)
+
+	vm.mu.Lock()
+	running, jailed := vm.started, vm.jail != nil
+	vm.mu.Unlock()
+	switch {
+	case !running:
+		http.Error(w, "microVM not running", http.StatusServiceUnavailable)
+		return
+	case jailed:
+		http.Error(w, "swapping drives of jailed microVMs is not supported", http.StatusNotImplemented)
+		return
+	}
+
+	file, err := os.Stat(path)
+	switch {
+	case err != nil:
+		writeFieldErrors(w, FieldError{Field: "path_on_host", Message: "does not exist in the Linux VM"})
+		return
+	case !file.Mode().IsRegular():
+		writeFieldErrors(w, FieldError{Field: "path_on_host", Message: "is not a regular file"})
+		return
+	}
+
+	a.swapMu.Lock()
+	defer a.swapMu.Unlock()
+
+	fc := firecrackerFor(vm)
+	cfg, err := fc.GetVMConfig(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read drives: %v", err), http.StatusBadGateway)
+		return
+	}
+	found := false
+	for _, d := range cfg.Drives {
+		found = found || d.DriveID == req.DriveID
+	}
+	if !found {
+		writeFieldErrors(w, FieldError{Field: "drive_id", Message: fmt.Sprintf("microVM %s has no drive %s", vm.Name, req.DriveID)})
+		return
+	}
+
+	if user := a.driveUser(r.Context(), file, vm, req.DriveID); user != "" {
+		http.Error(w, fmt.Sprintf("%s is in use by %s", path, user), http.StatusConflict)
+		return
+	}
+
+	if err := fc.PatchDrive(r.Context(), req.DriveID, path, nil); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to swap drive: %v", err), http.StatusBadGateway)
+		return
+	}
+	logrus.Infof("Swapped drive %s of microVM %s to %s", req.DriveID, vm.Name, path)
+
+	vm.mu.Lock()
+	if req.DriveID == "rootfs" && vm.Config != nil {
+		// Restarts and clones use the new rootfs
+		config := *vm.Config
+		config.Rootfs = path
+		vm.Config = &config
+	}
+	vm.touch()
+	info := vm.info()
+	vm.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// driveUser describes the drive, other than vm's drive driveID, that file
+// backs, or returns "" if there is none. It checks every microVM's rootfs
+// and the drives of those running.
+func (a *Agent) driveUser(ctx context.Context, file os.FileInfo, vm *MicroVM, driveID string) string {
+	a.vmMu.RLock()
+	vms := make([]*MicroVM, 0, len(a.microVMs))
+	for _, v := range a.microVMs {
+		vms = append(vms, v)
+	}
+	a.vmMu.RUnlock()
+
+	uses := func(path string) bool {
+		info, err := os.Stat(path)
+		return err == nil && os.SameFile(file, info)
+	}
+	for _, v := range vms {
+		v.mu.Lock()
+		rootfs, running := "", v.started
+		if v.Config != nil {
+			rootfs = v.Config.Rootfs
+		}
+		v.mu.Unlock()
+
+		if rootfs != "" && !(v == vm && driveID == "rootfs") && uses(rootfs) {
+			return fmt.Sprintf("microVM %s (drive rootfs)", v.Name)
+		}
+		if !running {
+			continue
+		}
+		cfg, err := firecrackerFor(v).GetVMConfig(ctx)
+		if err != nil {
+			logrus.Debugf("Cannot read drives of %s: %v", v.Name, err)
+			continue
+		}
+		for _, d := range cfg.Drives {
+			if !(v == vm && d.DriveID == driveID) && uses(d.PathOnHost) {
+				return fmt.Sprintf("microVM %s (drive %s)", v.Name, d.DriveID)
+			}
+		}
+	}
+	return ""
+}
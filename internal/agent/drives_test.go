@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anthropics/fc-macos/internal/fctest"
+)
+
+func TestSwapDrive(t *testing.T) {
+	a, srv := newTestAgent(t)
+	kernel, rootfs := guestImages(t)
+	_, dbRootfs := guestImages(t)
+
+	for name, path := range map[string]string{"web": rootfs, "db": dbRootfs} {
+		op := waitOperation(t, srv.URL, postJSON(t, srv.URL+"/agent/microvms", CreateMicroVMRequest{Name: name, Kernel: kernel, Rootfs: path}))
+		require.Equal(t, OperationSucceeded, op.Status, op.Error)
+	}
+
+	swap := func(req SwapDriveRequest) *http.Response {
+		t.Helper()
+		return postJSON(t, srv.URL+"/agent/microvms/web/swap-drive", req)
+	}
+	fieldError := func(resp *http.Response) string {
+		t.Helper()
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		var errResp ErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+		require.Len(t, errResp.Fields, 1)
+		return errResp.Fields[0].Field
+	}
+
+	newRootfs := filepath.Join(t.TempDir(), "rootfs-v2.ext4")
+	require.NoError(t, os.WriteFile(newRootfs, nil, 0600))
+
+	resp := swap(SwapDriveRequest{DriveID: "rootfs", PathOnHost: newRootfs})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var info MicroVMInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	resp.Body.Close()
+	assert.Equal(t, newRootfs, info.Config.Rootfs)
+
+	vm := a.getVMByIDOrName("web")
+	cfg, err := firecrackerFor(vm).GetVMConfig(t.Context())
+	require.NoError(t, err)
+	require.Len(t, cfg.Drives, 1)
+	assert.Equal(t, newRootfs, cfg.Drives[0].PathOnHost)
+
+	// Files another microVM uses are refused, however they are named
+	link := filepath.Join(t.TempDir(), "db.ext4")
+	require.NoError(t, os.Link(dbRootfs, link))
+	resp = swap(SwapDriveRequest{DriveID: "rootfs", PathOnHost: link})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Swapping to the file the drive already uses is fine
+	resp = swap(SwapDriveRequest{DriveID: "rootfs", PathOnHost: newRootfs})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, "path_on_host", fieldError(swap(SwapDriveRequest{DriveID: "rootfs", PathOnHost: "/no/such/file"})))
+	assert.Equal(t, "drive_id", fieldError(swap(SwapDriveRequest{DriveID: "data", PathOnHost: rootfs})))
+
+	// The old rootfs is free again
+	resp = swap(SwapDriveRequest{DriveID: "rootfs", PathOnHost: rootfs})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fctest.Running, firecrackerState(t, vm))
+}
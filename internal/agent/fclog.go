@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/api"
+)
+
+// jailLog is the Firecracker log file inside a jailed microVM's chroot.
+const jailLog = "/run/firecracker.log"
+
+// defaultFCLogLevel is used when a create request doesn't set fc_log_level.
+const defaultFCLogLevel = "Warning"
+
+// fcLogLevels are the levels Firecracker's logger accepts.
+var fcLogLevels = []string{"Error", "Warning", "Info", "Debug", "Trace"}
+
+// parseFCLogLevel returns Firecracker's spelling of level, matched
+// case-insensitively.
+func parseFCLogLevel(level string) (string, error) {
+	for _, l := range fcLogLevels {
+		if strings.EqualFold(level, l) {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("invalid fc_log_level %q (want one of %s)", level, strings.Join(fcLogLevels, ", "))
+}
+
+// setupLogger creates vm's Firecracker log file and points Firecracker at it.
+// It must run before InstanceStart.
+func (a *Agent) setupLogger(client *http.Client, vm *MicroVM) error {
+	hostPath := fmt.Sprintf("/tmp/firecracker-%s.log", vm.ID)
+	fcPath := hostPath
+	if vm.jail != nil {
+		hostPath = vm.jail.hostPath(jailLog)
+		fcPath = jailLog
+	}
+
+	// Firecracker opens the log without creating it
+	f, err := os.OpenFile(hostPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create log file: %w", err)
+	}
+	f.Close()
+	if vm.jail != nil {
+		if err := a.jailer.chown(hostPath, vm.jail.UID, vm.jail.GID); err != nil {
+			os.Remove(hostPath)
+			return fmt.Errorf("failed to chown log file: %w", err)
+		}
+	}
+
+	level := defaultFCLogLevel
+	if vm.Config != nil && vm.Config.FCLogLevel != "" {
+		level = vm.Config.FCLogLevel
+	}
+	logger := &api.Logger{LogPath: fcPath, Level: level, ShowLevel: true}
+	if err := a.putJSON(client, "http://localhost/logger", logger); err != nil {
+		os.Remove(hostPath)
+		return fmt.Errorf("failed to configure logger: %w", err)
+	}
+
+	vm.mu.Lock()
+	vm.logPath = hostPath
+	vm.mu.Unlock()
+	return nil
+}
+
+// handleVMFirecrackerLogs serves vm's Firecracker log. ?tail=N limits it to
+// the last N lines and ?follow=true keeps streaming new lines until the
+// client goes away or the microVM is removed.
+func (a *Agent) handleVMFirecrackerLogs(w http.ResponseWriter, r *http.Request, vm *MicroVM) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tail := 0
+	if s := r.URL.Query().Get("tail"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid tail %q", s), http.StatusBadRequest)
+			return
+		}
+		tail = n
+	}
+	follow := r.URL.Query().Get("follow") == "true"
+
+	vm.mu.Lock()
+	path := vm.logPath
+	vm.mu.Unlock()
+	if path == "" {
+		http.Error(w, fmt.Sprintf("no Firecracker log for %s", vm.Name), http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to open log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read log: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(lastLines(data, tail))
+	if !follow {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	buf := make([]byte, 32*1024)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := f.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil && err != io.EOF {
+			return
+		}
+		// The log is removed along with its microVM
+		if _, err := os.Stat(path); err != nil {
+			return
+		}
+	}
+}
+
+// lastLines returns the last n lines of data, or all of it when n is 0.
+func lastLines(data []byte, n int) []byte {
+	if n == 0 {
+		return data
+	}
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	for i := 0; i < n; i++ {
+		idx := bytes.LastIndexByte(data[:end], '\n')
+		if idx < 0 {
+			return data
+		}
+		end = idx
+	}
+	return data[end+1:]
+}
+
+// removeLog deletes vm's Firecracker log.
+func (vm *MicroVM) removeLog() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	if vm.logPath != "" {
+		os.Remove(vm.logPath)
+		vm.logPath = ""
+	}
+}
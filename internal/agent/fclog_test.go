@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFCLogLevel(t *testing.T) {
+	level, err := parseFCLogLevel("debug")
+	require.NoError(t, err)
+	assert.Equal(t, "Debug", level)
+
+	level, err = parseFCLogLevel("Warning")
+	require.NoError(t, err)
+	assert.Equal(t, "Warning", level)
+
+	_, err = parseFCLogLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestLastLines(t *testing.T) {
+	data := []byte("one\ntwo\nthree\n")
+	assert.Equal(t, "one\ntwo\nthree\n", string(lastLines(data, 0)))
+	assert.Equal(t, "three\n", string(lastLines(data, 1)))
+	assert.Equal(t, "two\nthree\n", string(lastLines(data, 2)))
+	assert.Equal(t, "one\ntwo\nthree\n", string(lastLines(data, 10)))
+	assert.Equal(t, "three", string(lastLines([]byte("one\ntwo\nthree"), 1)))
+}
+
+func TestHandleVMFirecrackerLogs(t *testing.T) {
+	a := New(&Config{AuditLog: "off"})
+	path := filepath.Join(t.TempDir(), "firecracker.log")
+	require.NoError(t, os.WriteFile(path, []byte("[Warning] a\n[Error] b\n[Warning] c\n"), 0600))
+	vm := &MicroVM{ID: "vm-1", Name: "worker", logPath: path}
+
+	rec := httptest.NewRecorder()
+	a.handleVMFirecrackerLogs(rec, httptest.NewRequest("GET", "/agent/microvms/vm-1/firecracker-logs?tail=2", nil), vm)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[Error] b\n[Warning] c\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	a.handleVMFirecrackerLogs(rec, httptest.NewRequest("GET", "/agent/microvms/vm-1/firecracker-logs?tail=x", nil), vm)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	vm.removeLog()
+	assert.NoFileExists(t, path)
+
+	rec = httptest.NewRecorder()
+	a.handleVMFirecrackerLogs(rec, httptest.NewRequest("GET", "/agent/microvms/vm-1/firecracker-logs", nil), vm)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
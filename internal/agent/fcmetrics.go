@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/anthropics/fc-macos/pkg/api"
+)
+
+// jailMetrics is the metrics FIFO inside a jailed microVM's chroot.
+const jailMetrics = "/run/metrics.fifo"
+
+// fcCounters accumulates the counters Firecracker writes to a microVM's
+// metrics FIFO. Firecracker reports each counter as the delta since its last
+// flush, so they are summed here to give monotonic totals.
+type fcCounters struct {
+	mu      sync.Mutex
+	groups  map[string]map[string]float64 // group (block, net, vcpu) -> counter -> total
+	flushes int
+	updated time.Time
+}
+
+func newFCCounters() *fcCounters {
+	return &fcCounters{groups: make(map[string]map[string]float64)}
+}
+
+// add folds one metrics line into the totals.
+func (c *fcCounters) add(m *api.Metrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for group, values := range map[string]map[string]interface{}{
+		"block": m.Block,
+		"net":   m.Net,
+		"vcpu":  m.VCPU,
+	} {
+		for name, v := range values {
+			// Latency aggregates are objects; only plain counters are kept
+			n, ok := v.(float64)
+			if !ok {
+				continue
+			}
+			if c.groups[group] == nil {
+				c.groups[group] = make(map[string]float64)
+			}
+			c.groups[group][name] += n
+		}
+	}
+	c.flushes++
+	c.updated = time.Now()
+}
+
+// fcCounter is one accumulated Firecracker counter.
+type fcCounter struct {
+	Group string
+	Name  string
+	Value float64
+}
+
+// snapshot returns the totals sorted by group and name.
+func (c *fcCounters) snapshot() []fcCounter {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var out []fcCounter
+	for group, values := range c.groups {
+		for name, v := range values {
+			out = append(out, fcCounter{Group: group, Name: name, Value: v})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Group != out[j].Group {
+			return out[i].Group < out[j].Group
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// get returns one counter's total, or 0 if it hasn't been reported.
+func (c *fcCounters) get(group, name string) float64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.groups[group][name]
+}
+
+// read consumes newline-delimited metrics JSON until r is closed.
+func (c *fcCounters) read(r io.Reader, vmName string) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		var m api.Metrics
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			logrus.Debugf("Ignoring malformed Firecracker metrics for %s: %v", vmName, err)
+			continue
+		}
+		c.add(&m)
+	}
+}
+
+// setupMetricsFIFO creates vm's metrics FIFO, starts draining it and points
+// Firecracker at it. It must run before InstanceStart.
+func (a *Agent) setupMetricsFIFO(client *http.Client, vm *MicroVM) error {
+	hostPath := fmt.Sprintf("/tmp/firecracker-%s.metrics", vm.ID)
+	fcPath := hostPath
+	if vm.jail != nil {
+		hostPath = vm.jail.hostPath(jailMetrics)
+		fcPath = jailMetrics
+	}
+
+	os.Remove(hostPath)
+	if err := syscall.Mkfifo(hostPath, 0600); err != nil {
+		return fmt.Errorf("failed to create metrics FIFO: %w", err)
+	}
+	if vm.jail != nil {
+		if err := a.jailer.chown(hostPath, vm.jail.UID, vm.jail.GID); err != nil {
+			os.Remove(hostPath)
+			return fmt.Errorf("failed to chown metrics FIFO: %w", err)
+		}
+	}
+
+	// Opening read-write never blocks waiting for a writer, and keeps the
+	// FIFO open if Firecracker reopens it.
+	f, err := os.OpenFile(hostPath, os.O_RDWR, 0)
+	if err != nil {
+		os.Remove(hostPath)
+		return fmt.Errorf("failed to open metrics FIFO: %w", err)
+	}
+
+	if err := a.putJSON(client, "http://localhost/metrics", &api.MetricsConfig{MetricsPath: fcPath}); err != nil {
+		f.Close()
+		os.Remove(hostPath)
+		return fmt.Errorf("failed to configure metrics: %w", err)
+	}
+
+	vm.mu.Lock()
+	vm.metricsPath = hostPath
+	vm.metricsFIFO = f
+	vm.mu.Unlock()
+
+	go vm.fcMetrics.read(f, vm.Name)
+	return nil
+}
+
+// closeMetricsFIFO stops draining vm's metrics FIFO. Callers hold vm.mu.
+func (vm *MicroVM) closeMetricsFIFO() {
+	if vm.metricsFIFO == nil {
+		return
+	}
+	vm.metricsFIFO.Close()
+	os.Remove(vm.metricsPath)
+	vm.metricsFIFO = nil
+}
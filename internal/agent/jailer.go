@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Paths inside a microVM's chroot, as Firecracker sees them.
+const (
+	jailAPISocket = "/run/firecracker.socket"
+	jailVsock     = "/run/vsock.sock"
+	jailKernel    = "/vmlinux"
+	jailRootfs    = "/rootfs.ext4"
+)
+
+// JailerConfig enables launching microVMs through Firecracker's jailer.
+type JailerConfig struct {
+	Bin           string // Path to the jailer binary
+	ChrootBaseDir string // Where per-microVM chroots are created (default: /srv/jailer)
+	UIDBase       int    // First uid handed out; each microVM gets its own (default: 10000)
+	GID           int    // Group all jailed Firecracker processes run as (default: 10000)
+}
+
+// jail is a microVM's confinement when running under the jailer.
+type jail struct {
+	Root  string // Host path of the chroot
+	UID   int
+	GID   int
+	Netns string // Name under /var/run/netns
+}
+
+// hostPath translates a path inside the chroot to the host.
+func (j *jail) hostPath(p string) string {
+	return filepath.Join(j.Root, p)
+}
+
+// jailer prepares chroots and network namespaces and builds jailer command
+// lines.
+type jailer struct {
+	cfg    *JailerConfig
+	fcBin  string
+	mu     sync.Mutex
+	uidSeq int
+
+	// run and chown touch the host. Replaced in tests.
+	run   func(name string, args ...string) error
+	chown func(path string, uid, gid int) error
+}
+
+func newJailer(cfg *JailerConfig, fcBin string) *jailer {
+	if cfg.ChrootBaseDir == "" {
+		cfg.ChrootBaseDir = "/srv/jailer"
+	}
+	if cfg.UIDBase == 0 {
+		cfg.UIDBase = 10000
+	}
+	if cfg.GID == 0 {
+		cfg.GID = 10000
+	}
+	return &jailer{
+		cfg:   cfg,
+		fcBin: fcBin,
+		run:   runNetworkCommand,
+		chown: os.Chown,
+	}
+}
+
+// chrootDir is the directory the jailer creates for id; the chroot itself
+// is its "root" subdirectory.
+func (j *jailer) chrootDir(id string) string {
+	return filepath.Join(j.cfg.ChrootBaseDir, filepath.Base(j.fcBin), id)
+}
+
+// prepare builds vm's chroot and network namespace and rewrites its socket
+// paths to where they will appear on the host.
+func (j *jailer) prepare(vm *MicroVM) error {
+	j.mu.Lock()
+	uid := j.cfg.UIDBase + j.uidSeq
+	j.uidSeq++
+	j.mu.Unlock()
+
+	jl := &jail{
+		Root:  filepath.Join(j.chrootDir(vm.ID), "root"),
+		UID:   uid,
+		GID:   j.cfg.GID,
+		Netns: "fc-" + vm.ID,
+	}
+
+	if err := os.MkdirAll(jl.hostPath("/run"), 0755); err != nil {
+		return fmt.Errorf("failed to create chroot: %w", err)
+	}
+	if err := j.chown(jl.hostPath("/run"), jl.UID, jl.GID); err != nil {
+		j.removeChroot(vm.ID)
+		return fmt.Errorf("failed to chown chroot: %w", err)
+	}
+
+	for _, f := range []struct{ src, dst string }{
+		{vm.Config.Kernel, jailKernel},
+		{vm.Config.Rootfs, jailRootfs},
+	} {
+		dst := jl.hostPath(f.dst)
+		if err := linkOrCopy(f.src, dst); err != nil {
+			j.removeChroot(vm.ID)
+			return fmt.Errorf("failed to add %s to chroot: %w", f.src, err)
+		}
+		if err := j.chown(dst, jl.UID, jl.GID); err != nil {
+			j.removeChroot(vm.ID)
+			return fmt.Errorf("failed to chown %s: %w", dst, err)
+		}
+	}
+
+	if err := j.run("ip", "netns", "add", jl.Netns); err != nil {
+		j.removeChroot(vm.ID)
+		return fmt.Errorf("failed to create network namespace: %w", err)
+	}
+
+	vm.jail = jl
+	vm.SocketPath = jl.hostPath(jailAPISocket)
+	if vm.VsockPath != "" {
+		vm.VsockPath = jl.hostPath(jailVsock)
+	}
+	logrus.Infof("Prepared jail for %s: %s (uid %d)", vm.Name, jl.Root, jl.UID)
+	return nil
+}
+
+// command returns the jailer invocation for vm.
+func (j *jailer) command(vm *MicroVM) *exec.Cmd {
+	return exec.Command(j.cfg.Bin, j.args(vm)...)
+}
+
+func (j *jailer) args(vm *MicroVM) []string {
+	return []string{
+		"--id", vm.ID,
+		"--exec-file", j.fcBin,
+		"--uid", strconv.Itoa(vm.jail.UID),
+		"--gid", strconv.Itoa(vm.jail.GID),
+		"--chroot-base-dir", j.cfg.ChrootBaseDir,
+		"--netns", filepath.Join("/var/run/netns", vm.jail.Netns),
+		"--",
+		"--api-sock", jailAPISocket,
+	}
+}
+
+// cleanup removes vm's chroot and network namespace. It is a no-op when
+// jailer mode is off.
+func (j *jailer) cleanup(vm *MicroVM) {
+	if j == nil || vm.jail == nil {
+		return
+	}
+	if err := j.run("ip", "netns", "del", vm.jail.Netns); err != nil {
+		logrus.Warnf("Failed to remove network namespace %s: %v", vm.jail.Netns, err)
+	}
+	j.removeChroot(vm.ID)
+}
+
+func (j *jailer) removeChroot(id string) {
+	if err := os.RemoveAll(j.chrootDir(id)); err != nil {
+		logrus.Warnf("Failed to remove chroot for %s: %v", id, err)
+	}
+}
+
+// linkOrCopy hard-links src to dst, copying when they are on different
+// filesystems.
+func linkOrCopy(src, dst string) error {
+	os.Remove(dst)
+	err := os.Link(src, dst)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	return CopyFile(src, dst)
+}
+
+// firecrackerPaths returns the kernel, rootfs and vsock paths to hand to
+// Firecracker's API, translated into the chroot for jailed microVMs.
+func (vm *MicroVM) firecrackerPaths() (kernel, rootfs, vsock string) {
+	if vm.jail == nil {
+		return vm.Config.Kernel, vm.Config.Rootfs, vm.VsockPath
+	}
+	if vm.VsockPath != "" {
+		vsock = jailVsock
+	}
+	return jailKernel, jailRootfs, vsock
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeJailer returns a jailer rooted in a temp dir that records the host
+// commands it would run.
+func fakeJailer(t *testing.T) (*jailer, *[]string) {
+	t.Helper()
+	var cmds []string
+	j := newJailer(&JailerConfig{
+		Bin:           "/usr/local/bin/jailer",
+		ChrootBaseDir: t.TempDir(),
+	}, "/usr/local/bin/firecracker")
+	j.run = func(name string, args ...string) error {
+		cmds = append(cmds, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	j.chown = func(string, int, int) error { return nil }
+	return j, &cmds
+}
+
+func testVMImages(t *testing.T) *MicroVMConfig {
+	t.Helper()
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "vmlinux")
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	require.NoError(t, os.WriteFile(kernel, []byte("kernel"), 0644))
+	require.NoError(t, os.WriteFile(rootfs, []byte("rootfs"), 0644))
+	return &MicroVMConfig{VCPUs: 1, MemoryMiB: 128, Kernel: kernel, Rootfs: rootfs}
+}
+
+func TestJailerPrepare(t *testing.T) {
+	j, cmds := fakeJailer(t)
+	vm := &MicroVM{ID: "vm-1", Name: "jailed", Config: testVMImages(t), VsockPath: "/tmp/fc.vsock"}
+
+	require.NoError(t, j.prepare(vm))
+	require.NotNil(t, vm.jail)
+
+	root := filepath.Join(j.cfg.ChrootBaseDir, "firecracker", "vm-1", "root")
+	assert.Equal(t, root, vm.jail.Root)
+	assert.Equal(t, 10000, vm.jail.UID)
+	assert.Equal(t, filepath.Join(root, "run/firecracker.socket"), vm.SocketPath)
+	assert.Equal(t, filepath.Join(root, "run/vsock.sock"), vm.VsockPath)
+	assert.Equal(t, "kernel", readFile(t, filepath.Join(root, "vmlinux")))
+	assert.Equal(t, "rootfs", readFile(t, filepath.Join(root, "rootfs.ext4")))
+	assert.Equal(t, []string{"ip netns add fc-vm-1"}, *cmds)
+
+	kernel, rootfs, vsock := vm.firecrackerPaths()
+	assert.Equal(t, "/vmlinux", kernel)
+	assert.Equal(t, "/rootfs.ext4", rootfs)
+	assert.Equal(t, "/run/vsock.sock", vsock)
+
+	// Each microVM gets its own uid
+	other := &MicroVM{ID: "vm-2", Config: testVMImages(t)}
+	require.NoError(t, j.prepare(other))
+	assert.Equal(t, 10001, other.jail.UID)
+
+	j.cleanup(vm)
+	assert.NoDirExists(t, filepath.Join(j.cfg.ChrootBaseDir, "firecracker", "vm-1"))
+	assert.Contains(t, *cmds, "ip netns del fc-vm-1")
+}
+
+func TestJailerArgs(t *testing.T) {
+	j, _ := fakeJailer(t)
+	vm := &MicroVM{ID: "vm-1", jail: &jail{UID: 10003, GID: 10000, Netns: "fc-vm-1"}}
+
+	args := strings.Join(j.args(vm), " ")
+	assert.Equal(t, "--id vm-1 --exec-file /usr/local/bin/firecracker --uid 10003 --gid 10000 "+
+		"--chroot-base-dir "+j.cfg.ChrootBaseDir+" --netns /var/run/netns/fc-vm-1 "+
+		"-- --api-sock /run/firecracker.socket", args)
+}
+
+func TestJailerPrepareMissingImage(t *testing.T) {
+	j, _ := fakeJailer(t)
+	vm := &MicroVM{ID: "vm-1", Config: &MicroVMConfig{Kernel: "/nonexistent/vmlinux", Rootfs: "/nonexistent/rootfs"}}
+
+	assert.Error(t, j.prepare(vm))
+	assert.Nil(t, vm.jail)
+	assert.NoDirExists(t, filepath.Join(j.cfg.ChrootBaseDir, "firecracker", "vm-1"))
+}
+
+func TestFirecrackerPathsUnjailed(t *testing.T) {
+	vm := &MicroVM{Config: &MicroVMConfig{Kernel: "/k", Rootfs: "/r"}, VsockPath: "/tmp/v.sock"}
+	kernel, rootfs, vsock := vm.firecrackerPaths()
+	assert.Equal(t, "/k", kernel)
+	assert.Equal(t, "/r", rootfs)
+	assert.Equal(t, "/tmp/v.sock", vsock)
+}
+
+func TestNetworkAttachJailed(t *testing.T) {
+	var cmds []string
+	n := newNetworkManager()
+	n.run = func(name string, args ...string) error {
+		cmds = append(cmds, name+" "+strings.Join(args, " "))
+		return nil
+	}
+
+	info, err := n.attach("backend", "vm-1", &jail{UID: 10000, Netns: "fc-vm-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "fctap1", info.TapDevice)
+	assert.Contains(t, cmds, "ip link add fcveth1 type veth peer name fcveth1p")
+	assert.Contains(t, cmds, "ip netns exec fc-vm-1 ip tuntap add dev fctap1 mode tap user 10000")
+	assert.Contains(t, cmds, "ip link set fcveth1 master fcbr0")
+
+	cmds = nil
+	n.detach(info, "vm-1")
+	assert.Contains(t, cmds, "ip link del fcveth1")
+}
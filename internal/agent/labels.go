@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ProjectLabel is the label compose projects use to group their microVMs.
+const ProjectLabel = "fc-macos.project"
+
+// Label keys and values must be safe to use in selectors. openapi.json
+// repeats these patterns to validate the labels of new microVMs.
+var (
+	labelKeyRe   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	labelValueRe = regexp.MustCompile(`^[A-Za-z0-9._:/@-]*$`)
+)
+
+type selectorOp int
+
+const (
+	opEquals selectorOp = iota
+	opNotEquals
+	opExists
+	opNotExists
+)
+
+type labelRequirement struct {
+	key   string
+	op    selectorOp
+	value string
+}
+
+// LabelSelector is a parsed label query such as "team=ci,job!=nightly,owner".
+// All requirements must hold for a microVM to match.
+type LabelSelector []labelRequirement
+
+// ParseSelector parses a comma-separated list of requirements:
+//
+//	key=value   key==value   key!=value   key   !key
+//
+// An empty string yields a selector that matches everything.
+func ParseSelector(s string) (LabelSelector, error) {
+	var sel LabelSelector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var req labelRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			req = labelRequirement{key: kv[0], op: opNotEquals, value: kv[1]}
+		case strings.Contains(part, "=="):
+			kv := strings.SplitN(part, "==", 2)
+			req = labelRequirement{key: kv[0], op: opEquals, value: kv[1]}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(part, "=", 2)
+			req = labelRequirement{key: kv[0], op: opEquals, value: kv[1]}
+		case strings.HasPrefix(part, "!"):
+			req = labelRequirement{key: part[1:], op: opNotExists}
+		default:
+			req = labelRequirement{key: part, op: opExists}
+		}
+
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+		if !labelKeyRe.MatchString(req.key) {
+			return nil, fmt.Errorf("invalid selector %q: bad label key", part)
+		}
+		if !labelValueRe.MatchString(req.value) {
+			return nil, fmt.Errorf("invalid selector %q: bad label value", part)
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels satisfy every requirement in the selector.
+func (sel LabelSelector) Matches(labels map[string]string) bool {
+	for _, req := range sel {
+		v, ok := labels[req.key]
+		switch req.op {
+		case opEquals:
+			if !ok || v != req.value {
+				return false
+			}
+		case opNotEquals:
+			if ok && v == req.value {
+				return false
+			}
+		case opExists:
+			if !ok {
+				return false
+			}
+		case opNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String renders the selector in canonical form.
+func (sel LabelSelector) String() string {
+	parts := make([]string, 0, len(sel))
+	for _, req := range sel {
+		switch req.op {
+		case opEquals:
+			parts = append(parts, req.key+"="+req.value)
+		case opNotEquals:
+			parts = append(parts, req.key+"!="+req.value)
+		case opExists:
+			parts = append(parts, req.key)
+		case opNotExists:
+			parts = append(parts, "!"+req.key)
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSelector(t *testing.T) {
+	sel, err := ParseSelector("team=ci, job!=nightly,owner,!debug,env==prod")
+	require.NoError(t, err)
+	require.Len(t, sel, 5)
+	assert.Equal(t, "!debug,env=prod,job!=nightly,owner,team=ci", sel.String())
+}
+
+func TestParseSelectorEmptyMatchesEverything(t *testing.T) {
+	sel, err := ParseSelector("")
+	require.NoError(t, err)
+	assert.Empty(t, sel)
+	assert.True(t, sel.Matches(nil))
+	assert.True(t, sel.Matches(map[string]string{"team": "ci"}))
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, s := range []string{"=ci", "team=c i", "!", "te am", "team!=a,b=c=d"} {
+		_, err := ParseSelector(s)
+		assert.Error(t, err, "selector %q", s)
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{"team": "ci", "job": "build-42"}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"team=ci", true},
+		{"team=dev", false},
+		{"team=ci,job=build-42", true},
+		{"team=ci,job!=build-42", false},
+		{"job!=nightly", true},
+		{"owner!=alice", true},
+		{"job", true},
+		{"owner", false},
+		{"!owner", true},
+		{"!team", false},
+	}
+
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.selector)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, sel.Matches(labels), "selector %q", tt.selector)
+	}
+}
@@ -0,0 +1,369 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc/<pid>/stat.
+const clockTicks = 100
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency
+// histogram.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// routeLabel maps a request path to a low-cardinality route for metrics.
+func routeLabel(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/agent/microvms/"):
+		parts := strings.SplitN(strings.TrimPrefix(path, "/agent/microvms/"), "/", 2)
+		if len(parts) == 1 {
+			return "/agent/microvms/{id}"
+		}
+		switch parts[1] {
+		case "console", "exec", "extend", "clone", "pause", "resume", "swap-drive", "firecracker-logs", "stats":
+			return "/agent/microvms/{id}/" + parts[1]
+		}
+		return "/agent/microvms/{id}/firecracker"
+	case strings.HasPrefix(path, "/agent/tokens/"):
+		return "/agent/tokens/{name}"
+	case strings.HasSuffix(path, "/cancel") && strings.HasPrefix(path, "/agent/operations/"):
+		return "/agent/operations/{id}/cancel"
+	case strings.HasPrefix(path, "/agent/operations/"):
+		return "/agent/operations/{id}"
+	case strings.HasPrefix(path, "/microvms/"):
+		return "/microvms/{id}/firecracker"
+	}
+	switch path {
+	case "/health", "/version", "/openapi.json", "/agent/metrics", "/console",
+		"/agent/microvms", "/agent/microvms:batch", "/agent/capacity", "/agent/stats", "/agent/operations", "/agent/tokens", "/agent/audit",
+		"/agent/start", "/agent/stop", "/agent/status":
+		return path
+	}
+	return "/firecracker"
+}
+
+type requestKey struct {
+	route, method string
+	code          int
+}
+
+type latencyKey struct {
+	route, method string
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// httpMetrics counts agent API requests and their latencies.
+type httpMetrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	latency  map[latencyKey]*histogram
+}
+
+func newHTTPMetrics() *httpMetrics {
+	return &httpMetrics{
+		requests: make(map[requestKey]uint64),
+		latency:  make(map[latencyKey]*histogram),
+	}
+}
+
+func (m *httpMetrics) observe(route, method string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{route, method, code}]++
+
+	h := m.latency[latencyKey{route, method}]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[latencyKey{route, method}] = h
+	}
+	secs := d.Seconds()
+	for i, le := range latencyBuckets {
+		if secs <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += secs
+	h.count++
+}
+
+// withMetrics records the count and latency of every request.
+func (a *Agent) withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := routeLabel(r.URL.Path)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		a.httpMetrics.observe(route, r.Method, rec.status(), time.Since(start))
+	})
+}
+
+// procStats reads a process's CPU time and resident memory from procfs
+// without forking.
+func procStats(procRoot string, pid int) (cpuSeconds float64, rssBytes int64, err error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	// The command name may contain spaces; fields resume after its ')'
+	s := string(data)
+	end := strings.LastIndexByte(s, ')')
+	if end < 0 {
+		return 0, 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 22 {
+		return 0, 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	// fields[0] is field 3 (state): utime is 14, stime 15, rss 24
+	utime, _ := strconv.ParseFloat(fields[11], 64)
+	stime, _ := strconv.ParseFloat(fields[12], 64)
+	rssPages, _ := strconv.ParseInt(fields[21], 10, 64)
+
+	return (utime + stime) / clockTicks, rssPages * int64(os.Getpagesize()), nil
+}
+
+// promWriter writes the Prometheus text exposition format.
+type promWriter struct {
+	w io.Writer
+}
+
+func (p *promWriter) header(name, typ, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample; labels are alternating names and values.
+func (p *promWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(p.w, "%s %s\n", b.String(), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// microVMSample is a point-in-time view of a microVM for /metrics.
+type microVMSample struct {
+	id, name   string
+	running    bool
+	pid        int
+	startedAt  time.Time
+	restarts   int
+	fcCounters []fcCounter
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// handleMetrics serves agent and microVM metrics in Prometheus format.
+func (a *Agent) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	a.vmMu.RLock()
+	samples := make([]microVMSample, 0, len(a.microVMs))
+	for _, vm := range a.microVMs {
+		vm.mu.Lock()
+		s := microVMSample{
+			id:        vm.ID,
+			name:      vm.Name,
+			running:   vm.started,
+			startedAt: vm.startedAt,
+		}
+		if vm.starts > 1 {
+			s.restarts = vm.starts - 1
+		}
+		if vm.fcProcess != nil && vm.fcProcess.Process != nil {
+			s.pid = vm.fcProcess.Process.Pid
+		}
+		vm.mu.Unlock()
+		s.fcCounters = vm.fcMetrics.snapshot()
+		samples = append(samples, s)
+	}
+	a.vmMu.RUnlock()
+	sort.Slice(samples, func(i, j int) bool { return samples[i].name < samples[j].name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p := &promWriter{w: w}
+
+	p.header("fc_agent_microvms", "gauge", "Number of microVMs managed by the agent.")
+	p.sample("fc_agent_microvms", float64(len(samples)))
+
+	a.capMu.Lock()
+	c, capErr := a.capacity()
+	a.capMu.Unlock()
+	if capErr == nil {
+		p.header("fc_agent_vcpus_reserved", "gauge", "vCPUs reserved by microVMs.")
+		p.sample("fc_agent_vcpus_reserved", float64(c.ReservedVCPUs))
+		p.header("fc_agent_vcpus_limit", "gauge", "vCPUs that may be reserved after overcommit.")
+		p.sample("fc_agent_vcpus_limit", float64(c.VCPULimit))
+		p.header("fc_agent_memory_reserved_bytes", "gauge", "Memory reserved by microVMs.")
+		p.sample("fc_agent_memory_reserved_bytes", float64(c.ReservedMemoryMiB)*(1<<20))
+		p.header("fc_agent_memory_limit_bytes", "gauge", "Memory that may be reserved after overcommit.")
+		p.sample("fc_agent_memory_limit_bytes", float64(c.MemoryLimitMiB)*(1<<20))
+	}
+
+	now := time.Now()
+	p.header("fc_microvm_up", "gauge", "Whether the microVM's Firecracker process is running.")
+	for _, s := range samples {
+		p.sample("fc_microvm_up", boolFloat(s.running), "microvm", s.id, "name", s.name)
+	}
+	p.header("fc_microvm_uptime_seconds", "gauge", "Seconds since Firecracker was last started.")
+	for _, s := range samples {
+		if s.running {
+			p.sample("fc_microvm_uptime_seconds", now.Sub(s.startedAt).Seconds(), "microvm", s.id, "name", s.name)
+		}
+	}
+	p.header("fc_microvm_restarts_total", "counter", "Times Firecracker was restarted for the microVM.")
+	for _, s := range samples {
+		p.sample("fc_microvm_restarts_total", float64(s.restarts), "microvm", s.id, "name", s.name)
+	}
+
+	type procSample struct {
+		s   *microVMSample
+		cpu float64
+		rss int64
+	}
+	var procs []procSample
+	for i := range samples {
+		s := &samples[i]
+		if !s.running || s.pid == 0 {
+			continue
+		}
+		if cpu, rss, err := procStats(a.config.ProcRoot, s.pid); err == nil {
+			procs = append(procs, procSample{s, cpu, rss})
+		}
+	}
+	p.header("fc_microvm_cpu_seconds_total", "counter", "CPU time used by the microVM's Firecracker process.")
+	for _, ps := range procs {
+		p.sample("fc_microvm_cpu_seconds_total", ps.cpu, "microvm", ps.s.id, "name", ps.s.name)
+	}
+	p.header("fc_microvm_memory_rss_bytes", "gauge", "Resident memory of the microVM's Firecracker process.")
+	for _, ps := range procs {
+		p.sample("fc_microvm_memory_rss_bytes", float64(ps.rss), "microvm", ps.s.id, "name", ps.s.name)
+	}
+
+	// Firecracker's own counters, one family per group and counter
+	type fcSample struct {
+		s     *microVMSample
+		value float64
+	}
+	families := make(map[string][]fcSample)
+	for i := range samples {
+		for _, c := range samples[i].fcCounters {
+			name := "firecracker_" + c.Group + "_" + sanitizeMetricName(c.Name) + "_total"
+			families[name] = append(families[name], fcSample{&samples[i], c.Value})
+		}
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p.header(name, "counter", "Firecracker counter read from the microVM's metrics FIFO.")
+		for _, fs := range families[name] {
+			p.sample(name, fs.value, "microvm", fs.s.id, "name", fs.s.name)
+		}
+	}
+
+	a.writeHTTPMetrics(p)
+}
+
+func (a *Agent) writeHTTPMetrics(p *promWriter) {
+	m := a.httpMetrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reqKeys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		reqKeys = append(reqKeys, k)
+	}
+	sort.Slice(reqKeys, func(i, j int) bool {
+		a, b := reqKeys[i], reqKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	p.header("fc_agent_http_requests_total", "counter", "HTTP requests served by the agent.")
+	for _, k := range reqKeys {
+		p.sample("fc_agent_http_requests_total", float64(m.requests[k]),
+			"route", k.route, "method", k.method, "code", strconv.Itoa(k.code))
+	}
+
+	latKeys := make([]latencyKey, 0, len(m.latency))
+	for k := range m.latency {
+		latKeys = append(latKeys, k)
+	}
+	sort.Slice(latKeys, func(i, j int) bool {
+		if latKeys[i].route != latKeys[j].route {
+			return latKeys[i].route < latKeys[j].route
+		}
+		return latKeys[i].method < latKeys[j].method
+	})
+	p.header("fc_agent_http_request_duration_seconds", "histogram", "Latency of HTTP requests served by the agent.")
+	for _, k := range latKeys {
+		h := m.latency[k]
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += h.counts[i]
+			p.sample("fc_agent_http_request_duration_seconds_bucket", float64(cumulative),
+				"route", k.route, "method", k.method, "le", strconv.FormatFloat(le, 'g', -1, 64))
+		}
+		p.sample("fc_agent_http_request_duration_seconds_bucket", float64(h.count),
+			"route", k.route, "method", k.method, "le", "+Inf")
+		p.sample("fc_agent_http_request_duration_seconds_sum", h.sum, "route", k.route, "method", k.method)
+		p.sample("fc_agent_http_request_duration_seconds_count", float64(h.count), "route", k.route, "method", k.method)
+	}
+}
+
+// sanitizeMetricName makes a Firecracker counter name safe for Prometheus.
+func sanitizeMetricName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteLabel(t *testing.T) {
+	tests := map[string]string{
+		"/agent/microvms":                       "/agent/microvms",
+		"/agent/microvms:batch":                 "/agent/microvms:batch",
+		"/agent/microvms/vm-1":                  "/agent/microvms/{id}",
+		"/agent/microvms/vm-1/console":          "/agent/microvms/{id}/console",
+		"/agent/microvms/vm-1/clone":            "/agent/microvms/{id}/clone",
+		"/agent/microvms/vm-1/resume":           "/agent/microvms/{id}/resume",
+		"/agent/microvms/vm-1/swap-drive":       "/agent/microvms/{id}/swap-drive",
+		"/agent/microvms/vm-1/firecracker-logs": "/agent/microvms/{id}/firecracker-logs",
+		"/agent/microvms/vm-1/drives/rootfs":    "/agent/microvms/{id}/firecracker",
+		"/agent/tokens/ci":                      "/agent/tokens/{name}",
+		"/agent/operations/op-1":                "/agent/operations/{id}",
+		"/agent/operations/op-1/cancel":         "/agent/operations/{id}/cancel",
+		"/microvms/vm-1/machine-config":         "/microvms/{id}/firecracker",
+		"/machine-config":                       "/firecracker",
+		"/agent/metrics":                        "/agent/metrics",
+		"/metrics":                              "/firecracker",
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, routeLabel(path), path)
+	}
+}
+
+func TestProcStats(t *testing.T) {
+	proc := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(proc, "42"), 0755))
+	// Fields after the command: state ppid ... utime(14)=250 stime(15)=50 ... rss(24)=1000
+	stat := "42 (fire cracker) S 1 42 42 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 3 0 1000 123456789 1000 18446744073709551615"
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "42", "stat"), []byte(stat), 0644))
+
+	cpu, rss, err := procStats(proc, 42)
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, cpu)
+	assert.Equal(t, int64(1000*os.Getpagesize()), rss)
+
+	_, _, err = procStats(proc, 43)
+	assert.Error(t, err)
+}
+
+func TestFCCountersAccumulateDeltas(t *testing.T) {
+	c := newFCCounters()
+	lines := `{"utc_timestamp_ms":1,"block":{"read_bytes":100,"write_count":2},"net":{"tx_bytes_count":10},"vcpu":{"exit_io_in":5,"exit_io_in_agg":{"min_us":1,"max_us":9}}}
+not json
+{"utc_timestamp_ms":2,"block":{"read_bytes":50,"write_count":0},"net":{"tx_bytes_count":5},"vcpu":{"exit_io_in":1}}
+`
+	c.read(strings.NewReader(lines), "test")
+
+	got := make(map[string]float64)
+	for _, s := range c.snapshot() {
+		got[s.Group+"."+s.Name] = s.Value
+	}
+	assert.Equal(t, map[string]float64{
+		"block.read_bytes":   150,
+		"block.write_count":  2,
+		"net.tx_bytes_count": 15,
+		"vcpu.exit_io_in":    6,
+	}, got)
+	assert.Equal(t, 2, c.flushes)
+}
+
+func TestHandleMetrics(t *testing.T) {
+	a := New(&Config{ProcRoot: fakeProc(t, 2, 2048, 1024), AuditLog: "off"})
+
+	vm := &MicroVM{ID: "vm-1", Name: `web"1`, started: true, startedAt: time.Now().Add(-time.Minute), starts: 2}
+	vm.fcMetrics = newFCCounters()
+	vm.fcMetrics.read(strings.NewReader(`{"block":{"read_bytes":4096}}`+"\n"), vm.Name)
+	a.microVMs[vm.ID] = vm
+
+	h := a.withMetrics(http.HandlerFunc(a.handleMetrics))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/agent/microvms/vm-1", nil))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/agent/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+
+	assert.Contains(t, body, "# TYPE fc_microvm_up gauge\n")
+	assert.Contains(t, body, `fc_microvm_up{microvm="vm-1",name="web\"1"} 1`)
+	assert.Contains(t, body, `fc_microvm_restarts_total{microvm="vm-1",name="web\"1"} 1`)
+	assert.Contains(t, body, `fc_microvm_uptime_seconds{microvm="vm-1"`)
+	assert.Contains(t, body, `firecracker_block_read_bytes_total{microvm="vm-1",name="web\"1"} 4096`)
+	assert.Contains(t, body, "fc_agent_microvms 1\n")
+	assert.Contains(t, body, "fc_agent_vcpus_limit 8\n")
+	assert.Contains(t, body, `fc_agent_http_requests_total{route="/agent/microvms/{id}",method="GET",code="200"} 1`)
+	assert.Contains(t, body, `fc_agent_http_request_duration_seconds_bucket{route="/agent/microvms/{id}",method="GET",le="+Inf"} 1`)
+}
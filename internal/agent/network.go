@@ -0,0 +1,244 @@
+package agent
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/sirupsen/logrus"
+)
+
+// Shared microVM networks are bridges inside the Linux VM. Each network gets
+// its own /24 out of 172.30.0.0/16; the bridge owns .1 and microVMs are
+// handed addresses from .2 upwards.
+const (
+	networkSubnetPrefix = "172.30"
+	networkMaxHosts     = 254
+)
+
+// NetworkConfig requests that a microVM be attached to a shared network.
+type NetworkConfig = agentclient.NetworkConfig
+
+// NetworkInfo describes a microVM's attachment to a shared network.
+type NetworkInfo = agentclient.NetworkInfo
+
+// vmNetwork is a bridge shared by the microVMs attached to it.
+type vmNetwork struct {
+	name   string
+	index  int
+	bridge string
+	hosts  map[int]string // host octet -> microVM ID
+}
+
+// networkManager allocates bridges, tap devices and addresses for microVMs.
+type networkManager struct {
+	mu       sync.Mutex
+	networks map[string]*vmNetwork
+	links    map[string]string // microVM ID -> device enslaved to the bridge
+	tapSeq   uint64
+
+	// run executes a host networking command. Replaced in tests.
+	run func(name string, args ...string) error
+}
+
+func newNetworkManager() *networkManager {
+	return &networkManager{
+		networks: make(map[string]*vmNetwork),
+		links:    make(map[string]string),
+		run:      runNetworkCommand,
+	}
+}
+
+func runNetworkCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// attach connects vmID to the named network, creating the bridge on first use.
+// Jailed microVMs get their tap inside the jail's network namespace, bridged
+// to the shared network through a veth pair.
+func (n *networkManager) attach(name, vmID string, jl *jail) (*NetworkInfo, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	network, err := n.ensureNetwork(name)
+	if err != nil {
+		return nil, err
+	}
+
+	host := 0
+	for h := 2; h <= networkMaxHosts; h++ {
+		if _, used := network.hosts[h]; !used {
+			host = h
+			break
+		}
+	}
+	if host == 0 {
+		return nil, fmt.Errorf("network %s has no free addresses", name)
+	}
+
+	n.tapSeq++
+	tap := fmt.Sprintf("fctap%d", n.tapSeq)
+	hostLink := tap
+
+	if jl != nil {
+		hostLink = fmt.Sprintf("fcveth%d", n.tapSeq)
+		if err := n.attachNetns(jl, hostLink, tap); err != nil {
+			n.run("ip", "link", "del", hostLink)
+			return nil, err
+		}
+	} else if err := n.run("ip", "tuntap", "add", "dev", tap, "mode", "tap"); err != nil {
+		return nil, fmt.Errorf("failed to create tap device: %w", err)
+	}
+	if err := n.run("ip", "link", "set", hostLink, "master", network.bridge); err != nil {
+		n.run("ip", "link", "del", hostLink)
+		return nil, fmt.Errorf("failed to attach tap device: %w", err)
+	}
+	if err := n.run("ip", "link", "set", hostLink, "up"); err != nil {
+		n.run("ip", "link", "del", hostLink)
+		return nil, fmt.Errorf("failed to bring up tap device: %w", err)
+	}
+
+	network.hosts[host] = vmID
+	n.links[vmID] = hostLink
+	logrus.Infof("Attached %s to network %s (%s)", vmID, name, hostLink)
+
+	return &NetworkInfo{
+		Name:      name,
+		IP:        fmt.Sprintf("%s.%d.%d", networkSubnetPrefix, network.index, host),
+		Gateway:   fmt.Sprintf("%s.%d.1", networkSubnetPrefix, network.index),
+		MAC:       fmt.Sprintf("06:00:ac:1e:%02x:%02x", network.index, host),
+		TapDevice: tap,
+	}, nil
+}
+
+// attachNetns creates tap inside jl's network namespace, owned by the
+// jail's uid, and bridges it to a veth pair whose host end is hostLink.
+// Callers must hold n.mu.
+func (n *networkManager) attachNetns(jl *jail, hostLink, tap string) error {
+	peer := hostLink + "p"
+	if err := n.run("ip", "link", "add", hostLink, "type", "veth", "peer", "name", peer); err != nil {
+		return fmt.Errorf("failed to create veth pair: %w", err)
+	}
+	if err := n.run("ip", "link", "set", peer, "netns", jl.Netns); err != nil {
+		return fmt.Errorf("failed to move veth into namespace: %w", err)
+	}
+
+	inNetns := [][]string{
+		{"ip", "tuntap", "add", "dev", tap, "mode", "tap", "user", strconv.Itoa(jl.UID)},
+		{"ip", "link", "add", "br0", "type", "bridge"},
+		{"ip", "link", "set", peer, "master", "br0"},
+		{"ip", "link", "set", tap, "master", "br0"},
+		{"ip", "link", "set", peer, "up"},
+		{"ip", "link", "set", tap, "up"},
+		{"ip", "link", "set", "br0", "up"},
+	}
+	for _, args := range inNetns {
+		if err := n.run("ip", append([]string{"netns", "exec", jl.Netns}, args...)...); err != nil {
+			return fmt.Errorf("failed to set up tap device in namespace: %w", err)
+		}
+	}
+	return nil
+}
+
+// detach releases the address and tap device held by vmID. The bridge is
+// removed once its last microVM has left.
+func (n *networkManager) detach(info *NetworkInfo, vmID string) {
+	if info == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// The bridged device is the tap itself, or the host end of a veth pair
+	// for jailed microVMs. Deleting a veth end also removes its peer in the
+	// jail's namespace.
+	link, ok := n.links[vmID]
+	if !ok {
+		link = info.TapDevice
+	}
+	delete(n.links, vmID)
+	if err := n.run("ip", "link", "del", link); err != nil {
+		logrus.Warnf("Failed to remove tap device %s: %v", link, err)
+	}
+
+	network, ok := n.networks[info.Name]
+	if !ok {
+		return
+	}
+	for host, id := range network.hosts {
+		if id == vmID {
+			delete(network.hosts, host)
+		}
+	}
+
+	if len(network.hosts) == 0 {
+		if err := n.run("ip", "link", "del", network.bridge); err != nil {
+			logrus.Warnf("Failed to remove bridge %s: %v", network.bridge, err)
+		}
+		delete(n.networks, info.Name)
+		logrus.Infof("Removed network %s", info.Name)
+	}
+}
+
+// ensureNetwork returns the named network, creating its bridge if needed.
+// Callers must hold n.mu.
+func (n *networkManager) ensureNetwork(name string) (*vmNetwork, error) {
+	if network, ok := n.networks[name]; ok {
+		return network, nil
+	}
+
+	used := make(map[int]bool, len(n.networks))
+	for _, network := range n.networks {
+		used[network.index] = true
+	}
+	index := -1
+	for i := 0; i < 256; i++ {
+		if !used[i] {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("no free network subnets")
+	}
+
+	network := &vmNetwork{
+		name:   name,
+		index:  index,
+		bridge: fmt.Sprintf("fcbr%d", index),
+		hosts:  make(map[int]string),
+	}
+
+	// A bridge left behind by a previous agent run is reused as-is.
+	if err := n.run("ip", "link", "show", network.bridge); err != nil {
+		if err := n.run("ip", "link", "add", "name", network.bridge, "type", "bridge"); err != nil {
+			return nil, fmt.Errorf("failed to create bridge: %w", err)
+		}
+		gateway := fmt.Sprintf("%s.%d.1/24", networkSubnetPrefix, index)
+		if err := n.run("ip", "addr", "add", gateway, "dev", network.bridge); err != nil {
+			n.run("ip", "link", "del", network.bridge)
+			return nil, fmt.Errorf("failed to configure bridge: %w", err)
+		}
+	}
+	if err := n.run("ip", "link", "set", network.bridge, "up"); err != nil {
+		return nil, fmt.Errorf("failed to bring up bridge: %w", err)
+	}
+
+	n.networks[name] = network
+	logrus.Infof("Created network %s on %s", name, network.bridge)
+	return network, nil
+}
+
+// kernelIPArg returns the kernel command line argument that configures the
+// guest's eth0 statically for the given attachment.
+func kernelIPArg(info *NetworkInfo) string {
+	return fmt.Sprintf("ip=%s::%s:255.255.255.0::eth0:off", info.IP, info.Gateway)
+}
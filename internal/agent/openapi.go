@@ -0,0 +1,310 @@
+package agent
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+)
+
+// openAPISpec is the OpenAPI 3 document for the agent API, served at
+// /openapi.json. Request bodies with a schema in it are validated against it.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// ErrorResponse is the JSON error body for requests that fail validation.
+type ErrorResponse = agentclient.ErrorResponse
+
+// FieldError is one invalid field in a request body.
+type FieldError = agentclient.FieldError
+
+func (a *Agent) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// schema is the subset of JSON Schema the agent's OpenAPI document uses.
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	PropertyNames        *schema            `json:"propertyNames"`
+	Items                *schema            `json:"items"`
+	Enum                 []string           `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+
+	pattern *regexp.Regexp // Pattern, compiled
+	extra   *schema        // AdditionalProperties, when it is a schema
+}
+
+var (
+	schemasOnce sync.Once
+	schemas     map[string]*schema
+)
+
+// specSchemas returns the document's component schemas, by name.
+func specSchemas() map[string]*schema {
+	schemasOnce.Do(func() {
+		var doc struct {
+			Components struct {
+				Schemas map[string]*schema `json:"schemas"`
+			} `json:"components"`
+		}
+		if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+			panic(fmt.Sprintf("invalid embedded openapi.json: %v", err))
+		}
+		for name, s := range doc.Components.Schemas {
+			if err := s.prepare(); err != nil {
+				panic(fmt.Sprintf("invalid schema %s in embedded openapi.json: %v", name, err))
+			}
+		}
+		schemas = doc.Components.Schemas
+	})
+	return schemas
+}
+
+// decodeRequest decodes r's JSON body into v after validating it against the
+// named schema. On failure it writes a 400 with an ErrorResponse and returns
+// false.
+func decodeRequest(w http.ResponseWriter, r *http.Request, schemaName string, v interface{}) bool {
+	var buf bytes.Buffer
+	var body interface{}
+	dec := json.NewDecoder(io.TeeReader(r.Body, &buf))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		writeErrorResponse(w, ErrorResponse{Error: fmt.Sprintf("invalid request body: %v", err)})
+		return false
+	}
+
+	if errs := validateSchema(specSchemas()[schemaName], body, ""); len(errs) > 0 {
+		writeErrorResponse(w, ErrorResponse{Error: "invalid request body", Fields: errs})
+		return false
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), v); err != nil {
+		writeErrorResponse(w, ErrorResponse{Error: fmt.Sprintf("invalid request body: %v", err)})
+		return false
+	}
+	return true
+}
+
+// writeFieldErrors rejects a request body whose fields failed checks that
+// need more than the schema, such as the fc_log_level names.
+func writeFieldErrors(w http.ResponseWriter, errs ...FieldError) {
+	writeErrorResponse(w, ErrorResponse{Error: "invalid request body", Fields: errs})
+}
+
+func writeErrorResponse(w http.ResponseWriter, resp ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// validateSchema checks v, a value decoded with UseNumber, against s and
+// returns an error for each invalid field. path is v's dotted field path.
+func validateSchema(s *schema, v interface{}, path string) []FieldError {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		return validateSchema(specSchemas()[strings.TrimPrefix(s.Ref, "#/components/schemas/")], v, path)
+	}
+
+	fail := func(format string, args ...interface{}) []FieldError {
+		field := path
+		if field == "" {
+			field = "(body)"
+		}
+		return []FieldError{{Field: field, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fail("must be an object")
+		}
+		return s.validateObject(obj, path)
+
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fail("must be an array")
+		}
+		var errs []FieldError
+		for i, item := range arr {
+			errs = append(errs, validateSchema(s.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return errs
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		return s.validateString(str, fail)
+
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok && s.Type == "integer" {
+			return fail("must be an integer")
+		}
+		if !ok {
+			return fail("must be a number")
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return fail("must be a number")
+		}
+		if s.Type == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return fail("must be an integer")
+			}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return fail("must be at most %v", *s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fail("must be true or false")
+		}
+	}
+	return nil
+}
+
+func (s *schema) validateObject(obj map[string]interface{}, path string) []FieldError {
+	prefix := path
+	if prefix != "" {
+		prefix += "."
+	}
+
+	var errs []FieldError
+	for _, name := range s.Required {
+		if obj[name] == nil {
+			errs = append(errs, FieldError{Field: prefix + name, Message: "is required"})
+		}
+	}
+
+	// Map keys are unordered; report fields in a stable order
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := prefix + name
+		if s.PropertyNames != nil {
+			if nameErrs := s.PropertyNames.validateString(name, func(format string, args ...interface{}) []FieldError {
+				return []FieldError{{Field: field, Message: "name " + fmt.Sprintf(format, args...)}}
+			}); len(nameErrs) > 0 {
+				errs = append(errs, nameErrs...)
+				continue
+			}
+		}
+
+		if prop, ok := s.Properties[name]; ok {
+			// null is the same as leaving an optional field out
+			if obj[name] == nil {
+				continue
+			}
+			errs = append(errs, validateSchema(prop, obj[name], field)...)
+			continue
+		}
+		switch {
+		case s.extra != nil:
+			errs = append(errs, validateSchema(s.extra, obj[name], field)...)
+		case string(s.AdditionalProperties) == "false":
+			errs = append(errs, FieldError{Field: field, Message: "unknown field"})
+		}
+	}
+	return errs
+}
+
+// prepare compiles s's patterns and additionalProperties schemas, so that
+// validation does not modify the shared schemas.
+func (s *schema) prepare() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+	if len(s.AdditionalProperties) > 0 && s.AdditionalProperties[0] == '{' {
+		s.extra = &schema{}
+		if err := json.Unmarshal(s.AdditionalProperties, s.extra); err != nil {
+			return err
+		}
+	}
+	for _, sub := range []*schema{s.PropertyNames, s.Items, s.extra} {
+		if sub != nil {
+			if err := sub.prepare(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, prop := range s.Properties {
+		if err := prop.prepare(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *schema) validateString(str string, fail func(string, ...interface{}) []FieldError) []FieldError {
+	if s.MinLength != nil && len(str) < *s.MinLength {
+		if *s.MinLength == 1 {
+			return fail("must not be empty")
+		}
+		return fail("must be at least %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && len(str) > *s.MaxLength {
+		return fail("must be at most %d characters", *s.MaxLength)
+	}
+	if s.pattern != nil {
+		if !s.pattern.MatchString(str) {
+			return fail("must match %s", s.Pattern)
+		}
+	}
+	if len(s.Enum) > 0 {
+		for _, e := range s.Enum {
+			if str == e {
+				return nil
+			}
+		}
+		return fail("must be one of %s", strings.Join(s.Enum, ", "))
+	}
+	if s.Format == "duration" && str != "" {
+		if d, err := time.ParseDuration(str); err != nil || d <= 0 {
+			return fail("must be a positive duration such as 30m")
+		}
+	}
+	return nil
+}
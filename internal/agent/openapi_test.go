@@ -0,0 +1,321 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// specTypes are the Go types behind each schema in openapi.json.
+var specTypes = map[string]reflect.Type{
+	"CreateMicroVMRequest": reflect.TypeOf(CreateMicroVMRequest{}),
+	"MicroVMConfig":        reflect.TypeOf(MicroVMConfig{}),
+	"MicroVMInfo":          reflect.TypeOf(MicroVMInfo{}),
+	"ResourceLimits":       reflect.TypeOf(ResourceLimits{}),
+	"NetworkConfig":        reflect.TypeOf(NetworkConfig{}),
+	"NetworkInfo":          reflect.TypeOf(NetworkInfo{}),
+	"Capacity":             reflect.TypeOf(Capacity{}),
+	"StatsSample":          reflect.TypeOf(StatsSample{}),
+	"MicroVMStats":         reflect.TypeOf(StatsResponse{}),
+	"MicroVMUsage":         reflect.TypeOf(MicroVMUsage{}),
+	"SwapDriveRequest":     reflect.TypeOf(SwapDriveRequest{}),
+	"ExtendRequest":        reflect.TypeOf(ExtendRequest{}),
+	"ExecRequest":          reflect.TypeOf(ExecRequest{}),
+	"ExecResponse":         reflect.TypeOf(ExecResponse{}),
+	"VersionInfo":          reflect.TypeOf(VersionInfo{}),
+	"ErrorResponse":        reflect.TypeOf(ErrorResponse{}),
+	"FieldError":           reflect.TypeOf(FieldError{}),
+	"APIToken":             reflect.TypeOf(APIToken{}),
+	"CreateTokenRequest":   reflect.TypeOf(CreateTokenRequest{}),
+	"CreateTokenResponse":  reflect.TypeOf(CreateTokenResponse{}),
+	"AuditEntry":           reflect.TypeOf(AuditEntry{}),
+	"Operation":            reflect.TypeOf(Operation{}),
+	"OperationStep":        reflect.TypeOf(OperationStep{}),
+	"BatchCreateRequest":   reflect.TypeOf(BatchCreateRequest{}),
+	"BatchItem":            reflect.TypeOf(BatchItem{}),
+	"CloneMicroVMRequest":  reflect.TypeOf(CloneMicroVMRequest{}),
+
+	// Built from a map rather than a struct
+	"Health": nil,
+}
+
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	schemas := specSchemas()
+	for name := range schemas {
+		_, ok := specTypes[name]
+		assert.True(t, ok, "schema %s has no Go type in specTypes", name)
+	}
+
+	for name, typ := range specTypes {
+		s, ok := schemas[name]
+		if !assert.True(t, ok, "openapi.json has no schema for %s", name) || typ == nil {
+			continue
+		}
+
+		fields := jsonFields(typ)
+		var goNames, specNames []string
+		for field := range fields {
+			goNames = append(goNames, field)
+		}
+		for prop := range s.Properties {
+			specNames = append(specNames, prop)
+		}
+		sort.Strings(goNames)
+		sort.Strings(specNames)
+		if !assert.Equal(t, goNames, specNames, "properties of %s", name) {
+			continue
+		}
+
+		for field, ft := range fields {
+			assertSchemaType(t, name+"."+field, s.Properties[field], ft)
+		}
+	}
+}
+
+// jsonFields returns the JSON fields of struct type t, including those of
+// embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" {
+			for name, ft := range jsonFields(f.Type) {
+				fields[name] = ft
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// assertSchemaType checks schema s describes values of Go type t.
+func assertSchemaType(t *testing.T, field string, s *schema, typ reflect.Type) {
+	t.Helper()
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if s.Ref != "" {
+		ref := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		assert.Equal(t, typ.Name(), ref, "%s refers to the wrong schema", field)
+		return
+	}
+
+	switch {
+	case typ == reflect.TypeOf(time.Time{}):
+		assert.Equal(t, "string", s.Type, field)
+		assert.Equal(t, "date-time", s.Format, field)
+	case typ.Kind() == reflect.String:
+		assert.Equal(t, "string", s.Type, field)
+	case typ.Kind() == reflect.Bool:
+		assert.Equal(t, "boolean", s.Type, field)
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		assert.Equal(t, "integer", s.Type, field)
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		assert.Equal(t, "number", s.Type, field)
+	case typ.Kind() == reflect.Slice:
+		if assert.Equal(t, "array", s.Type, field) && assert.NotNil(t, s.Items, field) {
+			assertSchemaType(t, field+"[]", s.Items, typ.Elem())
+		}
+	case typ.Kind() == reflect.Map:
+		if assert.Equal(t, "object", s.Type, field) && assert.NotNil(t, s.extra, field) {
+			assertSchemaType(t, field+"{}", s.extra, typ.Elem())
+		}
+	default:
+		t.Errorf("%s: no schema mapping for Go type %s", field, typ)
+	}
+}
+
+func TestOpenAPILabelPatterns(t *testing.T) {
+	labels := specSchemas()["CreateMicroVMRequest"].Properties["labels"]
+	assert.Equal(t, labelKeyRe.String(), labels.PropertyNames.Pattern)
+	assert.Equal(t, labelValueRe.String(), labels.extra.Pattern)
+}
+
+func TestOpenAPINamePatterns(t *testing.T) {
+	schemas := specSchemas()
+	name := schemas["CreateMicroVMRequest"].Properties["name"].Pattern
+	require.NotEmpty(t, name)
+	assert.Equal(t, name, schemas["CloneMicroVMRequest"].Properties["name"].Pattern)
+	assert.Equal(t, tokenNameRe.String(), schemas["CreateTokenRequest"].Properties["name"].Pattern)
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	a := New(&Config{
+		ProcRoot:                 fakeProc(t, 4, 8192, 8192),
+		AuditLog:                 "off",
+		AuthToken:                "secret",
+		DisableUnversionedRoutes: true,
+	})
+
+	for _, path := range []string{"/openapi.json", "/v1/openapi.json"} {
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var doc struct {
+			OpenAPI string                     `json:"openapi"`
+			Paths   map[string]json.RawMessage `json:"paths"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc), path)
+		assert.Equal(t, "3.1.0", doc.OpenAPI)
+		assert.Contains(t, doc.Paths, "/agent/microvms")
+	}
+}
+
+func TestCreateMicroVMValidation(t *testing.T) {
+	a := New(&Config{ProcRoot: fakeProc(t, 4, 8192, 8192), AuditLog: "off"})
+
+	tests := []struct {
+		name string
+		body string
+		want []FieldError
+	}{
+		{"missing images", `{}`, []FieldError{
+			{Field: "kernel", Message: "is required"},
+			{Field: "rootfs", Message: "is required"},
+		}},
+		{"empty kernel", `{"kernel":"","rootfs":"/r"}`, []FieldError{
+			{Field: "kernel", Message: "must not be empty"},
+		}},
+		{"wrong types", `{"kernel":"/k","rootfs":"/r","vcpus":"2","vsock":1}`, []FieldError{
+			{Field: "vcpus", Message: "must be an integer"},
+			{Field: "vsock", Message: "must be true or false"},
+		}},
+		{"fractional vcpus", `{"kernel":"/k","rootfs":"/r","vcpus":1.5}`, []FieldError{
+			{Field: "vcpus", Message: "must be an integer"},
+		}},
+		{"bad name", `{"name":"../web","kernel":"/k","rootfs":"/r"}`, []FieldError{
+			{Field: "name", Message: "must match ^[A-Za-z0-9][A-Za-z0-9._-]*$"},
+		}},
+		{"unknown field", `{"kernel":"/k","rootfs":"/r","memory":512}`, []FieldError{
+			{Field: "memory", Message: "unknown field"},
+		}},
+		{"labels", `{"kernel":"/k","rootfs":"/r","labels":{"bad key":"x","team":"a,b","-team":"x"}}`, []FieldError{
+			{Field: "labels.-team", Message: "name must match " + labelKeyRe.String()},
+			{Field: "labels.bad key", Message: "name must match " + labelKeyRe.String()},
+			{Field: "labels.team", Message: "must match " + labelValueRe.String()},
+		}},
+		{"durations", `{"kernel":"/k","rootfs":"/r","ttl":"soon","idle_timeout":"-5m"}`, []FieldError{
+			{Field: "idle_timeout", Message: "must be a positive duration such as 30m"},
+			{Field: "ttl", Message: "must be a positive duration such as 30m"},
+		}},
+		{"resources", `{"kernel":"/k","rootfs":"/r","resources":{"memory_max_mib":-1,"io_device":"sda"}}`, []FieldError{
+			{Field: "resources.io_device", Message: "must match ^[0-9]+:[0-9]+$"},
+			{Field: "resources.memory_max_mib", Message: "must be at least 0"},
+		}},
+		{"network", `{"kernel":"/k","rootfs":"/r","network":{}}`, []FieldError{
+			{Field: "network.name", Message: "is required"},
+		}},
+		{"fc log level", `{"kernel":"/k","rootfs":"/r","fc_log_level":"verbose"}`, []FieldError{
+			{Field: "fc_log_level", Message: "must be one of " + strings.Join(fcLogLevels, ", ")},
+		}},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/v1/agent/microvms", strings.NewReader(tt.body)))
+		require.Equal(t, http.StatusBadRequest, rec.Code, tt.name)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"), tt.name)
+
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), tt.name)
+		assert.Equal(t, "invalid request body", resp.Error, tt.name)
+		assert.Equal(t, tt.want, resp.Fields, tt.name)
+	}
+
+	// Malformed JSON has no fields to point at
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/v1/agent/microvms", strings.NewReader(`{"kernel":`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Contains(t, resp.Error, "invalid request body: ")
+	assert.Empty(t, resp.Fields)
+}
+
+func TestRequestFieldErrors(t *testing.T) {
+	a := New(&Config{ProcRoot: fakeProc(t, 4, 8192, 8192), AuditLog: "off"})
+	a.microVMs["vm-1"] = &MicroVM{ID: "vm-1", Name: "web"}
+
+	tests := []struct {
+		path string
+		body string
+		want []FieldError
+	}{
+		{"/v1/agent/microvms/web/extend", `{}`, []FieldError{
+			{Field: "ttl", Message: "is required"},
+		}},
+		{"/v1/agent/microvms/web/extend", `{"ttl":"soon"}`, []FieldError{
+			{Field: "ttl", Message: "must be a positive duration such as 30m"},
+		}},
+		{"/v1/agent/microvms/web/extend", `{"ttl":""}`, []FieldError{
+			{Field: "ttl", Message: "must be a positive duration such as 30m"},
+		}},
+		{"/v1/agent/microvms/web/exec", `{"command":"true"}`, []FieldError{
+			{Field: "port", Message: "is required"},
+		}},
+		{"/v1/agent/microvms/web/exec", `{"port":0,"command":"true"}`, []FieldError{
+			{Field: "port", Message: "must be at least 1"},
+		}},
+		{"/v1/agent/tokens", `{"name":"ci/bot","scopes":["read","root"]}`, []FieldError{
+			{Field: "name", Message: "must match " + tokenNameRe.String()},
+			{Field: "scopes[1]", Message: "must be one of read, console, write, proxy, admin"},
+		}},
+		{"/v1/agent/tokens", `{"name":"admin","scopes":[],"selector":"bad key=x"}`, []FieldError{
+			{Field: "name", Message: `"admin" is reserved for the agent's own token`},
+			{Field: "scopes", Message: "must name at least one scope"},
+			{Field: "selector", Message: `invalid selector "bad key=x": bad label key`},
+		}},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+		require.Equal(t, http.StatusBadRequest, rec.Code, "%s %s", tt.path, tt.body)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"), tt.path)
+
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), tt.path)
+		assert.Equal(t, tt.want, resp.Fields, "%s %s", tt.path, tt.body)
+	}
+}
+
+func TestValidateSchemaAccepts(t *testing.T) {
+	var body interface{}
+	dec := json.NewDecoder(strings.NewReader(`{
+		"name": "web",
+		"kernel": "/k",
+		"rootfs": "/r",
+		"vcpus": 2,
+		"memory_mib": 512,
+		"network": {"name": "default"},
+		"labels": {"team": "ci", "ci.example.com/job": "1234", "fc-macos.project": "itest", "empty": ""},
+		"ttl": "30m",
+		"resources": {"cpu_percent": 150, "io_device": "259:0"},
+		"fc_log_level": "debug",
+		"boot_args": null
+	}`))
+	dec.UseNumber()
+	require.NoError(t, dec.Decode(&body))
+
+	assert.Empty(t, validateSchema(specSchemas()["CreateMicroVMRequest"], body, ""))
+}
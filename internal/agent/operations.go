@@ -0,0 +1,321 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/sirupsen/logrus"
+)
+
+// Operation is a create or delete running in the background.
+type Operation = agentclient.Operation
+
+// OperationStep is one stage of an operation.
+type OperationStep = agentclient.OperationStep
+
+// BatchItem is the state of one microVM of a batch create.
+type BatchItem = agentclient.BatchItem
+
+// Operation states.
+const (
+	OperationPending   = agentclient.OperationPending
+	OperationRunning   = agentclient.OperationRunning
+	OperationSucceeded = agentclient.OperationSucceeded
+	OperationFailed    = agentclient.OperationFailed
+	OperationCancelled = agentclient.OperationCancelled
+)
+
+// operationRetention is how long finished operations can still be looked up.
+const operationRetention = time.Hour
+
+// operation is the agent's record of an Operation.
+type operation struct {
+	mu     sync.Mutex
+	op     Operation
+	labels map[string]string  // The microVM's, for tokens with a selector
+	cancel context.CancelFunc // nil if the operation cannot be cancelled
+	done   chan struct{}
+
+	// The Idempotency-Key it was started with, and a hash of the request
+	key         string
+	requestHash string
+}
+
+type operationKey struct{}
+
+// operationFrom returns the operation ctx belongs to, or nil outside one.
+func operationFrom(ctx context.Context) *operation {
+	op, _ := ctx.Value(operationKey{}).(*operation)
+	return op
+}
+
+// step finishes the current step and starts the next. It does nothing on a
+// nil operation, so code shared with synchronous callers can report progress.
+func (o *operation) step(name string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	o.endStep(OperationSucceeded, now)
+	o.op.Steps = append(o.op.Steps, OperationStep{Name: name, Status: OperationRunning, StartedAt: now})
+}
+
+// endStep marks the running step, if any, as finished. Callers must hold o.mu.
+func (o *operation) endStep(status string, now time.Time) {
+	if n := len(o.op.Steps); n > 0 && o.op.Steps[n-1].Status == OperationRunning {
+		o.op.Steps[n-1].Status = status
+		o.op.Steps[n-1].DoneAt = &now
+	}
+}
+
+// setItem records the state of item i of a batch operation.
+func (o *operation) setItem(i int, item BatchItem) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.op.Items[i] = item
+}
+
+// operationStatus is the state of an operation or batch item that ended
+// with err.
+func operationStatus(err error) string {
+	switch {
+	case err == nil:
+		return OperationSucceeded
+	case errors.Is(err, context.Canceled):
+		return OperationCancelled
+	}
+	return OperationFailed
+}
+
+// finish records the outcome of the operation.
+func (o *operation) finish(result *MicroVMInfo, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	status := operationStatus(err)
+	switch status {
+	case OperationCancelled:
+		o.op.Error = "cancelled"
+	case OperationFailed:
+		o.op.Error = err.Error()
+	}
+	o.endStep(status, now)
+	o.op.Status = status
+	o.op.Result = result
+	o.op.DoneAt = &now
+	o.cancel = nil
+	close(o.done)
+}
+
+// snapshot returns a copy of the operation that is safe to encode.
+func (o *operation) snapshot() Operation {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	op := o.op
+	op.Steps = make([]OperationStep, len(o.op.Steps))
+	copy(op.Steps, o.op.Steps)
+	if o.op.Items != nil {
+		op.Items = make([]BatchItem, len(o.op.Items))
+		copy(op.Items, o.op.Items)
+	}
+	return op
+}
+
+// operationStore holds running operations and recently finished ones.
+type operationStore struct {
+	mu      sync.Mutex
+	ops     map[string]*operation
+	byKey   map[string]*operation
+	counter uint64
+}
+
+func newOperationStore() *operationStore {
+	return &operationStore{ops: make(map[string]*operation), byKey: make(map[string]*operation)}
+}
+
+// start runs fn in the background as a new operation on vm. With
+// cancellable, fn's context is cancelled by POST
+// /agent/operations/{id}/cancel, and fn should stop and clean up.
+func (s *operationStore) start(typ string, vm *MicroVM, cancellable bool, fn func(ctx context.Context) (*MicroVMInfo, error)) *operation {
+	return s.launch(s.newOperation(typ, vm), cancellable, fn)
+}
+
+// newOperation returns an operation on vm that has not started yet.
+func (s *operationStore) newOperation(typ string, vm *MicroVM) *operation {
+	return &operation{
+		op: Operation{
+			ID:        fmt.Sprintf("op-%d-%d", time.Now().Unix(), atomic.AddUint64(&s.counter, 1)),
+			Type:      typ,
+			MicroVMID: vm.ID,
+			MicroVM:   vm.Name,
+			Status:    OperationRunning,
+			Steps:     []OperationStep{},
+			CreatedAt: time.Now(),
+		},
+		labels: vm.Labels,
+		done:   make(chan struct{}),
+	}
+}
+
+// launch registers op and runs fn as it, as described for start.
+func (s *operationStore) launch(op *operation, cancellable bool, fn func(ctx context.Context) (*MicroVMInfo, error)) *operation {
+	ctx, cancel := context.WithCancel(context.Background())
+	if cancellable {
+		op.cancel = cancel
+	}
+
+	s.mu.Lock()
+	s.prune(time.Now())
+	s.ops[op.op.ID] = op
+	s.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		result, err := fn(context.WithValue(ctx, operationKey{}, op))
+		if err != nil {
+			logrus.Warnf("Operation %s (%s %s) failed: %v", op.op.ID, op.op.Type, op.op.MicroVM, err)
+		}
+		op.finish(result, err)
+	}()
+	return op
+}
+
+// prune drops operations that finished more than operationRetention ago.
+// Callers must hold s.mu.
+func (s *operationStore) prune(now time.Time) {
+	for id, op := range s.ops {
+		op.mu.Lock()
+		expired := op.op.DoneAt != nil && now.Sub(*op.op.DoneAt) > operationRetention
+		op.mu.Unlock()
+		if expired {
+			delete(s.ops, id)
+			if op.key != "" {
+				delete(s.byKey, op.key)
+			}
+		}
+	}
+}
+
+func (s *operationStore) get(id string) *operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ops[id]
+}
+
+// byIdempotencyKey returns the operation started with key, or nil. Keys are
+// forgotten along with their operation.
+func (s *operationStore) byIdempotencyKey(key string) *operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.byKey[key]
+}
+
+// setIdempotencyKey records that op was started with key for a request whose
+// hash is requestHash.
+func (s *operationStore) setIdempotencyKey(op *operation, key, requestHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op.key = key
+	op.requestHash = requestHash
+	s.byKey[key] = op
+}
+
+// list returns the operations, oldest first.
+func (s *operationStore) list() []*operation {
+	s.mu.Lock()
+	ops := make([]*operation, 0, len(s.ops))
+	for _, op := range s.ops {
+		ops = append(ops, op)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].op.CreatedAt.Before(ops[j].op.CreatedAt)
+	})
+	return ops
+}
+
+// acceptOperation answers a request that started op with 202 Accepted.
+func acceptOperation(w http.ResponseWriter, op *operation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", apiPrefix+"/agent/operations/"+op.op.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(op.snapshot())
+}
+
+// handleOperations serves GET /agent/operations.
+func (a *Agent) handleOperations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := identityFrom(r.Context())
+	ops := []Operation{}
+	for _, op := range a.operations.list() {
+		if id.allows(op.labels) {
+			ops = append(ops, op.snapshot())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ops)
+}
+
+// handleOperationByID serves GET /agent/operations/{id} and POST
+// /agent/operations/{id}/cancel.
+func (a *Agent) handleOperationByID(w http.ResponseWriter, r *http.Request) {
+	opID, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/agent/operations/"), "/")
+
+	op := a.operations.get(opID)
+	if op == nil || !identityFrom(r.Context()).allows(op.labels) {
+		http.Error(w, fmt.Sprintf("operation not found: %s", opID), http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case sub == "" && r.Method == http.MethodGet:
+	case sub == "cancel" && r.Method == http.MethodPost:
+		op.mu.Lock()
+		cancel := op.cancel
+		running := op.op.Status == OperationRunning
+		op.mu.Unlock()
+		if !running {
+			http.Error(w, fmt.Sprintf("operation %s has already finished", opID), http.StatusConflict)
+			return
+		}
+		if cancel == nil {
+			http.Error(w, fmt.Sprintf("%s operations cannot be cancelled", op.op.Type), http.StatusConflict)
+			return
+		}
+		cancel()
+		// Report the outcome if the operation winds down promptly
+		select {
+		case <-op.done:
+		case <-time.After(5 * time.Second):
+		}
+	case sub == "" || sub == "cancel":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(op.snapshot())
+}
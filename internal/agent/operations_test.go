@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationCancel(t *testing.T) {
+	a := New(&Config{ProcRoot: fakeProc(t, 4, 8192, 8192), AuditLog: "off"})
+	vm := &MicroVM{ID: "vm-1", Name: "web"}
+
+	op := a.operations.start("create", vm, true, func(ctx context.Context) (*MicroVMInfo, error) {
+		operationFrom(ctx).step("Starting Firecracker")
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/v1/agent/operations/"+op.op.ID, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got Operation
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, OperationRunning, got.Status)
+	assert.Equal(t, "web", got.MicroVM)
+
+	rec = httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/v1/agent/operations/"+op.op.ID+"/cancel", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, OperationCancelled, got.Status)
+	require.Len(t, got.Steps, 1)
+	assert.Equal(t, OperationCancelled, got.Steps[0].Status)
+	assert.NotNil(t, got.DoneAt)
+
+	// Finished operations cannot be cancelled again
+	rec = httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/v1/agent/operations/"+op.op.ID+"/cancel", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestOperationNotCancellable(t *testing.T) {
+	a := New(&Config{ProcRoot: fakeProc(t, 4, 8192, 8192), AuditLog: "off"})
+	release := make(chan struct{})
+	defer close(release)
+
+	op := a.operations.start("delete", &MicroVM{ID: "vm-1", Name: "web"}, false, func(ctx context.Context) (*MicroVMInfo, error) {
+		<-release
+		return nil, nil
+	})
+
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/v1/agent/operations/"+op.op.ID+"/cancel", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "delete operations cannot be cancelled")
+
+	rec = httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/v1/agent/operations/op-missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestOperationList(t *testing.T) {
+	a := New(&Config{ProcRoot: fakeProc(t, 4, 8192, 8192), AuditLog: "off"})
+
+	failed := a.operations.start("create", &MicroVM{ID: "vm-1", Name: "a"}, true, func(ctx context.Context) (*MicroVMInfo, error) {
+		return nil, errors.New("no kernel")
+	})
+	<-failed.done
+	done := a.operations.start("delete", &MicroVM{ID: "vm-2", Name: "b"}, false, func(ctx context.Context) (*MicroVMInfo, error) {
+		return nil, nil
+	})
+	<-done.done
+
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/v1/agent/operations", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var ops []Operation
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &ops))
+	require.Len(t, ops, 2)
+	assert.Equal(t, OperationFailed, ops[0].Status)
+	assert.Equal(t, "no kernel", ops[0].Error)
+	assert.Equal(t, OperationSucceeded, ops[1].Status)
+
+	// Finished operations are forgotten after a while
+	a.operations.mu.Lock()
+	a.operations.prune(time.Now().Add(operationRetention + time.Minute))
+	a.operations.mu.Unlock()
+	assert.Empty(t, a.operations.list())
+}
+
+func TestBootMicroVMCancelled(t *testing.T) {
+	a, _ := newTestAgent(t)
+	kernel, rootfs := guestImages(t)
+	vm := &MicroVM{
+		ID:         "vm-1",
+		Name:       "web",
+		SocketPath: t.TempDir() + "/fc.socket",
+		Config:     &MicroVMConfig{VCPUs: 1, MemoryMiB: 128, Kernel: kernel, Rootfs: rootfs},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := a.bootMicroVM(ctx, vm, nil, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, a.getVMByIDOrName("web"))
+	assert.Nil(t, vm.fcProcess)
+}
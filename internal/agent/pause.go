@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// handleVMPause serves POST /agent/microvms/{id}/pause and .../resume.
+// Pausing a paused microVM, or resuming a running one, changes nothing.
+func (a *Agent) handleVMPause(w http.ResponseWriter, r *http.Request, vm *MicroVM, pause bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The Firecracker call is made without vm.mu, so that listing and the
+	// reaper don't wait on a slow socket; pausing keeps clones and other
+	// pauses out meanwhile
+	vm.mu.Lock()
+	switch {
+	case !vm.started:
+		vm.mu.Unlock()
+		http.Error(w, "microVM not running", http.StatusServiceUnavailable)
+		return
+	case vm.cloning:
+		vm.mu.Unlock()
+		http.Error(w, fmt.Sprintf("microVM %s is being cloned", vm.Name), http.StatusConflict)
+		return
+	case vm.pausing:
+		vm.mu.Unlock()
+		http.Error(w, fmt.Sprintf("microVM %s is already being paused or resumed", vm.Name), http.StatusConflict)
+		return
+	}
+	change, starts := vm.paused != pause, vm.starts
+	vm.pausing = change
+	vm.mu.Unlock()
+
+	if change {
+		fc := firecrackerFor(vm)
+		call, verb := fc.ResumeInstance, "resume"
+		if pause {
+			call, verb = fc.PauseInstance, "pause"
+		}
+		err := call(r.Context())
+
+		vm.mu.Lock()
+		vm.pausing = false
+		// Firecracker may have exited or been restarted meanwhile
+		if err == nil && vm.started && vm.starts == starts {
+			vm.paused = pause
+		}
+		vm.mu.Unlock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to %s microVM: %v", verb, err), http.StatusBadGateway)
+			return
+		}
+		logrus.Infof("MicroVM %s %sd", vm.Name, verb)
+	}
+
+	vm.mu.Lock()
+	vm.touch()
+	info := vm.info()
+	vm.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anthropics/fc-macos/internal/fctest"
+)
+
+func TestPauseResumeMicroVM(t *testing.T) {
+	a, srv := newTestAgent(t)
+	kernel, rootfs := guestImages(t)
+
+	op := waitOperation(t, srv.URL, postJSON(t, srv.URL+"/agent/microvms", CreateMicroVMRequest{
+		Name: "web", Kernel: kernel, Rootfs: rootfs, Vsock: true,
+	}))
+	require.Equal(t, OperationSucceeded, op.Status, op.Error)
+	vm := a.getVMByIDOrName("web")
+
+	post := func(sub string) (int, MicroVMInfo) {
+		t.Helper()
+		resp := postJSON(t, srv.URL+"/agent/microvms/web/"+sub, nil)
+		defer resp.Body.Close()
+		var info MicroVMInfo
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+		}
+		return resp.StatusCode, info
+	}
+
+	status, info := post("pause")
+	require.Equal(t, http.StatusOK, status)
+	assert.True(t, info.Paused)
+	assert.True(t, info.Running)
+	assert.Equal(t, fctest.Paused, firecrackerState(t, vm))
+
+	// Pausing again changes nothing
+	status, info = post("pause")
+	require.Equal(t, http.StatusOK, status)
+	assert.True(t, info.Paused)
+
+	// A paused guest cannot run commands
+	resp := postJSON(t, srv.URL+"/agent/microvms/web/exec", ExecRequest{Port: 52, Command: "true"})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Cloning a paused microVM leaves it paused
+	op = waitOperation(t, srv.URL, postJSON(t, srv.URL+"/agent/microvms/web/clone", CloneMicroVMRequest{Name: "web-copy"}))
+	require.Equal(t, OperationSucceeded, op.Status, op.Error)
+	for _, step := range op.Steps {
+		assert.NotEqual(t, "Pausing web", step.Name)
+	}
+	assert.Equal(t, fctest.Paused, firecrackerState(t, vm))
+
+	status, info = post("resume")
+	require.Equal(t, http.StatusOK, status)
+	assert.False(t, info.Paused)
+	assert.Equal(t, fctest.Running, firecrackerState(t, vm))
+
+	// Stopped microVMs cannot be paused
+	require.NoError(t, a.stopFirecrackerForVM(vm))
+	status, _ = post("pause")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestPauseDoesNotHoldLock(t *testing.T) {
+	a, srv := newTestAgent(t)
+
+	// A Firecracker whose pause hangs until released
+	release := make(chan struct{})
+	socket := filepath.Join(t.TempDir(), "fc.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	fc := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go fc.Serve(l)
+	t.Cleanup(func() { fc.Close() })
+
+	vm := &MicroVM{ID: "vm-1", Name: "web", SocketPath: socket, Config: &MicroVMConfig{}, started: true}
+	a.microVMs[vm.ID] = vm
+
+	done := make(chan int)
+	go func() {
+		resp := postJSON(t, srv.URL+"/agent/microvms/web/pause", nil)
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	require.Eventually(t, func() bool {
+		vm.mu.Lock()
+		defer vm.mu.Unlock()
+		return vm.pausing
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Listing doesn't wait for Firecracker
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get(srv.URL + "/agent/microvms")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Nor do other pauses and clones, which are refused meanwhile
+	resp = postJSON(t, srv.URL+"/agent/microvms/web/resume", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp = postJSON(t, srv.URL+"/agent/microvms/web/clone", CloneMicroVMRequest{Name: "web-copy"})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	vm.mu.Lock()
+	assert.True(t, vm.paused)
+	assert.False(t, vm.pausing)
+	vm.mu.Unlock()
+}
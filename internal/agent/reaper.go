@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/sirupsen/logrus"
+)
+
+// ExtendRequest is the request body for extending a microVM's lifetime.
+type ExtendRequest = agentclient.ExtendRequest
+
+// touch records console or vsock activity, resetting the idle timer.
+func (vm *MicroVM) touch() {
+	vm.lastActivity.Store(time.Now().UnixNano())
+}
+
+// lastActive returns when the microVM last saw console or vsock activity.
+func (vm *MicroVM) lastActive() time.Time {
+	return time.Unix(0, vm.lastActivity.Load())
+}
+
+// expiryReason returns why the microVM should be reaped at now, or "" if it
+// should keep running. Callers must hold vm.mu.
+func (vm *MicroVM) expiryReason(now time.Time) string {
+	if vm.ExpiresAt != nil && !now.Before(*vm.ExpiresAt) {
+		return fmt.Sprintf("ttl expired at %s", vm.ExpiresAt.Format(time.RFC3339))
+	}
+	if vm.IdleTimeout > 0 {
+		if idle := now.Sub(vm.lastActive()); idle >= vm.IdleTimeout {
+			return fmt.Sprintf("idle for %s (timeout %s)", idle.Round(time.Second), vm.IdleTimeout)
+		}
+	}
+	return ""
+}
+
+// runReaper periodically stops microVMs whose TTL or idle timeout has passed.
+func (a *Agent) runReaper(ctx context.Context) {
+	ticker := time.NewTicker(a.config.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.reapExpired(now)
+		}
+	}
+}
+
+// reapExpired stops every microVM that has expired at now and returns how
+// many were stopped.
+func (a *Agent) reapExpired(now time.Time) int {
+	type expired struct {
+		vm     *MicroVM
+		reason string
+	}
+
+	var victims []expired
+	a.vmMu.RLock()
+	for _, vm := range a.microVMs {
+		vm.mu.Lock()
+		reason := vm.expiryReason(now)
+		vm.mu.Unlock()
+		if reason != "" {
+			victims = append(victims, expired{vm: vm, reason: reason})
+		}
+	}
+	a.vmMu.RUnlock()
+
+	for _, v := range victims {
+		logrus.Infof("microVM %s (%s) expired: %s; stopping", v.vm.Name, v.vm.ID, v.reason)
+		if err := a.removeMicroVM(v.vm, false); err != nil {
+			logrus.Errorf("Failed to stop expired microVM %s: %v", v.vm.Name, err)
+		}
+	}
+	return len(victims)
+}
+
+func (a *Agent) handleVMExtend(w http.ResponseWriter, r *http.Request, vm *MicroVM) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ExtendRequest
+	if !decodeRequest(w, r, "ExtendRequest", &req) {
+		return
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil || ttl <= 0 {
+		writeFieldErrors(w, FieldError{Field: "ttl", Message: "must be a positive duration such as 30m"})
+		return
+	}
+
+	now := time.Now()
+	vm.mu.Lock()
+	base := now
+	if vm.ExpiresAt != nil && vm.ExpiresAt.After(now) {
+		base = *vm.ExpiresAt
+	}
+	expiresAt := base.Add(ttl)
+	vm.ExpiresAt = &expiresAt
+	vm.touch()
+	info := vm.info()
+	vm.mu.Unlock()
+
+	logrus.Infof("Extended microVM %s until %s", vm.Name, expiresAt.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiryReason(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	vm := &MicroVM{}
+	vm.touch()
+	assert.Empty(t, vm.expiryReason(now), "no limits set")
+
+	vm.ExpiresAt = &future
+	assert.Empty(t, vm.expiryReason(now))
+
+	vm.ExpiresAt = &past
+	assert.Contains(t, vm.expiryReason(now), "ttl expired")
+
+	vm.ExpiresAt = nil
+	vm.IdleTimeout = 30 * time.Second
+	assert.Empty(t, vm.expiryReason(now))
+	assert.Contains(t, vm.expiryReason(now.Add(time.Minute)), "idle for")
+}
+
+func TestReapExpired(t *testing.T) {
+	a := New(&Config{})
+	past := time.Now().Add(-time.Second)
+
+	expired := &MicroVM{ID: "vm-1", Name: "old", ExpiresAt: &past}
+	idle := &MicroVM{ID: "vm-2", Name: "idle", IdleTimeout: time.Minute}
+	idle.lastActivity.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	active := &MicroVM{ID: "vm-3", Name: "active", IdleTimeout: time.Minute}
+	active.touch()
+
+	a.microVMs[expired.ID] = expired
+	a.microVMs[idle.ID] = idle
+	a.microVMs[active.ID] = active
+
+	assert.Equal(t, 2, a.reapExpired(time.Now()))
+	assert.Len(t, a.microVMs, 1)
+	assert.Contains(t, a.microVMs, "vm-3")
+}
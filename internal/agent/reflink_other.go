@@ -0,0 +1,13 @@
+//go:build !linux
+
+package agent
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink is only implemented on Linux, where the agent runs.
+func reflink(dst, src *os.File) error {
+	return errors.ErrUnsupported
+}
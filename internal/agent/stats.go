@@ -0,0 +1,274 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+)
+
+// statsInterval is how often microVM resource usage is sampled. It is also
+// the resolution of the finest tier in the history.
+const statsInterval = time.Second
+
+// statsTiers are the resolutions resource history is kept at, finest first.
+// Each tier is averaged down from the one before it.
+var statsTiers = []struct {
+	step time.Duration
+	keep int
+}{
+	{time.Second, 600},  // 10 minutes
+	{time.Minute, 1440}, // 24 hours
+	{time.Hour, 168},    // 7 days
+}
+
+// StatsSample is a microVM's resource usage at one point in its history.
+type StatsSample = agentclient.StatsSample
+
+// StatsResponse is the JSON response for GET /agent/microvms/{id}/stats.
+type StatsResponse = agentclient.MicroVMStats
+
+// statsRing is a fixed-size buffer of samples, overwriting the oldest.
+type statsRing struct {
+	buf  []StatsSample
+	next int
+	full bool
+}
+
+func (r *statsRing) push(s StatsSample) {
+	r.buf[r.next] = s
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// since returns the samples at or after t, oldest first.
+func (r *statsRing) since(t time.Time) []StatsSample {
+	var ordered []StatsSample
+	if r.full {
+		ordered = append(ordered, r.buf[r.next:]...)
+	}
+	ordered = append(ordered, r.buf[:r.next]...)
+
+	for i, s := range ordered {
+		if !s.Time.Before(t) {
+			return ordered[i:]
+		}
+	}
+	return nil
+}
+
+// statsRollup averages the samples falling in one step-aligned bucket.
+type statsRollup struct {
+	step  time.Duration
+	start time.Time
+	sum   StatsSample
+	n     int
+}
+
+// add folds s into the current bucket. When s belongs to a later bucket, the
+// finished one is returned.
+func (b *statsRollup) add(s StatsSample) (StatsSample, bool) {
+	start := s.Time.Truncate(b.step)
+	var done StatsSample
+	finished := false
+	if b.n > 0 && !start.Equal(b.start) {
+		done, finished = b.flush(), true
+	}
+	if b.n == 0 {
+		b.start = start
+		b.sum = StatsSample{}
+	}
+	b.sum.CPUPercent += s.CPUPercent
+	b.sum.MemoryBytes += s.MemoryBytes
+	// Counters are cumulative, so the latest value stands for the bucket
+	b.sum.BlockReadBytes = s.BlockReadBytes
+	b.sum.BlockWriteBytes = s.BlockWriteBytes
+	b.sum.NetRxBytes = s.NetRxBytes
+	b.sum.NetTxBytes = s.NetTxBytes
+	b.n++
+	return done, finished
+}
+
+func (b *statsRollup) flush() StatsSample {
+	out := b.sum
+	out.Time = b.start
+	out.CPUPercent /= float64(b.n)
+	out.MemoryBytes /= int64(b.n)
+	b.n = 0
+	return out
+}
+
+// statsHistory is one microVM's resource usage at each of statsTiers.
+type statsHistory struct {
+	mu      sync.Mutex
+	rings   []*statsRing
+	rollups []*statsRollup // rollups[i] feeds rings[i+1]
+
+	// Previous CPU reading, for turning CPU seconds into a percentage
+	prevCPU float64
+	prevAt  time.Time
+}
+
+func newStatsHistory() *statsHistory {
+	h := &statsHistory{}
+	for i, t := range statsTiers {
+		h.rings = append(h.rings, &statsRing{buf: make([]StatsSample, t.keep)})
+		if i > 0 {
+			h.rollups = append(h.rollups, &statsRollup{step: t.step})
+		}
+	}
+	return h
+}
+
+// add records a raw sample in the finest tier and rolls it up into the
+// coarser ones.
+func (h *statsHistory) add(s StatsSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.rings[0].push(s)
+	for i, r := range h.rollups {
+		done, ok := r.add(s)
+		if !ok {
+			return
+		}
+		h.rings[i+1].push(done)
+		s = done
+	}
+}
+
+// cpuPercent converts a cumulative CPU seconds reading taken at now into
+// usage since the previous reading.
+func (h *statsHistory) cpuPercent(cpuSeconds float64, now time.Time) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var pct float64
+	if !h.prevAt.IsZero() && cpuSeconds >= h.prevCPU {
+		if elapsed := now.Sub(h.prevAt).Seconds(); elapsed > 0 {
+			pct = (cpuSeconds - h.prevCPU) / elapsed * 100
+		}
+	}
+	h.prevCPU, h.prevAt = cpuSeconds, now
+	return pct
+}
+
+// query returns the samples covering the last rng before now, from the
+// finest tier that spans it.
+func (h *statsHistory) query(rng time.Duration, now time.Time) (time.Duration, []StatsSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tier := len(statsTiers) - 1
+	for i, t := range statsTiers {
+		if time.Duration(t.keep)*t.step >= rng {
+			tier = i
+			break
+		}
+	}
+	samples := h.rings[tier].since(now.Add(-rng))
+	if samples == nil {
+		samples = []StatsSample{}
+	}
+	return statsTiers[tier].step, samples
+}
+
+// maxStatsRange is the longest history kept.
+func maxStatsRange() time.Duration {
+	last := statsTiers[len(statsTiers)-1]
+	return time.Duration(last.keep) * last.step
+}
+
+// runStatsCollector samples every running microVM's resource usage.
+func (a *Agent) runStatsCollector(ctx context.Context) {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.collectStats(now)
+		}
+	}
+}
+
+// collectStats records one sample for each running microVM. It reads /proc
+// and the metrics FIFO totals rather than forking ps.
+func (a *Agent) collectStats(now time.Time) {
+	a.vmMu.RLock()
+	vms := make([]*MicroVM, 0, len(a.microVMs))
+	for _, vm := range a.microVMs {
+		vms = append(vms, vm)
+	}
+	a.vmMu.RUnlock()
+
+	for _, vm := range vms {
+		vm.mu.Lock()
+		pid := 0
+		if vm.started && vm.fcProcess != nil && vm.fcProcess.Process != nil {
+			pid = vm.fcProcess.Process.Pid
+		}
+		if vm.stats == nil {
+			vm.stats = newStatsHistory()
+		}
+		history, counters := vm.stats, vm.fcMetrics
+		vm.mu.Unlock()
+		if pid == 0 {
+			continue
+		}
+
+		cpuSeconds, rss, err := procStats(a.config.ProcRoot, pid)
+		if err != nil {
+			continue
+		}
+		history.add(StatsSample{
+			Time:            now,
+			CPUPercent:      history.cpuPercent(cpuSeconds, now),
+			MemoryBytes:     rss,
+			BlockReadBytes:  int64(counters.get("block", "read_bytes")),
+			BlockWriteBytes: int64(counters.get("block", "write_bytes")),
+			NetRxBytes:      int64(counters.get("net", "rx_bytes_count")),
+			NetTxBytes:      int64(counters.get("net", "tx_bytes_count")),
+		})
+	}
+}
+
+// handleVMStats serves vm's resource history for ?range= (default 1h).
+func (a *Agent) handleVMStats(w http.ResponseWriter, r *http.Request, vm *MicroVM) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rng := time.Hour
+	if s := r.URL.Query().Get("range"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 || d > maxStatsRange() {
+			http.Error(w, fmt.Sprintf("invalid range %q (want a duration up to %s)", s, maxStatsRange()), http.StatusBadRequest)
+			return
+		}
+		rng = d
+	}
+
+	vm.mu.Lock()
+	history := vm.stats
+	vm.mu.Unlock()
+
+	resp := StatsResponse{ID: vm.ID, Name: vm.Name, Range: rng.String(), Samples: []StatsSample{}}
+	step := statsTiers[0].step
+	if history != nil {
+		step, resp.Samples = history.query(rng, time.Now())
+	}
+	resp.Step = step.String()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
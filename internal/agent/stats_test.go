@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsRingWraps(t *testing.T) {
+	r := &statsRing{buf: make([]StatsSample, 3)}
+	start := time.Unix(1000, 0)
+	for i := 0; i < 5; i++ {
+		r.push(StatsSample{Time: start.Add(time.Duration(i) * time.Second), MemoryBytes: int64(i)})
+	}
+
+	all := r.since(time.Time{})
+	require.Len(t, all, 3)
+	assert.Equal(t, []int64{2, 3, 4}, []int64{all[0].MemoryBytes, all[1].MemoryBytes, all[2].MemoryBytes})
+
+	assert.Len(t, r.since(start.Add(4*time.Second)), 1)
+	assert.Nil(t, r.since(start.Add(time.Minute)))
+}
+
+func TestStatsHistoryRollsUp(t *testing.T) {
+	h := newStatsHistory()
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Two minutes of samples: CPU 10% then 30%, memory growing
+	for i := 0; i < 120; i++ {
+		cpu := 10.0
+		if i >= 60 {
+			cpu = 30
+		}
+		h.add(StatsSample{
+			Time:           start.Add(time.Duration(i) * time.Second),
+			CPUPercent:     cpu,
+			MemoryBytes:    100,
+			BlockReadBytes: int64(i),
+		})
+	}
+	// The first sample of the third minute closes the second
+	h.add(StatsSample{Time: start.Add(2 * time.Minute)})
+
+	now := start.Add(2 * time.Minute)
+	step, samples := h.query(5*time.Minute, now)
+	assert.Equal(t, time.Second, step)
+	assert.Len(t, samples, 121)
+
+	step, samples = h.query(time.Hour, now)
+	assert.Equal(t, time.Minute, step)
+	require.Len(t, samples, 2)
+	assert.Equal(t, start, samples[0].Time)
+	assert.InDelta(t, 10, samples[0].CPUPercent, 0.001)
+	assert.InDelta(t, 30, samples[1].CPUPercent, 0.001)
+	assert.Equal(t, int64(100), samples[1].MemoryBytes)
+	assert.Equal(t, int64(119), samples[1].BlockReadBytes, "counters keep their latest value")
+
+	step, samples = h.query(48*time.Hour, now)
+	assert.Equal(t, time.Hour, step)
+	assert.Empty(t, samples, "the first hour is still open")
+}
+
+func TestStatsHistoryCPUPercent(t *testing.T) {
+	h := newStatsHistory()
+	now := time.Unix(1000, 0)
+	assert.Equal(t, 0.0, h.cpuPercent(10, now), "no previous reading")
+	assert.InDelta(t, 50, h.cpuPercent(11, now.Add(2*time.Second)), 0.001)
+}
+
+func TestCollectStatsAndHandleVMStats(t *testing.T) {
+	proc := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(proc, "42"), 0755))
+	writeStat := func(utime int) {
+		stat := fmt.Sprintf("42 (firecracker) S 1 42 42 0 -1 4194560 100 0 0 0 %d 0 0 0 20 0 3 0 1000 123456789 256 18446744073709551615", utime)
+		require.NoError(t, os.WriteFile(filepath.Join(proc, "42", "stat"), []byte(stat), 0644))
+	}
+
+	a := New(&Config{ProcRoot: proc, AuditLog: "off"})
+	vm := &MicroVM{ID: "vm-1", Name: "worker", started: true, fcProcess: &exec.Cmd{Process: &os.Process{Pid: 42}}}
+	vm.fcMetrics = newFCCounters()
+	vm.fcMetrics.read(strings.NewReader(`{"block":{"read_bytes":4096},"net":{"rx_bytes_count":512}}`+"\n"), vm.Name)
+	a.microVMs[vm.ID] = vm
+
+	now := time.Now()
+	writeStat(100)
+	a.collectStats(now.Add(-2 * time.Second))
+	writeStat(200) // One CPU second later
+	a.collectStats(now.Add(-time.Second))
+
+	rec := httptest.NewRecorder()
+	a.handleVMStats(rec, httptest.NewRequest("GET", "/agent/microvms/vm-1/stats?range=1m", nil), vm)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp StatsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "worker", resp.Name)
+	assert.Equal(t, "1s", resp.Step)
+	require.Len(t, resp.Samples, 2)
+	last := resp.Samples[1]
+	assert.InDelta(t, 100, last.CPUPercent, 0.001)
+	assert.Equal(t, int64(256*os.Getpagesize()), last.MemoryBytes)
+	assert.Equal(t, int64(4096), last.BlockReadBytes)
+	assert.Equal(t, int64(512), last.NetRxBytes)
+
+	rec = httptest.NewRecorder()
+	a.handleVMStats(rec, httptest.NewRequest("GET", "/agent/microvms/vm-1/stats?range=30d", nil), vm)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,359 @@
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Scopes a token can be granted.
+const (
+	ScopeRead    = "read"    // List and inspect microVMs and capacity
+	ScopeConsole = "console" // Attach to consoles and exec into microVMs
+	ScopeWrite   = "write"   // Create, stop and extend microVMs
+	ScopeProxy   = "proxy"   // Raw Firecracker API
+	ScopeAdmin   = "admin"   // Manage tokens; implies every other scope
+)
+
+var validScopes = map[string]bool{
+	ScopeRead:    true,
+	ScopeConsole: true,
+	ScopeWrite:   true,
+	ScopeProxy:   true,
+	ScopeAdmin:   true,
+}
+
+// adminTokenName identifies the token given with -token-file.
+const adminTokenName = "admin"
+
+var tokenNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+
+// APIToken describes a named token. The secret itself is only returned once,
+// when the token is created.
+type APIToken struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	Selector  string    `json:"selector,omitempty"` // Label selector limiting which microVMs it may touch
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateTokenRequest is the request body for creating a token.
+type CreateTokenRequest struct {
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	Selector string   `json:"selector,omitempty"`
+}
+
+// CreateTokenResponse carries the new token's secret.
+type CreateTokenResponse struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+// storedToken is the on-disk form of a token; only a hash of the secret is kept.
+type storedToken struct {
+	APIToken
+	Hash string `json:"hash"`
+}
+
+// identity is the caller a request was authenticated as.
+type identity struct {
+	Name     string
+	scopes   map[string]bool
+	selector LabelSelector
+}
+
+func adminIdentity() *identity {
+	return &identity{Name: adminTokenName, scopes: map[string]bool{ScopeAdmin: true}}
+}
+
+func (t *storedToken) identity() *identity {
+	id := &identity{Name: t.Name, scopes: make(map[string]bool)}
+	for _, s := range t.Scopes {
+		id.scopes[s] = true
+	}
+	// Validated on create
+	id.selector, _ = ParseSelector(t.Selector)
+	return id
+}
+
+// can reports whether the identity holds scope. A nil identity (auth
+// disabled) can do anything.
+func (id *identity) can(scope string) bool {
+	return id == nil || id.scopes[ScopeAdmin] || id.scopes[scope]
+}
+
+// restricted reports whether the identity is limited to some microVMs.
+func (id *identity) restricted() bool {
+	return id != nil && len(id.selector) > 0
+}
+
+// allows reports whether the identity may act on a microVM with labels.
+func (id *identity) allows(labels map[string]string) bool {
+	return !id.restricted() || id.selector.Matches(labels)
+}
+
+// tokenStore holds named tokens, persisted as JSON so they survive restarts.
+type tokenStore struct {
+	path    string // Empty keeps tokens in memory only
+	mu      sync.RWMutex
+	tokens  map[string]*storedToken
+	loadErr error // Set if the file could not be read; changes are refused
+}
+
+func newTokenStore(path string) *tokenStore {
+	s := &tokenStore{path: path, tokens: make(map[string]*storedToken)}
+	if path == "" {
+		return s
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s
+	}
+	if err == nil {
+		var tokens []*storedToken
+		if err = json.Unmarshal(data, &tokens); err == nil {
+			for _, t := range tokens {
+				s.tokens[t.Name] = t
+			}
+			return s
+		}
+	}
+
+	s.loadErr = fmt.Errorf("failed to load tokens from %s: %w", path, err)
+	logrus.Errorf("%v; named tokens are disabled", s.loadErr)
+	return s
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the token whose secret is presented, or nil.
+func (s *tokenStore) lookup(secret string) *storedToken {
+	want := []byte(hashToken(secret))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found *storedToken
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), want) == 1 {
+			found = t
+		}
+	}
+	return found
+}
+
+func (s *tokenStore) list() []APIToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]APIToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t.APIToken)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Name < tokens[j].Name
+	})
+	return tokens
+}
+
+// create adds a token and returns its secret.
+func (s *tokenStore) create(req *CreateTokenRequest) (*CreateTokenResponse, error) {
+	if s.loadErr != nil {
+		return nil, s.loadErr
+	}
+	if !tokenNameRe.MatchString(req.Name) || req.Name == adminTokenName {
+		return nil, fmt.Errorf("invalid token name %q", req.Name)
+	}
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := make(map[string]bool)
+	for _, scope := range req.Scopes {
+		if !validScopes[scope] {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	selector, err := ParseSelector(req.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret := hex.EncodeToString(buf)
+
+	t := &storedToken{
+		APIToken: APIToken{
+			Name:      req.Name,
+			Scopes:    scopes,
+			Selector:  selector.String(),
+			CreatedAt: time.Now().UTC(),
+		},
+		Hash: hashToken(secret),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tokens[t.Name]; exists {
+		return nil, errTokenExists
+	}
+	s.tokens[t.Name] = t
+	if err := s.saveLocked(); err != nil {
+		delete(s.tokens, t.Name)
+		return nil, err
+	}
+	return &CreateTokenResponse{APIToken: t.APIToken, Token: secret}, nil
+}
+
+var (
+	errTokenExists   = errors.New("token already exists")
+	errTokenNotFound = errors.New("token not found")
+)
+
+func (s *tokenStore) revoke(name string) error {
+	if s.loadErr != nil {
+		return s.loadErr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[name]
+	if !ok {
+		return errTokenNotFound
+	}
+	delete(s.tokens, name)
+	if err := s.saveLocked(); err != nil {
+		s.tokens[name] = t
+		return err
+	}
+	return nil
+}
+
+// saveLocked writes the store atomically. Callers hold s.mu.
+func (s *tokenStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	tokens := make([]*storedToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Name < tokens[j].Name
+	})
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	return nil
+}
+
+// ==================== Token Handlers ====================
+
+func (a *Agent) handleTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.tokens.list())
+	case http.MethodPost:
+		var req CreateTokenRequest
+		if !decodeRequest(w, r, "CreateTokenRequest", &req) {
+			return
+		}
+		var errs []FieldError
+		if req.Name == adminTokenName {
+			errs = append(errs, FieldError{Field: "name", Message: fmt.Sprintf("%q is reserved for the agent's own token", adminTokenName)})
+		}
+		if len(req.Scopes) == 0 {
+			errs = append(errs, FieldError{Field: "scopes", Message: "must name at least one scope"})
+		}
+		if _, err := ParseSelector(req.Selector); err != nil {
+			errs = append(errs, FieldError{Field: "selector", Message: err.Error()})
+		}
+		if len(errs) > 0 {
+			writeFieldErrors(w, errs...)
+			return
+		}
+		resp, err := a.tokens.create(&req)
+		switch {
+		case errors.Is(err, errTokenExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil && a.tokens.loadErr != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logrus.Infof("Created token %s (scopes: %s)", resp.Name, strings.Join(resp.Scopes, ","))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *Agent) handleTokenByName(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/agent/tokens/")
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := a.tokens.revoke(name); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errTokenNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	logrus.Infof("Revoked token %s", name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "revoked", "name": name})
+}
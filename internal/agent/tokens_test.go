@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenStoreLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s := newTokenStore(path)
+
+	resp, err := s.create(&CreateTokenRequest{Name: "ci", Scopes: []string{"write", "read", "read"}, Selector: "team=ci"})
+	require.NoError(t, err)
+	assert.Len(t, resp.Token, 64)
+	assert.Equal(t, []string{"read", "write"}, resp.Scopes)
+	assert.Equal(t, "ci", s.lookup(resp.Token).Name)
+	assert.Nil(t, s.lookup("nope"))
+
+	_, err = s.create(&CreateTokenRequest{Name: "ci", Scopes: []string{"read"}})
+	assert.ErrorIs(t, err, errTokenExists)
+
+	// Tokens survive a restart; only the hash is stored
+	reloaded := newTokenStore(path)
+	require.Len(t, reloaded.list(), 1)
+	assert.Equal(t, "team=ci", reloaded.list()[0].Selector)
+	assert.NotNil(t, reloaded.lookup(resp.Token))
+	assert.NotContains(t, readFile(t, path), resp.Token)
+
+	require.NoError(t, reloaded.revoke("ci"))
+	assert.ErrorIs(t, reloaded.revoke("ci"), errTokenNotFound)
+	assert.Empty(t, newTokenStore(path).list())
+}
+
+func TestTokenStoreValidation(t *testing.T) {
+	s := newTokenStore("")
+
+	for _, req := range []CreateTokenRequest{
+		{Name: "", Scopes: []string{"read"}},
+		{Name: "admin", Scopes: []string{"read"}},
+		{Name: "ci", Scopes: nil},
+		{Name: "ci", Scopes: []string{"root"}},
+		{Name: "ci", Scopes: []string{"read"}, Selector: "bad key=x"},
+	} {
+		_, err := s.create(&req)
+		assert.Error(t, err, "%+v", req)
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path, want string
+	}{
+		{"GET", "/agent/microvms", ScopeRead},
+		{"POST", "/agent/microvms", ScopeWrite},
+		{"POST", "/agent/microvms:batch", ScopeWrite},
+		{"GET", "/agent/microvms/vm-1", ScopeRead},
+		{"DELETE", "/agent/microvms/vm-1", ScopeWrite},
+		{"GET", "/agent/microvms/vm-1/console", ScopeConsole},
+		{"POST", "/agent/microvms/vm-1/exec", ScopeConsole},
+		{"POST", "/agent/microvms/vm-1/extend", ScopeWrite},
+		{"POST", "/agent/microvms/vm-1/clone", ScopeWrite},
+		{"POST", "/agent/microvms/vm-1/pause", ScopeWrite},
+		{"POST", "/agent/microvms/vm-1/swap-drive", ScopeWrite},
+		{"GET", "/agent/microvms/vm-1/firecracker-logs", ScopeRead},
+		{"GET", "/agent/microvms/vm-1/stats", ScopeRead},
+		{"PUT", "/agent/microvms/vm-1/drives/rootfs", ScopeProxy},
+		{"GET", "/agent/capacity", ScopeRead},
+		{"GET", "/agent/stats", ScopeRead},
+		{"GET", "/agent/operations/op-1", ScopeRead},
+		{"POST", "/agent/operations/op-1/cancel", ScopeWrite},
+		{"POST", "/agent/tokens", ScopeAdmin},
+		{"GET", "/version", ScopeRead},
+		{"GET", "/agent/metrics", ScopeRead},
+		{"GET", "/metrics", ScopeProxy},
+		{"PUT", "/machine-config", ScopeProxy},
+		{"GET", "/console", ScopeConsole},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, requiredScope(httptest.NewRequest(tt.method, tt.path, nil)), "%s %s", tt.method, tt.path)
+	}
+}
+
+func TestWithAuthScopes(t *testing.T) {
+	a := New(&Config{AuthToken: "admin-secret", TokenFile: filepath.Join(t.TempDir(), "tokens.json")})
+	a.microVMs["vm-1"] = &MicroVM{ID: "vm-1", Name: "ci-box", Labels: map[string]string{"team": "ci"}}
+	a.microVMs["vm-2"] = &MicroVM{ID: "vm-2", Name: "dev-box", Labels: map[string]string{"team": "dev"}}
+
+	reader, err := a.tokens.create(&CreateTokenRequest{Name: "viewer", Scopes: []string{ScopeRead}})
+	require.NoError(t, err)
+	ci, err := a.tokens.create(&CreateTokenRequest{Name: "ci", Scopes: []string{ScopeRead, ScopeWrite}, Selector: "team=ci"})
+	require.NoError(t, err)
+
+	var seen *identity
+	h := a.withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = identityFrom(r.Context())
+	}))
+
+	tests := []struct {
+		token, method, path string
+		want                int
+	}{
+		{"admin-secret", "POST", "/agent/tokens", http.StatusOK},
+		{reader.Token, "GET", "/agent/microvms", http.StatusOK},
+		{reader.Token, "DELETE", "/agent/microvms/vm-1", http.StatusForbidden},
+		{reader.Token, "GET", "/agent/microvms/vm-1/console", http.StatusForbidden},
+		{reader.Token, "POST", "/agent/tokens", http.StatusForbidden},
+		{ci.Token, "DELETE", "/agent/microvms/ci-box", http.StatusOK},
+		{ci.Token, "DELETE", "/agent/microvms/dev-box", http.StatusForbidden},
+		{ci.Token, "POST", "/agent/stop", http.StatusForbidden},
+		{ci.Token, "GET", "/agent/operations", http.StatusOK},
+		{ci.Token, "GET", "/agent/operations/op-1", http.StatusOK},
+		{ci.Token, "POST", "/agent/operations/op-1/cancel", http.StatusOK},
+		{ci.Token, "POST", "/agent/microvms:batch", http.StatusOK},
+		{"revoked-or-unknown", "GET", "/agent/microvms", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, tt.want, rec.Code, "%s %s", tt.method, tt.path)
+	}
+
+	// Handlers see who called
+	req := httptest.NewRequest("GET", "/agent/microvms", nil)
+	req.Header.Set("Authorization", "Bearer "+ci.Token)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	require.NotNil(t, seen)
+	assert.Equal(t, "ci", seen.Name)
+}
+
+func TestListMicroVMsHonoursTokenSelector(t *testing.T) {
+	a := New(&Config{AuthToken: "admin-secret", TokenFile: filepath.Join(t.TempDir(), "tokens.json")})
+	a.microVMs["vm-1"] = &MicroVM{ID: "vm-1", Name: "ci-box", Labels: map[string]string{"team": "ci"}}
+	a.microVMs["vm-2"] = &MicroVM{ID: "vm-2", Name: "dev-box", Labels: map[string]string{"team": "dev"}}
+
+	ci, err := a.tokens.create(&CreateTokenRequest{Name: "ci", Scopes: []string{ScopeRead}, Selector: "team=ci"})
+	require.NoError(t, err)
+
+	h := a.withAuth(http.HandlerFunc(a.handleMicroVMs))
+	req := httptest.NewRequest("GET", "/agent/microvms", nil)
+	req.Header.Set("Authorization", "Bearer "+ci.Token)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "ci-box")
+	assert.NotContains(t, rec.Body.String(), "dev-box")
+}
+
+func TestWithAuthAmbiguousPrefix(t *testing.T) {
+	a := New(&Config{AuthToken: "admin-secret", TokenFile: filepath.Join(t.TempDir(), "tokens.json")})
+	a.microVMs["vm-100a"] = &MicroVM{ID: "vm-100a", Name: "ci-box", Labels: map[string]string{"team": "ci"}}
+	a.microVMs["vm-100b"] = &MicroVM{ID: "vm-100b", Name: "dev-box", Labels: map[string]string{"team": "dev"}}
+
+	ci, err := a.tokens.create(&CreateTokenRequest{Name: "ci", Scopes: []string{ScopeRead, ScopeWrite}, Selector: "team=ci"})
+	require.NoError(t, err)
+
+	var seen *MicroVM
+	h := a.withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = a.requestVM(r, strings.TrimPrefix(r.URL.Path, "/agent/microvms/"))
+	}))
+	do := func(path string) int {
+		t.Helper()
+		seen = nil
+		req := httptest.NewRequest("DELETE", path, nil)
+		req.Header.Set("Authorization", "Bearer "+ci.Token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Whichever microVM map order puts first, the prefix is refused
+	for range 20 {
+		assert.Equal(t, http.StatusConflict, do("/agent/microvms/vm-100"))
+		assert.Nil(t, seen)
+	}
+
+	// The handler acts on the microVM the token was checked against
+	assert.Equal(t, http.StatusOK, do("/agent/microvms/vm-100a"))
+	require.NotNil(t, seen)
+	assert.Equal(t, "ci-box", seen.Name)
+	assert.Equal(t, http.StatusForbidden, do("/agent/microvms/vm-100b"))
+	assert.Equal(t, http.StatusForbidden, do("/agent/microvms/dev-box"))
+}
+
+func TestOperationsHonourTokenSelector(t *testing.T) {
+	a := New(&Config{AuthToken: "admin-secret", TokenFile: filepath.Join(t.TempDir(), "tokens.json")})
+	ci, err := a.tokens.create(&CreateTokenRequest{Name: "ci", Scopes: []string{ScopeRead, ScopeWrite}, Selector: "team=ci"})
+	require.NoError(t, err)
+
+	block := make(chan struct{})
+	defer close(block)
+	run := func(ctx context.Context) (*MicroVMInfo, error) {
+		select {
+		case <-block:
+		case <-ctx.Done():
+		}
+		return nil, ctx.Err()
+	}
+	ciOp := a.operations.start("create", &MicroVM{Name: "ci-box", Labels: map[string]string{"team": "ci"}}, true, run)
+	devOp := a.operations.start("create", &MicroVM{Name: "dev-box", Labels: map[string]string{"team": "dev"}}, true, run)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agent/operations", a.handleOperations)
+	mux.HandleFunc("/agent/operations/", a.handleOperationByID)
+	mux.HandleFunc("/agent/microvms:batch", a.handleBatchCreate)
+	h := a.withAuth(mux)
+	do := func(method, path string, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+ci.Token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("GET", "/agent/operations", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), ciOp.op.ID)
+	assert.NotContains(t, rec.Body.String(), devOp.op.ID)
+
+	assert.Equal(t, http.StatusOK, do("GET", "/agent/operations/"+ciOp.op.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/agent/operations/"+devOp.op.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("POST", "/agent/operations/"+devOp.op.ID+"/cancel", "").Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/agent/operations/"+ciOp.op.ID+"/cancel", "").Code)
+
+	// Batches are checked against the labels of their template
+	rec = do("POST", "/agent/microvms:batch", `{"name": "dev-{n}", "count": 2, "template": {"kernel": "/k", "rootfs": "/r", "labels": {"team": "dev"}}}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+}
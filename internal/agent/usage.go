@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/anthropics/fc-macos/pkg/api"
+)
+
+// balloonTimeout bounds each balloon query so one wedged Firecracker can't
+// stall the whole usage table.
+const balloonTimeout = time.Second
+
+// MicroVMUsage is one microVM's current resource usage in the
+// GET /agent/stats response.
+type MicroVMUsage = agentclient.MicroVMUsage
+
+// latest returns the most recent raw sample.
+func (h *statsHistory) latest() (StatsSample, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r := h.rings[0]
+	if r.next == 0 && !r.full {
+		return StatsSample{}, false
+	}
+	return r.buf[(r.next-1+len(r.buf))%len(r.buf)], true
+}
+
+// unixClient returns an HTTP client for the Firecracker API on socketPath.
+func unixClient(socketPath string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+		Timeout: timeout,
+	}
+}
+
+// balloonSizes asks vm's Firecracker for its balloon target and actual size.
+func balloonSizes(socketPath string) (target, actual *int64) {
+	client := unixClient(socketPath, balloonTimeout)
+
+	var stats api.BalloonStats
+	if err := getJSON(client, "http://localhost/balloon/statistics", &stats); err == nil {
+		return &stats.TargetMib, &stats.ActualMib
+	}
+	var balloon api.Balloon
+	if err := getJSON(client, "http://localhost/balloon", &balloon); err == nil {
+		return &balloon.AmountMib, nil
+	}
+	return nil, nil
+}
+
+// usage returns vm's current resource usage, from the stats collector's
+// latest sample and the metrics FIFO totals.
+func (a *Agent) usage(vm *MicroVM) MicroVMUsage {
+	vm.mu.Lock()
+	u := MicroVMUsage{ID: vm.ID, Name: vm.Name, Running: vm.started}
+	if vm.Config != nil {
+		u.MemoryMiB = vm.Config.MemoryMiB
+	}
+	history, counters, socketPath := vm.stats, vm.fcMetrics, vm.SocketPath
+	vm.mu.Unlock()
+
+	if !u.Running {
+		return u
+	}
+	if history != nil {
+		if s, ok := history.latest(); ok {
+			u.CPUPercent = s.CPUPercent
+			u.MemoryBytes = s.MemoryBytes
+		}
+	}
+	u.BlockReadBytes = int64(counters.get("block", "read_bytes"))
+	u.BlockWriteBytes = int64(counters.get("block", "write_bytes"))
+	u.NetRxBytes = int64(counters.get("net", "rx_bytes_count"))
+	u.NetTxBytes = int64(counters.get("net", "tx_bytes_count"))
+	u.BalloonTargetMiB, u.BalloonActualMiB = balloonSizes(socketPath)
+	return u
+}
+
+// handleStats serves the current resource usage of every microVM the caller
+// can see, optionally narrowed by ?selector=.
+func (a *Agent) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	selector, err := ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := identityFrom(r.Context())
+
+	a.vmMu.RLock()
+	var vms []*MicroVM
+	for _, vm := range a.microVMs {
+		if selector.Matches(vm.Labels) && id.allows(vm.Labels) {
+			vms = append(vms, vm)
+		}
+	}
+	a.vmMu.RUnlock()
+
+	usage := make([]MicroVMUsage, 0, len(vms))
+	for _, vm := range vms {
+		usage = append(usage, a.usage(vm))
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Name < usage[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// getJSON GETs url and decodes the JSON response into out.
+func getJSON(client *http.Client, url string, out interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBalloonAPI serves Firecracker's balloon endpoints on a unix socket.
+func fakeBalloonAPI(t *testing.T, withStats bool) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "fc.socket")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/balloon/statistics", func(w http.ResponseWriter, r *http.Request) {
+		if !withStats {
+			http.Error(w, `{"fault_message":"Statistics are not enabled"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"target_mib":64,"actual_mib":48,"target_pages":16384,"actual_pages":12288}`))
+	})
+	mux.HandleFunc("/balloon", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"amount_mib":64,"deflate_on_oom":true}`))
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return socket
+}
+
+func TestBalloonSizes(t *testing.T) {
+	target, actual := balloonSizes(fakeBalloonAPI(t, true))
+	require.NotNil(t, target)
+	require.NotNil(t, actual)
+	assert.Equal(t, int64(64), *target)
+	assert.Equal(t, int64(48), *actual)
+
+	target, actual = balloonSizes(fakeBalloonAPI(t, false))
+	require.NotNil(t, target)
+	assert.Equal(t, int64(64), *target)
+	assert.Nil(t, actual)
+
+	target, actual = balloonSizes(filepath.Join(t.TempDir(), "missing.socket"))
+	assert.Nil(t, target)
+	assert.Nil(t, actual)
+}
+
+func TestHandleStats(t *testing.T) {
+	a := New(&Config{AuditLog: "off"})
+
+	web := &MicroVM{
+		ID: "vm-1", Name: "web", Labels: map[string]string{"team": "web"}, started: true,
+		SocketPath: fakeBalloonAPI(t, true),
+		Config:     &MicroVMConfig{MemoryMiB: 256},
+	}
+	web.stats = newStatsHistory()
+	web.stats.add(StatsSample{Time: time.Now(), CPUPercent: 12.5, MemoryBytes: 100 << 20})
+	web.fcMetrics = newFCCounters()
+	web.fcMetrics.read(strings.NewReader(`{"block":{"write_bytes":2048},"net":{"tx_bytes_count":64}}`+"\n"), web.Name)
+	a.microVMs[web.ID] = web
+	a.microVMs["vm-2"] = &MicroVM{ID: "vm-2", Name: "batch", Labels: map[string]string{"team": "ci"}}
+
+	rec := httptest.NewRecorder()
+	a.handleStats(rec, httptest.NewRequest("GET", "/agent/stats", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var usage []MicroVMUsage
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&usage))
+	require.Len(t, usage, 2)
+	assert.Equal(t, "batch", usage[0].Name)
+	assert.False(t, usage[0].Running)
+	assert.Nil(t, usage[0].BalloonTargetMiB)
+
+	u := usage[1]
+	assert.Equal(t, 12.5, u.CPUPercent)
+	assert.Equal(t, int64(100<<20), u.MemoryBytes)
+	assert.Equal(t, 256, u.MemoryMiB)
+	assert.Equal(t, int64(2048), u.BlockWriteBytes)
+	assert.Equal(t, int64(64), u.NetTxBytes)
+	require.NotNil(t, u.BalloonActualMiB)
+	assert.Equal(t, int64(48), *u.BalloonActualMiB)
+
+	rec = httptest.NewRecorder()
+	a.handleStats(rec, httptest.NewRequest("GET", "/agent/stats?selector=team=ci", nil))
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&usage))
+	require.Len(t, usage, 1)
+	assert.Equal(t, "batch", usage[0].Name)
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+)
+
+// APIVersion is the version of the API served under /v1.
+const APIVersion = agentclient.APIVersion
+
+// apiPrefix is where the versioned API is served.
+const apiPrefix = "/" + APIVersion
+
+// VersionInfo is the /version response.
+type VersionInfo = agentclient.VersionInfo
+
+// versionlessPaths are served at the same path whether or not unversioned
+// routes are enabled: probes, Prometheus, version discovery and the API
+// document should not need to know the API version.
+var versionlessPaths = map[string]bool{
+	"/health":        true,
+	"/version":       true,
+	"/openapi.json":  true,
+	"/agent/metrics": true,
+}
+
+// withAPIVersion serves the API under /v1, and at the deprecated unversioned
+// paths unless they are disabled. Everything behind it sees the unversioned
+// path.
+func (a *Agent) withAPIVersion(next http.Handler) http.Handler {
+	versioned := http.StripPrefix(apiPrefix, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+			versioned.ServeHTTP(w, r)
+			return
+		}
+		if versionlessPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.config.DisableUnversionedRoutes {
+			http.Error(w, "Unversioned API routes are disabled; use "+apiPrefix+r.URL.Path, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+apiPrefix+r.URL.Path+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Agent) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VersionInfo{
+		Version:            a.config.Version,
+		APIVersion:         APIVersion,
+		FirecrackerVersion: a.firecrackerVersion(),
+	})
+}
+
+// firecrackerVersion returns the version the Firecracker binary reports, such
+// as "v1.7.0", or "" if it cannot be run. It is only looked up once.
+func (a *Agent) firecrackerVersion() string {
+	a.fcVersionOnce.Do(func() {
+		out, err := exec.Command(a.config.FirecrackerBin, "--version").Output()
+		if err != nil {
+			return
+		}
+		// "Firecracker v1.7.0", possibly followed by more lines
+		line, _, _ := strings.Cut(string(out), "\n")
+		a.fcVersion = strings.TrimSpace(strings.TrimPrefix(line, "Firecracker"))
+	})
+	return a.fcVersion
+}
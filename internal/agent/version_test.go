@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anthropics/fc-macos/internal/fctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIVersionRoutes(t *testing.T) {
+	tests := []struct {
+		path        string
+		unversioned bool // Whether unversioned routes are served
+		want        int
+		deprecated  bool
+	}{
+		{"/v1/agent/capacity", true, http.StatusOK, false},
+		{"/agent/capacity", true, http.StatusOK, true},
+		{"/health", true, http.StatusOK, false},
+		{"/v1/health", true, http.StatusOK, false},
+
+		{"/v1/agent/capacity", false, http.StatusOK, false},
+		{"/agent/capacity", false, http.StatusNotFound, false},
+		{"/agent/microvms/vm-1/console", false, http.StatusNotFound, false},
+		{"/health", false, http.StatusOK, false},
+		{"/version", false, http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		a := New(&Config{
+			ProcRoot:                 fakeProc(t, 4, 8192, 8192),
+			AuditLog:                 "off",
+			DisableUnversionedRoutes: !tt.unversioned,
+		})
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+
+		assert.Equal(t, tt.want, rec.Code, "%s (unversioned routes: %v)", tt.path, tt.unversioned)
+		if tt.deprecated {
+			assert.Equal(t, "true", rec.Header().Get("Deprecation"), tt.path)
+			assert.Equal(t, `</v1`+tt.path+`>; rel="successor-version"`, rec.Header().Get("Link"), tt.path)
+		} else {
+			assert.Empty(t, rec.Header().Get("Deprecation"), tt.path)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	a := New(&Config{FirecrackerBin: fctest.Build(t), AuditLog: "off", Version: "1.2.3"})
+	srv := httptest.NewServer(a.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/version")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var info VersionInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, VersionInfo{Version: "1.2.3", APIVersion: "v1", FirecrackerVersion: "v" + fctest.Version}, info)
+
+	// Clients look for the API version in /health before asking /version
+	resp, err = http.Get(srv.URL + "/health")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var health map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	assert.Equal(t, "v1", health["api_version"])
+}
+
+func TestFirecrackerVersionMissingBinary(t *testing.T) {
+	a := New(&Config{FirecrackerBin: "/nonexistent/firecracker", AuditLog: "off"})
+	assert.Empty(t, a.firecrackerVersion())
+}
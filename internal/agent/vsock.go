@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+)
+
+// Guest CIDs 0-2 are reserved by the vsock specification.
+const firstGuestCID = 3
+
+// ExecRequest is the request body for running a command in a microVM over vsock.
+type ExecRequest = agentclient.ExecRequest
+
+// ExecResponse is the result of a vsock exec.
+type ExecResponse = agentclient.ExecResponse
+
+func (a *Agent) handleVMExec(w http.ResponseWriter, r *http.Request, vm *MicroVM) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ExecRequest
+	if !decodeRequest(w, r, "ExecRequest", &req) {
+		return
+	}
+	if req.TimeoutSeconds == 0 {
+		req.TimeoutSeconds = 10
+	}
+
+	vm.mu.Lock()
+	udsPath := vm.VsockPath
+	running, paused := vm.started, vm.paused
+	vm.mu.Unlock()
+
+	if !running {
+		http.Error(w, "microVM not running", http.StatusServiceUnavailable)
+		return
+	}
+	if paused {
+		http.Error(w, "microVM is paused", http.StatusConflict)
+		return
+	}
+	if udsPath == "" {
+		http.Error(w, "microVM was created without a vsock device", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(req.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	vm.touch()
+	output, err := vsockExec(ctx, udsPath, req.Port, req.Command)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("vsock exec failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ExecResponse{Output: output})
+}
+
+// vsockExec connects to a guest vsock port through Firecracker's host-side
+// Unix socket and runs command against the guest's command service.
+func vsockExec(ctx context.Context, udsPath string, port uint32, command string) (string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", udsPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to vsock socket: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Firecracker's host-initiated connection handshake
+	if _, err := fmt.Fprintf(conn, "CONNECT %d\n", port); err != nil {
+		return "", fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	ack, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("guest did not accept connection on port %d: %w", port, err)
+	}
+	if !strings.HasPrefix(ack, "OK ") {
+		return "", fmt.Errorf("unexpected vsock handshake response: %q", strings.TrimSpace(ack))
+	}
+
+	if command != "" {
+		if _, err := io.WriteString(conn, command+"\n"); err != nil {
+			return "", fmt.Errorf("failed to send command: %w", err)
+		}
+	}
+	if uc, ok := conn.(*net.UnixConn); ok {
+		uc.CloseWrite()
+	}
+
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		return string(output), fmt.Errorf("failed to read output: %w", err)
+	}
+	return string(output), nil
+}
@@ -49,30 +49,30 @@ func newActionsStopCmd() *cobra.Command {
 		Use:   "stop",
 		Short: "Stop the microVM",
 		Long: `Stop the microVM instance by sending Ctrl+Alt+Del to initiate
-graceful shutdown. Use --force for immediate termination.`,
+graceful shutdown.
+
+The Firecracker API has no forced shutdown; to kill a microVM that ignores
+Ctrl+Alt+Del use 'fc-macos microvm stop --force'.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if force {
+				return fmt.Errorf("the Firecracker API cannot force a shutdown; use 'fc-macos microvm stop --force' to kill the microVM")
+			}
+
 			client, err := getFirecrackerClient(cmd)
 			if err != nil {
 				return err
 			}
 
-			if force {
-				if err := client.ForceStopInstance(cmd.Context()); err != nil {
-					return fmt.Errorf("failed to force stop instance: %w", err)
-				}
-				fmt.Println("MicroVM force stopped")
-			} else {
-				if err := client.StopInstance(cmd.Context()); err != nil {
-					return fmt.Errorf("failed to stop instance: %w", err)
-				}
-				fmt.Println("MicroVM stop signal sent")
+			if err := client.StopInstance(cmd.Context()); err != nil {
+				return fmt.Errorf("failed to stop instance: %w", err)
 			}
+			fmt.Println("MicroVM stop signal sent")
 
 			return nil
 		},
 	}
 
-	cmd.Flags().BoolVar(&force, "force", false, "force immediate termination")
+	cmd.Flags().BoolVar(&force, "force", false, "force immediate termination (not supported by the Firecracker API)")
 
 	return cmd
 }
@@ -0,0 +1,333 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newAgentCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Administer the fc-agent",
+		Long:  `Commands to administer the fc-agent running inside the Linux VM.`,
+	}
+
+	cmd.AddCommand(newAgentTokenCmd())
+	cmd.AddCommand(newAgentAuditCmd())
+
+	return cmd
+}
+
+func newAgentTokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage scoped API tokens",
+		Long: `Manage named fc-agent API tokens.
+
+Each token is granted one or more scopes:
+  read     list and inspect microVMs
+  console  attach to consoles and exec into microVMs
+  write    create, stop and extend microVMs
+  proxy    call the raw Firecracker API
+  admin    everything, including managing tokens
+
+A token can also be limited to microVMs matching a label selector. It then
+only sees those microVMs, and can only create microVMs whose labels match.
+
+Managing tokens requires the admin token created by 'fc-macos setup'.`,
+	}
+
+	cmd.AddCommand(newAgentTokenCreateCmd())
+	cmd.AddCommand(newAgentTokenListCmd())
+	cmd.AddCommand(newAgentTokenRevokeCmd())
+
+	return cmd
+}
+
+func newAgentTokenCreateCmd() *cobra.Command {
+	var (
+		name     string
+		scopes   []string
+		selector string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a token",
+		Example: `  # A CI token that can run and stop its own microVMs
+  fc-macos agent token create --name ci --scope read,write,console --selector team=ci
+
+  # A read-only token for dashboards
+  fc-macos agent token create --name viewer --scope read`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return createAgentToken(cmd.Context(), name, scopes, selector)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "token name (required)")
+	cmd.Flags().StringSliceVar(&scopes, "scope", nil, "scopes to grant: read, console, write, proxy, admin (required)")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "limit the token to microVMs matching this label selector")
+	cmd.MarkFlagRequired("name")
+	cmd.MarkFlagRequired("scope")
+
+	return cmd
+}
+
+func newAgentTokenListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List tokens",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listAgentTokens(cmd.Context())
+		},
+	}
+}
+
+func newAgentTokenRevokeCmd() *cobra.Command {
+	var name string
+
+	cmd := &cobra.Command{
+		Use:   "revoke",
+		Short: "Revoke a token",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return revokeAgentToken(cmd.Context(), name)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "token name (required)")
+	cmd.MarkFlagRequired("name")
+
+	return cmd
+}
+
+func newAgentAuditCmd() *cobra.Command {
+	var (
+		since   string
+		token   string
+		microVM string
+		limit   int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show the fc-agent audit log",
+		Long: `Show who changed what through the fc-agent API.
+
+Every non-GET request and every denied request is recorded with the caller's
+address and token, the target microVM, a SHA-256 of the request body and the
+response status. Requires the admin token.`,
+		Example: `  # What happened in the last hour
+  fc-macos agent audit --since 1h
+
+  # Everything the CI token did to one microVM
+  fc-macos agent audit --token ci --microvm worker-1`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return showAgentAudit(cmd.Context(), since, token, microVM, limit)
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "", "only entries newer than a duration (e.g. 1h) or RFC 3339 time")
+	cmd.Flags().StringVar(&token, "token", "", "only entries from this token name")
+	cmd.Flags().StringVar(&microVM, "microvm", "", "only entries targeting this microVM name or ID")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 100, "maximum number of entries to show")
+
+	return cmd
+}
+
+// getAgentAPIURL returns the versioned API root of the fc-agent in the Linux
+// VM and an HTTP client that authenticates to it.
+func getAgentAPIURL(ctx context.Context) (string, *http.Client, error) {
+	_, agentURL, client, err := getVMConnection(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	ac, _, err := connectAgent(ctx, agentURL, 10*time.Second)
+	if err != nil {
+		return "", nil, err
+	}
+	return ac.APIURL(), client, nil
+}
+
+func createAgentToken(ctx context.Context, name string, scopes []string, selector string) error {
+	apiURL, client, err := getAgentAPIURL(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"name":     name,
+		"scopes":   scopes,
+		"selector": selector,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL+"/agent/tokens", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to create token: %s", strings.TrimSpace(string(respBody)))
+	}
+
+	var token AgentToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("Created token %s (scopes: %s)\n", token.Name, strings.Join(token.Scopes, ","))
+	fmt.Println()
+	fmt.Println(token.Token)
+	fmt.Println()
+	fmt.Println("This is the only time the token is shown. Use it with:")
+	fmt.Println("  export FC_MACOS_AGENT_TOKEN=<token>")
+	return nil
+}
+
+func listAgentTokens(ctx context.Context) error {
+	apiURL, client, err := getAgentAPIURL(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Get(apiURL + "/agent/tokens")
+	if err != nil {
+		return fmt.Errorf("failed to list tokens: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to list tokens: %s", strings.TrimSpace(string(body)))
+	}
+
+	var tokens []AgentToken
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(tokens) == 0 {
+		fmt.Println("No tokens (only the admin token from setup)")
+		return nil
+	}
+
+	fmt.Printf("%-20s %-30s %-25s %s\n", "NAME", "SCOPES", "SELECTOR", "CREATED")
+	fmt.Println(strings.Repeat("-", 95))
+	for _, t := range tokens {
+		selector := t.Selector
+		if selector == "" {
+			selector = "-"
+		}
+		fmt.Printf("%-20s %-30s %-25s %s\n",
+			t.Name, strings.Join(t.Scopes, ","), selector, t.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+func revokeAgentToken(ctx context.Context, name string) error {
+	apiURL, client, err := getAgentAPIURL(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", apiURL+"/agent/tokens/"+url.PathEscape(name), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to revoke token: %s", strings.TrimSpace(string(body)))
+	}
+
+	fmt.Printf("Revoked token %s\n", name)
+	return nil
+}
+
+func showAgentAudit(ctx context.Context, since, token, microVM string, limit int) error {
+	apiURL, client, err := getAgentAPIURL(ctx)
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	if since != "" {
+		params.Set("since", since)
+	}
+	if token != "" {
+		params.Set("token", token)
+	}
+	if microVM != "" {
+		params.Set("microvm", microVM)
+	}
+	params.Set("limit", fmt.Sprint(limit))
+
+	resp, err := client.Get(apiURL + "/agent/audit?" + params.Encode())
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to read audit log: %s", strings.TrimSpace(string(body)))
+	}
+
+	var entries []AuditEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No audit entries")
+		return nil
+	}
+
+	fmt.Printf("%-19s %-21s %-12s %-7s %-40s %-22s %s\n", "TIME", "CLIENT", "TOKEN", "METHOD", "PATH", "MICROVM", "STATUS")
+	fmt.Println(strings.Repeat("-", 132))
+	for _, e := range entries {
+		tokenName := e.Token
+		if tokenName == "" {
+			tokenName = "-"
+		}
+		vm := e.MicroVM
+		if vm == "" {
+			vm = "-"
+		}
+		status := fmt.Sprint(e.Status)
+		switch {
+		case e.Denied != "":
+			status += " (" + e.Denied + ")"
+		case e.Outcome != "":
+			status += " (" + e.Operation + " " + e.Outcome + ")"
+		}
+		fmt.Printf("%-19s %-21s %-12s %-7s %-40s %-22s %s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), e.Remote, tokenName, e.Method, e.Path, vm, status)
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package cli
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/spf13/viper"
+)
+
+const (
+	agentPort = 8080
+
+	// agentServerName is the name in fc-agent's TLS certificate. Clients
+	// verify against it rather than the VM's IP, which can change.
+	agentServerName = "fc-agent"
+)
+
+// Files written by `fc-macos setup` under ~/.fc-macos/agent.
+const (
+	agentTokenFile = "token"
+	agentCAFile    = "ca.pem"
+	agentCAKeyFile = "ca-key.pem"
+)
+
+// agentConfigDir is where the host keeps fc-agent credentials.
+func agentConfigDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.Getenv("HOME")
+	}
+	return filepath.Join(home, ".fc-macos", "agent")
+}
+
+// agentToken returns the bearer token for fc-agent. The agent-token config
+// key (or FC_MACOS_AGENT_TOKEN) overrides the token saved by setup.
+func agentToken() string {
+	if token := viper.GetString("agent-token"); token != "" {
+		return token
+	}
+	data, err := os.ReadFile(filepath.Join(agentConfigDir(), agentTokenFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// agentTLSConfig returns a TLS config trusting the CA created by setup, or
+// nil if setup did not enable TLS.
+func agentTLSConfig() *tls.Config {
+	caPEM, err := os.ReadFile(filepath.Join(agentConfigDir(), agentCAFile))
+	if err != nil {
+		return nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil
+	}
+	return &tls.Config{
+		RootCAs:    pool,
+		ServerName: agentServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// AgentURL returns the base URL of the fc-agent listening in the VM at ip.
+func AgentURL(ip string) string {
+	scheme := "http"
+	if agentTLSConfig() != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, ip, agentPort)
+}
+
+// NewAgentClient returns an HTTP client that presents the fc-agent token on
+// every request and trusts the agent's certificate.
+func NewAgentClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = agentTLSConfig()
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &bearerTransport{token: agentToken(), base: transport},
+	}
+}
+
+// newAgentAPI returns an fc-agent API client that presents the fc-agent token
+// and trusts the agent's certificate. Use connectAgent, which checks the
+// agent's API version first.
+func newAgentAPI(agentURL string, timeout time.Duration, unversioned bool) *agentclient.Client {
+	return agentclient.New(agentURL, &agentclient.Options{
+		Token:       agentToken(),
+		TLSConfig:   agentTLSConfig(),
+		Timeout:     timeout,
+		Unversioned: unversioned,
+	})
+}
+
+// bearerTransport adds an Authorization header to each request.
+type bearerTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.token != "" && req.Header.Get("Authorization") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// dialAgent opens a raw connection to fc-agent for console streaming,
+// using TLS when the agent URL is https.
+func dialAgent(ctx context.Context, agentURL string) (net.Conn, error) {
+	u, err := url.Parse(agentURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent URL: %w", err)
+	}
+
+	var d net.Dialer
+	if u.Scheme == "https" {
+		td := &tls.Dialer{NetDialer: &d, Config: agentTLSConfig()}
+		return td.DialContext(ctx, "tcp", u.Host)
+	}
+	return d.DialContext(ctx, "tcp", u.Host)
+}
+
+// agentAuthHeader returns the Authorization header line for hand-written
+// console requests, or "" when no token is configured.
+func agentAuthHeader() string {
+	token := agentToken()
+	if token == "" {
+		return ""
+	}
+	return "Authorization: Bearer " + token + "\r\n"
+}
+
+// ==================== Setup ====================
+
+// agentCredentials are the secrets setup installs into the Linux VM.
+type agentCredentials struct {
+	Token   string
+	CertPEM []byte // Server certificate, nil without TLS
+	KeyPEM  []byte
+}
+
+// ensureAgentCredentials loads or creates the token and, if withTLS is set,
+// a CA and a fresh server certificate. Existing secrets are reused unless
+// rotate is set, so other clients keep working across re-runs of setup.
+func ensureAgentCredentials(dir string, withTLS, rotate bool) (*agentCredentials, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	creds := &agentCredentials{}
+
+	tokenPath := filepath.Join(dir, agentTokenFile)
+	if data, err := os.ReadFile(tokenPath); err == nil && !rotate {
+		creds.Token = strings.TrimSpace(string(data))
+	}
+	if creds.Token == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate token: %w", err)
+		}
+		creds.Token = hex.EncodeToString(buf)
+		if err := os.WriteFile(tokenPath, []byte(creds.Token+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save token: %w", err)
+		}
+	}
+
+	caPath := filepath.Join(dir, agentCAFile)
+	caKeyPath := filepath.Join(dir, agentCAKeyFile)
+	if !withTLS {
+		os.Remove(caPath)
+		os.Remove(caKeyPath)
+		return creds, nil
+	}
+
+	ca, caKey, err := loadAgentCA(caPath, caKeyPath)
+	if err != nil || rotate {
+		ca, caKey, err = createAgentCA(caPath, caKeyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	creds.CertPEM, creds.KeyPEM, err = issueAgentCert(ca, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func loadAgentCA(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("invalid CA files")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Now().After(cert.NotAfter) {
+		return nil, nil, fmt.Errorf("CA expired")
+	}
+	return cert, key, nil
+}
+
+// createAgentCA creates a self-signed CA for fc-agent certificates.
+func createAgentCA(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "fc-macos local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to save CA key: %w", err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to save CA: %w", err)
+	}
+	return cert, key, nil
+}
+
+// issueAgentCert issues a server certificate for fc-agent signed by ca.
+func issueAgentCert(ca *x509.Certificate, caKey *ecdsa.PrivateKey) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: agentServerName},
+		DNSNames:     []string{agentServerName, "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to issue certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
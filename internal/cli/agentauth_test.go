@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureAgentCredentials(t *testing.T) {
+	dir := t.TempDir()
+
+	creds, err := ensureAgentCredentials(dir, true, false)
+	require.NoError(t, err)
+	assert.Len(t, creds.Token, 64)
+
+	info, err := os.Stat(filepath.Join(dir, agentTokenFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The server certificate chains to the saved CA under the agent's name
+	caPEM, err := os.ReadFile(filepath.Join(dir, agentCAFile))
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+
+	block, _ := pem.Decode(creds.CertPEM)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: agentServerName})
+	assert.NoError(t, err)
+
+	// Re-running keeps the token and CA; rotating replaces both
+	again, err := ensureAgentCredentials(dir, true, false)
+	require.NoError(t, err)
+	assert.Equal(t, creds.Token, again.Token)
+	caAgain, _ := os.ReadFile(filepath.Join(dir, agentCAFile))
+	assert.Equal(t, caPEM, caAgain)
+
+	rotated, err := ensureAgentCredentials(dir, true, true)
+	require.NoError(t, err)
+	assert.NotEqual(t, creds.Token, rotated.Token)
+
+	// Disabling TLS removes the CA so clients fall back to plain HTTP
+	plain, err := ensureAgentCredentials(dir, false, false)
+	require.NoError(t, err)
+	assert.Nil(t, plain.CertPEM)
+	assert.NoFileExists(t, filepath.Join(dir, agentCAFile))
+}
+
+func TestBearerTransport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &bearerTransport{token: "s3cret", base: http.DefaultTransport}}
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Bearer s3cret", got)
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/anthropics/fc-macos/pkg/firecracker"
+	"github.com/sirupsen/logrus"
+)
+
+// cliVersion is the fc-macos release, set by NewRootCmd.
+var cliVersion = "dev"
+
+// negotiated remembers, per agent URL, what the version handshake found, so
+// the dashboard does not repeat it on every refresh.
+var negotiated = struct {
+	sync.Mutex
+	agents map[string]*agentclient.VersionInfo // nil for unversioned agents
+}{agents: make(map[string]*agentclient.VersionInfo)}
+
+// connectAgent returns an API client for the fc-agent at agentURL after
+// checking that it speaks an API version this fc-macos understands. Agents
+// from before API versioning are spoken to on the deprecated unversioned
+// routes, with a warning. The returned VersionInfo is nil for those.
+func connectAgent(ctx context.Context, agentURL string, timeout time.Duration) (*agentclient.Client, *agentclient.VersionInfo, error) {
+	negotiated.Lock()
+	info, ok := negotiated.agents[agentURL]
+	negotiated.Unlock()
+
+	if !ok {
+		var err error
+		info, err = newAgentAPI(agentURL, timeout, false).Version(ctx)
+		switch {
+		case errors.Is(err, agentclient.ErrUnversioned):
+			logrus.Warnf("fc-agent at %s predates API versioning; re-run 'fc-macos setup' to update it", agentURL)
+		case err != nil:
+			return nil, nil, fmt.Errorf("fc-agent not responding at %s: %w", agentURL, err)
+		default:
+			if err := checkAgentVersion(info, cliVersion); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		negotiated.Lock()
+		negotiated.agents[agentURL] = info
+		negotiated.Unlock()
+	}
+
+	return newAgentAPI(agentURL, timeout, info == nil), info, nil
+}
+
+// ConnectFirecracker returns a client for the Firecracker API that the
+// fc-agent at agentURL forwards, after the same version check as the
+// microvm commands. VM loaders use it for the drives, machine, boot and other
+// Firecracker commands.
+func ConnectFirecracker(ctx context.Context, agentURL string) (*firecracker.Client, error) {
+	ac, _, err := connectAgent(ctx, agentURL, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return firecracker.NewAt(NewAgentClient(30*time.Second), ac.APIURL()), nil
+}
+
+// checkAgentVersion refuses an agent whose API version differs from the one
+// this fc-macos speaks, and warns when the two were built from different
+// releases.
+func checkAgentVersion(info *agentclient.VersionInfo, version string) error {
+	if info.APIVersion != agentclient.APIVersion {
+		return fmt.Errorf("fc-agent %s speaks API %s, but fc-macos %s needs %s; re-run 'fc-macos setup' to install a matching agent",
+			info.Version, info.APIVersion, version, agentclient.APIVersion)
+	}
+	if info.Version != version && info.Version != "dev" && version != "dev" {
+		logrus.Warnf("fc-agent %s does not match fc-macos %s; re-run 'fc-macos setup' to update it", info.Version, version)
+	}
+	return nil
+}
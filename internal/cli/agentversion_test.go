@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAgentVersion(t *testing.T) {
+	assert.NoError(t, checkAgentVersion(&agentclient.VersionInfo{Version: "1.2.0", APIVersion: "v1"}, "1.2.0"))
+	// Different releases of the same API only warn
+	assert.NoError(t, checkAgentVersion(&agentclient.VersionInfo{Version: "1.1.0", APIVersion: "v1"}, "1.2.0"))
+
+	err := checkAgentVersion(&agentclient.VersionInfo{Version: "2.0.0", APIVersion: "v2"}, "1.2.0")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "speaks API v2")
+	assert.Contains(t, err.Error(), "fc-macos setup")
+}
+
+func TestConnectAgent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ctx := context.Background()
+
+	current := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			io.WriteString(w, `{"status":"ok","api_version":"v1"}`)
+		case "/version":
+			io.WriteString(w, `{"version":"dev","api_version":"v1","firecracker_version":"v1.7.0"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer current.Close()
+
+	ac, info, err := connectAgent(ctx, current.URL, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, current.URL+"/v1", ac.APIURL())
+	assert.Equal(t, "v1.7.0", info.FirecrackerVersion)
+
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status":"ok"}`)
+	}))
+	defer old.Close()
+
+	ac, info, err = connectAgent(ctx, old.URL, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, old.URL, ac.APIURL())
+	assert.Nil(t, info)
+
+	future := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			io.WriteString(w, `{"status":"ok","api_version":"v2"}`)
+			return
+		}
+		io.WriteString(w, `{"version":"9.0.0","api_version":"v2"}`)
+	}))
+	defer future.Close()
+
+	_, _, err = connectAgent(ctx, future.URL, time.Second)
+	assert.ErrorContains(t, err, "speaks API v2")
+}
+
+func TestConnectFirecracker(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/health":
+			io.WriteString(w, `{"status":"ok","api_version":"v1"}`)
+		case "/version":
+			io.WriteString(w, `{"version":"dev","api_version":"v1"}`)
+		case "/v1/machine-config":
+			io.WriteString(w, `{"vcpu_count":2,"mem_size_mib":256}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	fc, err := ConnectFirecracker(context.Background(), srv.URL)
+	require.NoError(t, err)
+	cfg, err := fc.GetMachineConfig(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 256, cfg.MemSizeMib)
+	assert.Equal(t, []string{"/health", "/version", "/v1/machine-config"}, paths)
+}
@@ -1,9 +1,10 @@
 package cli
 
 import (
-	"encoding/json"
 	"fmt"
+	"strconv"
 
+	"github.com/anthropics/fc-macos/internal/printer"
 	"github.com/anthropics/fc-macos/pkg/api"
 	"github.com/spf13/cobra"
 )
@@ -82,35 +83,21 @@ func newBalloonGetCmd() *cobra.Command {
 				return err
 			}
 
-			result, err := client.GetBalloon(cmd.Context())
+			balloon, err := client.GetBalloon(cmd.Context())
 			if err != nil {
 				return fmt.Errorf("failed to get balloon: %w", err)
 			}
 
-			balloon, err := convertTo[api.Balloon](result)
+			p, err := newPrinter(cmd)
 			if err != nil {
 				return err
 			}
-
-			if outputJSON {
-				data, err := json.MarshalIndent(balloon, "", "  ")
-				if err != nil {
-					return err
-				}
-				fmt.Println(string(data))
-			} else {
-				fmt.Printf("Target Amount: %d MiB\n", balloon.AmountMib)
-				fmt.Printf("Deflate on OOM: %v\n", balloon.DeflateOnOom)
-				if balloon.StatsPollingIntervalS > 0 {
-					fmt.Printf("Stats Polling Interval: %d s\n", balloon.StatsPollingIntervalS)
-				}
-			}
-
-			return nil
+			return printer.Object(p, *balloon, balloonFields)
 		},
 	}
 
 	cmd.Flags().BoolVar(&outputJSON, "json", false, "output in JSON format")
+	cmd.Flags().MarkDeprecated("json", "use --output json")
 
 	return cmd
 }
@@ -128,43 +115,21 @@ func newBalloonStatsCmd() *cobra.Command {
 				return err
 			}
 
-			result, err := client.GetBalloonStats(cmd.Context())
+			stats, err := client.GetBalloonStats(cmd.Context())
 			if err != nil {
 				return fmt.Errorf("failed to get balloon stats: %w", err)
 			}
 
-			stats, err := convertTo[api.BalloonStats](result)
+			p, err := newPrinter(cmd)
 			if err != nil {
 				return err
 			}
-
-			if outputJSON {
-				data, err := json.MarshalIndent(stats, "", "  ")
-				if err != nil {
-					return err
-				}
-				fmt.Println(string(data))
-			} else {
-				fmt.Printf("Target Pages: %d\n", stats.TargetPages)
-				fmt.Printf("Actual Pages: %d\n", stats.ActualPages)
-				fmt.Printf("Target Memory: %d MiB\n", stats.TargetMib)
-				fmt.Printf("Actual Memory: %d MiB\n", stats.ActualMib)
-				if stats.FreeMemory > 0 {
-					fmt.Printf("Free Memory: %d bytes\n", stats.FreeMemory)
-				}
-				if stats.TotalMemory > 0 {
-					fmt.Printf("Total Memory: %d bytes\n", stats.TotalMemory)
-				}
-				if stats.AvailableMemory > 0 {
-					fmt.Printf("Available Memory: %d bytes\n", stats.AvailableMemory)
-				}
-			}
-
-			return nil
+			return printer.Object(p, *stats, balloonStatsFields)
 		},
 	}
 
 	cmd.Flags().BoolVar(&outputJSON, "json", false, "output in JSON format")
+	cmd.Flags().MarkDeprecated("json", "use --output json")
 
 	return cmd
 }
@@ -195,3 +160,22 @@ func newBalloonUpdateCmd() *cobra.Command {
 
 	return cmd
 }
+
+// balloonFields are the fields shown by balloon get.
+var balloonFields = []printer.Column[api.Balloon]{
+	{Header: "Target Amount", Value: func(b api.Balloon) string { return fmt.Sprintf("%d MiB", b.AmountMib) }},
+	{Header: "Deflate on OOM", Value: func(b api.Balloon) string { return strconv.FormatBool(b.DeflateOnOom) }},
+	{Header: "Stats Polling Interval", Value: func(b api.Balloon) string { return optional(b.StatsPollingIntervalS, "%d s") }},
+}
+
+// balloonStatsFields are the fields shown by balloon stats. Memory figures
+// the guest hasn't reported are left out.
+var balloonStatsFields = []printer.Column[api.BalloonStats]{
+	{Header: "Target Pages", Value: func(s api.BalloonStats) string { return fmt.Sprint(s.TargetPages) }},
+	{Header: "Actual Pages", Value: func(s api.BalloonStats) string { return fmt.Sprint(s.ActualPages) }},
+	{Header: "Target Memory", Value: func(s api.BalloonStats) string { return fmt.Sprintf("%d MiB", s.TargetMib) }},
+	{Header: "Actual Memory", Value: func(s api.BalloonStats) string { return fmt.Sprintf("%d MiB", s.ActualMib) }},
+	{Header: "Free Memory", Value: func(s api.BalloonStats) string { return optional(s.FreeMemory, "%d bytes") }},
+	{Header: "Total Memory", Value: func(s api.BalloonStats) string { return optional(s.TotalMemory, "%d bytes") }},
+	{Header: "Available Memory", Value: func(s api.BalloonStats) string { return optional(s.AvailableMemory, "%d bytes") }},
+}
@@ -1,9 +1,9 @@
 package cli
 
 import (
-	"encoding/json"
 	"fmt"
 
+	"github.com/anthropics/fc-macos/internal/printer"
 	"github.com/anthropics/fc-macos/pkg/api"
 	"github.com/spf13/cobra"
 )
@@ -81,37 +81,25 @@ func newBootGetCmd() *cobra.Command {
 				return err
 			}
 
-			result, err := client.GetBootSource(cmd.Context())
+			bootSource, err := client.GetBootSource(cmd.Context())
 			if err != nil {
 				return fmt.Errorf("failed to get boot source: %w", err)
 			}
 
-			bootSource, err := convertTo[api.BootSource](result)
+			p, err := newPrinter(cmd)
 			if err != nil {
 				return err
 			}
-
-			if outputJSON {
-				data, err := json.MarshalIndent(bootSource, "", "  ")
-				if err != nil {
-					return err
-				}
-				fmt.Println(string(data))
-			} else {
-				fmt.Printf("Kernel: %s\n", bootSource.KernelImagePath)
-				if bootSource.InitrdPath != "" {
-					fmt.Printf("Initrd: %s\n", bootSource.InitrdPath)
-				}
-				if bootSource.BootArgs != "" {
-					fmt.Printf("Boot Args: %s\n", bootSource.BootArgs)
-				}
-			}
-
-			return nil
+			return printer.Object(p, *bootSource, []printer.Column[api.BootSource]{
+				{Header: "Kernel", Value: func(b api.BootSource) string { return b.KernelImagePath }},
+				{Header: "Initrd", Value: func(b api.BootSource) string { return b.InitrdPath }},
+				{Header: "Boot Args", Value: func(b api.BootSource) string { return b.BootArgs }},
+			})
 		},
 	}
 
 	cmd.Flags().BoolVar(&outputJSON, "json", false, "output in JSON format")
+	cmd.Flags().MarkDeprecated("json", "use --output json")
 
 	return cmd
 }
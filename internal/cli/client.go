@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/anthropics/fc-macos/pkg/api"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -27,32 +28,35 @@ type VMConfig interface {
 	GetMemorySizeMiB() uint64
 }
 
-// FirecrackerClientProvider interface for lazy loading
+// FirecrackerClientProvider is the Firecracker API as used by the CLI. It is
+// implemented by firecracker.Client over whichever transport the VM
+// loader provides.
 type FirecrackerClientProvider interface {
-	SetBootSource(ctx context.Context, bs interface{}) error
-	GetBootSource(ctx context.Context) (interface{}, error)
-	SetDrive(ctx context.Context, id string, drive interface{}) error
-	GetDrives(ctx context.Context) ([]interface{}, error)
-	PatchDrive(ctx context.Context, id string, pathOnHost string) error
+	SetBootSource(ctx context.Context, bs *api.BootSource) error
+	GetBootSource(ctx context.Context) (*api.BootSource, error)
+	SetDrive(ctx context.Context, id string, drive *api.Drive) error
+	GetDrives(ctx context.Context) ([]*api.Drive, error)
+	PatchDrive(ctx context.Context, id string, pathOnHost string, rateLimiter *api.RateLimiter) error
 	DeleteDrive(ctx context.Context, id string) error
-	SetNetworkInterface(ctx context.Context, id string, iface interface{}) error
-	GetNetworkInterfaces(ctx context.Context) ([]interface{}, error)
-	PatchNetworkInterface(ctx context.Context, id string, rxLimiter, txLimiter interface{}) error
+	SetNetworkInterface(ctx context.Context, id string, iface *api.NetworkInterface) error
+	GetNetworkInterfaces(ctx context.Context) ([]*api.NetworkInterface, error)
+	PatchNetworkInterface(ctx context.Context, id string, rxLimiter, txLimiter *api.RateLimiter) error
 	DeleteNetworkInterface(ctx context.Context, id string) error
-	SetMachineConfig(ctx context.Context, cfg interface{}) error
-	GetMachineConfig(ctx context.Context) (interface{}, error)
-	GetVersion(ctx context.Context) (interface{}, error)
+	SetMachineConfig(ctx context.Context, cfg *api.MachineConfig) error
+	GetMachineConfig(ctx context.Context) (*api.MachineConfig, error)
+	GetVersion(ctx context.Context) (*api.Version, error)
 	StartInstance(ctx context.Context) error
 	StopInstance(ctx context.Context) error
-	ForceStopInstance(ctx context.Context) error
 	PauseInstance(ctx context.Context) error
 	ResumeInstance(ctx context.Context) error
-	CreateSnapshot(ctx context.Context, params interface{}) error
-	LoadSnapshot(ctx context.Context, params interface{}) error
-	GetMetrics(ctx context.Context) (interface{}, error)
-	SetBalloon(ctx context.Context, balloon interface{}) error
-	GetBalloon(ctx context.Context) (interface{}, error)
-	GetBalloonStats(ctx context.Context) (interface{}, error)
+	CreateSnapshot(ctx context.Context, params *api.SnapshotCreate) error
+	LoadSnapshot(ctx context.Context, params *api.SnapshotLoad) error
+	GetMetrics(ctx context.Context) (*api.Metrics, error)
+	SetMetricsSink(ctx context.Context, cfg *api.MetricsConfig) error
+	SetLogger(ctx context.Context, logger *api.Logger) error
+	SetBalloon(ctx context.Context, balloon *api.Balloon) error
+	GetBalloon(ctx context.Context) (*api.Balloon, error)
+	GetBalloonStats(ctx context.Context) (*api.BalloonStats, error)
 	PatchBalloon(ctx context.Context, amountMib int64) error
 }
 
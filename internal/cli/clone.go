@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/spf13/cobra"
+)
+
+func newMicroVMCloneCmd() *cobra.Command {
+	var (
+		name     string
+		to       string
+		labels   map[string]string
+		ttl      time.Duration
+		execPort uint32
+		async    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "clone",
+		Short: "Clone a running microVM",
+		Long: `Start a copy of a running microVM in its current state.
+
+fc-agent pauses the microVM, snapshots its memory and copies its rootfs
+(as a reflink where the filesystem supports it), then resumes it. The
+snapshot is restored into a new microVM with its own name, rootfs copy, MAC
+and IP. The copy is made next to the source's rootfs, with the clone's name
+added, and is kept when the clone stops. Deleting the clone removes it.
+
+A microVM on a network is readdressed through its guest's vsock command
+service, so cloning one needs --exec-port. Jailed microVMs cannot be
+cloned.`,
+		Example: `  # Debug a copy of a misbehaving worker
+  fc-macos microvm clone --name worker-3 --to worker-3-debug
+
+  # Clone a networked microVM whose guest runs a command service on port 52
+  fc-macos microvm clone --name db --to db-copy --exec-port 52 --ttl 1h`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := &agentclient.CloneMicroVMRequest{Name: to, Labels: labels, ExecPort: execPort}
+			if ttl > 0 {
+				req.TTL = ttl.String()
+			}
+			return cloneMicroVM(cmd.Context(), name, req, async)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "microVM to clone, by name or ID (required)")
+	cmd.Flags().StringVar(&to, "to", "", "name of the clone (default: generated)")
+	cmd.Flags().StringToStringVar(&labels, "label", nil, "label for the clone (key=value, repeatable; default: the source's labels)")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "stop the clone automatically after this long")
+	cmd.Flags().Uint32Var(&execPort, "exec-port", 0, "vsock port of the guest's command service, to readdress a networked clone")
+	cmd.Flags().BoolVar(&async, "async", false, "print the operation ID instead of waiting for the clone to start")
+	cmd.MarkFlagRequired("name")
+
+	return cmd
+}
+
+func cloneMicroVM(ctx context.Context, name string, req *agentclient.CloneMicroVMRequest, async bool) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	vmID, err := resolveVMName(ctx, ac, name)
+	if err != nil {
+		return err
+	}
+
+	op, err := ac.CloneAsync(ctx, vmID, req)
+	if err != nil {
+		return fmt.Errorf("clone failed: %w", err)
+	}
+	if async {
+		fmt.Printf("Cloning %s to %s (operation %s)\n", name, op.MicroVM, op.ID)
+		return nil
+	}
+
+	if op, err = followOperation(ctx, ac, op); err != nil {
+		return fmt.Errorf("clone failed: %w", err)
+	}
+	vm := op.Result
+
+	fmt.Printf("Cloned %s to %s\n", name, vm.Name)
+	fmt.Printf("  ID:     %s\n", vm.ID)
+	fmt.Printf("  Rootfs: %s\n", vm.Config.Rootfs)
+	if vm.Network != nil {
+		fmt.Printf("  IP:     %s\n", vm.Network.IP)
+	}
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Printf("  fc-macos microvm shell --name %s\n", vm.Name)
+	fmt.Printf("  fc-macos microvm stop --name %s\n", vm.Name)
+	return nil
+}
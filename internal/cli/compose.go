@@ -0,0 +1,446 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/anthropics/fc-macos/internal/compose"
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+)
+
+// composeProjectLabel groups a compose project's microVMs; it matches the
+// agent's ProjectLabel.
+const composeProjectLabel = "fc-macos.project"
+
+// Colors cycled through for service log prefixes.
+var composeColors = []string{"36", "33", "32", "35", "34", "31"}
+
+func newUpCmd() *cobra.Command {
+	var (
+		file    string
+		project string
+		detach  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Start the microVMs defined in a compose file",
+		Long: `Start a group of microVMs described by a compose file.
+
+Services are started in depends_on order. A service's dependents are only
+started once its readiness check passes: either a console line matching a
+regular expression, or a command run inside the guest over vsock.
+
+All services join a shared network and are grouped under the project name.
+Console output from every service is streamed with a service prefix. Press
+Ctrl+C to stop all services, or use --detach to return once they are ready.`,
+		Example: `  # Start the project in ./fc-compose.yaml and stream logs
+  fc-macos up
+
+  # Start in the background once all services are ready
+  fc-macos up -f tests/fc-compose.yaml --detach`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := loadComposeFile(file, project)
+			if err != nil {
+				return err
+			}
+			return composeUp(cmd.Context(), f, detach)
+		},
+	}
+
+	addComposeFlags(cmd, &file, &project)
+	cmd.Flags().BoolVarP(&detach, "detach", "d", false, "return once all services are ready")
+
+	return cmd
+}
+
+func newDownCmd() *cobra.Command {
+	var (
+		file    string
+		project string
+		force   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "Stop the microVMs of a compose project",
+		Long: `Stop every microVM in a compose project. When the compose file is
+available, services are stopped in reverse dependency order.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := loadComposeFile(file, project)
+			if err != nil {
+				if project == "" {
+					return err
+				}
+				// The file is only needed for ordering; the project name is enough.
+				f = &compose.File{Project: project}
+			}
+			return composeDown(cmd.Context(), f, force)
+		},
+	}
+
+	addComposeFlags(cmd, &file, &project)
+	cmd.Flags().BoolVar(&force, "force", false, "force stop (kill process)")
+
+	return cmd
+}
+
+func newPsCmd() *cobra.Command {
+	var (
+		file    string
+		project string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "ps",
+		Short: "List the microVMs of a compose project",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := project
+			if name == "" {
+				f, err := loadComposeFile(file, "")
+				if err != nil {
+					return err
+				}
+				name = f.Project
+			}
+			return composePs(cmd.Context(), name)
+		},
+	}
+
+	addComposeFlags(cmd, &file, &project)
+
+	return cmd
+}
+
+func addComposeFlags(cmd *cobra.Command, file, project *string) {
+	cmd.Flags().StringVarP(file, "file", "f", compose.DefaultFile, "compose file")
+	cmd.Flags().StringVarP(project, "project-name", "p", "", "project name (default: from compose file)")
+}
+
+func loadComposeFile(path, project string) (*compose.File, error) {
+	f, err := compose.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load compose file: %w", err)
+	}
+	if project != "" {
+		f.Project = project
+	}
+	return f, nil
+}
+
+// composeLogWriter serializes prefixed console lines from several services.
+type composeLogWriter struct {
+	mu    sync.Mutex
+	out   io.Writer
+	color bool // Color the prefixes
+	width int
+}
+
+// newComposeLogWriter returns a writer to stdout that colors the prefixes
+// if stdout is a terminal and NO_COLOR is not set.
+func newComposeLogWriter() *composeLogWriter {
+	color := os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd()))
+	return &composeLogWriter{out: os.Stdout, color: color}
+}
+
+func (w *composeLogWriter) println(service, color, line string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.color {
+		fmt.Fprintf(w.out, "%-*s | %s\n", w.width, service, line)
+		return
+	}
+	fmt.Fprintf(w.out, "\033[%sm%-*s |\033[0m %s\n", color, w.width, service, line)
+}
+
+func composeUp(ctx context.Context, f *compose.File, detach bool) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	order, err := f.Order()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logs := newComposeLogWriter()
+	for _, svc := range order {
+		if len(svc.Name) > logs.width {
+			logs.width = len(svc.Name)
+		}
+	}
+
+	var (
+		started []*agentclient.MicroVMInfo
+		streams []io.Closer
+		wg      sync.WaitGroup
+	)
+	closeStreams := func() {
+		for _, s := range streams {
+			s.Close()
+		}
+		wg.Wait()
+	}
+	teardown := func() {
+		closeStreams()
+		// Use a fresh context: ctx may already be cancelled by a signal.
+		downCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		for i := len(started) - 1; i >= 0; i-- {
+			if err := stopSingleVM(downCtx, ac, started[i].ID, false); err != nil {
+				logrus.Warnf("Failed to stop %s: %v", started[i].Name, err)
+			} else {
+				fmt.Printf("Stopped: %s\n", started[i].Name)
+			}
+		}
+	}
+
+	for i, svc := range order {
+		color := composeColors[i%len(composeColors)]
+		vmName := f.VMName(svc.Name)
+
+		createReq := &agentclient.CreateMicroVMRequest{
+			Name:      vmName,
+			Labels:    map[string]string{composeProjectLabel: f.Project},
+			Kernel:    svc.Kernel,
+			Rootfs:    svc.Rootfs,
+			VCPUs:     svc.VCPUs,
+			MemoryMiB: svc.MemoryMiB,
+			BootArgs:  svc.BootArgs,
+			Network:   &agentclient.NetworkConfig{Name: f.Network},
+			Vsock:     svc.Ready != nil && svc.Ready.Vsock != nil,
+		}
+		if createReq.Kernel == "" {
+			createReq.Kernel = defaultMicroVMKernel
+		}
+		if createReq.Rootfs == "" {
+			createReq.Rootfs = defaultMicroVMRootfs
+		}
+		if createReq.BootArgs == "" {
+			createReq.BootArgs = defaultMicroVMBootArgs
+		}
+
+		fmt.Printf("Starting %s...\n", vmName)
+		vm, err := createMicroVMViaAgent(ctx, ac, createReq)
+		if err != nil {
+			teardown()
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		started = append(started, vm)
+
+		stream, err := openVMConsoleStream(ctx, ac, vm.ID)
+		if err != nil {
+			teardown()
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		streams = append(streams, stream)
+
+		consoleReady := make(chan struct{})
+		var readyOnce sync.Once
+		wg.Add(1)
+		go func(svc *compose.Service) {
+			defer wg.Done()
+			scanner := bufio.NewScanner(stream)
+			for scanner.Scan() {
+				line := strings.TrimRight(scanner.Text(), "\r")
+				logs.println(svc.Name, color, line)
+				if svc.Ready.MatchConsole(line) {
+					readyOnce.Do(func() { close(consoleReady) })
+				}
+			}
+		}(svc)
+
+		if err := waitForServiceReady(ctx, ac, vm, svc, consoleReady); err != nil {
+			teardown()
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		if svc.Ready != nil {
+			fmt.Printf("Ready: %s\n", vmName)
+		}
+	}
+
+	fmt.Printf("Project %s is up (%d services)\n", f.Project, len(started))
+
+	if detach {
+		closeStreams()
+		fmt.Printf("  fc-macos ps -p %s\n", f.Project)
+		fmt.Printf("  fc-macos down -p %s\n", f.Project)
+		return nil
+	}
+
+	<-ctx.Done()
+	fmt.Println()
+	fmt.Println("Stopping project...")
+	teardown()
+	return nil
+}
+
+// waitForServiceReady blocks until the service's readiness check passes.
+func waitForServiceReady(ctx context.Context, ac *agentclient.Client, vm *agentclient.MicroVMInfo, svc *compose.Service, consoleReady <-chan struct{}) error {
+	ready := svc.Ready
+	if ready == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ready.Timeout)
+	defer cancel()
+
+	if ready.Console != "" {
+		select {
+		case <-consoleReady:
+		case <-ctx.Done():
+			return fmt.Errorf("not ready after %s: console never matched %q", ready.Timeout, ready.Console)
+		}
+	}
+
+	if probe := ready.Vsock; probe != nil {
+		var lastErr error
+		for {
+			output, err := execInMicroVM(ctx, ac, vm.ID, probe.Port, probe.Command)
+			if err == nil && probe.MatchOutput(output) {
+				return nil
+			}
+			if err == nil {
+				lastErr = fmt.Errorf("output %q did not match %q", strings.TrimSpace(output), probe.Expect)
+			} else {
+				lastErr = err
+			}
+			logrus.Debugf("vsock probe for %s: %v", vm.Name, lastErr)
+
+			select {
+			case <-time.After(probe.Interval):
+			case <-ctx.Done():
+				return fmt.Errorf("not ready after %s: vsock probe failed: %v", ready.Timeout, lastErr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// execInMicroVM runs a command inside a microVM through the agent's vsock exec endpoint.
+func execInMicroVM(ctx context.Context, ac *agentclient.Client, vmID string, port uint32, command string) (string, error) {
+	output, err := ac.Exec(ctx, vmID, &agentclient.ExecRequest{Port: port, Command: command})
+	if err != nil {
+		return "", fmt.Errorf("exec failed: %w", err)
+	}
+	return output, nil
+}
+
+// listProjectMicroVMs returns the microVMs that belong to a compose project.
+func listProjectMicroVMs(ctx context.Context, ac *agentclient.Client, project string) ([]agentclient.MicroVMInfo, error) {
+	vms, err := ac.List(ctx, composeProjectLabel+"="+project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list microVMs: %w", err)
+	}
+	return vms, nil
+}
+
+func composeDown(ctx context.Context, f *compose.File, force bool) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	vms, err := listProjectMicroVMs(ctx, ac, f.Project)
+	if err != nil {
+		return err
+	}
+	if len(vms) == 0 {
+		fmt.Printf("No microVMs in project %s\n", f.Project)
+		return nil
+	}
+
+	// Stop dependents before their dependencies, then anything left over
+	// (e.g. services removed from the file since the project was started).
+	byName := make(map[string]agentclient.MicroVMInfo, len(vms))
+	for _, vm := range vms {
+		byName[vm.Name] = vm
+	}
+	var ordered []agentclient.MicroVMInfo
+	if len(f.Services) > 0 {
+		order, err := f.Order()
+		if err != nil {
+			return err
+		}
+		for i := len(order) - 1; i >= 0; i-- {
+			name := f.VMName(order[i].Name)
+			if vm, ok := byName[name]; ok {
+				ordered = append(ordered, vm)
+				delete(byName, name)
+			}
+		}
+	}
+	for _, vm := range vms {
+		if _, ok := byName[vm.Name]; ok {
+			ordered = append(ordered, vm)
+		}
+	}
+
+	var failed int
+	for _, vm := range ordered {
+		if err := stopSingleVM(ctx, ac, vm.ID, force); err != nil {
+			logrus.Warnf("Failed to stop %s: %v", vm.Name, err)
+			failed++
+		} else {
+			fmt.Printf("Stopped: %s\n", vm.Name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to stop %d microVM(s)", failed)
+	}
+	return nil
+}
+
+func composePs(ctx context.Context, project string) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	vms, err := listProjectMicroVMs(ctx, ac, project)
+	if err != nil {
+		return err
+	}
+	if len(vms) == 0 {
+		fmt.Printf("No microVMs in project %s\n", project)
+		return nil
+	}
+
+	fmt.Printf("%-15s %-25s %-10s %-15s %-6s %-8s %s\n", "SERVICE", "NAME", "STATUS", "IP", "VCPUS", "MEMORY", "CREATED")
+	fmt.Println(strings.Repeat("-", 95))
+
+	for _, vm := range vms {
+		status := microVMState(vm)
+		ip := "-"
+		if vm.Network != nil {
+			ip = vm.Network.IP
+		}
+		vcpus, memory := 0, 0
+		if vm.Config != nil {
+			vcpus = vm.Config.VCPUs
+			memory = vm.Config.MemoryMiB
+		}
+		fmt.Printf("%-15s %-25s %-10s %-15s %-6d %-8d %s\n",
+			strings.TrimPrefix(vm.Name, project+"-"), vm.Name, status, ip, vcpus, memory,
+			vm.CreatedAt.Format("15:04:05"))
+	}
+
+	return nil
+}
@@ -2,13 +2,12 @@ package cli
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"os/exec"
 	"strings"
 	"time"
 
+	"github.com/anthropics/fc-macos/pkg/agentclient"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/cobra"
@@ -22,6 +21,7 @@ var (
 	midGray   = lipgloss.Color("#cccccc") // Bright labels
 	dimGray   = lipgloss.Color("#888888") // Still visible
 	red       = lipgloss.Color("#ff6b6b")
+	yellow    = lipgloss.Color("#ffd75f")
 )
 
 // Styles
@@ -61,6 +61,9 @@ var (
 	statusOK = lipgloss.NewStyle().
 			Foreground(orange)
 
+	statusWarn = lipgloss.NewStyle().
+			Foreground(yellow)
+
 	statusErr = lipgloss.NewStyle().
 			Foreground(red)
 
@@ -95,11 +98,16 @@ type microVMStatus struct {
 	ID          string
 	Name        string
 	Running     bool
+	Paused      bool
 	VCPUs       int
 	MemoryMiB   int
 	PID         int
 	CPUPercent  float64 // CPU usage percentage
 	MemoryUsedM int     // Memory used in MiB
+
+	// Recent history for sparklines, oldest first
+	CPUHistory    []float64
+	MemoryHistory []float64
 }
 
 type agentStatus struct {
@@ -107,6 +115,7 @@ type agentStatus struct {
 	FirecrackerRunning bool
 	TotalVMs           int
 	RunningVMs         int
+	Capacity           *agentclient.Capacity
 }
 
 type dashboardModel struct {
@@ -215,6 +224,11 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if len(m.microVMs) > 0 && m.selectedIdx < len(m.microVMs) {
 				return m, m.stopSelectedMicroVM
 			}
+		case "p":
+			// Pause or resume selected microVM
+			if len(m.microVMs) > 0 && m.selectedIdx < len(m.microVMs) && m.microVMs[m.selectedIdx].Running {
+				return m, m.togglePauseSelectedMicroVM
+			}
 		case "S":
 			if m.linuxVM.Running {
 				return m, m.stopLinuxVM
@@ -391,6 +405,19 @@ func (m dashboardModel) renderAgentBox(width int, minLines int) string {
 				labelStyle.Render("○"),
 				labelStyle.Render("NO MICROVMS")))
 		}
+
+		// Reserved capacity against admission limits
+		if c := m.agent.Capacity; c != nil {
+			lines = append(lines, "")
+			if c.VCPULimit > 0 {
+				lines = append(lines, m.renderMeter("VCPU", c.ReservedVCPUs*100/c.VCPULimit,
+					fmt.Sprintf("%d / %d", c.ReservedVCPUs, c.VCPULimit), width-8))
+			}
+			if c.MemoryLimitMiB > 0 {
+				lines = append(lines, m.renderMeter("MEM", c.ReservedMemoryMiB*100/c.MemoryLimitMiB,
+					fmt.Sprintf("%dM / %dM", c.ReservedMemoryMiB, c.MemoryLimitMiB), width-8))
+			}
+		}
 	} else {
 		lines = append(lines, fmt.Sprintf("  %s  %s",
 			statusErr.Render("✗"),
@@ -479,7 +506,10 @@ func (m dashboardModel) renderMicroVMBox(width int) string {
 		// Status indicator and text
 		var statusText string
 		statusIcon := labelStyle.Render("○")
-		if vm.Running {
+		if vm.Paused {
+			statusText = "paused"
+			statusIcon = statusWarn.Render("◐")
+		} else if vm.Running {
 			statusText = "running"
 			statusIcon = statusOK.Render("●")
 		} else {
@@ -535,6 +565,17 @@ func (m dashboardModel) renderMicroVMBox(width int) string {
 					valueStyle.Render(cpuStr),
 					labelStyle.Render("RAM:"),
 					valueStyle.Render(memStr)))
+				if len(vm.CPUHistory) > 1 {
+					sparkStyle := lipgloss.NewStyle().Foreground(orange)
+					lines = append(lines, fmt.Sprintf("%s%s %s",
+						detailIndent,
+						labelStyle.Render("CPU:"),
+						sparkStyle.Render(sparkline(vm.CPUHistory, 40))))
+					lines = append(lines, fmt.Sprintf("%s%s %s",
+						detailIndent,
+						labelStyle.Render("RAM:"),
+						sparkStyle.Render(sparkline(vm.MemoryHistory, 40))))
+				}
 			}
 			lines = append(lines, "") // Empty line after details
 		}
@@ -580,6 +621,40 @@ func (m dashboardModel) renderMeter(label string, pct int, suffix string, width
 		labelStyle.Render(suffix))
 }
 
+// sparkBlocks are the bar heights a sparkline is drawn with, lowest first.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the last width values as a row of bars scaled between
+// their minimum and maximum.
+func sparkline(values []float64, width int) string {
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	if len(values) == 0 {
+		return ""
+	}
+
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+
+	out := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if hi > lo {
+			level = int((v - lo) / (hi - lo) * float64(len(sparkBlocks)-1))
+		}
+		out[i] = sparkBlocks[level]
+	}
+	return string(out)
+}
+
 func (m dashboardModel) renderFooter() string {
 	var parts []string
 
@@ -602,6 +677,11 @@ func (m dashboardModel) renderFooter() string {
 	cmds = append(cmds, fmt.Sprintf("%s refresh", keyStyle.Render("r")))
 	if len(m.microVMs) > 0 && m.selectedIdx < len(m.microVMs) {
 		cmds = append(cmds, fmt.Sprintf("%s stop vm", keyStyle.Render("s")))
+		if selected := m.microVMs[m.selectedIdx]; selected.Paused {
+			cmds = append(cmds, fmt.Sprintf("%s resume vm", keyStyle.Render("p")))
+		} else if selected.Running {
+			cmds = append(cmds, fmt.Sprintf("%s pause vm", keyStyle.Render("p")))
+		}
 	}
 	if m.linuxVM.Running {
 		cmds = append(cmds, fmt.Sprintf("%s stop linux", keyStyle.Render("S")))
@@ -675,36 +755,21 @@ func (m dashboardModel) checkAgentAndMicroVMs(ctx context.Context, vmIP string)
 	agent := agentStatus{}
 	var vms []microVMStatus
 
-	client := &http.Client{Timeout: 2 * time.Second}
-	agentURL := fmt.Sprintf("http://%s:8080", vmIP)
-
-	// Check agent health
-	resp, err := client.Get(agentURL + "/health")
+	// Check agent health and API version
+	ac, _, err := connectAgent(ctx, AgentURL(vmIP), 2*time.Second)
 	if err != nil {
 		return agent, vms
 	}
-	resp.Body.Close()
-	agent.Available = resp.StatusCode == 200
+	agent.Available = true
 
-	if !agent.Available {
-		return agent, vms
+	if c, err := ac.Capacity(ctx); err == nil {
+		agent.Capacity = c
 	}
 
-	// Fetch microVMs list from new API
-	resp, err = client.Get(agentURL + "/agent/microvms")
+	vmList, err := ac.List(ctx, "")
 	if err != nil {
 		return agent, vms
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return agent, vms
-	}
-
-	var vmList []MicroVMInfo
-	if err := json.NewDecoder(resp.Body).Decode(&vmList); err != nil {
-		return agent, vms
-	}
 
 	// Convert to dashboard status format
 	for _, vm := range vmList {
@@ -712,6 +777,7 @@ func (m dashboardModel) checkAgentAndMicroVMs(ctx context.Context, vmIP string)
 			ID:          vm.ID,
 			Name:        vm.Name,
 			Running:     vm.Running,
+			Paused:      vm.Paused,
 			PID:         vm.PID,
 			CPUPercent:  vm.CPUPercent,
 			MemoryUsedM: vm.MemoryUsedMB,
@@ -720,6 +786,14 @@ func (m dashboardModel) checkAgentAndMicroVMs(ctx context.Context, vmIP string)
 			vmStatus.VCPUs = vm.Config.VCPUs
 			vmStatus.MemoryMiB = vm.Config.MemoryMiB
 		}
+		if vm.Running {
+			if stats, err := ac.Stats(ctx, vm.ID, time.Minute); err == nil {
+				for _, s := range stats.Samples {
+					vmStatus.CPUHistory = append(vmStatus.CPUHistory, s.CPUPercent)
+					vmStatus.MemoryHistory = append(vmStatus.MemoryHistory, float64(s.MemoryBytes))
+				}
+			}
+		}
 		vms = append(vms, vmStatus)
 
 		if vm.Running {
@@ -743,21 +817,41 @@ func (m dashboardModel) stopSelectedMicroVM() tea.Msg {
 
 	selectedVM := m.microVMs[m.selectedIdx]
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	url := fmt.Sprintf("http://%s:8080/agent/microvms/%s", m.linuxVM.IP, selectedVM.ID)
-	req, _ := http.NewRequest("DELETE", url, nil)
-	resp, err := client.Do(req)
+	ac, _, err := connectAgent(context.Background(), AgentURL(m.linuxVM.IP), 5*time.Second)
 	if err != nil {
 		return actionResultMsg{action: "stop-microvm", err: err}
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		return actionResultMsg{action: "stop-microvm", err: fmt.Errorf("status %d", resp.StatusCode)}
+	if err := ac.Delete(context.Background(), selectedVM.ID, false); err != nil {
+		return actionResultMsg{action: "stop-microvm", err: err}
 	}
 	return actionResultMsg{action: "stop-microvm"}
 }
 
+func (m dashboardModel) togglePauseSelectedMicroVM() tea.Msg {
+	if m.linuxVM.IP == "" {
+		return actionResultMsg{action: "pause-microvm", err: fmt.Errorf("VM IP not available")}
+	}
+
+	if m.selectedIdx >= len(m.microVMs) {
+		return actionResultMsg{action: "pause-microvm", err: fmt.Errorf("no microVM selected")}
+	}
+
+	selectedVM := m.microVMs[m.selectedIdx]
+
+	ac, _, err := connectAgent(context.Background(), AgentURL(m.linuxVM.IP), 5*time.Second)
+	if err != nil {
+		return actionResultMsg{action: "pause-microvm", err: err}
+	}
+	change := ac.Pause
+	if selectedVM.Paused {
+		change = ac.Resume
+	}
+	if _, err := change(context.Background(), selectedVM.ID); err != nil {
+		return actionResultMsg{action: "pause-microvm", err: err}
+	}
+	return actionResultMsg{action: "pause-microvm"}
+}
+
 func (m dashboardModel) stopLinuxVM() tea.Msg {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
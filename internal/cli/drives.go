@@ -1,9 +1,11 @@
 package cli
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"strconv"
 
+	"github.com/anthropics/fc-macos/internal/printer"
 	"github.com/anthropics/fc-macos/pkg/api"
 	"github.com/spf13/cobra"
 )
@@ -88,66 +90,84 @@ func newDrivesListCmd() *cobra.Command {
 				return err
 			}
 
-			result, err := client.GetDrives(cmd.Context())
+			drives, err := client.GetDrives(cmd.Context())
 			if err != nil {
 				return fmt.Errorf("failed to get drives: %w", err)
 			}
 
-			// Convert []interface{} to []api.Drive via JSON
-			var drives []api.Drive
-			data, err := json.Marshal(result)
+			p, err := newPrinter(cmd)
 			if err != nil {
 				return err
 			}
-			if err := json.Unmarshal(data, &drives); err != nil {
-				return err
-			}
-
-			if outputJSON {
-				data, err := json.MarshalIndent(drives, "", "  ")
-				if err != nil {
-					return err
-				}
-				fmt.Println(string(data))
-			} else {
-				if len(drives) == 0 {
-					fmt.Println("No drives configured")
-					return nil
-				}
-				for _, drive := range drives {
-					fmt.Printf("ID: %s\n", drive.DriveID)
-					fmt.Printf("  Path: %s\n", drive.PathOnHost)
-					fmt.Printf("  Root Device: %v\n", drive.IsRootDevice)
-					fmt.Printf("  Read Only: %v\n", drive.IsReadOnly)
-					fmt.Println()
-				}
+			if len(drives) == 0 && p.Human() {
+				fmt.Fprintln(cmd.OutOrStdout(), "No drives configured")
+				return nil
 			}
-
-			return nil
+			return printer.List(p, drives, driveColumns)
 		},
 	}
 
 	cmd.Flags().BoolVar(&outputJSON, "json", false, "output in JSON format")
+	cmd.Flags().MarkDeprecated("json", "use --output json")
 
 	return cmd
 }
 
+// driveColumns are the table columns of drives list.
+var driveColumns = []printer.Column[*api.Drive]{
+	{Header: "ID", Value: func(d *api.Drive) string { return d.DriveID }},
+	{Header: "PATH", Value: func(d *api.Drive) string { return d.PathOnHost }},
+	{Header: "ROOT", Value: func(d *api.Drive) string { return strconv.FormatBool(d.IsRootDevice) }},
+	{Header: "READ-ONLY", Value: func(d *api.Drive) string { return strconv.FormatBool(d.IsReadOnly) }},
+	{Header: "PARTUUID", Value: func(d *api.Drive) string { return d.Partuuid }, Wide: true},
+	{Header: "CACHE", Value: func(d *api.Drive) string { return d.CacheType }, Wide: true},
+	{Header: "IO ENGINE", Value: func(d *api.Drive) string { return d.IoEngine }, Wide: true},
+}
+
 func newDrivesUpdateCmd() *cobra.Command {
 	var (
 		driveID    string
 		pathOnHost string
+		bandwidth  int64
+		ops        int64
 	)
 
 	cmd := &cobra.Command{
 		Use:   "update",
-		Short: "Update a drive's backing file path",
+		Short: "Update a drive's backing file path or rate limits",
+		Example: `  # Point a drive at another image
+  fc-macos drives update --id data --path /path/to/data-v2.ext4
+
+  # Limit a drive to 1 MiB/s and 100 operations/s
+  fc-macos drives update --id data --bandwidth 1048576 --ops 100`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if pathOnHost == "" && bandwidth <= 0 && ops <= 0 {
+				return fmt.Errorf("nothing to update: set --path, --bandwidth or --ops")
+			}
+
+			var rateLimiter *api.RateLimiter
+			if bandwidth > 0 || ops > 0 {
+				rateLimiter = &api.RateLimiter{}
+				if bandwidth > 0 {
+					rateLimiter.Bandwidth = &api.TokenBucket{
+						Size:       bandwidth,
+						RefillTime: 1000, // 1 second
+					}
+				}
+				if ops > 0 {
+					rateLimiter.Ops = &api.TokenBucket{
+						Size:       ops,
+						RefillTime: 1000,
+					}
+				}
+			}
+
 			client, err := getFirecrackerClient(cmd)
 			if err != nil {
 				return err
 			}
 
-			if err := client.PatchDrive(cmd.Context(), driveID, pathOnHost); err != nil {
+			if err := client.PatchDrive(cmd.Context(), driveID, pathOnHost, rateLimiter); err != nil {
 				return fmt.Errorf("failed to update drive: %w", err)
 			}
 
@@ -157,9 +177,10 @@ func newDrivesUpdateCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&driveID, "id", "", "drive identifier (required)")
-	cmd.Flags().StringVar(&pathOnHost, "path", "", "new path to the drive image (required)")
+	cmd.Flags().StringVar(&pathOnHost, "path", "", "new path to the drive image")
+	cmd.Flags().Int64Var(&bandwidth, "bandwidth", 0, "bandwidth limit in bytes/sec")
+	cmd.Flags().Int64Var(&ops, "ops", 0, "operations limit per second")
 	cmd.MarkFlagRequired("id")
-	cmd.MarkFlagRequired("path")
 
 	return cmd
 }
@@ -190,3 +211,66 @@ func newDrivesRemoveCmd() *cobra.Command {
 
 	return cmd
 }
+
+func newMicroVMDriveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drive",
+		Short: "Manage the drives of a running microVM",
+	}
+
+	cmd.AddCommand(newMicroVMDriveSwapCmd())
+
+	return cmd
+}
+
+func newMicroVMDriveSwapCmd() *cobra.Command {
+	var (
+		name    string
+		driveID string
+		path    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "swap",
+		Short: "Point a running microVM's drive at another file",
+		Long: `Point a running microVM's drive at another file in the Linux VM.
+
+fc-agent checks that the file exists and that no drive of any microVM is
+using it, then swaps it in through Firecracker. The guest sees the new
+contents the next time it reads the device, so unmount the drive in the
+guest first. Swapping rootfs also changes the rootfs the microVM restarts
+and is cloned from.`,
+		Example: `  # Give a worker a fresh data disk
+  fc-macos microvm drive swap --name worker-1 --drive data --path /var/lib/fc/data-2.img`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return swapMicroVMDrive(cmd.Context(), name, driveID, path)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "microVM name or ID (required)")
+	cmd.Flags().StringVar(&driveID, "drive", "", "drive identifier (required)")
+	cmd.Flags().StringVar(&path, "path", "", "new backing file, as a path in the Linux VM (required)")
+	cmd.MarkFlagRequired("name")
+	cmd.MarkFlagRequired("drive")
+	cmd.MarkFlagRequired("path")
+
+	return cmd
+}
+
+func swapMicroVMDrive(ctx context.Context, name, driveID, path string) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	vmID, err := resolveVMName(ctx, ac, name)
+	if err != nil {
+		return err
+	}
+	if _, err := ac.SwapDrive(ctx, vmID, driveID, path); err != nil {
+		return fmt.Errorf("drive swap failed: %w", err)
+	}
+
+	fmt.Printf("Drive '%s' of %s now uses %s\n", driveID, name, path)
+	return nil
+}
@@ -1,9 +1,10 @@
 package cli
 
 import (
-	"encoding/json"
 	"fmt"
+	"strconv"
 
+	"github.com/anthropics/fc-macos/internal/printer"
 	"github.com/anthropics/fc-macos/pkg/api"
 	"github.com/spf13/cobra"
 )
@@ -82,37 +83,21 @@ func newMachineInfoCmd() *cobra.Command {
 				return err
 			}
 
-			result, err := client.GetMachineConfig(cmd.Context())
+			cfg, err := client.GetMachineConfig(cmd.Context())
 			if err != nil {
 				return fmt.Errorf("failed to get machine config: %w", err)
 			}
 
-			cfg, err := convertTo[api.MachineConfig](result)
+			p, err := newPrinter(cmd)
 			if err != nil {
 				return err
 			}
-
-			if outputJSON {
-				data, err := json.MarshalIndent(cfg, "", "  ")
-				if err != nil {
-					return err
-				}
-				fmt.Println(string(data))
-			} else {
-				fmt.Printf("vCPUs: %d\n", cfg.VCPUCount)
-				fmt.Printf("Memory: %d MiB\n", cfg.MemSizeMib)
-				fmt.Printf("SMT: %v\n", cfg.SMT)
-				if cfg.CPUTemplate != "" {
-					fmt.Printf("CPU Template: %s\n", cfg.CPUTemplate)
-				}
-				fmt.Printf("Track Dirty Pages: %v\n", cfg.TrackDirtyPages)
-			}
-
-			return nil
+			return printer.Object(p, *cfg, machineConfigFields)
 		},
 	}
 
 	cmd.Flags().BoolVar(&outputJSON, "json", false, "output in JSON format")
+	cmd.Flags().MarkDeprecated("json", "use --output json")
 
 	return cmd
 }
@@ -129,31 +114,32 @@ func newMachineVersionCmd() *cobra.Command {
 				return err
 			}
 
-			result, err := client.GetVersion(cmd.Context())
+			version, err := client.GetVersion(cmd.Context())
 			if err != nil {
 				return fmt.Errorf("failed to get version: %w", err)
 			}
 
-			version, err := convertTo[api.Version](result)
+			p, err := newPrinter(cmd)
 			if err != nil {
 				return err
 			}
-
-			if outputJSON {
-				data, err := json.MarshalIndent(version, "", "  ")
-				if err != nil {
-					return err
-				}
-				fmt.Println(string(data))
-			} else {
-				fmt.Printf("Firecracker Version: %s\n", version.FirecrackerVersion)
-			}
-
-			return nil
+			return printer.Object(p, *version, []printer.Column[api.Version]{
+				{Header: "Firecracker Version", Value: func(v api.Version) string { return v.FirecrackerVersion }},
+			})
 		},
 	}
 
 	cmd.Flags().BoolVar(&outputJSON, "json", false, "output in JSON format")
+	cmd.Flags().MarkDeprecated("json", "use --output json")
 
 	return cmd
 }
+
+// machineConfigFields are the fields shown by machine info.
+var machineConfigFields = []printer.Column[api.MachineConfig]{
+	{Header: "vCPUs", Value: func(c api.MachineConfig) string { return fmt.Sprint(c.VCPUCount) }},
+	{Header: "Memory", Value: func(c api.MachineConfig) string { return fmt.Sprintf("%d MiB", c.MemSizeMib) }},
+	{Header: "SMT", Value: func(c api.MachineConfig) string { return strconv.FormatBool(c.SMT) }},
+	{Header: "CPU Template", Value: func(c api.MachineConfig) string { return c.CPUTemplate }},
+	{Header: "Track Dirty Pages", Value: func(c api.MachineConfig) string { return strconv.FormatBool(c.TrackDirtyPages) }},
+}
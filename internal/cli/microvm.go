@@ -3,15 +3,18 @@ package cli
 import (
 	"bufio"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/anthropics/fc-macos/internal/printer"
+	"github.com/anthropics/fc-macos/pkg/agentclient"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -27,20 +30,42 @@ func newMicroVMCmd() *cobra.Command {
 	cmd.AddCommand(newMicroVMStatusCmd())
 	cmd.AddCommand(newMicroVMShellCmd())
 	cmd.AddCommand(newMicroVMStopCmd())
+	cmd.AddCommand(newMicroVMPauseCmd(true))
+	cmd.AddCommand(newMicroVMPauseCmd(false))
+	cmd.AddCommand(newMicroVMExtendCmd())
+	cmd.AddCommand(newMicroVMCloneCmd())
+	cmd.AddCommand(newMicroVMDriveCmd())
+	cmd.AddCommand(newMicroVMThrottleCmd())
 	cmd.AddCommand(newMicroVMLogsCmd())
+	cmd.AddCommand(newMicroVMFirecrackerLogsCmd())
+	cmd.AddCommand(newMicroVMStatsCmd())
+	cmd.AddCommand(newMicroVMTopCmd())
+	cmd.AddCommand(newMicroVMOperationCmd())
 
 	return cmd
 }
 
 func newMicroVMListCmd() *cobra.Command {
-	return &cobra.Command{
+	var selector string
+
+	cmd := &cobra.Command{
 		Use:     "list",
 		Aliases: []string{"ls"},
 		Short:   "List all microVMs",
+		Example: `  # List microVMs owned by CI, except the nightly job
+  fc-macos microvm list --selector team=ci,job!=nightly`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return listMicroVMs(cmd.Context())
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+			return listMicroVMs(cmd.Context(), p, selector)
 		},
 	}
+
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "label selector (e.g. team=ci,job!=x,owner,!debug)")
+
+	return cmd
 }
 
 func newMicroVMStatusCmd() *cobra.Command {
@@ -50,7 +75,11 @@ func newMicroVMStatusCmd() *cobra.Command {
 		Use:   "status",
 		Short: "Show microVM status",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return showMicroVMStatus(cmd.Context(), name)
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+			return showMicroVMStatus(cmd.Context(), p, name)
 		},
 	}
 
@@ -81,22 +110,61 @@ This connects to the microVM's serial console via the intermediate Linux VM.`,
 
 func newMicroVMStopCmd() *cobra.Command {
 	var (
-		name  string
-		force bool
-		all   bool
+		name     string
+		force    bool
+		all      bool
+		selector string
+		async    bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "stop",
 		Short: "Stop a microVM",
+		Example: `  # Stop one microVM
+  fc-macos microvm stop --name worker-1
+
+  # CI cleanup: stop everything a job started
+  fc-macos microvm stop --selector team=ci,job=1234
+
+  # Return as soon as the agent has started stopping it
+  fc-macos microvm stop --name worker-1 --async`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return stopMicroVM(cmd.Context(), name, force, all)
+			return stopMicroVM(cmd.Context(), name, force, all, selector, async)
 		},
 	}
 
 	cmd.Flags().StringVar(&name, "name", "", "microVM name or ID")
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "force stop (kill process)")
 	cmd.Flags().BoolVar(&all, "all", false, "stop all microVMs")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "stop all microVMs matching a label selector")
+	cmd.Flags().BoolVar(&async, "async", false, "print the operation ID instead of waiting for the stop to finish")
+
+	return cmd
+}
+
+func newMicroVMExtendCmd() *cobra.Command {
+	var (
+		name string
+		by   time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "extend",
+		Short: "Extend a microVM's TTL",
+		Long: `Push back a microVM's TTL expiry and reset its idle timer.
+
+The extension is added to the current expiry, or to now if the microVM
+had no TTL.`,
+		Example: `  # Keep a microVM around for another hour
+  fc-macos microvm extend --name worker-1 --by 1h`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return extendMicroVM(cmd.Context(), name, by)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "microVM name or ID (required)")
+	cmd.Flags().DurationVar(&by, "by", time.Hour, "how long to extend the TTL by")
+	cmd.MarkFlagRequired("name")
 
 	return cmd
 }
@@ -117,6 +185,77 @@ func newMicroVMLogsCmd() *cobra.Command {
 	return cmd
 }
 
+func newMicroVMFirecrackerLogsCmd() *cobra.Command {
+	var (
+		name   string
+		follow bool
+		tail   int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "firecracker-logs",
+		Short: "Show a microVM's Firecracker log",
+		Long: `Show the log Firecracker itself writes for one microVM.
+
+This is the VMM's log, not the guest console. It explains why a microVM
+failed to boot or was killed. Use 'fc-macos run --fc-log-level' to make it
+more verbose.`,
+		Example: `  # Last 100 lines
+  fc-macos microvm firecracker-logs --name worker-1
+
+  # Stream new lines as they are written
+  fc-macos microvm firecracker-logs --name worker-1 -f`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return showFirecrackerLogs(cmd.Context(), name, follow, tail)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "microVM name or ID (required)")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "follow log output")
+	cmd.Flags().IntVarP(&tail, "tail", "n", 100, "number of lines to show (0 for all)")
+	cmd.MarkFlagRequired("name")
+
+	return cmd
+}
+
+func newMicroVMStatsCmd() *cobra.Command {
+	var (
+		name    string
+		rng     time.Duration
+		jsonOut bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show a microVM's resource usage history",
+		Long: `Show a microVM's CPU, memory, disk and network usage over time.
+
+fc-agent samples every microVM once a second and keeps 10 minutes at 1s
+resolution, 24 hours at 1m and 7 days at 1h. The finest resolution that
+covers --range is used.`,
+		Example: `  # Has worker-1's memory been creeping up?
+  fc-macos microvm stats --name worker-1 --range 1h
+
+  # Raw samples for scripts
+  fc-macos microvm stats --name worker-1 --range 24h -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+			return showMicroVMStats(cmd.Context(), p, name, rng)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "microVM name or ID (required)")
+	cmd.Flags().DurationVar(&rng, "range", time.Hour, "how far back to show (up to 168h)")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "print the samples as JSON")
+	cmd.Flags().MarkDeprecated("json", "use --output json")
+	cmd.MarkFlagRequired("name")
+
+	return cmd
+}
+
 func getVMConnection(ctx context.Context) (string, string, *http.Client, error) {
 	tartPath := findTart()
 	if tartPath == "" {
@@ -136,31 +275,86 @@ func getVMConnection(ctx context.Context) (string, string, *http.Client, error)
 	}
 	vmIP := strings.TrimSpace(string(output))
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	agentURL := fmt.Sprintf("http://%s:8080", vmIP)
+	client := NewAgentClient(10 * time.Second)
+	agentURL := AgentURL(vmIP)
 
 	return tartPath, agentURL, client, nil
 }
 
-// listMicroVMs lists all microVMs
-func listMicroVMs(ctx context.Context) error {
-	_, agentURL, client, err := getVMConnection(ctx)
+// getAgent returns an API client for the fc-agent in the running Linux VM.
+func getAgent(ctx context.Context) (*agentclient.Client, error) {
+	_, agentURL, _, err := getVMConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ac, _, err := connectAgent(ctx, agentURL, 10*time.Second)
+	return ac, err
+}
+
+// formatLabels renders labels as a stable, comma-separated key=value list.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
+	}
+	parts := make([]string, 0, len(labels))
+	for k, v := range labels {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// nextExpiry returns the earlier of a microVM's TTL and idle expiry, or nil if
+// it has neither.
+func nextExpiry(vm agentclient.MicroVMInfo) *time.Time {
+	expiry := vm.ExpiresAt
+	if vm.IdleExpiresAt != nil && (expiry == nil || vm.IdleExpiresAt.Before(*expiry)) {
+		expiry = vm.IdleExpiresAt
+	}
+	return expiry
+}
+
+// formatExpiry renders when a microVM will be reaped relative to now.
+func formatExpiry(vm agentclient.MicroVMInfo, now time.Time) string {
+	expiry := nextExpiry(vm)
+	if expiry == nil {
+		return "-"
+	}
+	remaining := expiry.Sub(now)
+	if remaining <= 0 {
+		return "expiring"
+	}
+	if remaining < time.Minute {
+		return "in " + remaining.Round(time.Second).String()
+	}
+	return "in " + strings.TrimSuffix(remaining.Round(time.Minute).String(), "0s")
+}
+
+// listMicroVMs lists all microVMs matching selector
+func listMicroVMs(ctx context.Context, p *printer.Printer, selector string) error {
+	ac, err := getAgent(ctx)
 	if err != nil {
 		return err
 	}
 
-	resp, err := client.Get(agentURL + "/agent/microvms")
+	vms, err := ac.List(ctx, selector)
 	if err != nil {
 		return fmt.Errorf("failed to list microVMs: %w", err)
 	}
-	defer resp.Body.Close()
+	return printMicroVMs(p, vms, selector)
+}
 
-	var vms []MicroVMInfo
-	if err := json.NewDecoder(resp.Body).Decode(&vms); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+// printMicroVMs prints vms, adding hints and a summary line for people.
+func printMicroVMs(p *printer.Printer, vms []agentclient.MicroVMInfo, selector string) error {
+	if !p.Human() {
+		return printer.List(p, vms, microVMColumns(time.Now()))
 	}
 
 	if len(vms) == 0 {
+		if selector != "" {
+			fmt.Printf("No microVMs match selector %q\n", selector)
+			return nil
+		}
 		fmt.Println("No microVMs running")
 		fmt.Println()
 		fmt.Println("Start a microVM with:")
@@ -168,51 +362,76 @@ func listMicroVMs(ctx context.Context) error {
 		return nil
 	}
 
-	fmt.Printf("%-20s %-18s %-10s %-6s %-10s %s\n", "NAME", "ID", "STATUS", "VCPUS", "MEMORY", "CREATED")
-	fmt.Println(strings.Repeat("-", 85))
-
-	for _, vm := range vms {
-		status := "stopped"
-		if vm.Running {
-			status = "running"
-		}
-		id := vm.ID
-		if len(id) > 15 {
-			id = id[:15] + "..."
-		}
-		vcpus := 0
-		memory := 0
-		if vm.Config != nil {
-			vcpus = vm.Config.VCPUs
-			memory = vm.Config.MemoryMiB
-		}
-		fmt.Printf("%-20s %-18s %-10s %-6d %-10d %s\n",
-			vm.Name, id, status, vcpus, memory,
-			vm.CreatedAt.Format("15:04:05"))
+	if err := printer.List(p, vms, microVMColumns(time.Now())); err != nil {
+		return err
 	}
 
 	fmt.Println()
-	running := 0
+	running, paused := 0, 0
 	for _, vm := range vms {
-		if vm.Running {
+		switch microVMState(vm) {
+		case "running":
 			running++
+		case "paused":
+			paused++
 		}
 	}
-	fmt.Printf("%d microVM(s), %d running\n", len(vms), running)
+	if paused > 0 {
+		fmt.Printf("%d microVM(s), %d running, %d paused\n", len(vms), running, paused)
+	} else {
+		fmt.Printf("%d microVM(s), %d running\n", len(vms), running)
+	}
 
 	return nil
 }
 
-// resolveVMName resolves a name or ID to a full VM ID
-func resolveVMName(ctx context.Context, client *http.Client, agentURL, name string) (string, error) {
-	resp, err := client.Get(agentURL + "/agent/microvms")
-	if err != nil {
-		return "", err
+// microVMColumns are the table columns of microvm list. now is used for the
+// time left until expiry.
+func microVMColumns(now time.Time) []printer.Column[agentclient.MicroVMInfo] {
+	return []printer.Column[agentclient.MicroVMInfo]{
+		{Header: "NAME", Value: func(vm agentclient.MicroVMInfo) string { return vm.Name }},
+		{Header: "ID", Value: func(vm agentclient.MicroVMInfo) string {
+			if len(vm.ID) > 15 {
+				return vm.ID[:15] + "..."
+			}
+			return vm.ID
+		}},
+		{Header: "STATUS", Value: microVMState},
+		{Header: "VCPUS", Value: func(vm agentclient.MicroVMInfo) string {
+			if vm.Config == nil {
+				return "0"
+			}
+			return strconv.Itoa(vm.Config.VCPUs)
+		}},
+		{Header: "MEMORY", Value: func(vm agentclient.MicroVMInfo) string {
+			if vm.Config == nil {
+				return "0"
+			}
+			return strconv.Itoa(vm.Config.MemoryMiB)
+		}},
+		{Header: "CREATED", Value: func(vm agentclient.MicroVMInfo) string { return vm.CreatedAt.Format("15:04:05") }},
+		{Header: "EXPIRES", Value: func(vm agentclient.MicroVMInfo) string { return formatExpiry(vm, now) }},
+		{Header: "LABELS", Value: func(vm agentclient.MicroVMInfo) string { return formatLabels(vm.Labels) }},
+		{Header: "PID", Value: func(vm agentclient.MicroVMInfo) string {
+			if vm.PID == 0 {
+				return "-"
+			}
+			return strconv.Itoa(vm.PID)
+		}, Wide: true},
+		{Header: "IP", Value: func(vm agentclient.MicroVMInfo) string {
+			if vm.Network == nil {
+				return "-"
+			}
+			return vm.Network.IP
+		}, Wide: true},
+		{Header: "JAILED", Value: func(vm agentclient.MicroVMInfo) string { return strconv.FormatBool(vm.Jailed) }, Wide: true},
 	}
-	defer resp.Body.Close()
+}
 
-	var vms []MicroVMInfo
-	if err := json.NewDecoder(resp.Body).Decode(&vms); err != nil {
+// resolveVMName resolves a name, ID or ID prefix to a full VM ID
+func resolveVMName(ctx context.Context, ac *agentclient.Client, name string) (string, error) {
+	vms, err := ac.List(ctx, "")
+	if err != nil {
 		return "", err
 	}
 
@@ -225,90 +444,219 @@ func resolveVMName(ctx context.Context, client *http.Client, agentURL, name stri
 	return "", fmt.Errorf("microVM not found: %s", name)
 }
 
-func showMicroVMStatus(ctx context.Context, name string) error {
-	tartPath, agentURL, client, err := getVMConnection(ctx)
+// MicroVMStatusReport is the structured output of microvm status without
+// --name.
+type MicroVMStatusReport struct {
+	LinuxVM  LinuxVMStatus             `json:"linux_vm"`
+	Agent    AgentHealth               `json:"agent"`
+	Capacity *agentclient.Capacity     `json:"capacity,omitempty"`
+	MicroVMs []agentclient.MicroVMInfo `json:"microvms"`
+}
+
+// AgentHealth is whether fc-agent answered its health check, and with which
+// versions.
+type AgentHealth struct {
+	URL     string                   `json:"url"`
+	Healthy bool                     `json:"healthy"`
+	Error   string                   `json:"error,omitempty"`
+	Version *agentclient.VersionInfo `json:"version,omitempty"`
+}
+
+func showMicroVMStatus(ctx context.Context, p *printer.Printer, name string) error {
+	tartPath, agentURL, _, err := getVMConnection(ctx)
 	if err != nil {
 		return err
 	}
 
+	// A specific microVM is printed on its own in the structured formats
+	if name != "" && !p.Human() {
+		ac, _, err := connectAgent(ctx, agentURL, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		vm, err := fetchMicroVM(ctx, ac, name)
+		if err != nil {
+			return err
+		}
+		return printer.Object(p, *vm, nil)
+	}
+
 	vmName := "fc-macos-linux"
 
 	// Get VM IP for display
 	ipCmd := exec.CommandContext(ctx, tartPath, "ip", vmName)
 	output, _ := ipCmd.Output()
-	vmIP := strings.TrimSpace(string(output))
+	report := MicroVMStatusReport{
+		LinuxVM: LinuxVMStatus{Name: vmName, State: "running", IP: strings.TrimSpace(string(output))},
+		Agent:   AgentHealth{URL: agentURL},
+	}
+
+	// Check agent health and API version
+	ac, info, err := connectAgent(ctx, agentURL, 10*time.Second)
+	if err != nil {
+		report.Agent.Error = err.Error()
+	} else {
+		report.Agent.Healthy = true
+		report.Agent.Version = info
+	}
+
+	if !p.Human() {
+		if report.Agent.Healthy {
+			report.Capacity, _ = ac.Capacity(ctx)
+			if report.MicroVMs, err = ac.List(ctx, ""); err != nil {
+				return fmt.Errorf("failed to list microVMs: %w", err)
+			}
+		}
+		return printer.Object(p, report, nil)
+	}
 
 	fmt.Println("=== Linux VM Status ===")
-	fmt.Printf("Name:   %s\n", vmName)
-	fmt.Printf("IP:     %s\n", vmIP)
-	fmt.Printf("Status: running\n")
+	fmt.Printf("Name:   %s\n", report.LinuxVM.Name)
+	fmt.Printf("IP:     %s\n", report.LinuxVM.IP)
+	fmt.Printf("Status: %s\n", report.LinuxVM.State)
 	fmt.Println()
 
-	// Check agent health
-	resp, err := client.Get(agentURL + "/health")
-	if err != nil {
-		fmt.Println("=== fc-agent Status ===")
-		fmt.Printf("Status: not responding (%v)\n", err)
+	fmt.Println("=== fc-agent Status ===")
+	if !report.Agent.Healthy {
+		fmt.Printf("Status: not responding (%s)\n", report.Agent.Error)
 		return nil
 	}
-	defer resp.Body.Close()
-
-	fmt.Println("=== fc-agent Status ===")
 	fmt.Printf("Status: healthy\n")
 	fmt.Printf("URL:    %s\n", agentURL)
+	if v := report.Agent.Version; v != nil {
+		fmt.Printf("Version: %s (API %s, Firecracker %s)\n", v.Version, v.APIVersion, v.FirecrackerVersion)
+	} else {
+		fmt.Printf("Version: unknown (predates API versioning)\n")
+	}
 	fmt.Println()
 
+	if c, err := ac.Capacity(ctx); err == nil {
+		fmt.Println("=== Capacity ===")
+		fmt.Printf("vCPUs:    %d / %d reserved (%d CPUs x %.1f)\n",
+			c.ReservedVCPUs, c.VCPULimit, c.HostCPUs, c.CPUOvercommitRatio)
+		fmt.Printf("Memory:   %d / %d MiB reserved (%d MiB host, %d MiB kept back)\n",
+			c.ReservedMemoryMiB, c.MemoryLimitMiB, c.HostMemoryMiB, c.MemoryReserveMiB)
+		fmt.Printf("Free:     %d MiB available\n", c.HostAvailableMemoryMiB)
+		fmt.Printf("MicroVMs: %d / %d\n", c.MicroVMs, c.MaxMicroVMs)
+		fmt.Println()
+	}
+
 	// If no specific VM requested, list all
 	if name == "" {
-		return listMicroVMs(ctx)
+		vms, err := ac.List(ctx, "")
+		if err != nil {
+			return fmt.Errorf("failed to list microVMs: %w", err)
+		}
+		return printMicroVMs(p, vms, "")
 	}
 
-	// Get specific VM status
-	vmID, err := resolveVMName(ctx, client, agentURL, name)
+	vm, err := fetchMicroVM(ctx, ac, name)
 	if err != nil {
 		return err
 	}
+	fmt.Printf("=== MicroVM: %s ===\n", vm.Name)
+	return printer.Object(p, *vm, microVMFields)
+}
 
-	resp, err = client.Get(fmt.Sprintf("%s/agent/microvms/%s", agentURL, vmID))
+// fetchMicroVM returns the microVM with a name, ID or ID prefix.
+func fetchMicroVM(ctx context.Context, ac *agentclient.Client, name string) (*agentclient.MicroVMInfo, error) {
+	vmID, err := resolveVMName(ctx, ac, name)
 	if err != nil {
-		return fmt.Errorf("failed to get microVM status: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var vm MicroVMInfo
-	if err := json.NewDecoder(resp.Body).Decode(&vm); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+	vm, err := ac.Get(ctx, vmID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get microVM status: %w", err)
 	}
+	return vm, nil
+}
 
-	fmt.Printf("=== MicroVM: %s ===\n", vm.Name)
-	fmt.Printf("ID:      %s\n", vm.ID)
-	status := "stopped"
-	if vm.Running {
-		status = "running"
-	}
-	fmt.Printf("Status:  %s\n", status)
-	if vm.PID > 0 {
-		fmt.Printf("PID:     %d\n", vm.PID)
-	}
-	if vm.Config != nil {
-		fmt.Printf("vCPUs:   %d\n", vm.Config.VCPUs)
-		fmt.Printf("Memory:  %d MiB\n", vm.Config.MemoryMiB)
-		fmt.Printf("Kernel:  %s\n", vm.Config.Kernel)
-		fmt.Printf("Rootfs:  %s\n", vm.Config.Rootfs)
+// microVMState is "running", "paused" or "stopped".
+func microVMState(vm agentclient.MicroVMInfo) string {
+	switch {
+	case vm.Paused:
+		return "paused"
+	case vm.Running:
+		return "running"
 	}
-	fmt.Printf("Created: %s\n", vm.CreatedAt.Format(time.RFC3339))
+	return "stopped"
+}
 
-	return nil
+// microVMFields are the fields shown by microvm status --name.
+var microVMFields = []printer.Column[agentclient.MicroVMInfo]{
+	{Header: "ID", Value: func(vm agentclient.MicroVMInfo) string { return vm.ID }},
+	{Header: "Status", Value: func(vm agentclient.MicroVMInfo) string {
+		if vm.Jailed {
+			return microVMState(vm) + " (jailed)"
+		}
+		return microVMState(vm)
+	}},
+	{Header: "PID", Value: func(vm agentclient.MicroVMInfo) string { return optional(int64(vm.PID), "%d") }},
+	{Header: "vCPUs", Value: func(vm agentclient.MicroVMInfo) string {
+		if vm.Config == nil {
+			return ""
+		}
+		return strconv.Itoa(vm.Config.VCPUs)
+	}},
+	{Header: "Memory", Value: func(vm agentclient.MicroVMInfo) string {
+		if vm.Config == nil {
+			return ""
+		}
+		return fmt.Sprintf("%d MiB", vm.Config.MemoryMiB)
+	}},
+	{Header: "Kernel", Value: func(vm agentclient.MicroVMInfo) string {
+		if vm.Config == nil {
+			return ""
+		}
+		return vm.Config.Kernel
+	}},
+	{Header: "Rootfs", Value: func(vm agentclient.MicroVMInfo) string {
+		if vm.Config == nil {
+			return ""
+		}
+		return vm.Config.Rootfs
+	}},
+	{Header: "Labels", Value: func(vm agentclient.MicroVMInfo) string {
+		if len(vm.Labels) == 0 {
+			return ""
+		}
+		return formatLabels(vm.Labels)
+	}},
+	{Header: "Limits", Value: func(vm agentclient.MicroVMInfo) string {
+		r := vm.Resources
+		if r == nil {
+			return ""
+		}
+		limits := fmt.Sprintf("%d%% CPU, %d MiB memory", r.CPUPercent, r.MemoryMaxMiB)
+		if r.IODevice != "" {
+			limits += ", io " + r.IODevice
+		}
+		return limits
+	}},
+	{Header: "Created", Value: func(vm agentclient.MicroVMInfo) string { return vm.CreatedAt.Format(time.RFC3339) }},
+	{Header: "Expires", Value: func(vm agentclient.MicroVMInfo) string {
+		if vm.ExpiresAt == nil {
+			return ""
+		}
+		return vm.ExpiresAt.Local().Format(time.RFC3339)
+	}},
+	{Header: "Idle", Value: func(vm agentclient.MicroVMInfo) string {
+		if vm.IdleTimeout == "" {
+			return ""
+		}
+		return fmt.Sprintf("timeout %s, stops %s", vm.IdleTimeout, formatExpiry(agentclient.MicroVMInfo{IdleExpiresAt: vm.IdleExpiresAt}, time.Now()))
+	}},
 }
 
 func openMicroVMShell(ctx context.Context, name string) error {
-	_, agentURL, client, err := getVMConnection(ctx)
+	ac, err := getAgent(ctx)
 	if err != nil {
 		return err
 	}
 
 	// Resolve VM name to ID
-	vmID, err := resolveVMName(ctx, client, agentURL, name)
+	vmID, err := resolveVMName(ctx, ac, name)
 	if err != nil {
 		return err
 	}
@@ -320,52 +668,63 @@ func openMicroVMShell(ctx context.Context, name string) error {
 	fmt.Println()
 
 	// Connect to the VM-specific console
-	return connectToVMConsole(ctx, agentURL, vmID)
+	return connectToVMConsole(ctx, ac, vmID)
 }
 
-func stopMicroVM(ctx context.Context, name string, force, all bool) error {
-	_, agentURL, client, err := getVMConnection(ctx)
+func stopMicroVM(ctx context.Context, name string, force, all bool, selector string, async bool) error {
+	ac, err := getAgent(ctx)
 	if err != nil {
 		return err
 	}
 
-	if all {
-		// Stop all VMs
-		resp, err := client.Get(agentURL + "/agent/microvms")
+	if all || selector != "" {
+		// Stop all VMs, or all VMs matching the selector
+		vms, err := ac.List(ctx, selector)
 		if err != nil {
 			return fmt.Errorf("failed to list microVMs: %w", err)
 		}
 
-		var vms []MicroVMInfo
-		json.NewDecoder(resp.Body).Decode(&vms)
-		resp.Body.Close()
-
 		if len(vms) == 0 {
 			fmt.Println("No microVMs to stop")
 			return nil
 		}
 
+		var failed int
 		for _, vm := range vms {
-			if err := stopSingleVM(ctx, client, agentURL, vm.ID, force); err != nil {
+			if async {
+				if err := stopVMAsync(ctx, ac, vm.ID, force); err != nil {
+					logrus.Warnf("Failed to stop %s: %v", vm.Name, err)
+					failed++
+				}
+				continue
+			}
+			if err := stopSingleVM(ctx, ac, vm.ID, force); err != nil {
 				logrus.Warnf("Failed to stop %s: %v", vm.Name, err)
+				failed++
 			} else {
 				fmt.Printf("Stopped: %s\n", vm.Name)
 			}
 		}
+		if failed > 0 {
+			return fmt.Errorf("failed to stop %d of %d microVM(s)", failed, len(vms))
+		}
 		return nil
 	}
 
 	if name == "" {
-		return fmt.Errorf("--name is required (or use --all to stop all microVMs)")
+		return fmt.Errorf("--name is required (or use --all or --selector to stop several microVMs)")
 	}
 
 	// Resolve VM name to ID
-	vmID, err := resolveVMName(ctx, client, agentURL, name)
+	vmID, err := resolveVMName(ctx, ac, name)
 	if err != nil {
 		return err
 	}
 
-	if err := stopSingleVM(ctx, client, agentURL, vmID, force); err != nil {
+	if async {
+		return stopVMAsync(ctx, ac, vmID, force)
+	}
+	if err := stopSingleVM(ctx, ac, vmID, force); err != nil {
 		return err
 	}
 
@@ -373,28 +732,52 @@ func stopMicroVM(ctx context.Context, name string, force, all bool) error {
 	return nil
 }
 
-func stopSingleVM(ctx context.Context, client *http.Client, agentURL, vmID string, force bool) error {
-	url := fmt.Sprintf("%s/agent/microvms/%s", agentURL, vmID)
-	if force {
-		url += "?force=true"
+func extendMicroVM(ctx context.Context, name string, by time.Duration) error {
+	if by <= 0 {
+		return fmt.Errorf("--by must be positive")
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	ac, err := getAgent(ctx)
 	if err != nil {
 		return err
 	}
 
-	resp, err := client.Do(req)
+	vmID, err := resolveVMName(ctx, ac, name)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("stop failed: %s", string(body))
+	vm, err := ac.Extend(ctx, vmID, by)
+	if err != nil {
+		return fmt.Errorf("extend failed: %w", err)
 	}
 
+	fmt.Printf("%s now expires at %s\n", vm.Name, vm.ExpiresAt.Local().Format(time.RFC3339))
+	return nil
+}
+
+func stopSingleVM(ctx context.Context, ac *agentclient.Client, vmID string, force bool) error {
+	op, err := ac.DeleteAsync(ctx, vmID, force)
+	if err == nil {
+		_, err = followOperation(ctx, ac, op)
+	}
+	if err != nil {
+		return fmt.Errorf("stop failed: %w", err)
+	}
+	return nil
+}
+
+// stopVMAsync starts stopping a microVM and prints the operation to follow.
+func stopVMAsync(ctx context.Context, ac *agentclient.Client, vmID string, force bool) error {
+	op, err := ac.DeleteAsync(ctx, vmID, force)
+	if err != nil {
+		return fmt.Errorf("stop failed: %w", err)
+	}
+	if op.Done() {
+		fmt.Printf("Stopped: %s\n", op.MicroVM)
+		return nil
+	}
+	fmt.Printf("Stopping: %s (operation %s)\n", op.MicroVM, op.ID)
 	return nil
 }
 
@@ -439,3 +822,95 @@ func showMicroVMLogs(ctx context.Context, follow bool) error {
 
 	return cmd.Wait()
 }
+
+func showFirecrackerLogs(ctx context.Context, name string, follow bool, tail int) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	vmID, err := resolveVMName(ctx, ac, name)
+	if err != nil {
+		return err
+	}
+
+	logs, err := ac.FirecrackerLogs(ctx, vmID, tail, follow)
+	if err != nil {
+		return fmt.Errorf("failed to read Firecracker log: %w", err)
+	}
+	defer logs.Close()
+
+	if _, err := io.Copy(os.Stdout, logs); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func showMicroVMStats(ctx context.Context, p *printer.Printer, name string, rng time.Duration) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	vmID, err := resolveVMName(ctx, ac, name)
+	if err != nil {
+		return err
+	}
+
+	stats, err := ac.Stats(ctx, vmID, rng)
+	if err != nil {
+		return fmt.Errorf("failed to get stats: %w", err)
+	}
+
+	if !p.Human() {
+		return printer.Object(p, *stats, nil)
+	}
+
+	fmt.Printf("%s  (last %s, %s resolution, %d samples)\n", stats.Name, stats.Range, stats.Step, len(stats.Samples))
+	if len(stats.Samples) == 0 {
+		fmt.Println("No samples yet")
+		return nil
+	}
+
+	var cpu, mem []float64
+	var cpuMax float64
+	var memMax int64
+	for _, s := range stats.Samples {
+		cpu = append(cpu, s.CPUPercent)
+		mem = append(mem, float64(s.MemoryBytes))
+		if s.CPUPercent > cpuMax {
+			cpuMax = s.CPUPercent
+		}
+		if s.MemoryBytes > memMax {
+			memMax = s.MemoryBytes
+		}
+	}
+	first, last := stats.Samples[0], stats.Samples[len(stats.Samples)-1]
+
+	fmt.Println()
+	fmt.Printf("%-8s %-60s now %-10s max %s\n", "CPU", sparkline(cpu, 60),
+		fmt.Sprintf("%.1f%%", last.CPUPercent), fmt.Sprintf("%.1f%%", cpuMax))
+	fmt.Printf("%-8s %-60s now %-10s max %s\n", "MEMORY", sparkline(mem, 60),
+		formatBytes(last.MemoryBytes), formatBytes(memMax))
+	fmt.Println()
+	fmt.Printf("Over this range:\n")
+	fmt.Printf("  Block  read %s, written %s\n",
+		formatBytes(last.BlockReadBytes-first.BlockReadBytes), formatBytes(last.BlockWriteBytes-first.BlockWriteBytes))
+	fmt.Printf("  Net    received %s, sent %s\n",
+		formatBytes(last.NetRxBytes-first.NetRxBytes), formatBytes(last.NetTxBytes-first.NetTxBytes))
+	return nil
+}
+
+// formatBytes renders a byte count with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -1,9 +1,9 @@
 package cli
 
 import (
-	"encoding/json"
 	"fmt"
 
+	"github.com/anthropics/fc-macos/internal/printer"
 	"github.com/anthropics/fc-macos/pkg/api"
 	"github.com/spf13/cobra"
 )
@@ -80,47 +80,25 @@ func newNetworkListCmd() *cobra.Command {
 				return err
 			}
 
-			result, err := client.GetNetworkInterfaces(cmd.Context())
+			interfaces, err := client.GetNetworkInterfaces(cmd.Context())
 			if err != nil {
 				return fmt.Errorf("failed to get network interfaces: %w", err)
 			}
 
-			// Convert []interface{} to []api.NetworkInterface via JSON
-			var interfaces []api.NetworkInterface
-			data, err := json.Marshal(result)
+			p, err := newPrinter(cmd)
 			if err != nil {
 				return err
 			}
-			if err := json.Unmarshal(data, &interfaces); err != nil {
-				return err
-			}
-
-			if outputJSON {
-				data, err := json.MarshalIndent(interfaces, "", "  ")
-				if err != nil {
-					return err
-				}
-				fmt.Println(string(data))
-			} else {
-				if len(interfaces) == 0 {
-					fmt.Println("No network interfaces configured")
-					return nil
-				}
-				for _, iface := range interfaces {
-					fmt.Printf("ID: %s\n", iface.IfaceID)
-					fmt.Printf("  Host Device: %s\n", iface.HostDevName)
-					if iface.GuestMAC != "" {
-						fmt.Printf("  Guest MAC: %s\n", iface.GuestMAC)
-					}
-					fmt.Println()
-				}
+			if len(interfaces) == 0 && p.Human() {
+				fmt.Fprintln(cmd.OutOrStdout(), "No network interfaces configured")
+				return nil
 			}
-
-			return nil
+			return printer.List(p, interfaces, networkColumns)
 		},
 	}
 
 	cmd.Flags().BoolVar(&outputJSON, "json", false, "output in JSON format")
+	cmd.Flags().MarkDeprecated("json", "use --output json")
 
 	return cmd
 }
@@ -204,3 +182,10 @@ func newNetworkRemoveCmd() *cobra.Command {
 
 	return cmd
 }
+
+// networkColumns are the table columns of network list.
+var networkColumns = []printer.Column[*api.NetworkInterface]{
+	{Header: "ID", Value: func(n *api.NetworkInterface) string { return n.IfaceID }},
+	{Header: "HOST DEVICE", Value: func(n *api.NetworkInterface) string { return n.HostDevName }},
+	{Header: "GUEST MAC", Value: func(n *api.NetworkInterface) string { return n.GuestMAC }},
+}
@@ -0,0 +1,325 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/anthropics/fc-macos/internal/printer"
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newMicroVMOperationCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "operation",
+		Aliases: []string{"op"},
+		Short:   "Follow microVM creates, clones and stops",
+		Long: `The fc-agent creates, clones and stops microVMs in the background. Each is
+an operation that can be listed, followed and, unless it is a stop,
+cancelled.
+
+'fc-macos run --async', 'fc-macos microvm clone --async' and
+'fc-macos microvm stop --async' print the operation ID instead of waiting. The agent keeps finished operations for an
+hour.`,
+	}
+
+	cmd.AddCommand(newMicroVMOperationListCmd())
+	cmd.AddCommand(newMicroVMOperationStatusCmd())
+	cmd.AddCommand(newMicroVMOperationWaitCmd())
+	cmd.AddCommand(newMicroVMOperationCancelCmd())
+
+	return cmd
+}
+
+func newMicroVMOperationListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List recent operations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+			return listOperations(cmd.Context(), p)
+		},
+	}
+}
+
+func newMicroVMOperationStatusCmd() *cobra.Command {
+	var id string
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show an operation",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+			return showOperation(cmd.Context(), p, id)
+		},
+	}
+
+	cmd.Flags().StringVar(&id, "id", "", "operation ID (required)")
+	cmd.MarkFlagRequired("id")
+
+	return cmd
+}
+
+func newMicroVMOperationWaitCmd() *cobra.Command {
+	var id string
+
+	cmd := &cobra.Command{
+		Use:   "wait",
+		Short: "Wait for an operation to finish",
+		Long: `Wait for an operation to finish, showing its progress. Exits non-zero if the
+operation failed or was cancelled. Interrupting the wait cancels a create.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return waitOperation(cmd.Context(), id)
+		},
+	}
+
+	cmd.Flags().StringVar(&id, "id", "", "operation ID (required)")
+	cmd.MarkFlagRequired("id")
+
+	return cmd
+}
+
+func newMicroVMOperationCancelCmd() *cobra.Command {
+	var id string
+
+	cmd := &cobra.Command{
+		Use:   "cancel",
+		Short: "Cancel a create",
+		Long: `Cancel a running create. The agent stops Firecracker and releases the
+microVM's network and resources. Stops cannot be cancelled.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cancelOperation(cmd.Context(), id)
+		},
+	}
+
+	cmd.Flags().StringVar(&id, "id", "", "operation ID (required)")
+	cmd.MarkFlagRequired("id")
+
+	return cmd
+}
+
+// operationColumns are the table columns of microvm operation list.
+var operationColumns = []printer.Column[agentclient.Operation]{
+	{Header: "ID", Value: func(op agentclient.Operation) string { return op.ID }},
+	{Header: "TYPE", Value: func(op agentclient.Operation) string { return op.Type }},
+	{Header: "MICROVM", Value: func(op agentclient.Operation) string { return op.MicroVM }},
+	{Header: "STATUS", Value: func(op agentclient.Operation) string { return op.Status }},
+	{Header: "STEP", Value: operationStep},
+	{Header: "CREATED", Value: func(op agentclient.Operation) string { return op.CreatedAt.Local().Format("15:04:05") }},
+	{Header: "DURATION", Value: func(op agentclient.Operation) string {
+		if op.DoneAt == nil {
+			return "-"
+		}
+		return op.DoneAt.Sub(op.CreatedAt).Round(100 * time.Millisecond).String()
+	}},
+	{Header: "ERROR", Value: func(op agentclient.Operation) string {
+		if op.Error == "" {
+			return "-"
+		}
+		return op.Error
+	}, Wide: true},
+}
+
+// operationStep returns the name of the step op is on, or reached last. For
+// a batch, it is how many of its microVMs have started.
+func operationStep(op agentclient.Operation) string {
+	if len(op.Items) > 0 {
+		started := 0
+		for _, item := range op.Items {
+			if item.Status == agentclient.OperationSucceeded {
+				started++
+			}
+		}
+		return fmt.Sprintf("%d/%d started", started, len(op.Items))
+	}
+	if len(op.Steps) == 0 {
+		return "-"
+	}
+	return op.Steps[len(op.Steps)-1].Name
+}
+
+// operationTitle describes op for people, e.g. "Creating web".
+func operationTitle(op *agentclient.Operation) string {
+	switch op.Type {
+	case "create":
+		return "Creating " + op.MicroVM
+	case "delete":
+		return "Stopping " + op.MicroVM
+	case "batch":
+		return fmt.Sprintf("Creating %d microVMs (%s)", len(op.Items), op.MicroVM)
+	case "clone":
+		return "Creating clone " + op.MicroVM
+	}
+	return op.Type + " " + op.MicroVM
+}
+
+func listOperations(ctx context.Context, p *printer.Printer) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	ops, err := ac.Operations(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list operations: %w", err)
+	}
+
+	if p.Human() && len(ops) == 0 {
+		fmt.Println("No operations in the last hour")
+		return nil
+	}
+	return printer.List(p, ops, operationColumns)
+}
+
+func showOperation(ctx context.Context, p *printer.Printer, id string) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	op, err := ac.Operation(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get operation: %w", err)
+	}
+	if err := printer.Object(p, *op, operationColumns); err != nil {
+		return err
+	}
+	if p.Human() && len(op.Steps) > 0 {
+		fmt.Println()
+		fmt.Println("Steps:")
+		for _, step := range op.Steps {
+			took := "-"
+			if step.DoneAt != nil {
+				took = step.DoneAt.Sub(step.StartedAt).Round(time.Millisecond).String()
+			}
+			fmt.Printf("  %-22s %-10s %s\n", step.Name, step.Status, took)
+		}
+	}
+	return nil
+}
+
+func waitOperation(ctx context.Context, id string) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	op, err := ac.Operation(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get operation: %w", err)
+	}
+	if op, err = followOperation(ctx, ac, op); err != nil {
+		return fmt.Errorf("operation %s: %w", id, err)
+	}
+
+	fmt.Printf("%s: %s\n", operationTitle(op), op.Status)
+	return nil
+}
+
+func cancelOperation(ctx context.Context, id string) error {
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	op, err := ac.CancelOperation(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel operation: %w", err)
+	}
+
+	if op.Done() {
+		fmt.Printf("%s: %s\n", operationTitle(op), op.Status)
+	} else {
+		fmt.Printf("%s: cancelling (%s)\n", operationTitle(op), operationStep(*op))
+	}
+	return nil
+}
+
+// followOperation waits for op to finish, showing its progress on stderr. A
+// failed or cancelled operation is returned with an *OperationError.
+// Interrupting the wait cancels a create or batch create on the agent, so
+// that Ctrl+C does not leave half-started microVMs behind.
+func followOperation(ctx context.Context, ac *agentclient.Client, op *agentclient.Operation) (*agentclient.Operation, error) {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	progress := newOperationProgress(os.Stderr)
+	done, err := ac.Wait(ctx, op, progress.update)
+	progress.clear()
+
+	var opErr *agentclient.OperationError
+	switch {
+	case errors.As(err, &opErr):
+		return done, err
+	case err != nil && ctx.Err() != nil && op.Type != "delete":
+		// ctx is done, so cancel with a fresh one
+		cancelCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, cerr := ac.CancelOperation(cancelCtx, op.ID); cerr != nil {
+			logrus.Warnf("Failed to cancel operation %s: %v", op.ID, cerr)
+		}
+		return done, fmt.Errorf("cancelled %s", strings.ToLower(operationTitle(op)))
+	case err != nil:
+		return done, fmt.Errorf("waiting for operation %s: %w", op.ID, err)
+	}
+	return done, nil
+}
+
+// progressFrames animate the spinner shown while an operation runs.
+var progressFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// operationProgress shows the step an operation is on: as a spinner when
+// writing to a terminal, and otherwise as a log line per step.
+type operationProgress struct {
+	out   *os.File
+	tty   bool
+	start time.Time
+	frame int
+	step  string
+}
+
+func newOperationProgress(out *os.File) *operationProgress {
+	return &operationProgress{out: out, tty: term.IsTerminal(int(out.Fd())), start: time.Now()}
+}
+
+// update is called with each poll of the operation.
+func (p *operationProgress) update(op *agentclient.Operation) {
+	if op.Done() {
+		return
+	}
+	step := operationStep(*op)
+
+	if !p.tty {
+		if step != p.step && step != "-" {
+			logrus.Infof("%s: %s", operationTitle(op), step)
+		}
+		p.step = step
+		return
+	}
+
+	fmt.Fprintf(p.out, "\r\033[K%c %s: %s (%s)",
+		progressFrames[p.frame%len(progressFrames)], operationTitle(op), step, time.Since(p.start).Round(time.Second))
+	p.frame++
+}
+
+// clear removes the spinner line.
+func (p *operationProgress) clear() {
+	if p.tty && p.frame > 0 {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/anthropics/fc-macos/internal/printer"
+	"github.com/spf13/cobra"
+)
+
+// newPrinter returns a printer for the global --output and --format flags.
+func newPrinter(cmd *cobra.Command) (*printer.Printer, error) {
+	output, format, err := outputFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return printer.New(cmd.OutOrStdout(), output, format)
+}
+
+// outputFlags returns the --output and --format values. The deprecated
+// per-command --json flag still selects JSON, and, as in docker, a --format
+// that is just an output format such as json selects that output.
+func outputFlags(cmd *cobra.Command) (output, format string, err error) {
+	output, _ = cmd.Flags().GetString("output")
+	format, _ = cmd.Flags().GetString("format")
+	if f := cmd.Flags().Lookup("json"); f != nil && f.Changed && f.Value.String() == "true" {
+		output = printer.JSON
+	}
+	if slices.Contains(printer.Formats, format) {
+		if cmd.Flags().Changed("output") && output != format {
+			return "", "", fmt.Errorf("--format %s conflicts with --output %s", format, output)
+		}
+		output, format = format, ""
+	}
+	return output, format, nil
+}
+
+// validateOutput rejects bad --output and --format values before a command
+// does any work.
+func validateOutput(cmd *cobra.Command) error {
+	_, err := newPrinter(cmd)
+	return err
+}
+
+// structuredErrors wraps the RunE and PersistentPreRunE of cmd and its
+// subcommands so that with --output json or yaml a failure is printed to
+// stderr as an error document instead of cobra's "Error: ..." line.
+func structuredErrors(cmd *cobra.Command) {
+	if cmd.RunE != nil {
+		cmd.RunE = withStructuredErrors(cmd.RunE)
+	}
+	if cmd.PersistentPreRunE != nil {
+		cmd.PersistentPreRunE = withStructuredErrors(cmd.PersistentPreRunE)
+	}
+	for _, sub := range cmd.Commands() {
+		structuredErrors(sub)
+	}
+}
+
+func withStructuredErrors(run func(*cobra.Command, []string) error) func(*cobra.Command, []string) error {
+	return func(c *cobra.Command, args []string) error {
+		err := run(c, args)
+		if err == nil {
+			return nil
+		}
+		if p, perr := newErrorPrinter(c); perr == nil && p.Error(err) {
+			c.SilenceErrors = true
+		}
+		return err
+	}
+}
+
+func newErrorPrinter(cmd *cobra.Command) (*printer.Printer, error) {
+	output, _, err := outputFlags(cmd)
+	if err != nil {
+		output, _ = cmd.Flags().GetString("output")
+	}
+	if output != printer.JSON && output != printer.YAML {
+		return nil, fmt.Errorf("not a structured format")
+	}
+	return printer.New(cmd.ErrOrStderr(), output, "")
+}
+
+// optional formats n with format, or returns "" so the field is left out
+// when n is zero.
+func optional(n int64, format string) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf(format, n)
+}
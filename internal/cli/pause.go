@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// newMicroVMPauseCmd returns microvm pause, or microvm resume if pause is
+// false.
+func newMicroVMPauseCmd(pause bool) *cobra.Command {
+	var (
+		name     string
+		all      bool
+		selector string
+	)
+
+	verb, _ := pauseVerb(pause)
+	cmd := &cobra.Command{
+		Use:   verb,
+		Short: "Pause a running microVM",
+		Long: `Pause a running microVM's vCPUs.
+
+A paused microVM keeps its memory, devices and network address, and shows
+as paused in microvm list until it is resumed or stopped. Its guest cannot
+run commands over vsock meanwhile.`,
+		Example: `  # Free up CPU while a worker is not needed
+  fc-macos microvm pause --name worker-1
+
+  # Pause everything a CI job started
+  fc-macos microvm pause --selector team=ci,job=1234`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return pauseMicroVMs(cmd.Context(), name, all, selector, pause)
+		},
+	}
+	if !pause {
+		cmd.Short = "Resume a paused microVM"
+		cmd.Long = "Resume a microVM paused with microvm pause."
+		cmd.Example = `  # Resume one microVM
+  fc-macos microvm resume --name worker-1
+
+  # Resume everything a CI job started
+  fc-macos microvm resume --selector team=ci,job=1234`
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "microVM name or ID")
+	cmd.Flags().BoolVar(&all, "all", false, verb+" all microVMs")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", verb+" all microVMs matching a label selector")
+
+	return cmd
+}
+
+// pauseVerb returns "pause" and "Paused", or "resume" and "Resumed".
+func pauseVerb(pause bool) (verb, done string) {
+	if pause {
+		return "pause", "Paused"
+	}
+	return "resume", "Resumed"
+}
+
+func pauseMicroVMs(ctx context.Context, name string, all bool, selector string, pause bool) error {
+	verb, done := pauseVerb(pause)
+	if name == "" && !all && selector == "" {
+		return fmt.Errorf("--name is required (or use --all or --selector to %s several microVMs)", verb)
+	}
+	if name != "" && (all || selector != "") {
+		return fmt.Errorf("--name cannot be used with --all or --selector")
+	}
+
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	change := ac.Resume
+	if pause {
+		change = ac.Pause
+	}
+
+	if all || selector != "" {
+		vms, err := ac.List(ctx, selector)
+		if err != nil {
+			return fmt.Errorf("failed to list microVMs: %w", err)
+		}
+
+		// Only running microVMs can be paused or resumed
+		var targets []agentclient.MicroVMInfo
+		for _, vm := range vms {
+			if vm.Running && vm.Paused != pause {
+				targets = append(targets, vm)
+			}
+		}
+		if len(targets) == 0 {
+			fmt.Printf("No microVMs to %s\n", verb)
+			return nil
+		}
+
+		var failed int
+		for _, vm := range targets {
+			if _, err := change(ctx, vm.ID); err != nil {
+				logrus.Warnf("Failed to %s %s: %v", verb, vm.Name, err)
+				failed++
+			} else {
+				fmt.Printf("%s: %s\n", done, vm.Name)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to %s %d of %d microVM(s)", verb, failed, len(targets))
+		}
+		return nil
+	}
+
+	vmID, err := resolveVMName(ctx, ac, name)
+	if err != nil {
+		return err
+	}
+	if _, err := change(ctx, vmID); err != nil {
+		return fmt.Errorf("%s failed: %w", verb, err)
+	}
+
+	fmt.Printf("%s: %s\n", done, name)
+	return nil
+}
@@ -14,6 +14,8 @@ var cfgFile string
 
 // NewRootCmd creates the root command for fc-macos CLI.
 func NewRootCmd(version string) *cobra.Command {
+	cliVersion = version
+
 	rootCmd := &cobra.Command{
 		Use:   "fc-macos",
 		Short: "Run Firecracker microVMs on macOS",
@@ -23,6 +25,9 @@ using Apple's Virtualization Framework with nested virtualization.
 It creates a Linux VM with KVM support, and runs Firecracker inside it
 to provide the full Firecracker API on macOS.`,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutput(cmd); err != nil {
+				return err
+			}
 			return initConfig()
 		},
 		SilenceUsage: true,
@@ -36,6 +41,8 @@ to provide the full Firecracker API on macOS.`,
 	rootCmd.PersistentFlags().Int("cpus", 2, "number of CPUs for the intermediate VM")
 	rootCmd.PersistentFlags().Int("memory", 2048, "memory in MiB for the intermediate VM")
 	rootCmd.PersistentFlags().String("shared-dir", "", "directory to share with the VM via virtio-fs")
+	rootCmd.PersistentFlags().StringP("output", "o", "table", "output format: table, wide, json or yaml")
+	rootCmd.PersistentFlags().String("format", "", "format each result with a Go template (e.g. '{{.Name}}'), or one of table, wide, json or yaml")
 
 	// Bind flags to viper
 	viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level"))
@@ -50,6 +57,7 @@ to provide the full Firecracker API on macOS.`,
 	rootCmd.AddCommand(newSetupCmd())
 	rootCmd.AddCommand(newRunCmd())
 	rootCmd.AddCommand(newMicroVMCmd())
+	rootCmd.AddCommand(newAgentCmd())
 	rootCmd.AddCommand(newBootCmd())
 	rootCmd.AddCommand(newDrivesCmd())
 	rootCmd.AddCommand(newNetworkCmd())
@@ -60,6 +68,11 @@ to provide the full Firecracker API on macOS.`,
 	rootCmd.AddCommand(newBalloonCmd())
 	rootCmd.AddCommand(newVMCmd())
 	rootCmd.AddCommand(newDashboardCmd())
+	rootCmd.AddCommand(newUpCmd())
+	rootCmd.AddCommand(newDownCmd())
+	rootCmd.AddCommand(newPsCmd())
+
+	structuredErrors(rootCmd)
 
 	return rootCmd
 }
@@ -79,6 +92,7 @@ func initConfig() error {
 
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix("FC_MACOS")
+	viper.BindEnv("agent-token", "FC_MACOS_AGENT_TOKEN")
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
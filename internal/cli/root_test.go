@@ -1,8 +1,14 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
+	"strings"
 	"testing"
 
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/anthropics/fc-macos/pkg/api"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -29,6 +35,10 @@ func TestRootCmdHasSubcommands(t *testing.T) {
 		"metrics",
 		"balloon",
 		"vm",
+		"up",
+		"down",
+		"ps",
+		"agent",
 	}
 
 	for _, name := range subcommands {
@@ -144,3 +154,246 @@ func TestMicroVMStatusAcceptsNameFlag(t *testing.T) {
 	err := cmd.Execute()
 	require.NoError(t, err)
 }
+
+func TestMicroVMFirecrackerLogsRequiresName(t *testing.T) {
+	cmd := NewRootCmd("test")
+	cmd.SetArgs([]string{"microvm", "firecracker-logs", "-f"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "required flag")
+}
+
+func TestMicroVMStatsRequiresName(t *testing.T) {
+	cmd := NewRootCmd("test")
+	cmd.SetArgs([]string{"microvm", "stats", "--json"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "required flag")
+}
+
+func TestSparkline(t *testing.T) {
+	assert.Equal(t, "▁▄█", sparkline([]float64{0, 50, 100}, 10))
+	assert.Equal(t, "▁█", sparkline([]float64{100, 0, 100}, 2), "only the last width values are drawn")
+	assert.Equal(t, "▁▁▁", sparkline([]float64{7, 7, 7}, 10))
+	assert.Equal(t, "", sparkline(nil, 10))
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "128.0 MiB", formatBytes(128<<20))
+}
+
+func TestRejectsUnknownOutputFormat(t *testing.T) {
+	cmd := NewRootCmd("test")
+	cmd.SetArgs([]string{"microvm", "top", "--output", "xml"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid output format "xml"`)
+}
+
+func TestRejectsTemplateWithJSON(t *testing.T) {
+	cmd := NewRootCmd("test")
+	cmd.SetArgs([]string{"microvm", "list", "-o", "json", "--format", "{{.Name}}"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be combined")
+}
+
+func TestErrorsAreJSONInJSONMode(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	cmd := NewRootCmd("test")
+	var stdout, stderr bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	cmd.SetArgs([]string{"vm", "status", "-o", "json"})
+
+	require.Error(t, cmd.Execute())
+	assert.Empty(t, stdout.String())
+
+	var doc map[string]string
+	require.NoError(t, json.Unmarshal(stderr.Bytes(), &doc))
+	assert.Equal(t, "tart not found", doc["error"])
+}
+
+func TestWriteUsageTable(t *testing.T) {
+	target, actual := int64(64), int64(48)
+	var buf bytes.Buffer
+	writeUsageTable(&buf, []agentclient.MicroVMUsage{
+		{Name: "web", Running: true, CPUPercent: 12.5, MemoryBytes: 100 << 20, MemoryMiB: 256,
+			BlockReadBytes: 2048, NetTxBytes: 512, BalloonTargetMiB: &target, BalloonActualMiB: &actual},
+		{Name: "batch"},
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[1], "12.5%")
+	assert.Contains(t, lines[1], "100.0 MiB / 256.0 MiB")
+	assert.Contains(t, lines[1], "48/64 MiB")
+	assert.Contains(t, lines[1], "2.0 KiB / 0 B")
+	assert.Contains(t, lines[2], "stopped")
+}
+
+func TestMicroVMExtendRequiresName(t *testing.T) {
+	cmd := NewRootCmd("test")
+	cmd.SetArgs([]string{"microvm", "extend", "--by", "1h"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "required flag")
+}
+
+func TestAgentTokenCreateRequiresScope(t *testing.T) {
+	cmd := NewRootCmd("test")
+	cmd.SetArgs([]string{"agent", "token", "create", "--name", "ci"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "required flag")
+}
+
+func TestMicroVMOperationWaitRequiresID(t *testing.T) {
+	cmd := NewRootCmd("test")
+	cmd.SetArgs([]string{"microvm", "op", "wait"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "required flag")
+}
+
+func TestRunCountRequiresNamePrefix(t *testing.T) {
+	cmd := NewRootCmd("test")
+	cmd.SetArgs([]string{"run", "--count", "3"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--count needs --name-prefix")
+}
+
+func TestMicroVMCloneRequiresName(t *testing.T) {
+	cmd := NewRootCmd("test")
+	cmd.SetArgs([]string{"microvm", "clone", "--to", "web-debug"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "required flag")
+}
+
+func TestMicroVMPauseRequiresTarget(t *testing.T) {
+	for _, sub := range []string{"pause", "resume"} {
+		cmd := NewRootCmd("test")
+		cmd.SetArgs([]string{"microvm", sub})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "--name is required")
+
+		for _, flag := range []string{"--all", "--selector=team=ci"} {
+			cmd = NewRootCmd("test")
+			cmd.SetArgs([]string{"microvm", sub, "--name", "web", flag})
+			err = cmd.Execute()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "--name cannot be used with --all or --selector")
+		}
+	}
+}
+
+func TestThrottleProfileNamed(t *testing.T) {
+	t.Cleanup(func() { viper.Set("throttle-profiles", nil) })
+
+	// Misspelt limits are caught instead of ignored
+	viper.Set("throttle-profiles", map[string]interface{}{
+		"typo": map[string]interface{}{
+			"drive": map[string]interface{}{"bandwith": map[string]interface{}{"size": 1}},
+		},
+	})
+	_, err := throttleProfileNamed("typo")
+	assert.ErrorContains(t, err, `unknown field "bandwith"`)
+
+	viper.Set("throttle-profiles", map[string]interface{}{
+		"slow-disk": map[string]interface{}{
+			"drive": map[string]interface{}{
+				"bandwidth": map[string]interface{}{"size": 1048576, "refill_time": 1000},
+			},
+		},
+		"empty": map[string]interface{}{},
+	})
+
+	profile, err := throttleProfileNamed("slow-disk")
+	require.NoError(t, err)
+	assert.Equal(t, &api.RateLimiter{Bandwidth: &api.TokenBucket{Size: 1048576, RefillTime: 1000}}, profile.Drive)
+	assert.False(t, profile.network())
+
+	_, err = throttleProfileNamed("empty")
+	assert.ErrorContains(t, err, "sets no drive, rx or tx limits")
+
+	_, err = throttleProfileNamed("3g")
+	assert.ErrorContains(t, err, "(have: empty, slow-disk)")
+}
+
+func TestMicroVMThrottleNeedsProfile(t *testing.T) {
+	cmd := NewRootCmd("test")
+	cmd.SetArgs([]string{"microvm", "throttle", "--name", "web", "--profile", "slow-disk", "--clear"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be used together")
+}
+
+func TestNoRateLimit(t *testing.T) {
+	// Firecracker only turns off buckets that are sent with a zero size
+	data, err := json.Marshal(noRateLimit())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"bandwidth":{"size":0,"refill_time":0},"ops":{"size":0,"refill_time":0}}`, string(data))
+}
+
+func TestComposeLogWriterColor(t *testing.T) {
+	var out bytes.Buffer
+	w := &composeLogWriter{out: &out, width: 5}
+	w.println("web", "36", "booted")
+	assert.Equal(t, "web   | booted\n", out.String())
+
+	out.Reset()
+	w.color = true
+	w.println("web", "36", "booted")
+	assert.Equal(t, "\033[36mweb   |\033[0m booted\n", out.String())
+
+	// go test's stdout is not a terminal
+	assert.False(t, newComposeLogWriter().color)
+}
+
+func TestFormatNameSelectsOutput(t *testing.T) {
+	top, _, err := NewRootCmd("test").Find([]string{"microvm", "top"})
+	require.NoError(t, err)
+	require.NoError(t, top.ParseFlags([]string{"--format", "json"}))
+	output, format, err := outputFlags(top)
+	require.NoError(t, err)
+	assert.Equal(t, "json", output)
+	assert.Empty(t, format)
+
+	top, _, err = NewRootCmd("test").Find([]string{"microvm", "top"})
+	require.NoError(t, err)
+	require.NoError(t, top.ParseFlags([]string{"-o", "yaml", "--format", "json"}))
+	_, _, err = outputFlags(top)
+	assert.ErrorContains(t, err, "conflicts with --output yaml")
+}
+
+func TestPreRunErrorsAreStructured(t *testing.T) {
+	cmd := NewRootCmd("test")
+	var stderr bytes.Buffer
+	cmd.SetErr(&stderr)
+	cmd.SetArgs([]string{"version", "-o", "json", "--log-level", "loud"})
+	require.Error(t, cmd.Execute())
+
+	var doc struct {
+		Error string `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(stderr.Bytes(), &doc), stderr.String())
+	assert.Contains(t, doc.Error, "invalid log level")
+}
@@ -1,12 +1,11 @@
 package cli
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -15,29 +14,42 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/anthropics/fc-macos/pkg/agentclient"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 )
 
-// MicroVMInfo matches the agent's response structure
-type MicroVMInfo struct {
-	ID           string         `json:"id"`
-	Name         string         `json:"name"`
-	Running      bool           `json:"running"`
-	PID          int            `json:"pid,omitempty"`
-	CreatedAt    time.Time      `json:"created_at"`
-	Config       *MicroVMConfig `json:"config,omitempty"`
-	CPUPercent   float64        `json:"cpu_percent,omitempty"`
-	MemoryUsedMB int            `json:"memory_used_mb,omitempty"`
+// Default microVM settings, shared by run and compose.
+const (
+	defaultMicroVMKernel   = "/var/lib/firecracker/kernels/vmlinux"
+	defaultMicroVMRootfs   = "/var/lib/firecracker/rootfs/alpine-shell.ext4"
+	defaultMicroVMBootArgs = "console=ttyS0 reboot=k panic=1 pci=off init=/init"
+)
+
+// AgentToken matches a token in the agent's /agent/tokens responses. Token
+// is only set when the token is created.
+type AgentToken struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	Selector  string    `json:"selector,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Token     string    `json:"token,omitempty"`
 }
 
-type MicroVMConfig struct {
-	VCPUs     int    `json:"vcpus"`
-	MemoryMiB int    `json:"memory_mib"`
-	Kernel    string `json:"kernel"`
-	Rootfs    string `json:"rootfs"`
-	BootArgs  string `json:"boot_args"`
+// AuditEntry matches an entry in the agent's GET /agent/audit response.
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Remote     string    `json:"remote"`
+	Token      string    `json:"token,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	MicroVM    string    `json:"microvm,omitempty"`
+	BodySHA256 string    `json:"body_sha256,omitempty"`
+	Status     int       `json:"status"`
+	Denied     string    `json:"denied,omitempty"`
+	Operation  string    `json:"operation,omitempty"`
+	Outcome    string    `json:"outcome,omitempty"`
 }
 
 func newRunCmd() *cobra.Command {
@@ -49,6 +61,14 @@ func newRunCmd() *cobra.Command {
 		rootfs     string
 		bootArgs   string
 		background bool
+		async      bool
+		idemKey    string
+		labels     map[string]string
+		ttl        time.Duration
+		idle       time.Duration
+		limits     agentclient.ResourceLimits
+		fcLogLevel string
+		batch      batchOptions
 	)
 
 	cmd := &cobra.Command{
@@ -71,24 +91,76 @@ This command will:
   fc-macos run --name web-server --vcpus 2 --memory 512
 
   # Start in background
-  fc-macos run --name worker-1 --background`,
+  fc-macos run --name worker-1 --background
+
+  # Tag a CI microVM so it can be cleaned up by selector
+  fc-macos run --background --label team=ci --label job=1234
+
+  # Stop automatically after 2 hours, or after 15 minutes without activity
+  fc-macos run --background --ttl 2h --idle-timeout 15m
+
+  # Cap a noisy microVM at half a CPU and 10 MB/s of disk writes
+  fc-macos run --background --cpu-percent 50 --io-write-bps 10485760
+
+  # Return as soon as the agent has accepted the create
+  fc-macos run --name worker-1 --async
+  fc-macos microvm operation wait --id <operation>
+
+  # Safe to re-run if the CI step is retried: the same key never starts a
+  # second microVM
+  fc-macos run --name ci-1234 --async --idempotency-key job-1234
+
+  # Start 20 identical microVMs for a load test, 8 at a time, and stop them
+  # all again if any fails to boot
+  fc-macos run --count 20 --name-prefix worker --parallel 8 --rollback
+
+  # Debug a microVM that fails to boot
+  fc-macos run --name broken --background --fc-log-level Debug
+  fc-macos microvm firecracker-logs --name broken`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runMicroVM(cmd.Context(), name, vcpus, memoryMiB, kernel, rootfs, bootArgs, background)
+			var resources *agentclient.ResourceLimits
+			if limits != (agentclient.ResourceLimits{}) {
+				resources = &limits
+			}
+			var batchOpts *batchOptions
+			if batch.count != 1 {
+				if err := batch.validate(name, idemKey); err != nil {
+					return err
+				}
+				batchOpts = &batch
+			}
+			return runMicroVM(cmd.Context(), name, vcpus, memoryMiB, kernel, rootfs, bootArgs, background, async, idemKey, labels, ttl, idle, resources, fcLogLevel, batchOpts)
 		},
 	}
 
 	cmd.Flags().StringVar(&name, "name", "", "name for the microVM (auto-generated if not provided)")
 	cmd.Flags().IntVar(&vcpus, "vcpus", 1, "number of vCPUs for the microVM")
 	cmd.Flags().IntVar(&memoryMiB, "memory", 128, "memory in MiB for the microVM")
-	cmd.Flags().StringVar(&kernel, "kernel", "/var/lib/firecracker/kernels/vmlinux", "path to kernel inside the VM")
-	cmd.Flags().StringVar(&rootfs, "rootfs", "/var/lib/firecracker/rootfs/alpine-shell.ext4", "path to rootfs inside the VM")
-	cmd.Flags().StringVar(&bootArgs, "boot-args", "console=ttyS0 reboot=k panic=1 pci=off init=/init", "kernel boot arguments")
+	cmd.Flags().StringVar(&kernel, "kernel", defaultMicroVMKernel, "path to kernel inside the VM")
+	cmd.Flags().StringVar(&rootfs, "rootfs", defaultMicroVMRootfs, "path to rootfs inside the VM")
+	cmd.Flags().StringVar(&bootArgs, "boot-args", defaultMicroVMBootArgs, "kernel boot arguments")
 	cmd.Flags().BoolVar(&background, "background", false, "run in background")
+	cmd.Flags().BoolVar(&async, "async", false, "print the operation ID instead of waiting for the microVM to boot (implies --background)")
+	cmd.Flags().StringVar(&idemKey, "idempotency-key", "", "reuse the microVM created by an earlier run with this key instead of starting another")
+	cmd.Flags().StringToStringVar(&labels, "label", nil, "label to attach to the microVM (key=value, repeatable)")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "stop the microVM this long after it starts (e.g. 2h)")
+	cmd.Flags().DurationVar(&idle, "idle-timeout", 0, "stop the microVM after this long without console or vsock activity")
+	cmd.Flags().IntVar(&limits.CPUPercent, "cpu-percent", 0, "cgroup CPU limit, 100 = one CPU (default: vcpus x 100)")
+	cmd.Flags().IntVar(&limits.MemoryMaxMiB, "memory-max", 0, "cgroup memory limit in MiB (default: memory + VMM overhead)")
+	cmd.Flags().Int64Var(&limits.IOReadBPS, "io-read-bps", 0, "rootfs disk read limit in bytes/s")
+	cmd.Flags().Int64Var(&limits.IOWriteBPS, "io-write-bps", 0, "rootfs disk write limit in bytes/s")
+	cmd.Flags().Int64Var(&limits.IOReadIOPS, "io-read-iops", 0, "rootfs disk read limit in operations/s")
+	cmd.Flags().Int64Var(&limits.IOWriteIOPS, "io-write-iops", 0, "rootfs disk write limit in operations/s")
+	cmd.Flags().StringVar(&fcLogLevel, "fc-log-level", "", "Firecracker log level: Error, Warning, Info, Debug or Trace (default: Warning)")
+	cmd.Flags().IntVar(&batch.count, "count", 1, "number of identical microVMs to start (implies --background)")
+	cmd.Flags().StringVar(&batch.namePrefix, "name-prefix", "", "with --count, name the microVMs <prefix>-1 to <prefix>-N, or replace {n} in it")
+	cmd.Flags().IntVar(&batch.parallel, "parallel", 0, "with --count, how many microVMs boot at once (default: 4)")
+	cmd.Flags().BoolVar(&batch.rollback, "rollback", false, "with --count, stop all the microVMs again if any fails to start")
 
 	return cmd
 }
 
-func runMicroVM(ctx context.Context, name string, vcpus, memoryMiB int, kernel, rootfs, bootArgs string, background bool) error {
+func runMicroVM(ctx context.Context, name string, vcpus, memoryMiB int, kernel, rootfs, bootArgs string, background, async bool, idempotencyKey string, labels map[string]string, ttl, idleTimeout time.Duration, resources *agentclient.ResourceLimits, fcLogLevel string, batch *batchOptions) error {
 	tartPath := findTart()
 	if tartPath == "" {
 		return fmt.Errorf("tart not found")
@@ -112,13 +184,10 @@ func runMicroVM(ctx context.Context, name string, vcpus, memoryMiB int, kernel,
 	logrus.Infof("Connecting to fc-agent at %s:8080", vmIP)
 
 	// Wait for agent to be ready
-	agentURL := fmt.Sprintf("http://%s:8080", vmIP)
-	client := &http.Client{Timeout: 10 * time.Second}
+	agentURL := AgentURL(vmIP)
 
 	for i := 0; i < 10; i++ {
-		resp, err := client.Get(agentURL + "/health")
-		if err == nil && resp.StatusCode == 200 {
-			resp.Body.Close()
+		if err := newAgentAPI(agentURL, 10*time.Second, false).Health(ctx); err == nil {
 			break
 		}
 		if i == 9 {
@@ -127,43 +196,47 @@ func runMicroVM(ctx context.Context, name string, vcpus, memoryMiB int, kernel,
 		time.Sleep(time.Second)
 	}
 
-	// Create microVM via new API
-	logrus.Info("Creating microVM...")
-
-	createReq := map[string]interface{}{
-		"name":       name, // Empty string means auto-generate
-		"kernel":     kernel,
-		"rootfs":     rootfs,
-		"vcpus":      vcpus,
-		"memory_mib": memoryMiB,
-		"boot_args":  bootArgs,
-	}
-
-	reqBody, err := json.Marshal(createReq)
+	ac, _, err := connectAgent(ctx, agentURL, 10*time.Second)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", agentURL+"/agent/microvms", bytes.NewReader(reqBody))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	// Create microVM via new API
+	if batch != nil {
+		logrus.Infof("Creating %d microVMs...", batch.count)
+	} else {
+		logrus.Info("Creating microVM...")
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to create microVM: %w", err)
-	}
-	defer resp.Body.Close()
+	req := &agentclient.CreateMicroVMRequest{
+		Name:      name, // Empty string means auto-generate
+		Labels:    labels,
+		Kernel:    kernel,
+		Rootfs:    rootfs,
+		VCPUs:     vcpus,
+		MemoryMiB: memoryMiB,
+		BootArgs:  bootArgs,
+		Resources: resources,
 
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to create microVM: %s", string(body))
-	}
+		FCLogLevel: fcLogLevel,
 
-	var vmInfo MicroVMInfo
-	if err := json.NewDecoder(resp.Body).Decode(&vmInfo); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+		IdempotencyKey: idempotencyKey,
+	}
+	if ttl > 0 {
+		req.TTL = ttl.String()
+	}
+	if idleTimeout > 0 {
+		req.IdleTimeout = idleTimeout.String()
+	}
+	if batch != nil {
+		return runMicroVMBatch(ctx, ac, req, batch, async)
+	}
+	if async {
+		return startMicroVMAsync(ctx, ac, req)
+	}
+	vmInfo, err := createMicroVMViaAgent(ctx, ac, req)
+	if err != nil {
+		return err
 	}
 
 	fmt.Println()
@@ -174,6 +247,15 @@ func runMicroVM(ctx context.Context, name string, vcpus, memoryMiB int, kernel,
 	fmt.Printf("Memory: %d MiB\n", vmInfo.Config.MemoryMiB)
 	fmt.Printf("Kernel: %s\n", vmInfo.Config.Kernel)
 	fmt.Printf("Rootfs: %s\n", vmInfo.Config.Rootfs)
+	if len(vmInfo.Labels) > 0 {
+		fmt.Printf("Labels: %s\n", formatLabels(vmInfo.Labels))
+	}
+	if vmInfo.ExpiresAt != nil {
+		fmt.Printf("Expires: %s\n", vmInfo.ExpiresAt.Local().Format(time.RFC3339))
+	}
+	if vmInfo.IdleTimeout != "" {
+		fmt.Printf("Idle timeout: %s\n", vmInfo.IdleTimeout)
+	}
 	fmt.Println()
 
 	if background {
@@ -194,31 +276,160 @@ func runMicroVM(ctx context.Context, name string, vcpus, memoryMiB int, kernel,
 	fmt.Println("Press Ctrl+] to exit")
 	fmt.Println()
 
-	return connectToVMConsole(ctx, agentURL, vmInfo.ID)
+	return connectToVMConsole(ctx, ac, vmInfo.ID)
 }
 
-// connectToVMConsole connects to a specific microVM's console
-func connectToVMConsole(ctx context.Context, agentURL string, vmID string) error {
-	// Connect to the console endpoint for this VM
-	conn, err := net.Dial("tcp", strings.TrimPrefix(agentURL, "http://"))
+// createMicroVMViaAgent asks the agent to create and boot a microVM, showing
+// its progress until it is running.
+func createMicroVMViaAgent(ctx context.Context, ac *agentclient.Client, createReq *agentclient.CreateMicroVMRequest) (*agentclient.MicroVMInfo, error) {
+	setIdempotencyKey(createReq)
+	op, err := ac.CreateAsync(ctx, createReq)
+	if err == nil {
+		op, err = followOperation(ctx, ac, op)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to connect to agent: %w", err)
+		return nil, fmt.Errorf("failed to create microVM: %w", err)
 	}
-	defer conn.Close()
+	return op.Result, nil
+}
 
-	// Send HTTP request for VM-specific console
-	fmt.Fprintf(conn, "GET /agent/microvms/%s/console HTTP/1.1\r\nHost: localhost\r\n\r\n", vmID)
+// startMicroVMAsync asks the agent to create a microVM and prints the
+// operation to follow instead of waiting for it to boot.
+func startMicroVMAsync(ctx context.Context, ac *agentclient.Client, createReq *agentclient.CreateMicroVMRequest) error {
+	setIdempotencyKey(createReq)
+	op, err := ac.CreateAsync(ctx, createReq)
+	if err != nil {
+		return fmt.Errorf("failed to create microVM: %w", err)
+	}
+	if op.Done() {
+		// Agents from before operations answer once the microVM is running
+		fmt.Printf("Started microVM %s\n", op.MicroVM)
+		return nil
+	}
 
-	// Read HTTP response header
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
+	fmt.Printf("Creating microVM %s (operation %s)\n", op.MicroVM, op.ID)
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Printf("  fc-macos microvm operation wait --id %s\n", op.ID)
+	fmt.Printf("  fc-macos microvm operation cancel --id %s\n", op.ID)
+	fmt.Printf("  fc-macos microvm status --name %s\n", op.MicroVM)
+	return nil
+}
+
+// batchOptions are run's flags for starting several identical microVMs.
+type batchOptions struct {
+	count      int
+	namePrefix string
+	parallel   int
+	rollback   bool
+}
+
+// validate checks the batch flags, and that they are not combined with
+// flags that only make sense for one microVM.
+func (b *batchOptions) validate(name, idempotencyKey string) error {
+	switch {
+	case b.count < 1:
+		return fmt.Errorf("--count must be at least 1")
+	case b.namePrefix == "":
+		return fmt.Errorf("--count needs --name-prefix")
+	case name != "":
+		return fmt.Errorf("--name cannot be used with --count; use --name-prefix")
+	case idempotencyKey != "":
+		return fmt.Errorf("--idempotency-key cannot be used with --count")
+	}
+	return nil
+}
+
+// pattern returns the name pattern for the batch, such as "worker-{n}".
+func (b *batchOptions) pattern() string {
+	if strings.Contains(b.namePrefix, "{n}") {
+		return b.namePrefix
+	}
+	return b.namePrefix + "-{n}"
+}
+
+// runMicroVMBatch starts batch.count microVMs from template and reports how
+// each of them went.
+func runMicroVMBatch(ctx context.Context, ac *agentclient.Client, template *agentclient.CreateMicroVMRequest, batch *batchOptions, async bool) error {
+	op, err := ac.BatchCreateAsync(ctx, &agentclient.BatchCreateRequest{
+		Name:        batch.pattern(),
+		Count:       batch.count,
+		Template:    *template,
+		Parallelism: batch.parallel,
+		Rollback:    batch.rollback,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return fmt.Errorf("failed to create microVMs: %w", err)
 	}
-	// Skip the HTTP header (we expect 200 OK)
-	if !strings.Contains(string(buf[:n]), "200 OK") {
-		return fmt.Errorf("console not available: %s", string(buf[:n]))
+
+	if async {
+		fmt.Printf("Creating %d microVMs named %s (operation %s)\n", batch.count, op.MicroVM, op.ID)
+		fmt.Println()
+		fmt.Println("Commands:")
+		fmt.Printf("  fc-macos microvm operation wait --id %s\n", op.ID)
+		fmt.Printf("  fc-macos microvm operation status --id %s\n", op.ID)
+		return nil
+	}
+
+	op, err = followOperation(ctx, ac, op)
+	if len(op.Items) > 0 {
+		fmt.Println()
+		fmt.Printf("%-24s %-10s %-16s %s\n", "NAME", "STATUS", "IP", "ERROR")
+		for _, item := range op.Items {
+			ip, errMsg := "-", "-"
+			if item.Result != nil && item.Result.Network != nil {
+				ip = item.Result.Network.IP
+			}
+			if item.Error != "" {
+				errMsg = item.Error
+			}
+			fmt.Printf("%-24s %-10s %-16s %s\n", item.Name, item.Status, ip, errMsg)
+		}
+		fmt.Println()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create microVMs: %w", err)
+	}
+
+	fmt.Printf("Started %d microVMs\n", batch.count)
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  fc-macos microvm list")
+	fmt.Printf("  fc-macos microvm stop --name %s\n", strings.ReplaceAll(op.MicroVM, "{n}", "1"))
+	return nil
+}
+
+// setIdempotencyKey gives a create without an idempotency key a random one,
+// so that the client can safely retry it if the connection drops.
+func setIdempotencyKey(createReq *agentclient.CreateMicroVMRequest) {
+	if createReq.IdempotencyKey != "" {
+		return
 	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return
+	}
+	createReq.IdempotencyKey = hex.EncodeToString(buf)
+}
+
+// openVMConsoleStream attaches to a microVM's console without taking over the
+// terminal. The returned body streams console output until it is closed.
+func openVMConsoleStream(ctx context.Context, ac *agentclient.Client, vmID string) (io.ReadCloser, error) {
+	console, err := ac.Console(ctx, vmID)
+	if err != nil {
+		return nil, fmt.Errorf("console not available: %w", err)
+	}
+	return console, nil
+}
+
+// connectToVMConsole connects to a specific microVM's console
+func connectToVMConsole(ctx context.Context, ac *agentclient.Client, vmID string) error {
+	// Connect to the console endpoint for this VM
+	conn, err := ac.Console(ctx, vmID)
+	if err != nil {
+		return fmt.Errorf("console not available: %w", err)
+	}
+	defer conn.Close()
 
 	// Set terminal to raw mode
 	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
@@ -290,14 +501,14 @@ func connectToVMConsole(ctx context.Context, agentURL string, vmID string) error
 // Legacy console connection (for backward compatibility)
 func connectToConsole(ctx context.Context, agentURL string) error {
 	// Connect to the legacy console endpoint
-	conn, err := net.Dial("tcp", strings.TrimPrefix(agentURL, "http://"))
+	conn, err := dialAgent(ctx, agentURL)
 	if err != nil {
 		return fmt.Errorf("failed to connect to agent: %w", err)
 	}
 	defer conn.Close()
 
 	// Send HTTP request for console
-	fmt.Fprintf(conn, "GET /console HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	fmt.Fprintf(conn, "GET /console HTTP/1.1\r\nHost: localhost\r\n%s\r\n", agentAuthHeader())
 
 	// Read HTTP response header
 	buf := make([]byte, 1024)
@@ -45,6 +45,8 @@ tar -xzf /tmp/firecracker.tgz -C /tmp
 echo "Installing Firecracker..."
 sudo mv /tmp/release-v${FC_VERSION}-${ARCH}/firecracker-v${FC_VERSION}-${ARCH} /usr/local/bin/firecracker
 sudo chmod +x /usr/local/bin/firecracker
+sudo mv /tmp/release-v${FC_VERSION}-${ARCH}/jailer-v${FC_VERSION}-${ARCH} /usr/local/bin/jailer
+sudo chmod +x /usr/local/bin/jailer
 
 # Verify installation
 echo "Verifying Firecracker installation..."
@@ -84,6 +86,7 @@ func newSetupCmd() *cobra.Command {
 		skipAssets bool
 		cpus       int
 		memoryMiB  int
+		useTLS     bool
 	)
 
 	cmd := &cobra.Command{
@@ -96,7 +99,11 @@ This command will:
 2. Start the VM with nested virtualization
 3. Install Firecracker inside the VM
 4. Download a sample kernel and rootfs
-5. Install and start the fc-agent`,
+5. Install and start the fc-agent
+
+The agent API requires a bearer token, generated on first setup and kept in
+~/.fc-macos/agent/token. With --tls (the default) setup also creates a local
+CA and serves the API over HTTPS. --force rotates the token and CA.`,
 		Example: `  # Initial setup
   fc-macos setup
 
@@ -109,7 +116,7 @@ This command will:
   # Setup without downloading kernel/rootfs (use your own)
   fc-macos setup --skip-assets`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runSetup(cmd.Context(), force, skipAssets, cpus, memoryMiB)
+			return runSetup(cmd.Context(), force, skipAssets, useTLS, cpus, memoryMiB)
 		},
 	}
 
@@ -117,11 +124,12 @@ This command will:
 	cmd.Flags().BoolVar(&skipAssets, "skip-assets", false, "skip downloading kernel and rootfs")
 	cmd.Flags().IntVar(&cpus, "cpus", 4, "number of CPUs for the Linux VM")
 	cmd.Flags().IntVar(&memoryMiB, "memory", 4096, "memory in MiB for the Linux VM")
+	cmd.Flags().BoolVar(&useTLS, "tls", true, "serve the fc-agent API over TLS with a self-signed CA")
 
 	return cmd
 }
 
-func runSetup(ctx context.Context, force, skipAssets bool, cpus, memoryMiB int) error {
+func runSetup(ctx context.Context, force, skipAssets, useTLS bool, cpus, memoryMiB int) error {
 	tartPath := findTart()
 	if tartPath == "" {
 		return fmt.Errorf("tart not found. Install from: https://github.com/cirruslabs/tart/releases")
@@ -279,12 +287,18 @@ sudo chmod 666 /var/lib/firecracker/rootfs/ubuntu-rw.ext4`, "", 1)
 			logrus.Debugf("fc-agent installed: %s", string(output))
 		}
 
+		// Install credentials
+		agentArgs, err := installAgentCredentials(ctx, tartPath, vmName, useTLS, force)
+		if err != nil {
+			return fmt.Errorf("failed to install agent credentials: %w", err)
+		}
+
 		// Start agent
 		logrus.Info("Starting fc-agent...")
 		exec.CommandContext(ctx, tartPath, "exec", vmName, "sh", "-c",
 			"sudo pkill fc-agent 2>/dev/null || true").Run()
 		exec.CommandContext(ctx, tartPath, "exec", vmName, "sh", "-c",
-			"nohup sudo /usr/local/bin/fc-agent > /var/log/fc-agent.log 2>&1 &").Run()
+			fmt.Sprintf("nohup sudo /usr/local/bin/fc-agent %s > /var/log/fc-agent.log 2>&1 &", agentArgs)).Run()
 
 		// Wait for agent to be ready
 		time.Sleep(2 * time.Second)
@@ -491,6 +505,40 @@ func transferAgentViaHTTP(ctx context.Context, tartPath, vmName, vmIP, agentPath
 	return nil
 }
 
+// installAgentCredentials writes the API token and, with TLS, the server
+// certificate into the Linux VM. It returns the fc-agent flags that use them.
+func installAgentCredentials(ctx context.Context, tartPath, vmName string, useTLS, rotate bool) (string, error) {
+	creds, err := ensureAgentCredentials(agentConfigDir(), useTLS, rotate)
+	if err != nil {
+		return "", err
+	}
+
+	type vmFile struct {
+		path string
+		data []byte
+	}
+	files := []vmFile{{"/etc/fc-agent/token", []byte(creds.Token + "\n")}}
+	args := "-token-file /etc/fc-agent/token"
+	if useTLS {
+		files = append(files,
+			vmFile{"/etc/fc-agent/tls.crt", creds.CertPEM},
+			vmFile{"/etc/fc-agent/tls.key", creds.KeyPEM})
+		args += " -tls-cert /etc/fc-agent/tls.crt -tls-key /etc/fc-agent/tls.key"
+	}
+
+	for _, f := range files {
+		script := fmt.Sprintf("echo %s | base64 -d | sudo tee %s > /dev/null && sudo chmod 600 %s",
+			base64.StdEncoding.EncodeToString(f.data), f.path, f.path)
+		cmd := exec.CommandContext(ctx, tartPath, "exec", vmName, "sh", "-c", script)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("failed to write %s: %v, output: %s", f.path, err, string(output))
+		}
+	}
+
+	logrus.Infof("Agent credentials saved in %s", agentConfigDir())
+	return args, nil
+}
+
 func getHostIPForVM(vmIP string) string {
 	// Get network interfaces and find one on the same subnet as the VM
 	interfaces, err := net.Interfaces()
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anthropics/fc-macos/pkg/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// throttleProfile is a named set of rate limits from the throttle-profiles
+// section of the config file. Drive applies to each throttled drive, RX and
+// TX to the microVM's network interface.
+type throttleProfile struct {
+	Drive *api.RateLimiter `json:"drive,omitempty"`
+	RX    *api.RateLimiter `json:"rx,omitempty"`
+	TX    *api.RateLimiter `json:"tx,omitempty"`
+}
+
+// network reports whether the profile limits the network.
+func (p throttleProfile) network() bool {
+	return p.RX != nil || p.TX != nil
+}
+
+func newMicroVMThrottleCmd() *cobra.Command {
+	var (
+		name        string
+		profile     string
+		drives      []string
+		clearLimits bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "throttle",
+		Short: "Apply a rate-limit profile to a running microVM",
+		Long: `Apply a named set of disk and network rate limits to a running microVM.
+
+Profiles are defined under throttle-profiles in the config file, as
+Firecracker rate limiters: token buckets of size bytes (bandwidth) or
+operations (ops) refilled every refill_time milliseconds.
+
+  throttle-profiles:
+    slow-disk:
+      drive:
+        bandwidth: {size: 1048576, refill_time: 1000}
+        ops: {size: 100, refill_time: 1000}
+    3g:
+      rx:
+        bandwidth: {size: 96000, refill_time: 1000}
+      tx:
+        bandwidth: {size: 48000, refill_time: 1000}
+
+The limits replace those the microVM had, and last until it stops or
+--clear removes them.`,
+		Example: `  # Simulate a slow disk
+  fc-macos microvm throttle --name worker-1 --profile slow-disk
+
+  # Throttle a data drive instead of the rootfs
+  fc-macos microvm throttle --name worker-1 --profile slow-disk --drive data
+
+  # Back to full speed
+  fc-macos microvm throttle --name worker-1 --clear`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return throttleMicroVM(cmd.Context(), name, profile, drives, clearLimits)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "microVM name or ID (required)")
+	cmd.Flags().StringVar(&profile, "profile", "", "profile from throttle-profiles in the config file")
+	cmd.Flags().StringSliceVar(&drives, "drive", []string{"rootfs"}, "drives to throttle (repeatable)")
+	cmd.Flags().BoolVar(&clearLimits, "clear", false, "remove the disk and network rate limits")
+	cmd.MarkFlagRequired("name")
+
+	return cmd
+}
+
+// throttleProfileNamed returns the profile called name from the config file.
+func throttleProfileNamed(name string) (throttleProfile, error) {
+	var profiles map[string]throttleProfile
+	if raw := viper.Get("throttle-profiles"); raw != nil {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return throttleProfile{}, fmt.Errorf("invalid throttle-profiles in config: %w", err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&profiles); err != nil {
+			return throttleProfile{}, fmt.Errorf("invalid throttle-profiles in config: %w", err)
+		}
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		if len(profiles) == 0 {
+			return throttleProfile{}, fmt.Errorf("unknown throttle profile %q: the config file defines no throttle-profiles", name)
+		}
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return throttleProfile{}, fmt.Errorf("unknown throttle profile %q (have: %s)", name, strings.Join(names, ", "))
+	}
+	if profile.Drive == nil && !profile.network() {
+		return throttleProfile{}, fmt.Errorf("throttle profile %q sets no drive, rx or tx limits", name)
+	}
+	return profile, nil
+}
+
+// noRateLimit returns a rate limiter update that turns both buckets off.
+// Firecracker keeps a bucket the update leaves out, and only turns one off
+// when its size or refill time is 0.
+func noRateLimit() *api.RateLimiter {
+	return &api.RateLimiter{Bandwidth: &api.TokenBucket{}, Ops: &api.TokenBucket{}}
+}
+
+func throttleMicroVM(ctx context.Context, name, profileName string, drives []string, clearLimits bool) error {
+	var profile throttleProfile
+	switch {
+	case clearLimits && profileName != "":
+		return fmt.Errorf("--profile and --clear cannot be used together")
+	case clearLimits:
+		profile = throttleProfile{Drive: noRateLimit(), RX: noRateLimit(), TX: noRateLimit()}
+	case profileName == "":
+		return fmt.Errorf("--profile is required (or use --clear to remove the limits)")
+	default:
+		var err error
+		if profile, err = throttleProfileNamed(profileName); err != nil {
+			return err
+		}
+	}
+
+	ac, err := getAgent(ctx)
+	if err != nil {
+		return err
+	}
+
+	vm, err := fetchMicroVM(ctx, ac, name)
+	if err != nil {
+		return err
+	}
+	if !vm.Running {
+		return fmt.Errorf("microVM %s is not running", vm.Name)
+	}
+	if vm.Network == nil {
+		if profile.network() && !clearLimits {
+			return fmt.Errorf("throttle profile %q limits the network, but microVM %s has none", profileName, vm.Name)
+		}
+		profile.RX, profile.TX = nil, nil
+	}
+
+	fc := ac.Firecracker(vm.ID)
+	if profile.Drive != nil {
+		for _, drive := range drives {
+			if err := fc.PatchDrive(ctx, drive, "", profile.Drive); err != nil {
+				return fmt.Errorf("failed to throttle drive '%s': %w", drive, err)
+			}
+		}
+	}
+	if profile.network() {
+		if err := fc.PatchNetworkInterface(ctx, "eth0", profile.RX, profile.TX); err != nil {
+			return fmt.Errorf("failed to throttle network: %w", err)
+		}
+	}
+
+	if clearLimits {
+		fmt.Printf("Removed rate limits from %s\n", vm.Name)
+		return nil
+	}
+	var applied []string
+	if profile.Drive != nil {
+		applied = append(applied, "drive "+strings.Join(drives, ", "))
+	}
+	if profile.network() {
+		applied = append(applied, "network")
+	}
+	fmt.Printf("Applied throttle profile %s to %s (%s)\n", profileName, vm.Name, strings.Join(applied, "; "))
+	return nil
+}
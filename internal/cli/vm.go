@@ -1,11 +1,13 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
 
+	"github.com/anthropics/fc-macos/internal/printer"
 	"github.com/spf13/cobra"
 )
 
@@ -28,49 +30,80 @@ This VM provides KVM support via nested virtualization.`,
 	return cmd
 }
 
+// LinuxVMStatus is the state of the intermediate Linux VM as reported by tart.
+type LinuxVMStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	IP    string `json:"ip,omitempty"`
+}
+
+// linuxVMStatusFields are the fields shown by vm status.
+var linuxVMStatusFields = []printer.Column[LinuxVMStatus]{
+	{Header: "Name", Value: func(s LinuxVMStatus) string { return s.Name }},
+	{Header: "State", Value: func(s LinuxVMStatus) string { return s.State }},
+	{Header: "IP", Value: func(s LinuxVMStatus) string { return s.IP }},
+}
+
 func newVMStatusCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "status",
 		Short: "Check the status of the Linux VM",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
 			tartPath := findTart()
 			if tartPath == "" {
 				return fmt.Errorf("tart not found")
 			}
 
-			// Get VM list
-			listCmd := exec.CommandContext(ctx, tartPath, "list")
-			output, err := listCmd.Output()
+			status, err := linuxVMStatus(cmd.Context(), tartPath)
 			if err != nil {
-				return fmt.Errorf("failed to list VMs: %w", err)
-			}
-
-			lines := strings.Split(string(output), "\n")
-			for _, line := range lines {
-				if strings.Contains(line, tartVMName) {
-					fmt.Println("=== Linux VM Status ===")
-					fmt.Printf("Name: %s\n", tartVMName)
-					if strings.Contains(line, "running") {
-						fmt.Println("State: running")
-						// Get IP
-						ipCmd := exec.CommandContext(ctx, tartPath, "ip", tartVMName)
-						if ipOut, err := ipCmd.Output(); err == nil {
-							fmt.Printf("IP: %s\n", strings.TrimSpace(string(ipOut)))
-						}
-					} else {
-						fmt.Println("State: stopped")
-					}
-					return nil
+				return err
+			}
+			if status == nil {
+				if !p.Human() {
+					return fmt.Errorf("VM not found. Run 'fc-macos setup' to create it")
 				}
+				fmt.Println("VM not found. Run 'fc-macos setup' to create it.")
+				return nil
 			}
 
-			fmt.Println("VM not found. Run 'fc-macos setup' to create it.")
-			return nil
+			if p.Human() {
+				fmt.Println("=== Linux VM Status ===")
+			}
+			return printer.Object(p, *status, linuxVMStatusFields)
 		},
 	}
 }
 
+// linuxVMStatus looks the Linux VM up in tart list. It returns nil if the VM
+// doesn't exist.
+func linuxVMStatus(ctx context.Context, tartPath string) (*LinuxVMStatus, error) {
+	listCmd := exec.CommandContext(ctx, tartPath, "list")
+	output, err := listCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VMs: %w", err)
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.Contains(line, tartVMName) {
+			continue
+		}
+		status := &LinuxVMStatus{Name: tartVMName, State: "stopped"}
+		if strings.Contains(line, "running") {
+			status.State = "running"
+			ipCmd := exec.CommandContext(ctx, tartPath, "ip", tartVMName)
+			if ipOut, err := ipCmd.Output(); err == nil {
+				status.IP = strings.TrimSpace(string(ipOut))
+			}
+		}
+		return status, nil
+	}
+	return nil, nil
+}
+
 func newVMLogsCmd() *cobra.Command {
 	var follow bool
 
@@ -206,4 +239,3 @@ func newVMStopCmd() *cobra.Command {
 
 	return cmd
 }
-
@@ -0,0 +1,230 @@
+// Package compose parses fc-macos compose files, which describe a group of
+// microVMs that are started together, in dependency order, on a shared network.
+package compose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the compose file looked up when none is given.
+const DefaultFile = "fc-compose.yaml"
+
+// DefaultReadyTimeout bounds how long a service may take to become ready.
+const DefaultReadyTimeout = 60 * time.Second
+
+// File is a parsed compose file.
+type File struct {
+	// Project groups the microVMs; defaults to the compose file's directory name.
+	Project string `yaml:"project"`
+	// Network is the shared network all services join; defaults to Project.
+	Network  string              `yaml:"network"`
+	Services map[string]*Service `yaml:"services"`
+}
+
+// Service describes a single microVM in the project.
+type Service struct {
+	Name      string     `yaml:"-"`
+	Kernel    string     `yaml:"kernel"`
+	Rootfs    string     `yaml:"rootfs"`
+	VCPUs     int        `yaml:"vcpus"`
+	MemoryMiB int        `yaml:"memory"`
+	BootArgs  string     `yaml:"boot_args"`
+	DependsOn []string   `yaml:"depends_on"`
+	Ready     *Readiness `yaml:"ready"`
+}
+
+// Readiness describes how to decide that a service has finished starting.
+// Dependents are not started until it passes.
+type Readiness struct {
+	// Console is a regular expression matched against serial console lines.
+	Console string `yaml:"console"`
+	// Vsock runs a command inside the guest over vsock until it succeeds.
+	Vsock   *VsockProbe   `yaml:"vsock"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	consoleRe *regexp.Regexp
+}
+
+// VsockProbe runs Command against a command service listening on a guest
+// vsock port. The probe passes once the exec succeeds and its output matches
+// Expect (if set).
+type VsockProbe struct {
+	Port     uint32        `yaml:"port"`
+	Command  string        `yaml:"command"`
+	Expect   string        `yaml:"expect"`
+	Interval time.Duration `yaml:"interval"`
+
+	expectRe *regexp.Regexp
+}
+
+// Load reads and validates a compose file.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, filepath.Base(filepath.Dir(abs)))
+}
+
+// Parse parses and validates compose file contents. defaultProject is used
+// when the file does not name its project.
+func Parse(data []byte, defaultProject string) (*File, error) {
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+
+	if f.Project == "" {
+		f.Project = defaultProject
+	}
+	f.Project = strings.ToLower(f.Project)
+	if f.Project == "" {
+		return nil, fmt.Errorf("project name is required")
+	}
+	if f.Network == "" {
+		f.Network = f.Project
+	}
+
+	if len(f.Services) == 0 {
+		return nil, fmt.Errorf("no services defined")
+	}
+
+	for name, svc := range f.Services {
+		if svc == nil {
+			svc = &Service{}
+			f.Services[name] = svc
+		}
+		svc.Name = name
+
+		for _, dep := range svc.DependsOn {
+			if dep == name {
+				return nil, fmt.Errorf("service %s depends on itself", name)
+			}
+			if _, ok := f.Services[dep]; !ok {
+				return nil, fmt.Errorf("service %s depends on undefined service %s", name, dep)
+			}
+		}
+
+		if err := svc.Ready.compile(); err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+	}
+
+	if _, err := f.Order(); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+func (r *Readiness) compile() error {
+	if r == nil {
+		return nil
+	}
+	if r.Console == "" && r.Vsock == nil {
+		return fmt.Errorf("ready requires a console pattern or a vsock probe")
+	}
+	if r.Timeout == 0 {
+		r.Timeout = DefaultReadyTimeout
+	}
+	if r.Console != "" {
+		re, err := regexp.Compile(r.Console)
+		if err != nil {
+			return fmt.Errorf("invalid console pattern: %w", err)
+		}
+		r.consoleRe = re
+	}
+	if r.Vsock != nil {
+		if r.Vsock.Port == 0 {
+			return fmt.Errorf("vsock probe requires a port")
+		}
+		if r.Vsock.Interval == 0 {
+			r.Vsock.Interval = 2 * time.Second
+		}
+		if r.Vsock.Expect != "" {
+			re, err := regexp.Compile(r.Vsock.Expect)
+			if err != nil {
+				return fmt.Errorf("invalid vsock expect pattern: %w", err)
+			}
+			r.Vsock.expectRe = re
+		}
+	}
+	return nil
+}
+
+// MatchConsole reports whether a console line satisfies the console readiness check.
+func (r *Readiness) MatchConsole(line string) bool {
+	return r != nil && r.consoleRe != nil && r.consoleRe.MatchString(line)
+}
+
+// MatchOutput reports whether vsock probe output satisfies the expectation.
+func (p *VsockProbe) MatchOutput(output string) bool {
+	return p.expectRe == nil || p.expectRe.MatchString(output)
+}
+
+// Order returns the services in start order: every service comes after all of
+// its dependencies. Services with no ordering constraint between them are
+// sorted by name so the order is stable.
+func (f *File) Order() ([]*Service, error) {
+	names := make([]string, 0, len(f.Services))
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(names))
+	order := make([]*Service, 0, len(names))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+		state[name] = visiting
+
+		deps := append([]string(nil), f.Services[name].DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+
+		state[name] = done
+		order = append(order, f.Services[name])
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// VMName returns the microVM name used for a service.
+func (f *File) VMName(service string) string {
+	return f.Project + "-" + service
+}
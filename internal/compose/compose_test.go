@@ -0,0 +1,113 @@
+package compose
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleFile = `
+project: itest
+services:
+  loadgen:
+    depends_on: [app]
+  app:
+    memory: 256
+    depends_on: [db]
+    ready:
+      vsock:
+        port: 52
+        command: curl -s localhost:8080/health
+        expect: ok
+  db:
+    vcpus: 2
+    ready:
+      console: "database system is ready"
+      timeout: 90s
+`
+
+func names(services []*Service) []string {
+	var out []string
+	for _, svc := range services {
+		out = append(out, svc.Name)
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(sampleFile), "ignored")
+	require.NoError(t, err)
+
+	assert.Equal(t, "itest", f.Project)
+	assert.Equal(t, "itest", f.Network)
+	require.Len(t, f.Services, 3)
+
+	db := f.Services["db"]
+	assert.Equal(t, "db", db.Name)
+	assert.Equal(t, 2, db.VCPUs)
+	assert.Equal(t, 90*time.Second, db.Ready.Timeout)
+	assert.True(t, db.Ready.MatchConsole("LOG:  database system is ready to accept connections"))
+	assert.False(t, db.Ready.MatchConsole("starting"))
+
+	app := f.Services["app"]
+	assert.Equal(t, 256, app.MemoryMiB)
+	assert.Equal(t, DefaultReadyTimeout, app.Ready.Timeout)
+	assert.Equal(t, uint32(52), app.Ready.Vsock.Port)
+	assert.Equal(t, 2*time.Second, app.Ready.Vsock.Interval)
+	assert.True(t, app.Ready.Vsock.MatchOutput("ok\n"))
+	assert.False(t, app.Ready.Vsock.MatchOutput("connection refused"))
+
+	assert.Nil(t, f.Services["loadgen"].Ready)
+	assert.Equal(t, "itest-db", f.VMName("db"))
+}
+
+func TestParseDefaultsProject(t *testing.T) {
+	f, err := Parse([]byte("services:\n  web: {}\n"), "MyProject")
+	require.NoError(t, err)
+	assert.Equal(t, "myproject", f.Project)
+	assert.NotNil(t, f.Services["web"])
+}
+
+func TestOrder(t *testing.T) {
+	f, err := Parse([]byte(sampleFile), "")
+	require.NoError(t, err)
+
+	order, err := f.Order()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db", "app", "loadgen"}, names(order))
+}
+
+func TestOrderIsStableForIndependentServices(t *testing.T) {
+	f, err := Parse([]byte("project: p\nservices:\n  c: {}\n  a: {}\n  b: {depends_on: [c]}\n"), "")
+	require.NoError(t, err)
+
+	order, err := f.Order()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c", "b"}, names(order))
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"no services", "project: p\n", "no services"},
+		{"undefined dependency", "project: p\nservices:\n  a: {depends_on: [b]}\n", "undefined service b"},
+		{"self dependency", "project: p\nservices:\n  a: {depends_on: [a]}\n", "depends on itself"},
+		{"cycle", "project: p\nservices:\n  a: {depends_on: [b]}\n  b: {depends_on: [a]}\n", "dependency cycle"},
+		{"empty ready", "project: p\nservices:\n  a: {ready: {timeout: 5s}}\n", "console pattern or a vsock probe"},
+		{"bad regex", "project: p\nservices:\n  a: {ready: {console: '('}}\n", "invalid console pattern"},
+		{"vsock without port", "project: p\nservices:\n  a: {ready: {vsock: {command: true}}}\n", "requires a port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), "")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
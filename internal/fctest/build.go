@@ -0,0 +1,23 @@
+package fctest
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Build compiles the fake firecracker executable into a temporary directory
+// and returns its path. The test is skipped when no Go toolchain is found.
+func Build(t testing.TB) string {
+	t.Helper()
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("fctest: go toolchain not found")
+	}
+	bin := filepath.Join(t.TempDir(), "firecracker")
+	cmd := exec.Command(goBin, "build", "-o", bin, "github.com/anthropics/fc-macos/internal/fctest/firecracker")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("fctest: building fake firecracker: %v\n%s", err, out)
+	}
+	return bin
+}
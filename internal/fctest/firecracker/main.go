@@ -0,0 +1,12 @@
+// Command firecracker is a fake Firecracker for tests. See package fctest.
+package main
+
+import (
+	"os"
+
+	"github.com/anthropics/fc-macos/internal/fctest"
+)
+
+func main() {
+	os.Exit(fctest.Main(os.Args[1:], os.Stdin, os.Stdout))
+}
@@ -0,0 +1,88 @@
+package fctest
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Main runs the fake firecracker executable: it serves the API on
+// --api-sock and, once the microVM starts, plays a serial console on stdin
+// and stdout that echoes each line it reads. The guest "reboots" (exits) on
+// a "reboot" line or a SendCtrlAltDel action, and SIGINT or SIGTERM stop it
+// like the real Firecracker. It returns the exit code.
+func Main(args []string, stdin io.Reader, stdout io.Writer) int {
+	fs := flag.NewFlagSet("firecracker", flag.ContinueOnError)
+	socket := fs.String("api-sock", "/run/firecracker.socket", "path to the API socket")
+	id := fs.String("id", "anonymous-instance", "microVM ID")
+	fs.String("level", "Warning", "log level (ignored)")
+	version := fs.Bool("version", false, "print the version and exit")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *version {
+		fmt.Fprintf(stdout, "Firecracker v%s\n", Version)
+		return 0
+	}
+
+	l, err := net.Listen("unix", *socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "firecracker: %v\n", err)
+		return 1
+	}
+	defer os.Remove(*socket)
+
+	s := NewServer()
+	defer s.Close()
+	srv := &http.Server{Handler: s}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	rebooted := make(chan struct{})
+	go func() {
+		select {
+		case <-s.Started():
+		case <-sigs:
+			close(rebooted)
+			return
+		}
+		console(*id, stdin, stdout)
+		close(rebooted)
+	}()
+
+	select {
+	case <-rebooted:
+	case <-s.Shutdown():
+	case <-sigs:
+	}
+	return 0
+}
+
+// console prints a boot banner and echoes stdin line by line until it reads
+// "reboot" or stdin closes.
+func console(id string, stdin io.Reader, stdout io.Writer) {
+	fmt.Fprintf(stdout, "[    0.000000] Linux version 6.1.0-fctest (Firecracker v%s)\r\n", Version)
+	fmt.Fprintf(stdout, "[    0.100000] Run /sbin/init as init process\r\n")
+	fmt.Fprintf(stdout, "\r\n%s login: ", id)
+
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "reboot" {
+			fmt.Fprintf(stdout, "[    1.000000] reboot: Restarting system\r\n")
+			return
+		}
+		fmt.Fprintf(stdout, "%s\r\n", line)
+	}
+}
@@ -0,0 +1,58 @@
+package fctest
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMainConsole(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "firecracker.socket")
+	stdin, consoleIn := io.Pipe()
+	consoleOut, stdout := io.Pipe()
+
+	exit := make(chan int, 1)
+	go func() {
+		exit <- Main([]string{"--api-sock", socket, "--id", "test-vm"}, stdin, stdout)
+		stdout.Close()
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socket)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	boot(t, client(socket))
+
+	out := bufio.NewReader(consoleOut)
+	line, err := out.ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, line, "Linux version")
+
+	go io.WriteString(consoleIn, "echo hello\nreboot\n")
+	rest, err := io.ReadAll(out)
+	require.NoError(t, err)
+	assert.Contains(t, string(rest), "test-vm login: echo hello\r\n")
+	assert.Contains(t, string(rest), "reboot: Restarting system")
+
+	select {
+	case code := <-exit:
+		assert.Equal(t, 0, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Main did not exit on reboot")
+	}
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err), "socket not removed")
+}
+
+func TestMainVersion(t *testing.T) {
+	var out strings.Builder
+	assert.Equal(t, 0, Main([]string{"--version"}, nil, &out))
+	assert.Equal(t, "Firecracker v"+Version+"\n", out.String())
+}
@@ -0,0 +1,732 @@
+// Package fctest provides a fake Firecracker for tests: an in-process
+// implementation of the Firecracker REST API, and a fake firecracker
+// executable built from it that fc-agent can run in place of the real one.
+//
+// The fake keeps the state a real Firecracker would (pre-boot configuration,
+// running and paused microVMs, snapshot files) and rejects requests the same
+// way, with a 400 and a fault_message, but boots no guest.
+package fctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/api"
+)
+
+// Version is the Firecracker version the fake reports.
+const Version = "1.7.0"
+
+// Instance states, as reported by GET /.
+const (
+	NotStarted = "Not started"
+	Running    = "Running"
+	Paused     = "Paused"
+)
+
+// Fault messages shared with the real Firecracker.
+const (
+	faultAfterBoot  = "The requested operation is not supported after starting the microVM."
+	faultBeforeBoot = "The requested operation is not supported before starting the microVM."
+)
+
+// Server is a fake Firecracker API. It is safe for concurrent use.
+type Server struct {
+	mu      sync.Mutex
+	state   string
+	boot    *api.BootSource
+	machine api.MachineConfig
+	drives  map[string]*api.Drive
+	ifaces  map[string]*api.NetworkInterface
+	balloon *api.Balloon
+	vsock   *api.Vsock
+	logger  *os.File
+	metrics *os.File
+
+	started  chan struct{} // Closed by InstanceStart or a resuming snapshot load
+	shutdown chan struct{} // Closed by SendCtrlAltDel
+}
+
+// NewServer returns a fake Firecracker with nothing configured.
+func NewServer() *Server {
+	return &Server{
+		state:    NotStarted,
+		machine:  api.MachineConfig{VCPUCount: 1, MemSizeMib: 128},
+		drives:   make(map[string]*api.Drive),
+		ifaces:   make(map[string]*api.NetworkInterface),
+		started:  make(chan struct{}),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Start serves a new fake Firecracker on a Unix socket in a temporary
+// directory until the test ends, and returns it with the socket path.
+func Start(t testing.TB) (*Server, string) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "firecracker.socket")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("fctest: %v", err)
+	}
+	s := NewServer()
+	srv := &http.Server{Handler: s}
+	go srv.Serve(l)
+	t.Cleanup(func() {
+		srv.Close()
+		s.Close()
+	})
+	return s, socket
+}
+
+// State returns the instance state: NotStarted, Running or Paused.
+func (s *Server) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Started is closed when the microVM starts.
+func (s *Server) Started() <-chan struct{} {
+	return s.started
+}
+
+// Shutdown is closed when the guest is asked to shut down with
+// SendCtrlAltDel.
+func (s *Server) Shutdown() <-chan struct{} {
+	return s.shutdown
+}
+
+// Close closes the log and metrics files.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.logger != nil {
+		s.logger.Close()
+		s.logger = nil
+	}
+	if s.metrics != nil {
+		s.metrics.Close()
+		s.metrics = nil
+	}
+}
+
+// fault is an API error.
+type fault struct {
+	status  int
+	message string
+}
+
+func (f *fault) Error() string { return f.message }
+
+func badRequest(format string, args ...interface{}) *fault {
+	return &fault{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+// ServeHTTP implements the Firecracker API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	result, f := s.route(r)
+	s.mu.Unlock()
+
+	if f != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(f.status)
+		json.NewEncoder(w).Encode(api.Error{FaultMessage: f.message})
+		return
+	}
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// route handles one request. Callers hold s.mu.
+func (s *Server) route(r *http.Request) (interface{}, *fault) {
+	path := r.URL.Path
+	id := ""
+	for _, prefix := range []string{"/drives/", "/network-interfaces/"} {
+		if strings.HasPrefix(path, prefix) {
+			id = strings.TrimPrefix(path, prefix)
+			path = prefix + "{id}"
+		}
+	}
+
+	switch r.Method + " " + path {
+	case "GET /":
+		return &api.InstanceInfo{ID: "anonymous-instance", State: s.state, VMState: Version, AppName: "Firecracker"}, nil
+	case "GET /version":
+		return &api.Version{FirecrackerVersion: Version}, nil
+	case "GET /machine-config":
+		return s.machine, nil
+	case "GET /vm/config":
+		return s.config(), nil
+	case "GET /balloon":
+		if s.balloon == nil {
+			return nil, badRequest("Invalid request: the balloon device is not configured.")
+		}
+		return s.balloon, nil
+	case "GET /balloon/statistics":
+		return s.balloonStats()
+
+	case "PUT /machine-config":
+		return nil, s.putMachineConfig(r)
+	case "PUT /boot-source":
+		return nil, s.putBootSource(r)
+	case "PUT /drives/{id}":
+		return nil, s.putDrive(r, id)
+	case "PATCH /drives/{id}":
+		return nil, s.patchDrive(r, id)
+	case "PUT /network-interfaces/{id}":
+		return nil, s.putNetworkInterface(r, id)
+	case "PATCH /network-interfaces/{id}":
+		return nil, s.patchNetworkInterface(r, id)
+	case "PUT /vsock":
+		return nil, s.putVsock(r)
+	case "PUT /balloon":
+		return nil, s.putBalloon(r)
+	case "PATCH /balloon":
+		return nil, s.patchBalloon(r)
+	case "PUT /logger":
+		return nil, s.putLogger(r)
+	case "PUT /metrics":
+		return nil, s.putMetrics(r)
+	case "PUT /actions":
+		return nil, s.action(r)
+	case "PATCH /vm":
+		return nil, s.patchVM(r)
+	case "PUT /snapshot/create":
+		return nil, s.createSnapshot(r)
+	case "PUT /snapshot/load":
+		return nil, s.loadSnapshot(r)
+	}
+	return nil, badRequest("Invalid request method and/or path: %s %s.", r.Method, r.URL.Path)
+}
+
+// decode reads a JSON request body into v.
+func decode(r *http.Request, v interface{}) *fault {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest("An error occurred when deserializing the json body of a request: %v.", err)
+	}
+	return nil
+}
+
+// preBoot rejects configuration changes once the microVM has started.
+func (s *Server) preBoot() *fault {
+	if s.state != NotStarted {
+		return badRequest(faultAfterBoot)
+	}
+	return nil
+}
+
+// postBoot rejects runtime updates before the microVM has started.
+func (s *Server) postBoot() *fault {
+	if s.state == NotStarted {
+		return badRequest(faultBeforeBoot)
+	}
+	return nil
+}
+
+// openable checks that path can be opened, as Firecracker does when a
+// resource is configured.
+func openable(kind, path string) *fault {
+	f, err := os.Open(path)
+	if err != nil {
+		return badRequest("Unable to open the %s file %s: %v", kind, path, err)
+	}
+	f.Close()
+	return nil
+}
+
+func (s *Server) putMachineConfig(r *http.Request) *fault {
+	if f := s.preBoot(); f != nil {
+		return f
+	}
+	var cfg api.MachineConfig
+	if f := decode(r, &cfg); f != nil {
+		return f
+	}
+	if cfg.VCPUCount < 1 || cfg.VCPUCount > 32 {
+		return badRequest("The vCPU number is invalid! The vCPU number can only be 1 or an even number when SMT is enabled.")
+	}
+	if cfg.MemSizeMib < 1 {
+		return badRequest("The memory size (MiB) is invalid.")
+	}
+	s.machine = cfg
+	return nil
+}
+
+func (s *Server) putBootSource(r *http.Request) *fault {
+	if f := s.preBoot(); f != nil {
+		return f
+	}
+	var bs api.BootSource
+	if f := decode(r, &bs); f != nil {
+		return f
+	}
+	if f := openable("kernel", bs.KernelImagePath); f != nil {
+		return f
+	}
+	if bs.InitrdPath != "" {
+		if f := openable("initrd", bs.InitrdPath); f != nil {
+			return f
+		}
+	}
+	s.boot = &bs
+	return nil
+}
+
+func (s *Server) putDrive(r *http.Request, id string) *fault {
+	if f := s.preBoot(); f != nil {
+		return f
+	}
+	var d api.Drive
+	if f := decode(r, &d); f != nil {
+		return f
+	}
+	if d.DriveID != id {
+		return badRequest("The id from the path [%s] does not match the id from the body [%s]!", id, d.DriveID)
+	}
+	if f := openable("block device", d.PathOnHost); f != nil {
+		return f
+	}
+	if d.IsRootDevice {
+		for _, other := range s.drives {
+			if other.IsRootDevice && other.DriveID != id {
+				return badRequest("A root block device already exists!")
+			}
+		}
+	}
+	s.drives[id] = &d
+	return nil
+}
+
+func (s *Server) patchDrive(r *http.Request, id string) *fault {
+	if f := s.postBoot(); f != nil {
+		return f
+	}
+	var update struct {
+		DriveID     string           `json:"drive_id"`
+		PathOnHost  string           `json:"path_on_host,omitempty"`
+		RateLimiter *api.RateLimiter `json:"rate_limiter,omitempty"`
+	}
+	if f := decode(r, &update); f != nil {
+		return f
+	}
+	if update.DriveID != id {
+		return badRequest("The id from the path [%s] does not match the id from the body [%s]!", id, update.DriveID)
+	}
+	d, ok := s.drives[id]
+	if !ok {
+		return badRequest("Invalid block device ID!")
+	}
+	if update.PathOnHost != "" {
+		if f := openable("block device", update.PathOnHost); f != nil {
+			return f
+		}
+		d.PathOnHost = update.PathOnHost
+	}
+	d.RateLimiter = mergeRateLimiter(d.RateLimiter, update.RateLimiter)
+	return nil
+}
+
+// mergeRateLimiter applies a rate limiter update the way Firecracker does:
+// a bucket the update leaves out is kept, and one whose size or refill time
+// is 0 is turned off. A limiter with neither bucket is no limiter at all.
+func mergeRateLimiter(current, update *api.RateLimiter) *api.RateLimiter {
+	if update == nil {
+		return current
+	}
+	merged := api.RateLimiter{}
+	if current != nil {
+		merged = *current
+	}
+	mergeBucket := func(bucket **api.TokenBucket, update *api.TokenBucket) {
+		switch {
+		case update == nil:
+		case update.Size == 0 || update.RefillTime == 0:
+			*bucket = nil
+		default:
+			b := *update
+			*bucket = &b
+		}
+	}
+	mergeBucket(&merged.Bandwidth, update.Bandwidth)
+	mergeBucket(&merged.Ops, update.Ops)
+	if merged.Bandwidth == nil && merged.Ops == nil {
+		return nil
+	}
+	return &merged
+}
+
+func (s *Server) putNetworkInterface(r *http.Request, id string) *fault {
+	if f := s.preBoot(); f != nil {
+		return f
+	}
+	var iface api.NetworkInterface
+	if f := decode(r, &iface); f != nil {
+		return f
+	}
+	if iface.IfaceID != id {
+		return badRequest("The id from the path [%s] does not match the id from the body [%s]!", id, iface.IfaceID)
+	}
+	s.ifaces[id] = &iface
+	return nil
+}
+
+func (s *Server) patchNetworkInterface(r *http.Request, id string) *fault {
+	if f := s.postBoot(); f != nil {
+		return f
+	}
+	var update struct {
+		IfaceID       string           `json:"iface_id"`
+		RxRateLimiter *api.RateLimiter `json:"rx_rate_limiter,omitempty"`
+		TxRateLimiter *api.RateLimiter `json:"tx_rate_limiter,omitempty"`
+	}
+	if f := decode(r, &update); f != nil {
+		return f
+	}
+	if update.IfaceID != id {
+		return badRequest("The id from the path [%s] does not match the id from the body [%s]!", id, update.IfaceID)
+	}
+	iface, ok := s.ifaces[id]
+	if !ok {
+		return badRequest("Invalid network interface ID - not found.")
+	}
+	iface.RxRateLimiter = mergeRateLimiter(iface.RxRateLimiter, update.RxRateLimiter)
+	iface.TxRateLimiter = mergeRateLimiter(iface.TxRateLimiter, update.TxRateLimiter)
+	return nil
+}
+
+func (s *Server) putVsock(r *http.Request) *fault {
+	if f := s.preBoot(); f != nil {
+		return f
+	}
+	var v api.Vsock
+	if f := decode(r, &v); f != nil {
+		return f
+	}
+	if v.GuestCID < 3 {
+		return badRequest("Invalid guest CID %d: CIDs 0-2 are reserved.", v.GuestCID)
+	}
+	s.vsock = &v
+	return nil
+}
+
+func (s *Server) putBalloon(r *http.Request) *fault {
+	if f := s.preBoot(); f != nil {
+		return f
+	}
+	var b api.Balloon
+	if f := decode(r, &b); f != nil {
+		return f
+	}
+	if int(b.AmountMib) > s.machine.MemSizeMib {
+		return badRequest("Amount of pages requested is greater than total guest memory.")
+	}
+	s.balloon = &b
+	return nil
+}
+
+func (s *Server) patchBalloon(r *http.Request) *fault {
+	if f := s.postBoot(); f != nil {
+		return f
+	}
+	if s.balloon == nil {
+		return badRequest("Invalid request: the balloon device is not configured.")
+	}
+	var update api.BalloonUpdate
+	if f := decode(r, &update); f != nil {
+		return f
+	}
+	if int(update.AmountMib) > s.machine.MemSizeMib {
+		return badRequest("Amount of pages requested is greater than total guest memory.")
+	}
+	s.balloon.AmountMib = update.AmountMib
+	return nil
+}
+
+// balloonStats reports the balloon as fully inflated to its target.
+func (s *Server) balloonStats() (interface{}, *fault) {
+	if s.balloon == nil {
+		return nil, badRequest("Invalid request: the balloon device is not configured.")
+	}
+	if s.balloon.StatsPollingIntervalS == 0 {
+		return nil, badRequest("Statistics are not enabled.")
+	}
+	pages := s.balloon.AmountMib << 8 // 4 KiB pages
+	return &api.BalloonStats{
+		TargetPages: pages,
+		ActualPages: pages,
+		TargetMib:   s.balloon.AmountMib,
+		ActualMib:   s.balloon.AmountMib,
+		TotalMemory: int64(s.machine.MemSizeMib) << 20,
+		FreeMemory:  (int64(s.machine.MemSizeMib) - s.balloon.AmountMib) << 20,
+	}, nil
+}
+
+func (s *Server) putLogger(r *http.Request) *fault {
+	if f := s.preBoot(); f != nil {
+		return f
+	}
+	var l api.Logger
+	if f := decode(r, &l); f != nil {
+		return f
+	}
+	// Firecracker opens the log without creating it
+	f, err := os.OpenFile(l.LogPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return badRequest("Cannot initialize logging system: %v", err)
+	}
+	if s.logger != nil {
+		s.logger.Close()
+	}
+	s.logger = f
+	s.log("INFO", "Running Firecracker v%s", Version)
+	return nil
+}
+
+func (s *Server) putMetrics(r *http.Request) *fault {
+	if f := s.preBoot(); f != nil {
+		return f
+	}
+	var m api.MetricsConfig
+	if f := decode(r, &m); f != nil {
+		return f
+	}
+	f, err := os.OpenFile(m.MetricsPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return badRequest("Cannot initialize metrics system: %v", err)
+	}
+	if s.metrics != nil {
+		s.metrics.Close()
+	}
+	s.metrics = f
+	return nil
+}
+
+func (s *Server) action(r *http.Request) *fault {
+	var a api.Action
+	if f := decode(r, &a); f != nil {
+		return f
+	}
+	switch a.ActionType {
+	case "InstanceStart":
+		if s.state != NotStarted {
+			return badRequest("The microVM is already running.")
+		}
+		if s.boot == nil {
+			return badRequest("Cannot start microvm without kernel configuration.")
+		}
+		s.state = Running
+		close(s.started)
+		s.log("INFO", "Successfully started microvm that was configured from one single json")
+	case "SendCtrlAltDel":
+		if f := s.postBoot(); f != nil {
+			return f
+		}
+		select {
+		case <-s.shutdown:
+		default:
+			close(s.shutdown)
+		}
+		s.log("INFO", "Sending CTRL+ALT+DEL to the guest")
+	case "FlushMetrics":
+		if s.metrics == nil {
+			return badRequest("The metrics system is not initialized.")
+		}
+		s.flushMetrics()
+	default:
+		return badRequest("An error occurred when deserializing the json body of a request: unknown variant `%s`.", a.ActionType)
+	}
+	return nil
+}
+
+func (s *Server) patchVM(r *http.Request) *fault {
+	if f := s.postBoot(); f != nil {
+		return f
+	}
+	var v api.VMState
+	if f := decode(r, &v); f != nil {
+		return f
+	}
+	switch v.State {
+	case Paused, "Resumed":
+	default:
+		return badRequest("An error occurred when deserializing the json body of a request: unknown variant `%s`, expected `Paused` or `Resumed`.", v.State)
+	}
+	if v.State == Paused {
+		s.state = Paused
+	} else {
+		s.state = Running
+	}
+	s.log("INFO", "The microVM state is now %s", s.state)
+	return nil
+}
+
+// snapshot is the fake's snapshot file: the configuration it restores.
+type snapshot struct {
+	Machine api.MachineConfig       `json:"machine-config"`
+	Boot    *api.BootSource         `json:"boot-source"`
+	Drives  []*api.Drive            `json:"drives"`
+	Ifaces  []*api.NetworkInterface `json:"network-interfaces"`
+	Balloon *api.Balloon            `json:"balloon,omitempty"`
+	Vsock   *api.Vsock              `json:"vsock,omitempty"`
+}
+
+func (s *Server) createSnapshot(r *http.Request) *fault {
+	var params api.SnapshotCreate
+	if f := decode(r, &params); f != nil {
+		return f
+	}
+	if s.state != Paused {
+		return badRequest("Create snapshot error: Cannot save the microVM state: the microVM is not paused.")
+	}
+	if params.SnapshotType != "" && params.SnapshotType != "Full" && params.SnapshotType != "Diff" {
+		return badRequest("An error occurred when deserializing the json body of a request: unknown variant `%s`.", params.SnapshotType)
+	}
+
+	cfg := s.config()
+	data, err := json.Marshal(snapshot{
+		Machine: s.machine,
+		Boot:    s.boot,
+		Drives:  cfg.Drives,
+		Ifaces:  cfg.NetworkInterfaces,
+		Balloon: s.balloon,
+		Vsock:   s.vsock,
+	})
+	if err != nil {
+		return &fault{http.StatusInternalServerError, err.Error()}
+	}
+	if err := os.WriteFile(params.SnapshotPath, data, 0600); err != nil {
+		return badRequest("Create snapshot error: Cannot write the microVM state: %v", err)
+	}
+	mem, err := os.Create(params.MemFilePath)
+	if err != nil {
+		return badRequest("Create snapshot error: Cannot write the memory file: %v", err)
+	}
+	defer mem.Close()
+	if err := mem.Truncate(int64(s.machine.MemSizeMib) << 20); err != nil {
+		return badRequest("Create snapshot error: Cannot write the memory file: %v", err)
+	}
+	s.log("INFO", "Snapshot created at %s", params.SnapshotPath)
+	return nil
+}
+
+func (s *Server) loadSnapshot(r *http.Request) *fault {
+	var params api.SnapshotLoad
+	if f := decode(r, &params); f != nil {
+		return f
+	}
+	if s.state != NotStarted || s.boot != nil || len(s.drives) > 0 || len(s.ifaces) > 0 {
+		return badRequest("Loading a microVM snapshot not allowed after configuring boot-specific resources.")
+	}
+
+	data, err := os.ReadFile(params.SnapshotPath)
+	if err != nil {
+		return badRequest("Load snapshot error: Cannot open the snapshot file: %v", err)
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return badRequest("Load snapshot error: Cannot deserialize the microVM state: %v", err)
+	}
+	for _, o := range params.NetworkOverrides {
+		found := false
+		for _, iface := range snap.Ifaces {
+			if iface.IfaceID == o.IfaceID {
+				iface.HostDevName = o.HostDevName
+				if o.GuestMAC != "" {
+					iface.GuestMAC = o.GuestMAC
+				}
+				found = true
+			}
+		}
+		if !found {
+			return badRequest("Load snapshot error: Invalid network override: no network interface %s in the snapshot.", o.IfaceID)
+		}
+	}
+	mem, err := os.Stat(params.MemFilePath)
+	if err != nil {
+		return badRequest("Load snapshot error: Cannot open the memory file: %v", err)
+	}
+	if mem.Size() != int64(snap.Machine.MemSizeMib)<<20 {
+		return badRequest("Load snapshot error: The memory file size does not match the microVM state.")
+	}
+
+	s.machine = snap.Machine
+	s.boot = snap.Boot
+	for _, d := range snap.Drives {
+		s.drives[d.DriveID] = d
+	}
+	for _, iface := range snap.Ifaces {
+		s.ifaces[iface.IfaceID] = iface
+	}
+	s.balloon = snap.Balloon
+	s.vsock = snap.Vsock
+
+	s.state = Paused
+	close(s.started)
+	if params.ResumeVM {
+		s.state = Running
+	}
+	s.log("INFO", "Loaded snapshot from %s", params.SnapshotPath)
+	return nil
+}
+
+// Config is the response to GET /vm/config.
+type Config = api.FullVMConfig
+
+// config returns the full configuration, drives and interfaces by ID.
+func (s *Server) config() *Config {
+	cfg := &Config{
+		BootSource:        s.boot,
+		Drives:            []*api.Drive{},
+		MachineConfig:     s.machine,
+		NetworkInterfaces: []*api.NetworkInterface{},
+		Balloon:           s.balloon,
+		Vsock:             s.vsock,
+	}
+	for _, d := range s.drives {
+		cfg.Drives = append(cfg.Drives, d)
+	}
+	sort.Slice(cfg.Drives, func(i, j int) bool { return cfg.Drives[i].DriveID < cfg.Drives[j].DriveID })
+	for _, iface := range s.ifaces {
+		cfg.NetworkInterfaces = append(cfg.NetworkInterfaces, iface)
+	}
+	sort.Slice(cfg.NetworkInterfaces, func(i, j int) bool {
+		return cfg.NetworkInterfaces[i].IfaceID < cfg.NetworkInterfaces[j].IfaceID
+	})
+	return cfg
+}
+
+// log writes a line to the configured log file. Callers hold s.mu.
+func (s *Server) log(level, format string, args ...interface{}) {
+	if s.logger == nil {
+		return
+	}
+	fmt.Fprintf(s.logger, "%s [anonymous-instance:fc_api:%s] %s\n",
+		time.Now().UTC().Format(time.RFC3339Nano), level, fmt.Sprintf(format, args...))
+}
+
+// flushMetrics writes one line of metrics, with a block and network counter
+// per configured device. Callers hold s.mu.
+func (s *Server) flushMetrics() {
+	m := api.Metrics{
+		Block: map[string]interface{}{"read_bytes": 4096 * len(s.drives), "write_bytes": 0},
+		Net:   map[string]interface{}{"rx_bytes_count": 512 * len(s.ifaces), "tx_bytes_count": 256 * len(s.ifaces)},
+		VCPU:  map[string]interface{}{"exit_io_in": 1, "exit_io_out": 1},
+		API:   map[string]interface{}{"process_startup_time_us": 1000},
+	}
+	data, _ := json.Marshal(m)
+	s.metrics.Write(append(data, '\n'))
+}
@@ -0,0 +1,350 @@
+package fctest
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anthropics/fc-macos/pkg/api"
+	"github.com/anthropics/fc-macos/pkg/firecracker"
+)
+
+// httpClient returns an HTTP client that dials socket.
+func httpClient(socket string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		},
+	}
+}
+
+// client returns a FirecrackerClient for the API on socket.
+func client(socket string) *firecracker.Client {
+	return firecracker.NewAt(httpClient(socket), "http://localhost")
+}
+
+// touch creates an empty file in dir and returns its path.
+func touch(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	return path
+}
+
+// boot configures and starts a microVM with a kernel and rootfs.
+func boot(t *testing.T, c *firecracker.Client) {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, c.SetBootSource(ctx, &api.BootSource{KernelImagePath: touch(t, dir, "vmlinux")}))
+	require.NoError(t, c.SetDrive(ctx, "rootfs", &api.Drive{DriveID: "rootfs", PathOnHost: touch(t, dir, "rootfs.ext4"), IsRootDevice: true}))
+	require.NoError(t, c.StartInstance(ctx))
+}
+
+func TestPreBootValidation(t *testing.T) {
+	ctx := context.Background()
+	_, socket := Start(t)
+	c := client(socket)
+
+	err := c.StartInstance(ctx)
+	require.Error(t, err)
+	assert.Equal(t, "API error (400): Cannot start microvm without kernel configuration.", err.Error())
+
+	err = c.SetBootSource(ctx, &api.BootSource{KernelImagePath: "/nonexistent/vmlinux"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Unable to open the kernel file /nonexistent/vmlinux")
+
+	rootfs := touch(t, t.TempDir(), "rootfs.ext4")
+	err = c.SetDrive(ctx, "rootfs", &api.Drive{DriveID: "data", PathOnHost: rootfs})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match the id from the body")
+
+	err = c.SetMachineConfig(ctx, &api.MachineConfig{VCPUCount: 0, MemSizeMib: 128})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "The vCPU number is invalid!")
+
+	err = c.PauseInstance(ctx)
+	require.Error(t, err)
+	assert.Equal(t, "API error (400): "+faultBeforeBoot, err.Error())
+
+	err = c.PatchBalloon(ctx, 64)
+	require.Error(t, err)
+	assert.Equal(t, "API error (400): "+faultBeforeBoot, err.Error())
+}
+
+func TestRunningValidation(t *testing.T) {
+	ctx := context.Background()
+	s, socket := Start(t)
+	c := client(socket)
+
+	require.NoError(t, c.SetMachineConfig(ctx, &api.MachineConfig{VCPUCount: 2, MemSizeMib: 256}))
+	require.NoError(t, c.SetBalloon(ctx, &api.Balloon{AmountMib: 32}))
+	boot(t, c)
+	assert.Equal(t, Running, s.State())
+	select {
+	case <-s.Started():
+	default:
+		t.Fatal("Started not closed by InstanceStart")
+	}
+
+	err := c.SetMachineConfig(ctx, &api.MachineConfig{VCPUCount: 4, MemSizeMib: 512})
+	require.Error(t, err)
+	assert.Equal(t, "API error (400): "+faultAfterBoot, err.Error())
+
+	err = c.StartInstance(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already running")
+
+	cfg, err := c.GetMachineConfig(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, cfg.VCPUCount)
+	assert.Equal(t, 256, cfg.MemSizeMib)
+
+	require.NoError(t, c.PatchBalloon(ctx, 64))
+	balloon, err := c.GetBalloon(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(64), balloon.AmountMib)
+
+	// Statistics need a polling interval
+	_, err = c.GetBalloonStats(ctx)
+	require.Error(t, err)
+	assert.Equal(t, "API error (400): Statistics are not enabled.", err.Error())
+
+	err = c.PatchDrive(ctx, "data", touch(t, t.TempDir(), "data.ext4"), nil)
+	require.Error(t, err)
+	assert.Equal(t, "API error (400): Invalid block device ID!", err.Error())
+
+	version, err := c.GetVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Version, version.FirecrackerVersion)
+}
+
+func TestRateLimiterUpdates(t *testing.T) {
+	ctx := context.Background()
+	_, socket := Start(t)
+	c := client(socket)
+	require.NoError(t, c.SetNetworkInterface(ctx, "eth0", &api.NetworkInterface{IfaceID: "eth0", HostDevName: "fctap1"}))
+	boot(t, c)
+
+	drive := func() *api.RateLimiter {
+		t.Helper()
+		cfg, err := c.GetVMConfig(ctx)
+		require.NoError(t, err)
+		require.Len(t, cfg.Drives, 1)
+		return cfg.Drives[0].RateLimiter
+	}
+	ops := &api.TokenBucket{Size: 100, RefillTime: 1000}
+	bandwidth := &api.TokenBucket{Size: 1 << 20, RefillTime: 1000}
+	off := &api.TokenBucket{}
+
+	require.NoError(t, c.PatchDrive(ctx, "rootfs", "", &api.RateLimiter{Bandwidth: bandwidth, Ops: ops}))
+	assert.Equal(t, &api.RateLimiter{Bandwidth: bandwidth, Ops: ops}, drive())
+
+	// Buckets left out are kept
+	require.NoError(t, c.PatchDrive(ctx, "rootfs", "", &api.RateLimiter{}))
+	assert.Equal(t, &api.RateLimiter{Bandwidth: bandwidth, Ops: ops}, drive())
+
+	// A bucket with a zero size or refill time is turned off
+	require.NoError(t, c.PatchDrive(ctx, "rootfs", "", &api.RateLimiter{Ops: &api.TokenBucket{Size: 100}}))
+	assert.Equal(t, &api.RateLimiter{Bandwidth: bandwidth}, drive())
+	require.NoError(t, c.PatchDrive(ctx, "rootfs", "", &api.RateLimiter{Bandwidth: off, Ops: off}))
+	assert.Nil(t, drive())
+
+	require.NoError(t, c.PatchNetworkInterface(ctx, "eth0", &api.RateLimiter{Ops: ops}, &api.RateLimiter{Ops: ops}))
+	require.NoError(t, c.PatchNetworkInterface(ctx, "eth0", &api.RateLimiter{Bandwidth: bandwidth}, &api.RateLimiter{Ops: off}))
+	cfg, err := c.GetVMConfig(ctx)
+	require.NoError(t, err)
+	require.Len(t, cfg.NetworkInterfaces, 1)
+	assert.Equal(t, &api.RateLimiter{Bandwidth: bandwidth, Ops: ops}, cfg.NetworkInterfaces[0].RxRateLimiter)
+	assert.Nil(t, cfg.NetworkInterfaces[0].TxRateLimiter)
+
+	// The body must name the drive or interface being patched
+	for path, body := range map[string]string{
+		"/drives/rootfs":           `{"path_on_host":"/r"}`,
+		"/network-interfaces/eth0": `{"rx_rate_limiter":{}}`,
+	} {
+		req, err := http.NewRequest(http.MethodPatch, "http://localhost"+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := httpClient(socket).Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	ctx := context.Background()
+	s, socket := Start(t)
+	c := client(socket)
+	boot(t, c)
+
+	require.NoError(t, c.PauseInstance(ctx))
+	assert.Equal(t, Paused, s.State())
+
+	resp, err := httpClient(socket).Get("http://localhost/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var info api.InstanceInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, Paused, info.State)
+
+	require.NoError(t, c.ResumeInstance(ctx))
+	assert.Equal(t, Running, s.State())
+}
+
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	_, socket := Start(t)
+	c := client(socket)
+	require.NoError(t, c.SetMachineConfig(ctx, &api.MachineConfig{VCPUCount: 1, MemSizeMib: 16}))
+	boot(t, c)
+
+	dir := t.TempDir()
+	params := &api.SnapshotCreate{
+		SnapshotPath: filepath.Join(dir, "vm.snap"),
+		MemFilePath:  filepath.Join(dir, "vm.mem"),
+	}
+	err := c.CreateSnapshot(ctx, params)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the microVM is not paused")
+
+	require.NoError(t, c.PauseInstance(ctx))
+	require.NoError(t, c.CreateSnapshot(ctx, params))
+	mem, err := os.Stat(params.MemFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(16<<20), mem.Size())
+
+	// Load into a fresh Firecracker
+	restored, socket2 := Start(t)
+	c2 := client(socket2)
+	require.NoError(t, c2.LoadSnapshot(ctx, &api.SnapshotLoad{
+		SnapshotPath: params.SnapshotPath,
+		MemFilePath:  params.MemFilePath,
+		ResumeVM:     true,
+	}))
+	assert.Equal(t, Running, restored.State())
+	cfg, err := c2.GetMachineConfig(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 16, cfg.MemSizeMib)
+
+	// Loading is only allowed into an unconfigured Firecracker
+	err = c2.LoadSnapshot(ctx, &api.SnapshotLoad{SnapshotPath: params.SnapshotPath, MemFilePath: params.MemFilePath})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not allowed after configuring boot-specific resources")
+}
+
+func TestSnapshotNetworkOverrides(t *testing.T) {
+	ctx := context.Background()
+	_, socket := Start(t)
+	c := client(socket)
+	require.NoError(t, c.SetMachineConfig(ctx, &api.MachineConfig{VCPUCount: 1, MemSizeMib: 16}))
+	require.NoError(t, c.SetNetworkInterface(ctx, "eth0", &api.NetworkInterface{IfaceID: "eth0", HostDevName: "fctap1", GuestMAC: "06:00:ac:10:00:02"}))
+	boot(t, c)
+	require.NoError(t, c.PauseInstance(ctx))
+
+	dir := t.TempDir()
+	params := &api.SnapshotCreate{
+		SnapshotPath: filepath.Join(dir, "vm.snap"),
+		MemFilePath:  filepath.Join(dir, "vm.mem"),
+	}
+	require.NoError(t, c.CreateSnapshot(ctx, params))
+
+	_, socket2 := Start(t)
+	c2 := client(socket2)
+	err := c2.LoadSnapshot(ctx, &api.SnapshotLoad{
+		SnapshotPath:     params.SnapshotPath,
+		MemFilePath:      params.MemFilePath,
+		NetworkOverrides: []api.NetworkOverride{{IfaceID: "eth1", HostDevName: "fctap2"}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no network interface eth1 in the snapshot")
+
+	require.NoError(t, c2.LoadSnapshot(ctx, &api.SnapshotLoad{
+		SnapshotPath:     params.SnapshotPath,
+		MemFilePath:      params.MemFilePath,
+		NetworkOverrides: []api.NetworkOverride{{IfaceID: "eth0", HostDevName: "fctap2", GuestMAC: "06:00:ac:10:00:03"}},
+	}))
+	resp, err := httpClient(socket2).Get("http://localhost/vm/config")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var cfg Config
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&cfg))
+	require.Len(t, cfg.NetworkInterfaces, 1)
+	assert.Equal(t, "fctap2", cfg.NetworkInterfaces[0].HostDevName)
+	assert.Equal(t, "06:00:ac:10:00:03", cfg.NetworkInterfaces[0].GuestMAC)
+}
+
+func TestLoggerAndMetrics(t *testing.T) {
+	ctx := context.Background()
+	_, socket := Start(t)
+	c := client(socket)
+	dir := t.TempDir()
+
+	// The log must exist already
+	err := c.SetLogger(ctx, &api.Logger{LogPath: filepath.Join(dir, "missing.log")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Cannot initialize logging system")
+
+	logPath := touch(t, dir, "fc.log")
+	require.NoError(t, c.SetLogger(ctx, &api.Logger{LogPath: logPath, Level: "Info"}))
+
+	fifo := filepath.Join(dir, "fc.metrics")
+	require.NoError(t, syscall.Mkfifo(fifo, 0600))
+	r, err := os.OpenFile(fifo, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer r.Close()
+	require.NoError(t, c.SetMetricsSink(ctx, &api.MetricsConfig{MetricsPath: fifo}))
+
+	boot(t, c)
+	require.NoError(t, c.StopInstance(ctx))
+
+	resp, err := httpClient(socket).Do(mustPut(t, "http://localhost/actions", `{"action_type":"FlushMetrics"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	buf := make([]byte, 4096)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	var m api.Metrics
+	require.NoError(t, json.Unmarshal(buf[:n], &m))
+	assert.EqualValues(t, 4096, m.Block["read_bytes"])
+
+	log, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(log), "Running Firecracker v"+Version)
+	assert.Contains(t, string(log), "Successfully started microvm")
+	assert.Contains(t, string(log), "Sending CTRL+ALT+DEL")
+}
+
+func TestUnknownRoute(t *testing.T) {
+	_, socket := Start(t)
+	resp, err := httpClient(socket).Get("http://localhost/drives")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	var fault api.Error
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&fault))
+	assert.Equal(t, "Invalid request method and/or path: GET /drives.", fault.FaultMessage)
+}
+
+// mustPut returns a PUT request with a JSON body.
+func mustPut(t *testing.T, url, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
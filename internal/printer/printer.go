@@ -0,0 +1,226 @@
+// Package printer renders command results as JSON, YAML, aligned tables or
+// Go templates, as selected by fc-macos's global --output and --format flags.
+package printer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats accepted by --output.
+const (
+	JSON  = "json"
+	YAML  = "yaml"
+	Table = "table"
+	Wide  = "wide"
+)
+
+// Formats lists the --output values in the order they are documented.
+var Formats = []string{Table, Wide, JSON, YAML}
+
+// Column is one column of a table, or one field of an object's table view.
+type Column[T any] struct {
+	Header string
+	Value  func(T) string
+	Wide   bool // Only shown with --output wide
+}
+
+// Printer writes results in one output format.
+type Printer struct {
+	out    io.Writer
+	format string
+	tmpl   *template.Template
+}
+
+// New returns a printer for an --output value and an optional --format Go
+// template. A template takes precedence over the table formats.
+func New(out io.Writer, output, format string) (*Printer, error) {
+	p := &Printer{out: out, format: output}
+	switch output {
+	case "":
+		p.format = Table
+	case Table, Wide, JSON, YAML:
+	default:
+		return nil, fmt.Errorf("invalid output format %q (want one of %s)", output, strings.Join(Formats, ", "))
+	}
+
+	if format != "" {
+		if p.format == JSON || p.format == YAML {
+			return nil, fmt.Errorf("--format cannot be combined with --output %s", p.format)
+		}
+		tmpl, err := template.New("format").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				data, err := json.Marshal(v)
+				return string(data), err
+			},
+		}).Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --format template: %w", err)
+		}
+		p.tmpl = tmpl
+	}
+	return p, nil
+}
+
+// Format returns the output format, or "template" when --format is set.
+func (p *Printer) Format() string {
+	if p.tmpl != nil {
+		return "template"
+	}
+	return p.format
+}
+
+// Human reports whether output is meant for people, so commands can add
+// headings, hints and empty-list messages that would break parsing.
+func (p *Printer) Human() bool {
+	return p.tmpl == nil && (p.format == Table || p.format == Wide)
+}
+
+// List prints items as a JSON or YAML array, one template execution per item,
+// or a table with one row per item.
+func List[T any](p *Printer, items []T, cols []Column[T]) error {
+	if items == nil {
+		items = []T{}
+	}
+	if done, err := p.encode(items); done {
+		return err
+	}
+	if p.tmpl != nil {
+		for _, item := range items {
+			if err := p.execute(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cols = visible(p, cols)
+	tw := tabwriter.NewWriter(p.out, 0, 0, 3, ' ', 0)
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = c.Header
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, item := range items {
+		values := make([]string, len(cols))
+		for i, c := range cols {
+			values[i] = c.Value(item)
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+// Object prints one item as JSON or YAML, a template execution, or aligned
+// "Header: value" lines.
+func Object[T any](p *Printer, item T, fields []Column[T]) error {
+	if done, err := p.encode(item); done {
+		return err
+	}
+	if p.tmpl != nil {
+		return p.execute(item)
+	}
+
+	tw := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	for _, f := range visible(p, fields) {
+		value := f.Value(item)
+		if value == "" {
+			continue
+		}
+		fmt.Fprintf(tw, "%s:\t%s\n", f.Header, value)
+	}
+	return tw.Flush()
+}
+
+// Error prints err in the output format: an {"error": ...} document for JSON
+// and YAML, and nothing otherwise (cobra prints it). It reports whether err
+// was printed.
+func (p *Printer) Error(err error) bool {
+	doc := struct {
+		Error string `json:"error"`
+	}{err.Error()}
+	done, _ := p.encode(doc)
+	return done
+}
+
+// encode writes v as JSON or YAML. It reports false when the format is
+// neither.
+func (p *Printer) encode(v interface{}) (bool, error) {
+	if p.tmpl != nil {
+		return false, nil
+	}
+	switch p.format {
+	case JSON:
+		enc := json.NewEncoder(p.out)
+		enc.SetIndent("", "  ")
+		return true, enc.Encode(v)
+	case YAML:
+		data, err := toYAML(v)
+		if err != nil {
+			return true, err
+		}
+		_, err = p.out.Write(data)
+		return true, err
+	}
+	return false, nil
+}
+
+func (p *Printer) execute(item interface{}) error {
+	if err := p.tmpl.Execute(p.out, item); err != nil {
+		return fmt.Errorf("failed to execute --format template: %w", err)
+	}
+	_, err := fmt.Fprintln(p.out)
+	return err
+}
+
+// visible drops the wide-only columns unless the format is wide.
+func visible[T any](p *Printer, cols []Column[T]) []Column[T] {
+	if p.format == Wide {
+		return cols
+	}
+	var out []Column[T]
+	for _, c := range cols {
+		if !c.Wide {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// toYAML converts v to YAML via its JSON encoding, so the json struct tags
+// name the fields and their order is kept.
+func toYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// blockStyle clears the flow style JSON parses as, so the YAML encoder uses
+// block style and only quotes strings that need it.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
@@ -0,0 +1,87 @@
+package printer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type vm struct {
+	Name  string `json:"name"`
+	VCPUs int    `json:"vcpus"`
+	Note  string `json:"note,omitempty"`
+}
+
+var vmColumns = []Column[vm]{
+	{Header: "NAME", Value: func(v vm) string { return v.Name }},
+	{Header: "VCPUS", Value: func(v vm) string { return fmt.Sprint(v.VCPUs) }},
+	{Header: "NOTE", Value: func(v vm) string { return v.Note }, Wide: true},
+}
+
+var vms = []vm{{Name: "web", VCPUs: 2, Note: "true"}, {Name: "batch-worker", VCPUs: 1}}
+
+func render(t *testing.T, output, format string, fn func(p *Printer) error) string {
+	t.Helper()
+	var buf bytes.Buffer
+	p, err := New(&buf, output, format)
+	require.NoError(t, err)
+	require.NoError(t, fn(p))
+	return buf.String()
+}
+
+func TestListTable(t *testing.T) {
+	out := render(t, "", "", func(p *Printer) error { return List(p, vms, vmColumns) })
+	assert.Equal(t, "NAME           VCPUS\nweb            2\nbatch-worker   1\n", out)
+
+	out = render(t, Wide, "", func(p *Printer) error { return List(p, vms, vmColumns) })
+	assert.Equal(t, "NAME           VCPUS   NOTE\nweb            2       true\nbatch-worker   1       \n", out)
+}
+
+func TestListJSONAndYAML(t *testing.T) {
+	out := render(t, JSON, "", func(p *Printer) error { return List(p, vms, vmColumns) })
+	assert.JSONEq(t, `[{"name":"web","vcpus":2,"note":"true"},{"name":"batch-worker","vcpus":1}]`, out)
+
+	out = render(t, JSON, "", func(p *Printer) error { return List[vm](p, nil, vmColumns) })
+	assert.Equal(t, "[]\n", out, "empty lists are arrays, not null")
+
+	out = render(t, YAML, "", func(p *Printer) error { return List(p, vms, vmColumns) })
+	assert.Equal(t, "- name: web\n  vcpus: 2\n  note: \"true\"\n- name: batch-worker\n  vcpus: 1\n", out)
+}
+
+func TestTemplate(t *testing.T) {
+	out := render(t, "", "{{.Name}}={{.VCPUs}}", func(p *Printer) error { return List(p, vms, vmColumns) })
+	assert.Equal(t, "web=2\nbatch-worker=1\n", out)
+
+	out = render(t, "", "{{json .}}", func(p *Printer) error { return Object(p, vms[1], vmColumns) })
+	assert.Equal(t, `{"name":"batch-worker","vcpus":1}`+"\n", out)
+}
+
+func TestObjectTable(t *testing.T) {
+	out := render(t, Table, "", func(p *Printer) error { return Object(p, vms[1], vmColumns) })
+	assert.Equal(t, "NAME:   batch-worker\nVCPUS:  1\n", out)
+}
+
+func TestNewRejectsBadInput(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, "xml", "")
+	assert.Error(t, err)
+	_, err = New(&bytes.Buffer{}, JSON, "{{.Name}}")
+	assert.Error(t, err)
+	_, err = New(&bytes.Buffer{}, "", "{{.Name")
+	assert.Error(t, err)
+}
+
+func TestError(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := New(&buf, JSON, "")
+	require.NoError(t, err)
+	assert.True(t, p.Error(errors.New("microVM not found: web")))
+	assert.JSONEq(t, `{"error":"microVM not found: web"}`, buf.String())
+
+	p, err = New(&buf, Table, "")
+	require.NoError(t, err)
+	assert.False(t, p.Error(errors.New("boom")))
+}
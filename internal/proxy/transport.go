@@ -1,4 +1,5 @@
-// Package proxy provides communication between the macOS host and Firecracker in the Linux VM.
+//go:build darwin && cgo
+
 package proxy
 
 import (
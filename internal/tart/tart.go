@@ -472,7 +472,7 @@ func (v *VM) PingAgent() bool {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	output, err := v.Exec(ctx, "curl -s http://localhost:8080/health || echo 'failed'")
+	output, err := v.Exec(ctx, "curl -sk https://localhost:8080/health || curl -s http://localhost:8080/health || echo 'failed'")
 	if err != nil {
 		return false
 	}
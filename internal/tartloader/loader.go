@@ -4,13 +4,8 @@
 package tartloader
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -68,236 +63,6 @@ func (c *configWrapper) GetMemorySizeMiB() uint64 {
 	return c.cfg.MemorySizeMiB
 }
 
-// httpClientWrapper implements cli.FirecrackerClientProvider using HTTP to fc-agent
-type httpClientWrapper struct {
-	vm         *tart.VM
-	httpClient *http.Client
-	agentURL   string
-}
-
-func (c *httpClientWrapper) doRequest(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
-	var reqBody io.Reader
-	if body != nil {
-		data, err := json.Marshal(body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request: %w", err)
-		}
-		reqBody = bytes.NewReader(data)
-	}
-
-	url := c.agentURL + path
-	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
-	}
-
-	return respBody, nil
-}
-
-func (c *httpClientWrapper) SetBootSource(ctx context.Context, bs interface{}) error {
-	_, err := c.doRequest(ctx, "PUT", "/boot-source", bs)
-	return err
-}
-
-func (c *httpClientWrapper) GetBootSource(ctx context.Context) (interface{}, error) {
-	data, err := c.doRequest(ctx, "GET", "/boot-source", nil)
-	if err != nil {
-		return nil, err
-	}
-	var result interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-func (c *httpClientWrapper) SetDrive(ctx context.Context, id string, drive interface{}) error {
-	_, err := c.doRequest(ctx, "PUT", "/drives/"+id, drive)
-	return err
-}
-
-func (c *httpClientWrapper) GetDrives(ctx context.Context) ([]interface{}, error) {
-	data, err := c.doRequest(ctx, "GET", "/drives", nil)
-	if err != nil {
-		return nil, err
-	}
-	var result []interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-func (c *httpClientWrapper) PatchDrive(ctx context.Context, id string, pathOnHost string) error {
-	_, err := c.doRequest(ctx, "PATCH", "/drives/"+id, map[string]string{"path_on_host": pathOnHost})
-	return err
-}
-
-func (c *httpClientWrapper) DeleteDrive(ctx context.Context, id string) error {
-	_, err := c.doRequest(ctx, "DELETE", "/drives/"+id, nil)
-	return err
-}
-
-func (c *httpClientWrapper) SetNetworkInterface(ctx context.Context, id string, iface interface{}) error {
-	_, err := c.doRequest(ctx, "PUT", "/network-interfaces/"+id, iface)
-	return err
-}
-
-func (c *httpClientWrapper) GetNetworkInterfaces(ctx context.Context) ([]interface{}, error) {
-	data, err := c.doRequest(ctx, "GET", "/network-interfaces", nil)
-	if err != nil {
-		return nil, err
-	}
-	var result []interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-func (c *httpClientWrapper) PatchNetworkInterface(ctx context.Context, id string, rxLimiter, txLimiter interface{}) error {
-	_, err := c.doRequest(ctx, "PATCH", "/network-interfaces/"+id, map[string]interface{}{
-		"rx_rate_limiter": rxLimiter,
-		"tx_rate_limiter": txLimiter,
-	})
-	return err
-}
-
-func (c *httpClientWrapper) DeleteNetworkInterface(ctx context.Context, id string) error {
-	_, err := c.doRequest(ctx, "DELETE", "/network-interfaces/"+id, nil)
-	return err
-}
-
-func (c *httpClientWrapper) SetMachineConfig(ctx context.Context, cfg interface{}) error {
-	_, err := c.doRequest(ctx, "PUT", "/machine-config", cfg)
-	return err
-}
-
-func (c *httpClientWrapper) GetMachineConfig(ctx context.Context) (interface{}, error) {
-	data, err := c.doRequest(ctx, "GET", "/machine-config", nil)
-	if err != nil {
-		return nil, err
-	}
-	var result interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-func (c *httpClientWrapper) GetVersion(ctx context.Context) (interface{}, error) {
-	data, err := c.doRequest(ctx, "GET", "/version", nil)
-	if err != nil {
-		return nil, err
-	}
-	var result interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-func (c *httpClientWrapper) StartInstance(ctx context.Context) error {
-	_, err := c.doRequest(ctx, "PUT", "/actions", map[string]string{"action_type": "InstanceStart"})
-	return err
-}
-
-func (c *httpClientWrapper) StopInstance(ctx context.Context) error {
-	_, err := c.doRequest(ctx, "PUT", "/actions", map[string]string{"action_type": "SendCtrlAltDel"})
-	return err
-}
-
-func (c *httpClientWrapper) ForceStopInstance(ctx context.Context) error {
-	_, err := c.doRequest(ctx, "PUT", "/actions", map[string]string{"action_type": "SendCtrlAltDel"})
-	return err
-}
-
-func (c *httpClientWrapper) PauseInstance(ctx context.Context) error {
-	_, err := c.doRequest(ctx, "PATCH", "/vm", map[string]string{"state": "Paused"})
-	return err
-}
-
-func (c *httpClientWrapper) ResumeInstance(ctx context.Context) error {
-	_, err := c.doRequest(ctx, "PATCH", "/vm", map[string]string{"state": "Resumed"})
-	return err
-}
-
-func (c *httpClientWrapper) CreateSnapshot(ctx context.Context, params interface{}) error {
-	_, err := c.doRequest(ctx, "PUT", "/snapshot/create", params)
-	return err
-}
-
-func (c *httpClientWrapper) LoadSnapshot(ctx context.Context, params interface{}) error {
-	_, err := c.doRequest(ctx, "PUT", "/snapshot/load", params)
-	return err
-}
-
-func (c *httpClientWrapper) GetMetrics(ctx context.Context) (interface{}, error) {
-	data, err := c.doRequest(ctx, "GET", "/metrics", nil)
-	if err != nil {
-		return nil, err
-	}
-	var result interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-func (c *httpClientWrapper) SetBalloon(ctx context.Context, balloon interface{}) error {
-	_, err := c.doRequest(ctx, "PUT", "/balloon", balloon)
-	return err
-}
-
-func (c *httpClientWrapper) GetBalloon(ctx context.Context) (interface{}, error) {
-	data, err := c.doRequest(ctx, "GET", "/balloon", nil)
-	if err != nil {
-		return nil, err
-	}
-	var result interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-func (c *httpClientWrapper) GetBalloonStats(ctx context.Context) (interface{}, error) {
-	data, err := c.doRequest(ctx, "GET", "/balloon/statistics", nil)
-	if err != nil {
-		return nil, err
-	}
-	var result interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
-func (c *httpClientWrapper) PatchBalloon(ctx context.Context, amountMib int64) error {
-	_, err := c.doRequest(ctx, "PATCH", "/balloon", map[string]int64{"amount_mib": amountMib})
-	return err
-}
-
 func initializeVM(ctx context.Context, cfg cli.VMInitConfig) (cli.VMProvider, cli.FirecrackerClientProvider, error) {
 	// Convert shared directory
 	var sharedDirs []tart.SharedDir
@@ -351,13 +116,10 @@ func initializeVM(ctx context.Context, cfg cli.VMInitConfig) (cli.VMProvider, cl
 
 	logrus.Infof("VM ready at %s", ip)
 
-	// Create HTTP client that talks to the agent
-	client := &httpClientWrapper{
-		vm:       vm,
-		agentURL: fmt.Sprintf("http://%s:8080", ip),
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+	// fc-agent forwards the Firecracker API over TCP
+	client, err := cli.ConnectFirecracker(ctx, cli.AgentURL(ip))
+	if err != nil {
+		return nil, nil, err
 	}
 
 	return &vmWrapper{vm: vm}, client, nil
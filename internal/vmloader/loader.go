@@ -10,6 +10,7 @@ import (
 	"github.com/anthropics/fc-macos/internal/cli"
 	"github.com/anthropics/fc-macos/internal/linuxvm"
 	"github.com/anthropics/fc-macos/internal/proxy"
+	"github.com/anthropics/fc-macos/pkg/firecracker"
 )
 
 func init() {
@@ -62,117 +63,6 @@ func (c *configWrapper) GetMemorySizeMiB() uint64 {
 	return c.cfg.MemorySizeMiB
 }
 
-// clientWrapper implements cli.FirecrackerClientProvider
-type clientWrapper struct {
-	client *proxy.FirecrackerClient
-}
-
-func (c *clientWrapper) SetBootSource(ctx context.Context, bs interface{}) error {
-	// Type assertion will be handled by the caller passing the correct type
-	return fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) GetBootSource(ctx context.Context) (interface{}, error) {
-	return nil, fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) SetDrive(ctx context.Context, id string, drive interface{}) error {
-	return fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) GetDrives(ctx context.Context) ([]interface{}, error) {
-	return nil, fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) PatchDrive(ctx context.Context, id string, pathOnHost string) error {
-	return c.client.PatchDrive(ctx, id, pathOnHost)
-}
-
-func (c *clientWrapper) DeleteDrive(ctx context.Context, id string) error {
-	return c.client.DeleteDrive(ctx, id)
-}
-
-func (c *clientWrapper) SetNetworkInterface(ctx context.Context, id string, iface interface{}) error {
-	return fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) GetNetworkInterfaces(ctx context.Context) ([]interface{}, error) {
-	return nil, fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) PatchNetworkInterface(ctx context.Context, id string, rxLimiter, txLimiter interface{}) error {
-	return fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) DeleteNetworkInterface(ctx context.Context, id string) error {
-	return c.client.DeleteNetworkInterface(ctx, id)
-}
-
-func (c *clientWrapper) SetMachineConfig(ctx context.Context, cfg interface{}) error {
-	return fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) GetMachineConfig(ctx context.Context) (interface{}, error) {
-	return nil, fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) GetVersion(ctx context.Context) (interface{}, error) {
-	return c.client.GetVersion(ctx)
-}
-
-func (c *clientWrapper) StartInstance(ctx context.Context) error {
-	return c.client.StartInstance(ctx)
-}
-
-func (c *clientWrapper) StopInstance(ctx context.Context) error {
-	return c.client.StopInstance(ctx)
-}
-
-func (c *clientWrapper) ForceStopInstance(ctx context.Context) error {
-	return c.client.ForceStopInstance(ctx)
-}
-
-func (c *clientWrapper) PauseInstance(ctx context.Context) error {
-	return c.client.PauseInstance(ctx)
-}
-
-func (c *clientWrapper) ResumeInstance(ctx context.Context) error {
-	return c.client.ResumeInstance(ctx)
-}
-
-func (c *clientWrapper) CreateSnapshot(ctx context.Context, params interface{}) error {
-	return fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) LoadSnapshot(ctx context.Context, params interface{}) error {
-	return fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) GetMetrics(ctx context.Context) (interface{}, error) {
-	return c.client.GetMetrics(ctx)
-}
-
-func (c *clientWrapper) SetBalloon(ctx context.Context, balloon interface{}) error {
-	return fmt.Errorf("not implemented - use typed client directly")
-}
-
-func (c *clientWrapper) GetBalloon(ctx context.Context) (interface{}, error) {
-	return c.client.GetBalloon(ctx)
-}
-
-func (c *clientWrapper) GetBalloonStats(ctx context.Context) (interface{}, error) {
-	return c.client.GetBalloonStats(ctx)
-}
-
-func (c *clientWrapper) PatchBalloon(ctx context.Context, amountMib int64) error {
-	return c.client.PatchBalloon(ctx, amountMib)
-}
-
-// GetTypedClient returns the underlying typed client for commands that need it
-func (c *clientWrapper) GetTypedClient() *proxy.FirecrackerClient {
-	return c.client
-}
-
 func initializeVM(ctx context.Context, cfg cli.VMInitConfig) (cli.VMProvider, cli.FirecrackerClientProvider, error) {
 	vmCfg := &linuxvm.Config{
 		KernelPath:    cfg.KernelPath,
@@ -199,7 +89,7 @@ func initializeVM(ctx context.Context, cfg cli.VMInitConfig) (cli.VMProvider, cl
 	}
 
 	transport := proxy.NewVsockTransport(vm.VsockDevice(), cfg.VsockPort)
-	client := proxy.NewFirecrackerClient(transport)
+	client := firecracker.New(transport)
 
-	return &vmWrapper{vm: vm}, &clientWrapper{client: client}, nil
+	return &vmWrapper{vm: vm}, client, nil
 }
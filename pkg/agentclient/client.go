@@ -0,0 +1,715 @@
+// Package agentclient is a Go client for fc-agent's management API. It
+// creates, lists and deletes microVMs, attaches to their serial consoles and
+// reaches each microVM's Firecracker API through the agent.
+//
+// The request and response types are the ones fc-agent itself uses.
+package agentclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/fc-macos/pkg/firecracker"
+)
+
+// DefaultTimeout bounds each request when Options.Timeout is zero.
+const DefaultTimeout = 30 * time.Second
+
+// DefaultPollInterval is how often Wait checks on an operation when
+// Options.PollInterval is zero.
+const DefaultPollInterval = 250 * time.Millisecond
+
+// createAttempts is how many times CreateAsync sends a create that has an
+// idempotency key, waiting one more poll interval before each retry.
+const createAttempts = 3
+
+// APIVersion is the version of the fc-agent API this package speaks.
+const APIVersion = "v1"
+
+// ErrUnversioned is returned by Version for agents that predate API
+// versioning. Talk to them with Options.Unversioned.
+var ErrUnversioned = errors.New("fc-agent predates API versioning")
+
+// Options configures a Client. A nil *Options talks plain HTTP without a
+// token.
+type Options struct {
+	// Token is an fc-agent API token, sent as a bearer token.
+	Token string
+
+	// TLSConfig is used for https URLs. Nil trusts the system roots.
+	TLSConfig *tls.Config
+
+	// Timeout bounds each request, but not console streams or followed
+	// logs (default: DefaultTimeout).
+	Timeout time.Duration
+
+	// Unversioned uses the deprecated routes without the /v1 prefix, for
+	// agents that predate API versioning.
+	Unversioned bool
+
+	// PollInterval is how often Wait checks on an operation (default:
+	// DefaultPollInterval).
+	PollInterval time.Duration
+}
+
+// Client is a client for one fc-agent. It is safe for concurrent use.
+type Client struct {
+	baseURL      string
+	apiURL       string // baseURL plus the API version prefix
+	token        string
+	tlsConfig    *tls.Config
+	httpClient   *http.Client
+	streamClient *http.Client // Without a timeout, for followed logs
+	pollInterval time.Duration
+}
+
+// New returns a client for the fc-agent at baseURL, such as
+// "http://192.168.64.2:8080".
+func New(baseURL string, opts *Options) *Client {
+	if opts == nil {
+		opts = &Options{}
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	pollInterval := opts.PollInterval
+	if pollInterval == 0 {
+		pollInterval = DefaultPollInterval
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = opts.TLSConfig
+	authed := &bearerTransport{token: opts.Token, base: transport}
+
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	apiURL := baseURL + "/" + APIVersion
+	if opts.Unversioned {
+		apiURL = baseURL
+	}
+
+	return &Client{
+		baseURL:      baseURL,
+		apiURL:       apiURL,
+		token:        opts.Token,
+		tlsConfig:    opts.TLSConfig,
+		httpClient:   &http.Client{Timeout: timeout, Transport: authed},
+		streamClient: &http.Client{Transport: authed},
+		pollInterval: pollInterval,
+	}
+}
+
+// Error is an error response from fc-agent. Fields is set when fc-agent
+// rejected a request body field by field.
+type Error struct {
+	StatusCode int
+	Message    string
+	Fields     []FieldError
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Field + " " + f.Message
+	}
+	return e.Message + ": " + strings.Join(fields, "; ")
+}
+
+// OperationError is an operation that failed or was cancelled.
+type OperationError struct {
+	Operation *Operation
+}
+
+func (e *OperationError) Error() string {
+	if e.Operation.Status == OperationCancelled {
+		return fmt.Sprintf("%s of %s was cancelled", e.Operation.Type, e.Operation.MicroVM)
+	}
+	return e.Operation.Error
+}
+
+// IsNotFound reports whether err is fc-agent reporting that a microVM does
+// not exist.
+func IsNotFound(err error) bool {
+	var agentErr *Error
+	return errors.As(err, &agentErr) && agentErr.StatusCode == http.StatusNotFound
+}
+
+// APIURL returns the root of the API routes, such as
+// "http://192.168.64.2:8080/v1".
+func (c *Client) APIURL() string {
+	return c.apiURL
+}
+
+// Health checks that fc-agent is up.
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, c.baseURL+"/health", nil, nil)
+}
+
+// Version returns fc-agent's version and API version, or ErrUnversioned if
+// the agent predates API versioning.
+func (c *Client) Version(ctx context.Context) (*VersionInfo, error) {
+	// Older agents forward unknown paths, /version included, to Firecracker,
+	// so ask /health first: only versioned agents report an API version there
+	var health struct {
+		APIVersion string `json:"api_version"`
+	}
+	if err := c.do(ctx, http.MethodGet, c.baseURL+"/health", nil, &health); err != nil {
+		return nil, err
+	}
+	if health.APIVersion == "" {
+		return nil, ErrUnversioned
+	}
+
+	var info VersionInfo
+	if err := c.do(ctx, http.MethodGet, c.baseURL+"/version", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Create creates and boots a microVM, waiting until it is running.
+func (c *Client) Create(ctx context.Context, req *CreateMicroVMRequest) (*MicroVMInfo, error) {
+	op, err := c.CreateAsync(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if op, err = c.Wait(ctx, op, nil); err != nil {
+		return nil, err
+	}
+	return op.Result, nil
+}
+
+// CreateAsync starts creating a microVM and returns the operation booting
+// it. Agents that create synchronously return an operation that is already
+// done.
+//
+// With req.IdempotencyKey set, requests that fail without an answer from
+// fc-agent are retried, since a retry cannot create a second microVM.
+func (c *Client) CreateAsync(ctx context.Context, req *CreateMicroVMRequest) (*Operation, error) {
+	var header http.Header
+	attempts := 1
+	if req.IdempotencyKey != "" {
+		header = http.Header{"Idempotency-Key": {req.IdempotencyKey}}
+		attempts = createAttempts
+	}
+
+	var vm MicroVMInfo
+	var op *Operation
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(i) * c.pollInterval):
+			}
+		}
+		op, err = c.submit(ctx, http.MethodPost, c.apiURL+"/agent/microvms", req, &vm, header)
+		var agentErr *Error
+		if err == nil || errors.As(err, &agentErr) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if op == nil {
+		op = &Operation{Type: "create", MicroVMID: vm.ID, MicroVM: vm.Name, Status: OperationSucceeded, Result: &vm}
+	}
+	return op, nil
+}
+
+// BatchCreate creates req.Count microVMs from one template, waiting until
+// all of them have booted or failed. The finished operation reports each
+// microVM in its Items, and is returned with an *OperationError if any of
+// them failed.
+func (c *Client) BatchCreate(ctx context.Context, req *BatchCreateRequest) (*Operation, error) {
+	op, err := c.BatchCreateAsync(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.Wait(ctx, op, nil)
+}
+
+// BatchCreateAsync starts a batch create and returns its operation.
+func (c *Client) BatchCreateAsync(ctx context.Context, req *BatchCreateRequest) (*Operation, error) {
+	var op Operation
+	if err := c.do(ctx, http.MethodPost, c.apiURL+"/agent/microvms:batch", req, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// List returns the microVMs matching a label selector such as
+// "team=ci,env!=prod", or all microVMs the token can see if it is empty.
+func (c *Client) List(ctx context.Context, selector string) ([]MicroVMInfo, error) {
+	path := "/agent/microvms"
+	if selector != "" {
+		path += "?selector=" + url.QueryEscape(selector)
+	}
+	var vms []MicroVMInfo
+	if err := c.do(ctx, http.MethodGet, c.apiURL+path, nil, &vms); err != nil {
+		return nil, err
+	}
+	return vms, nil
+}
+
+// Get returns the microVM with an ID or name.
+func (c *Client) Get(ctx context.Context, idOrName string) (*MicroVMInfo, error) {
+	var vm MicroVMInfo
+	if err := c.do(ctx, http.MethodGet, c.apiURL+microVMPath(idOrName, ""), nil, &vm); err != nil {
+		return nil, err
+	}
+	return &vm, nil
+}
+
+// Delete stops a microVM and releases its resources, waiting until it is
+// gone. With force, the microVM is removed even if Firecracker could not be
+// stopped cleanly.
+func (c *Client) Delete(ctx context.Context, idOrName string, force bool) error {
+	op, err := c.DeleteAsync(ctx, idOrName, force)
+	if err != nil {
+		return err
+	}
+	_, err = c.Wait(ctx, op, nil)
+	return err
+}
+
+// DeleteAsync starts deleting a microVM and returns the operation stopping
+// it. Agents that delete synchronously return an operation that is already
+// done.
+func (c *Client) DeleteAsync(ctx context.Context, idOrName string, force bool) (*Operation, error) {
+	path := microVMPath(idOrName, "")
+	if force {
+		path += "?force=true"
+	}
+	op, err := c.submit(ctx, http.MethodDelete, c.apiURL+path, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if op == nil {
+		op = &Operation{Type: "delete", MicroVM: idOrName, Status: OperationSucceeded}
+	}
+	return op, nil
+}
+
+// Operation returns the current state of an operation.
+func (c *Client) Operation(ctx context.Context, id string) (*Operation, error) {
+	var op Operation
+	if err := c.do(ctx, http.MethodGet, c.apiURL+"/agent/operations/"+url.PathEscape(id), nil, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// Operations returns the running and recently finished operations, oldest
+// first.
+func (c *Client) Operations(ctx context.Context) ([]Operation, error) {
+	var ops []Operation
+	if err := c.do(ctx, http.MethodGet, c.apiURL+"/agent/operations", nil, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// CancelOperation cancels a running create. fc-agent tears down whatever the
+// create had set up; a create that has already booted its microVM finishes
+// anyway.
+func (c *Client) CancelOperation(ctx context.Context, id string) (*Operation, error) {
+	var op Operation
+	if err := c.do(ctx, http.MethodPost, c.apiURL+"/agent/operations/"+url.PathEscape(id)+"/cancel", nil, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// Wait polls op until it is done, calling progress, if set, with each state
+// seen. It returns the finished operation, with an *OperationError if it
+// failed or was cancelled. If ctx ends first, the operation carries on in
+// fc-agent.
+func (c *Client) Wait(ctx context.Context, op *Operation, progress func(*Operation)) (*Operation, error) {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if progress != nil {
+			progress(op)
+		}
+		if op.Done() {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return op, ctx.Err()
+		case <-ticker.C:
+		}
+		next, err := c.Operation(ctx, op.ID)
+		if err != nil {
+			return op, err
+		}
+		op = next
+	}
+
+	if op.Status != OperationSucceeded {
+		return op, &OperationError{Operation: op}
+	}
+	return op, nil
+}
+
+// Clone copies a running microVM into a new one, waiting until the clone is
+// running. The source is paused while its memory and rootfs are copied.
+func (c *Client) Clone(ctx context.Context, idOrName string, req *CloneMicroVMRequest) (*MicroVMInfo, error) {
+	op, err := c.CloneAsync(ctx, idOrName, req)
+	if err != nil {
+		return nil, err
+	}
+	if op, err = c.Wait(ctx, op, nil); err != nil {
+		return nil, err
+	}
+	return op.Result, nil
+}
+
+// CloneAsync starts cloning a microVM and returns the operation restoring
+// the clone.
+func (c *Client) CloneAsync(ctx context.Context, idOrName string, req *CloneMicroVMRequest) (*Operation, error) {
+	var op Operation
+	if err := c.do(ctx, http.MethodPost, c.apiURL+microVMPath(idOrName, "clone"), req, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// Extend pushes a microVM's expiry back by ttl, or sets it to ttl from now
+// if the microVM had none, and returns the updated microVM.
+func (c *Client) Extend(ctx context.Context, idOrName string, ttl time.Duration) (*MicroVMInfo, error) {
+	var vm MicroVMInfo
+	req := &ExtendRequest{TTL: ttl.String()}
+	if err := c.do(ctx, http.MethodPost, c.apiURL+microVMPath(idOrName, "extend"), req, &vm); err != nil {
+		return nil, err
+	}
+	return &vm, nil
+}
+
+// Pause pauses a running microVM and returns the updated microVM. Pausing
+// a paused microVM changes nothing.
+func (c *Client) Pause(ctx context.Context, idOrName string) (*MicroVMInfo, error) {
+	var vm MicroVMInfo
+	if err := c.do(ctx, http.MethodPost, c.apiURL+microVMPath(idOrName, "pause"), nil, &vm); err != nil {
+		return nil, err
+	}
+	return &vm, nil
+}
+
+// Resume resumes a paused microVM and returns the updated microVM.
+func (c *Client) Resume(ctx context.Context, idOrName string) (*MicroVMInfo, error) {
+	var vm MicroVMInfo
+	if err := c.do(ctx, http.MethodPost, c.apiURL+microVMPath(idOrName, "resume"), nil, &vm); err != nil {
+		return nil, err
+	}
+	return &vm, nil
+}
+
+// SwapDrive points a running microVM's drive at another file on the Linux
+// VM, which no other drive may be using, and returns the updated microVM.
+func (c *Client) SwapDrive(ctx context.Context, idOrName, driveID, pathOnHost string) (*MicroVMInfo, error) {
+	var vm MicroVMInfo
+	req := &SwapDriveRequest{DriveID: driveID, PathOnHost: pathOnHost}
+	if err := c.do(ctx, http.MethodPost, c.apiURL+microVMPath(idOrName, "swap-drive"), req, &vm); err != nil {
+		return nil, err
+	}
+	return &vm, nil
+}
+
+// Exec runs a command against the command service a microVM's guest runs on
+// a vsock port, and returns its output.
+func (c *Client) Exec(ctx context.Context, idOrName string, req *ExecRequest) (string, error) {
+	var resp ExecResponse
+	if err := c.do(ctx, http.MethodPost, c.apiURL+microVMPath(idOrName, "exec"), req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Output, nil
+}
+
+// FirecrackerLogs returns a microVM's Firecracker log: the last tail lines
+// (all if zero), and with follow, new lines as they are written until the
+// reader is closed or ctx is done.
+func (c *Client) FirecrackerLogs(ctx context.Context, idOrName string, tail int, follow bool) (io.ReadCloser, error) {
+	params := url.Values{}
+	if tail > 0 {
+		params.Set("tail", strconv.Itoa(tail))
+	}
+	if follow {
+		params.Set("follow", "true")
+	}
+	path := microVMPath(idOrName, "firecracker-logs")
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// Stats returns a microVM's resource history over the last rng.
+func (c *Client) Stats(ctx context.Context, idOrName string, rng time.Duration) (*MicroVMStats, error) {
+	var stats MicroVMStats
+	path := microVMPath(idOrName, "stats") + "?range=" + rng.String()
+	if err := c.do(ctx, http.MethodGet, c.apiURL+path, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Usage returns the current resource usage of the microVMs matching a label
+// selector (all if empty).
+func (c *Client) Usage(ctx context.Context, selector string) ([]MicroVMUsage, error) {
+	path := "/agent/stats"
+	if selector != "" {
+		path += "?selector=" + url.QueryEscape(selector)
+	}
+	var usage []MicroVMUsage
+	if err := c.do(ctx, http.MethodGet, c.apiURL+path, nil, &usage); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// Capacity returns fc-agent's resource admission state.
+func (c *Client) Capacity(ctx context.Context) (*Capacity, error) {
+	var capacity Capacity
+	if err := c.do(ctx, http.MethodGet, c.apiURL+"/agent/capacity", nil, &capacity); err != nil {
+		return nil, err
+	}
+	return &capacity, nil
+}
+
+// Firecracker returns a client for a microVM's Firecracker API, forwarded by
+// fc-agent.
+func (c *Client) Firecracker(idOrName string) *firecracker.Client {
+	return firecracker.NewAt(c.httpClient, c.apiURL+microVMPath(idOrName, ""))
+}
+
+// Console attaches to a microVM's serial console. Reads return the guest's
+// console output and writes are typed into it. ctx only bounds connecting;
+// close the console to detach.
+func (c *Client) Console(ctx context.Context, idOrName string) (io.ReadWriteCloser, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL+microVMPath(idOrName, "console"), nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	// Give up on a silent agent when ctx is done, then leave the stream
+	// open for as long as the caller wants it
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to request console: %w", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read console response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		return nil, responseError(resp)
+	}
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+
+	// The agent hijacks the connection, so the body is the console stream
+	return &console{Reader: resp.Body, conn: conn}, nil
+}
+
+// console is an attached serial console.
+type console struct {
+	io.Reader
+	conn net.Conn
+}
+
+func (c *console) Write(p []byte) (int, error) {
+	return c.conn.Write(p)
+}
+
+func (c *console) Close() error {
+	return c.conn.Close()
+}
+
+// dial opens a raw connection to the agent, using TLS for https URLs.
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent URL: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	var d net.Dialer
+	if u.Scheme == "https" {
+		td := &tls.Dialer{NetDialer: &d, Config: c.tlsConfig}
+		return td.DialContext(ctx, "tcp", host)
+	}
+	return d.DialContext(ctx, "tcp", host)
+}
+
+// do sends a request with an optional JSON body and decodes a JSON response
+// into out, if set.
+func (c *Client) do(ctx context.Context, method, reqURL string, body, out interface{}) error {
+	resp, err := c.send(ctx, method, reqURL, body, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, out)
+}
+
+// submit sends a request that fc-agent runs as an operation, and returns
+// the operation from its 202 response. Agents that predate operations answer
+// with the result itself, which is decoded into out, and a nil operation.
+func (c *Client) submit(ctx context.Context, method, reqURL string, body, out interface{}, header http.Header) (*Operation, error) {
+	resp, err := c.send(ctx, method, reqURL, body, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, decodeResponse(resp, out)
+	}
+	var op Operation
+	if err := decodeResponse(resp, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// send sends a request with an optional JSON body and extra headers, and
+// returns the response if it succeeded.
+func (c *Client) send(ctx context.Context, method, reqURL string, body interface{}, header http.Header) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// decodeResponse decodes a JSON response into out, if set.
+func decodeResponse(resp *http.Response, out interface{}) error {
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// responseError reads fc-agent's error body: an ErrorResponse for invalid
+// request bodies, plain text otherwise.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var errResp ErrorResponse
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
+			return &Error{StatusCode: resp.StatusCode, Message: errResp.Error, Fields: errResp.Fields}
+		}
+	}
+
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		msg = resp.Status
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: msg}
+}
+
+// microVMPath returns the path of a microVM, or of one of its sub-resources.
+func microVMPath(idOrName, sub string) string {
+	path := "/agent/microvms/" + url.PathEscape(idOrName)
+	if sub != "" {
+		path += "/" + sub
+	}
+	return path
+}
+
+// bearerTransport adds an Authorization header to each request.
+type bearerTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.token != "" && req.Header.Get("Authorization") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,445 @@
+package agentclient_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anthropics/fc-macos/internal/agent"
+	"github.com/anthropics/fc-macos/internal/fctest"
+	"github.com/anthropics/fc-macos/pkg/agentclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "test-token"
+
+// newTestAgent serves a real fc-agent, backed by the fake Firecracker, that
+// requires testToken.
+func newTestAgent(t *testing.T) *httptest.Server {
+	t.Helper()
+	proc := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "stat"), []byte("cpu  100 0 100 1000 0 0 0 0 0 0\ncpu0 10 0 10 100 0 0 0 0 0 0\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "meminfo"), []byte("MemTotal:       4194304 kB\nMemAvailable:   4194304 kB\n"), 0644))
+
+	a := agent.New(&agent.Config{
+		FirecrackerBin: fctest.Build(t),
+		ProcRoot:       proc,
+		CgroupRoot:     t.TempDir(),
+		AuthToken:      testToken,
+		TokenFile:      filepath.Join(t.TempDir(), "tokens.json"),
+		AuditLog:       "off",
+	})
+	srv := httptest.NewServer(a.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func createVM(t *testing.T, c *agentclient.Client, name string) *agentclient.MicroVMInfo {
+	t.Helper()
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "vmlinux")
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	require.NoError(t, os.WriteFile(kernel, nil, 0600))
+	require.NoError(t, os.WriteFile(rootfs, nil, 0600))
+
+	vm, err := c.Create(context.Background(), &agentclient.CreateMicroVMRequest{
+		Name:      name,
+		Labels:    map[string]string{"team": "ci"},
+		Kernel:    kernel,
+		Rootfs:    rootfs,
+		VCPUs:     1,
+		MemoryMiB: 128,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Delete(context.Background(), vm.ID, true) })
+	return vm
+}
+
+func TestClient(t *testing.T) {
+	srv := newTestAgent(t)
+	c := agentclient.New(srv.URL, &agentclient.Options{Token: testToken})
+	ctx := context.Background()
+
+	require.NoError(t, c.Health(ctx))
+
+	vm := createVM(t, c, "web")
+	assert.Equal(t, "web", vm.Name)
+	assert.True(t, vm.Running)
+
+	t.Run("list and get", func(t *testing.T) {
+		vms, err := c.List(ctx, "team=ci")
+		require.NoError(t, err)
+		require.Len(t, vms, 1)
+		assert.Equal(t, vm.ID, vms[0].ID)
+
+		vms, err = c.List(ctx, "team=other")
+		require.NoError(t, err)
+		assert.Empty(t, vms)
+
+		got, err := c.Get(ctx, "web")
+		require.NoError(t, err)
+		assert.Equal(t, vm.ID, got.ID)
+		assert.Equal(t, 128, got.Config.MemoryMiB)
+	})
+
+	t.Run("capacity", func(t *testing.T) {
+		capacity, err := c.Capacity(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, capacity.MicroVMs)
+		assert.Equal(t, 1, capacity.ReservedVCPUs)
+	})
+
+	t.Run("extend", func(t *testing.T) {
+		before := time.Now()
+		got, err := c.Extend(ctx, "web", time.Hour)
+		require.NoError(t, err)
+		require.NotNil(t, got.ExpiresAt)
+		assert.True(t, got.ExpiresAt.After(before.Add(59*time.Minute)))
+	})
+
+	t.Run("console", func(t *testing.T) {
+		console, err := c.Console(ctx, "web")
+		require.NoError(t, err)
+		defer console.Close()
+
+		_, err = io.WriteString(console, "hello from the host\n")
+		require.NoError(t, err)
+
+		r := bufio.NewReader(console)
+		var out strings.Builder
+		for !strings.Contains(out.String(), "hello from the host\r\n") {
+			line, err := r.ReadString('\n')
+			out.WriteString(line)
+			require.NoError(t, err, "console output so far: %q", out.String())
+		}
+	})
+
+	t.Run("firecracker", func(t *testing.T) {
+		cfg, err := c.Firecracker("web").GetMachineConfig(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 128, cfg.MemSizeMib)
+	})
+
+	t.Run("firecracker metrics", func(t *testing.T) {
+		// metrics get reaches Firecracker, not the agent's Prometheus
+		// endpoint. Firecracker only flushes metrics to its sink, so it
+		// refuses the GET.
+		_, err := c.Firecracker("web").GetMetrics(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Invalid request method and/or path: GET /metrics")
+	})
+
+	t.Run("firecracker logs", func(t *testing.T) {
+		logs, err := c.FirecrackerLogs(ctx, "web", 0, false)
+		require.NoError(t, err)
+		defer logs.Close()
+		data, err := io.ReadAll(logs)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "Successfully started microvm")
+	})
+
+	require.NoError(t, c.Delete(ctx, "web", false))
+	_, err := c.Get(ctx, "web")
+	require.Error(t, err)
+	assert.True(t, agentclient.IsNotFound(err))
+}
+
+func TestOperations(t *testing.T) {
+	srv := newTestAgent(t)
+	c := agentclient.New(srv.URL, &agentclient.Options{Token: testToken, PollInterval: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	require.NoError(t, os.WriteFile(rootfs, nil, 0600))
+
+	// Firecracker rejects the kernel after the create has been accepted
+	op, err := c.CreateAsync(ctx, &agentclient.CreateMicroVMRequest{
+		Name:   "broken",
+		Kernel: "/nonexistent/vmlinux",
+		Rootfs: rootfs,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "create", op.Type)
+	assert.Equal(t, "broken", op.MicroVM)
+
+	var seen []string
+	op, err = c.Wait(ctx, op, func(op *agentclient.Operation) {
+		seen = append(seen, op.Status)
+	})
+	var opErr *agentclient.OperationError
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, agentclient.OperationFailed, op.Status)
+	assert.Contains(t, err.Error(), "Unable to open the kernel file")
+	assert.Equal(t, agentclient.OperationFailed, seen[len(seen)-1])
+
+	ops, err := c.Operations(ctx)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, op.ID, ops[0].ID)
+
+	_, err = c.CancelOperation(ctx, op.ID)
+	var agentErr *agentclient.Error
+	require.ErrorAs(t, err, &agentErr)
+	assert.Equal(t, http.StatusConflict, agentErr.StatusCode)
+
+	// Agents from before operations answer creates and deletes directly
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id":"vm-1","name":"web","running":true}`)
+			return
+		}
+		io.WriteString(w, `{"status":"deleted","id":"vm-1"}`)
+	}))
+	defer old.Close()
+	oc := agentclient.New(old.URL, &agentclient.Options{Unversioned: true})
+
+	vm, err := oc.Create(ctx, &agentclient.CreateMicroVMRequest{Kernel: "/k", Rootfs: "/r"})
+	require.NoError(t, err)
+	assert.Equal(t, "vm-1", vm.ID)
+	assert.NoError(t, oc.Delete(ctx, "web", false))
+}
+
+func TestBatchCreate(t *testing.T) {
+	srv := newTestAgent(t)
+	c := agentclient.New(srv.URL, &agentclient.Options{Token: testToken, PollInterval: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "vmlinux")
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	require.NoError(t, os.WriteFile(kernel, nil, 0600))
+	require.NoError(t, os.WriteFile(rootfs, nil, 0600))
+
+	op, err := c.BatchCreate(ctx, &agentclient.BatchCreateRequest{
+		Name:     "worker-{n}",
+		Count:    2,
+		Template: agentclient.CreateMicroVMRequest{Kernel: kernel, Rootfs: rootfs},
+	})
+	require.NoError(t, err)
+	require.Len(t, op.Items, 2)
+	for _, item := range op.Items {
+		t.Cleanup(func() { c.Delete(context.Background(), item.Name, true) })
+		assert.Equal(t, agentclient.OperationSucceeded, item.Status)
+	}
+
+	vms, err := c.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, vms, 2)
+
+	// A failed batch still reports each microVM
+	op, err = c.BatchCreate(ctx, &agentclient.BatchCreateRequest{
+		Name:     "worker-{n}",
+		Count:    1,
+		Template: agentclient.CreateMicroVMRequest{Kernel: kernel, Rootfs: rootfs},
+	})
+	var opErr *agentclient.OperationError
+	require.ErrorAs(t, err, &opErr)
+	require.Len(t, op.Items, 1)
+	assert.Equal(t, "microVM with name 'worker-1' already exists", op.Items[0].Error)
+}
+
+func TestClone(t *testing.T) {
+	srv := newTestAgent(t)
+	c := agentclient.New(srv.URL, &agentclient.Options{Token: testToken, PollInterval: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "vmlinux")
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	require.NoError(t, os.WriteFile(kernel, nil, 0600))
+	require.NoError(t, os.WriteFile(rootfs, nil, 0600))
+
+	_, err := c.Create(ctx, &agentclient.CreateMicroVMRequest{Name: "web", Kernel: kernel, Rootfs: rootfs})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Delete(context.Background(), "web", true) })
+
+	vm, err := c.Clone(ctx, "web", &agentclient.CloneMicroVMRequest{Name: "web-2"})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Delete(context.Background(), "web-2", true) })
+	assert.Equal(t, "web-2", vm.Name)
+	assert.True(t, vm.Running)
+	assert.Equal(t, filepath.Join(dir, "rootfs-web-2.ext4"), vm.Config.Rootfs)
+
+	_, err = c.Clone(ctx, "nope", &agentclient.CloneMicroVMRequest{})
+	assert.True(t, agentclient.IsNotFound(err))
+}
+
+func TestPauseResume(t *testing.T) {
+	srv := newTestAgent(t)
+	c := agentclient.New(srv.URL, &agentclient.Options{Token: testToken, PollInterval: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "vmlinux")
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	require.NoError(t, os.WriteFile(kernel, nil, 0600))
+	require.NoError(t, os.WriteFile(rootfs, nil, 0600))
+
+	_, err := c.Create(ctx, &agentclient.CreateMicroVMRequest{Name: "web", Kernel: kernel, Rootfs: rootfs})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Delete(context.Background(), "web", true) })
+
+	vm, err := c.Pause(ctx, "web")
+	require.NoError(t, err)
+	assert.True(t, vm.Paused)
+
+	vm, err = c.Get(ctx, "web")
+	require.NoError(t, err)
+	assert.True(t, vm.Paused)
+
+	vm, err = c.Resume(ctx, "web")
+	require.NoError(t, err)
+	assert.False(t, vm.Paused)
+
+	_, err = c.Pause(ctx, "nope")
+	assert.True(t, agentclient.IsNotFound(err))
+}
+
+func TestSwapDrive(t *testing.T) {
+	srv := newTestAgent(t)
+	c := agentclient.New(srv.URL, &agentclient.Options{Token: testToken, PollInterval: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "vmlinux")
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	newRootfs := filepath.Join(dir, "rootfs-v2.ext4")
+	for _, path := range []string{kernel, rootfs, newRootfs} {
+		require.NoError(t, os.WriteFile(path, nil, 0600))
+	}
+
+	_, err := c.Create(ctx, &agentclient.CreateMicroVMRequest{Name: "web", Kernel: kernel, Rootfs: rootfs})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Delete(context.Background(), "web", true) })
+
+	vm, err := c.SwapDrive(ctx, "web", "rootfs", newRootfs)
+	require.NoError(t, err)
+	assert.Equal(t, newRootfs, vm.Config.Rootfs)
+
+	_, err = c.SwapDrive(ctx, "web", "rootfs", filepath.Join(dir, "missing.ext4"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist")
+}
+
+func TestCreateIdempotencyKey(t *testing.T) {
+	srv := newTestAgent(t)
+	c := agentclient.New(srv.URL, &agentclient.Options{Token: testToken, PollInterval: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "vmlinux")
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	require.NoError(t, os.WriteFile(kernel, nil, 0600))
+	require.NoError(t, os.WriteFile(rootfs, nil, 0600))
+	req := &agentclient.CreateMicroVMRequest{Kernel: kernel, Rootfs: rootfs, IdempotencyKey: "job-1234"}
+
+	first, err := c.Create(ctx, req)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Delete(context.Background(), first.ID, true) })
+	again, err := c.Create(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, again.ID)
+
+	// Connections that fail before an answer are retried with the same key
+	var keys []string
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"id":"op-1","type":"create","microvm":"web","status":"running"}`)
+	}))
+	defer flaky.Close()
+
+	op, err := agentclient.New(flaky.URL, &agentclient.Options{PollInterval: time.Millisecond}).CreateAsync(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "op-1", op.ID)
+	assert.Equal(t, []string{"job-1234", "job-1234"}, keys)
+}
+
+func TestVersion(t *testing.T) {
+	srv := newTestAgent(t)
+	ctx := context.Background()
+
+	info, err := agentclient.New(srv.URL, &agentclient.Options{Token: testToken}).Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, agentclient.APIVersion, info.APIVersion)
+	assert.Equal(t, "v"+fctest.Version, info.FirecrackerVersion)
+
+	// Agents from before /v1 only answer the health check with a status
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/health", r.URL.Path, "older agents forward other paths to Firecracker")
+		io.WriteString(w, `{"status":"ok"}`)
+	}))
+	defer old.Close()
+	_, err = agentclient.New(old.URL, nil).Version(ctx)
+	assert.ErrorIs(t, err, agentclient.ErrUnversioned)
+}
+
+func TestClientUnversioned(t *testing.T) {
+	srv := newTestAgent(t)
+	c := agentclient.New(srv.URL, &agentclient.Options{Token: testToken, Unversioned: true})
+	assert.Equal(t, srv.URL, c.APIURL())
+
+	vms, err := c.List(context.Background(), "")
+	require.NoError(t, err)
+	assert.Empty(t, vms)
+
+	assert.Equal(t, srv.URL+"/v1", agentclient.New(srv.URL+"/", nil).APIURL())
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := newTestAgent(t)
+	ctx := context.Background()
+
+	t.Run("not found", func(t *testing.T) {
+		c := agentclient.New(srv.URL, &agentclient.Options{Token: testToken})
+		err := c.Delete(ctx, "missing", false)
+		require.Error(t, err)
+		assert.True(t, agentclient.IsNotFound(err))
+
+		_, err = c.Console(ctx, "missing")
+		require.Error(t, err)
+		assert.True(t, agentclient.IsNotFound(err))
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		c := agentclient.New(srv.URL, &agentclient.Options{Token: testToken})
+		_, err := c.Create(ctx, &agentclient.CreateMicroVMRequest{Name: "no-images"})
+		require.Error(t, err)
+		var agentErr *agentclient.Error
+		require.ErrorAs(t, err, &agentErr)
+		assert.Equal(t, http.StatusBadRequest, agentErr.StatusCode)
+		assert.False(t, agentclient.IsNotFound(err))
+
+		// Invalid bodies are reported field by field
+		assert.Equal(t, "invalid request body", agentErr.Message)
+		assert.Equal(t, []agentclient.FieldError{
+			{Field: "kernel", Message: "must not be empty"},
+			{Field: "rootfs", Message: "must not be empty"},
+		}, agentErr.Fields)
+		assert.EqualError(t, err, "invalid request body: kernel must not be empty; rootfs must not be empty")
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		c := agentclient.New(srv.URL, nil)
+		_, err := c.List(ctx, "")
+		require.Error(t, err)
+		var agentErr *agentclient.Error
+		require.ErrorAs(t, err, &agentErr)
+		assert.Equal(t, http.StatusUnauthorized, agentErr.StatusCode)
+	})
+}
@@ -0,0 +1,291 @@
+package agentclient
+
+import "time"
+
+// MicroVMConfig holds per-microVM configuration.
+type MicroVMConfig struct {
+	VCPUs     int    `json:"vcpus"`
+	MemoryMiB int    `json:"memory_mib"`
+	Kernel    string `json:"kernel"`
+	Rootfs    string `json:"rootfs"`
+	BootArgs  string `json:"boot_args"`
+
+	FCLogLevel string `json:"fc_log_level,omitempty"` // Firecracker's own log level
+}
+
+// MicroVMInfo is fc-agent's view of a microVM.
+type MicroVMInfo struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Running      bool              `json:"running"`
+	Paused       bool              `json:"paused,omitempty"`
+	PID          int               `json:"pid,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Config       *MicroVMConfig    `json:"config,omitempty"`
+	Network      *NetworkInfo      `json:"network,omitempty"`
+	Vsock        bool              `json:"vsock,omitempty"`
+	CPUPercent   float64           `json:"cpu_percent,omitempty"`
+	MemoryUsedMB int               `json:"memory_used_mb,omitempty"`
+
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	IdleTimeout   string     `json:"idle_timeout,omitempty"`
+	LastActivity  *time.Time `json:"last_activity,omitempty"`
+	IdleExpiresAt *time.Time `json:"idle_expires_at,omitempty"`
+
+	Resources *ResourceLimits `json:"resources,omitempty"`
+	Jailed    bool            `json:"jailed,omitempty"`
+}
+
+// CreateMicroVMRequest is the request body for creating a microVM.
+type CreateMicroVMRequest struct {
+	Name      string            `json:"name,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Kernel    string            `json:"kernel"`
+	Rootfs    string            `json:"rootfs"`
+	VCPUs     int               `json:"vcpus"`
+	MemoryMiB int               `json:"memory_mib"`
+	BootArgs  string            `json:"boot_args,omitempty"`
+	Network   *NetworkConfig    `json:"network,omitempty"`
+	Vsock     bool              `json:"vsock,omitempty"`
+
+	// TTL stops the microVM this long after creation. IdleTimeout stops it
+	// after this long without console or vsock activity. Go duration syntax.
+	TTL         string `json:"ttl,omitempty"`
+	IdleTimeout string `json:"idle_timeout,omitempty"`
+
+	// Resources overrides the cgroup limits derived from vcpus and memory.
+	Resources *ResourceLimits `json:"resources,omitempty"`
+
+	// FCLogLevel is Firecracker's log level: Error, Warning (default), Info,
+	// Debug or Trace.
+	FCLogLevel string `json:"fc_log_level,omitempty"`
+
+	// IdempotencyKey is sent as the Idempotency-Key header. A create retried
+	// with the same key returns the original operation instead of starting
+	// a second microVM.
+	IdempotencyKey string `json:"-"`
+}
+
+// Operation states, also used for each step of an operation and each item
+// of a batch.
+const (
+	OperationPending   = "pending" // A batch item that has not started yet
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+	OperationCancelled = "cancelled"
+)
+
+// Operation is a change fc-agent makes in the background, such as creating
+// a microVM. Creates and deletes return one straight away; poll it at
+// /agent/operations/{id} until it is done.
+type Operation struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"` // "create", "delete", "batch" or "clone"
+	MicroVMID string          `json:"microvm_id"`
+	MicroVM   string          `json:"microvm"` // The microVM's name
+	Status    string          `json:"status"`
+	Steps     []OperationStep `json:"steps"`
+	Error     string          `json:"error,omitempty"`
+	Result    *MicroVMInfo    `json:"result,omitempty"` // The created microVM
+	Items     []BatchItem     `json:"items,omitempty"`  // Each microVM of a batch
+	CreatedAt time.Time       `json:"created_at"`
+	DoneAt    *time.Time      `json:"done_at,omitempty"`
+}
+
+// Done reports whether the operation has finished, successfully or not.
+func (o *Operation) Done() bool {
+	return o.Status != OperationRunning
+}
+
+// OperationStep is one stage of an operation, such as starting Firecracker.
+type OperationStep struct {
+	Name      string     `json:"name"`
+	Status    string     `json:"status"`
+	StartedAt time.Time  `json:"started_at"`
+	DoneAt    *time.Time `json:"done_at,omitempty"`
+}
+
+// BatchCreateRequest creates Count microVMs from one template.
+type BatchCreateRequest struct {
+	// Name is the pattern for the microVMs' names, in which {n} stands for 1
+	// to Count, such as "worker-{n}". Template.Name must be empty.
+	Name     string               `json:"name"`
+	Count    int                  `json:"count"`
+	Template CreateMicroVMRequest `json:"template"`
+
+	// Parallelism is how many microVMs boot at once (default: 4).
+	Parallelism int `json:"parallelism,omitempty"`
+
+	// Rollback stops every microVM of the batch if any of them fails.
+	Rollback bool `json:"rollback,omitempty"`
+}
+
+// BatchItem is the state of one microVM of a batch create.
+type BatchItem struct {
+	Name   string       `json:"name"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Result *MicroVMInfo `json:"result,omitempty"` // The created microVM
+}
+
+// CloneMicroVMRequest is the request body for cloning a running microVM.
+// The clone gets the source's configuration, memory and disk contents as of
+// the clone, but its own name, rootfs copy and network address.
+type CloneMicroVMRequest struct {
+	Name   string            `json:"name,omitempty"`   // Empty means auto-generate
+	Labels map[string]string `json:"labels,omitempty"` // Default: the source's labels
+	TTL    string            `json:"ttl,omitempty"`
+
+	// ExecPort is the vsock port of the guest's command service, which the
+	// clone of a microVM on a network is readdressed through. Required for
+	// those.
+	ExecPort uint32 `json:"exec_port,omitempty"`
+}
+
+// ErrorResponse is the body of fc-agent's 400 responses to request bodies
+// that do not match the API's OpenAPI document.
+type ErrorResponse struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError is one invalid field in a request body.
+type FieldError struct {
+	Field   string `json:"field"` // Dotted path, e.g. "resources.cpu_percent"
+	Message string `json:"message"`
+}
+
+// VersionInfo is fc-agent's /version response.
+type VersionInfo struct {
+	Version            string `json:"version"` // fc-agent release
+	APIVersion         string `json:"api_version"`
+	FirecrackerVersion string `json:"firecracker_version,omitempty"`
+}
+
+// ResourceLimits are the cgroup limits applied to a microVM's Firecracker
+// process. Zero values mean "derive from the microVM config" for CPU and
+// memory and "unlimited" for I/O.
+type ResourceLimits struct {
+	CPUPercent   int   `json:"cpu_percent,omitempty"`    // 100 = one full CPU
+	MemoryMaxMiB int   `json:"memory_max_mib,omitempty"` // Guest memory plus VMM overhead
+	IOReadBPS    int64 `json:"io_read_bps,omitempty"`
+	IOWriteBPS   int64 `json:"io_write_bps,omitempty"`
+	IOReadIOPS   int64 `json:"io_read_iops,omitempty"`
+	IOWriteIOPS  int64 `json:"io_write_iops,omitempty"`
+
+	// IODevice is the "major:minor" of the block device I/O limits apply
+	// to. Defaults to the disk holding the rootfs.
+	IODevice string `json:"io_device,omitempty"`
+}
+
+// NetworkConfig requests that a microVM be attached to a shared network.
+type NetworkConfig struct {
+	Name string `json:"name"`
+}
+
+// NetworkInfo describes a microVM's attachment to a shared network.
+type NetworkInfo struct {
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+	Gateway   string `json:"gateway"`
+	MAC       string `json:"mac"`
+	TapDevice string `json:"tap_device"`
+}
+
+// Capacity is fc-agent's resource admission state.
+type Capacity struct {
+	// Linux VM resources as reported by /proc
+	HostCPUs               int `json:"host_cpus"`
+	HostMemoryMiB          int `json:"host_memory_mib"`
+	HostAvailableMemoryMiB int `json:"host_available_memory_mib"`
+
+	// Admission limits after overcommit and the host memory reserve
+	CPUOvercommitRatio    float64 `json:"cpu_overcommit_ratio"`
+	MemoryOvercommitRatio float64 `json:"memory_overcommit_ratio"`
+	MemoryReserveMiB      int     `json:"memory_reserve_mib"`
+	VCPULimit             int     `json:"vcpu_limit"`
+	MemoryLimitMiB        int     `json:"memory_limit_mib"`
+
+	// Resources reserved by existing and in-flight microVMs
+	ReservedVCPUs     int `json:"reserved_vcpus"`
+	ReservedMemoryMiB int `json:"reserved_memory_mib"`
+	MicroVMs          int `json:"microvms"`
+	MaxMicroVMs       int `json:"max_microvms"`
+}
+
+// StatsSample is a microVM's resource usage at one point in its history.
+// CPU and memory are averaged over the sample's step; the block and network
+// counters are totals since the microVM started, as of the end of the step.
+type StatsSample struct {
+	Time            time.Time `json:"time"`
+	CPUPercent      float64   `json:"cpu_percent"`
+	MemoryBytes     int64     `json:"memory_bytes"`
+	BlockReadBytes  int64     `json:"block_read_bytes"`
+	BlockWriteBytes int64     `json:"block_write_bytes"`
+	NetRxBytes      int64     `json:"net_rx_bytes"`
+	NetTxBytes      int64     `json:"net_tx_bytes"`
+}
+
+// MicroVMStats is a microVM's resource history.
+type MicroVMStats struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Range   string        `json:"range"`
+	Step    string        `json:"step"`
+	Samples []StatsSample `json:"samples"`
+}
+
+// MicroVMUsage is one microVM's current resource usage. The block and
+// network counters are totals since the microVM started.
+type MicroVMUsage struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Running         bool    `json:"running"`
+	CPUPercent      float64 `json:"cpu_percent"`
+	MemoryBytes     int64   `json:"memory_bytes"`
+	MemoryMiB       int     `json:"memory_mib"` // Configured guest memory
+	BlockReadBytes  int64   `json:"block_read_bytes"`
+	BlockWriteBytes int64   `json:"block_write_bytes"`
+	NetRxBytes      int64   `json:"net_rx_bytes"`
+	NetTxBytes      int64   `json:"net_tx_bytes"`
+
+	// Balloon sizes, set when the microVM has a balloon device. Actual is
+	// only known when the balloon has statistics polling enabled.
+	BalloonTargetMiB *int64 `json:"balloon_target_mib,omitempty"`
+	BalloonActualMiB *int64 `json:"balloon_actual_mib,omitempty"`
+}
+
+// SwapDriveRequest is the request body for pointing a running microVM's
+// drive at another file.
+type SwapDriveRequest struct {
+	DriveID string `json:"drive_id"`
+	// PathOnHost is the new backing file, on the Linux VM's filesystem. No
+	// other drive may be using it.
+	PathOnHost string `json:"path_on_host"`
+}
+
+// ExtendRequest is the request body for extending a microVM's lifetime.
+type ExtendRequest struct {
+	// TTL is added to the current expiry (or to now, if the microVM had no
+	// TTL or has already passed it). Go duration syntax, e.g. "30m".
+	TTL string `json:"ttl"`
+}
+
+// ExecRequest is the request body for running a command in a microVM over vsock.
+//
+// The guest is expected to run a line-oriented command service on Port, for
+// example `socat VSOCK-LISTEN:52,fork EXEC:/bin/sh`. The command is written
+// followed by a newline, the write side is closed, and everything the guest
+// sends back until it closes the connection is returned as output.
+type ExecRequest struct {
+	Port           uint32 `json:"port"`
+	Command        string `json:"command"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+// ExecResponse is the result of a vsock exec.
+type ExecResponse struct {
+	Output string `json:"output"`
+}
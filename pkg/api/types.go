@@ -56,6 +56,19 @@ type SnapshotLoad struct {
 	MemFilePath         string `json:"mem_file_path,omitempty"`
 	EnableDiffSnapshots bool   `json:"enable_diff_snapshots,omitempty"`
 	ResumeVM            bool   `json:"resume_vm,omitempty"`
+
+	// NetworkOverrides attach restored network interfaces to different tap
+	// devices, and give them different MACs, than the snapshotted microVM
+	// used.
+	NetworkOverrides []NetworkOverride `json:"network_overrides,omitempty"`
+}
+
+// NetworkOverride replaces a network interface's tap device on snapshot
+// load. An empty GuestMAC keeps the snapshotted MAC.
+type NetworkOverride struct {
+	IfaceID     string `json:"iface_id"`
+	HostDevName string `json:"host_dev_name"`
+	GuestMAC    string `json:"guest_mac,omitempty"`
 }
 
 // Balloon represents memory balloon configuration.
@@ -106,6 +119,7 @@ type Metrics struct {
 	Block   map[string]interface{} `json:"block,omitempty"`
 	Net     map[string]interface{} `json:"net,omitempty"`
 	VCPUs   []interface{}          `json:"vcpus,omitempty"`
+	VCPU    map[string]interface{} `json:"vcpu,omitempty"` // Counters summed over all vCPUs, as written to the metrics FIFO
 	Seccomp map[string]interface{} `json:"seccomp,omitempty"`
 	VMM     map[string]interface{} `json:"vmm,omitempty"`
 	Signals map[string]interface{} `json:"signals,omitempty"`
@@ -126,6 +140,11 @@ type Logger struct {
 	ShowLogOrigin bool   `json:"show_log_origin,omitempty"`
 }
 
+// MetricsConfig represents the metrics sink configuration.
+type MetricsConfig struct {
+	MetricsPath string `json:"metrics_path"`
+}
+
 // Version represents Firecracker version information.
 type Version struct {
 	FirecrackerVersion string `json:"firecracker_version"`
@@ -144,6 +163,17 @@ type VMState struct {
 	State string `json:"state"` // "Paused" or "Resumed"
 }
 
+// FullVMConfig is the whole configuration of a microVM, as returned by
+// GET /vm/config.
+type FullVMConfig struct {
+	BootSource        *BootSource         `json:"boot-source,omitempty"`
+	Drives            []*Drive            `json:"drives"`
+	MachineConfig     MachineConfig       `json:"machine-config"`
+	NetworkInterfaces []*NetworkInterface `json:"network-interfaces"`
+	Balloon           *Balloon            `json:"balloon,omitempty"`
+	Vsock             *Vsock              `json:"vsock,omitempty"`
+}
+
 // Error represents an API error response.
 type Error struct {
 	FaultMessage string `json:"fault_message"`
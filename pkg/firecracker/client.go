@@ -0,0 +1,327 @@
+// Package firecracker is a client for the Firecracker REST API. It speaks
+// the API over any HTTP transport: a vsock transport for the
+// Virtualization.framework VM, a Unix socket to Firecracker itself, or plain
+// TCP to fc-agent, which forwards the API to Firecracker.
+package firecracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/anthropics/fc-macos/pkg/api"
+)
+
+// Client is a client for the Firecracker API.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// New creates a Firecracker API client that sends every request through
+// transport, such as a vsock transport.
+func New(transport http.RoundTripper) *Client {
+	// vsock doesn't need a real host
+	return NewAt(&http.Client{Transport: transport}, "http://localhost")
+}
+
+// NewAt creates a Firecracker API client for the API served at baseURL, such
+// as fc-agent's forwarding endpoint.
+func NewAt(httpClient *http.Client, baseURL string) *Client {
+	return &Client{
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Boot Source
+
+// SetBootSource configures the boot source for the microVM.
+func (c *Client) SetBootSource(ctx context.Context, bs *api.BootSource) error {
+	return c.put(ctx, "/boot-source", bs)
+}
+
+// GetBootSource retrieves the boot source configuration, which is empty
+// until one is set.
+func (c *Client) GetBootSource(ctx context.Context) (*api.BootSource, error) {
+	// Firecracker only reports the boot source as part of /vm/config
+	cfg, err := c.GetVMConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BootSource == nil {
+		return &api.BootSource{}, nil
+	}
+	return cfg.BootSource, nil
+}
+
+// Drives
+
+// SetDrive configures a block device.
+func (c *Client) SetDrive(ctx context.Context, id string, drive *api.Drive) error {
+	return c.put(ctx, fmt.Sprintf("/drives/%s", id), drive)
+}
+
+// GetDrives retrieves all configured drives, from /vm/config.
+func (c *Client) GetDrives(ctx context.Context) ([]*api.Drive, error) {
+	cfg, err := c.GetVMConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Drives, nil
+}
+
+// PatchDrive updates a drive's backing file, its rate limiter, or both. An
+// empty pathOnHost or nil rateLimiter leaves that part as it is. Firecracker
+// keeps any bucket rateLimiter leaves out, and turns off one whose size or
+// refill time is 0.
+func (c *Client) PatchDrive(ctx context.Context, id string, pathOnHost string, rateLimiter *api.RateLimiter) error {
+	update := map[string]interface{}{"drive_id": id}
+	if pathOnHost != "" {
+		update["path_on_host"] = pathOnHost
+	}
+	if rateLimiter != nil {
+		update["rate_limiter"] = rateLimiter
+	}
+	return c.patch(ctx, fmt.Sprintf("/drives/%s", id), update)
+}
+
+// DeleteDrive removes a drive configuration.
+func (c *Client) DeleteDrive(ctx context.Context, id string) error {
+	return c.delete(ctx, fmt.Sprintf("/drives/%s", id))
+}
+
+// Network Interfaces
+
+// SetNetworkInterface configures a network interface.
+func (c *Client) SetNetworkInterface(ctx context.Context, id string, iface *api.NetworkInterface) error {
+	return c.put(ctx, fmt.Sprintf("/network-interfaces/%s", id), iface)
+}
+
+// GetNetworkInterfaces retrieves all configured network interfaces, from
+// /vm/config.
+func (c *Client) GetNetworkInterfaces(ctx context.Context) ([]*api.NetworkInterface, error) {
+	cfg, err := c.GetVMConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.NetworkInterfaces, nil
+}
+
+// PatchNetworkInterface updates a network interface's rate limiters. A nil
+// limiter, or a bucket left out of one, is kept as it is, and a bucket whose
+// size or refill time is 0 is turned off.
+func (c *Client) PatchNetworkInterface(ctx context.Context, id string, rxLimiter, txLimiter *api.RateLimiter) error {
+	update := map[string]interface{}{"iface_id": id}
+	if rxLimiter != nil {
+		update["rx_rate_limiter"] = rxLimiter
+	}
+	if txLimiter != nil {
+		update["tx_rate_limiter"] = txLimiter
+	}
+	return c.patch(ctx, fmt.Sprintf("/network-interfaces/%s", id), update)
+}
+
+// DeleteNetworkInterface removes a network interface configuration.
+func (c *Client) DeleteNetworkInterface(ctx context.Context, id string) error {
+	return c.delete(ctx, fmt.Sprintf("/network-interfaces/%s", id))
+}
+
+// Machine Config
+
+// SetMachineConfig configures the machine settings.
+func (c *Client) SetMachineConfig(ctx context.Context, cfg *api.MachineConfig) error {
+	return c.put(ctx, "/machine-config", cfg)
+}
+
+// GetMachineConfig retrieves the machine configuration.
+func (c *Client) GetMachineConfig(ctx context.Context) (*api.MachineConfig, error) {
+	var cfg api.MachineConfig
+	if err := c.get(ctx, "/machine-config", &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// GetVMConfig retrieves the whole microVM configuration, including the
+// current drives and network interfaces.
+func (c *Client) GetVMConfig(ctx context.Context) (*api.FullVMConfig, error) {
+	var cfg api.FullVMConfig
+	if err := c.get(ctx, "/vm/config", &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Version
+
+// GetVersion retrieves the Firecracker version.
+func (c *Client) GetVersion(ctx context.Context) (*api.Version, error) {
+	var version api.Version
+	if err := c.get(ctx, "/version", &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// Actions
+
+// StartInstance starts the microVM.
+func (c *Client) StartInstance(ctx context.Context) error {
+	return c.put(ctx, "/actions", &api.Action{ActionType: "InstanceStart"})
+}
+
+// StopInstance sends Ctrl+Alt+Del to the microVM.
+func (c *Client) StopInstance(ctx context.Context) error {
+	return c.put(ctx, "/actions", &api.Action{ActionType: "SendCtrlAltDel"})
+}
+
+// PauseInstance pauses the microVM.
+func (c *Client) PauseInstance(ctx context.Context) error {
+	return c.patch(ctx, "/vm", &api.VMState{State: "Paused"})
+}
+
+// ResumeInstance resumes the microVM.
+func (c *Client) ResumeInstance(ctx context.Context) error {
+	return c.patch(ctx, "/vm", &api.VMState{State: "Resumed"})
+}
+
+// Snapshots
+
+// CreateSnapshot creates a snapshot of the microVM.
+func (c *Client) CreateSnapshot(ctx context.Context, params *api.SnapshotCreate) error {
+	return c.put(ctx, "/snapshot/create", params)
+}
+
+// LoadSnapshot loads a snapshot into a microVM.
+func (c *Client) LoadSnapshot(ctx context.Context, params *api.SnapshotLoad) error {
+	return c.put(ctx, "/snapshot/load", params)
+}
+
+// Metrics
+
+// GetMetrics retrieves the microVM metrics.
+func (c *Client) GetMetrics(ctx context.Context) (*api.Metrics, error) {
+	var metrics api.Metrics
+	if err := c.get(ctx, "/metrics", &metrics); err != nil {
+		return nil, err
+	}
+	return &metrics, nil
+}
+
+// SetMetricsSink points Firecracker at a file or FIFO to flush metrics to.
+func (c *Client) SetMetricsSink(ctx context.Context, cfg *api.MetricsConfig) error {
+	return c.put(ctx, "/metrics", cfg)
+}
+
+// Logging
+
+// SetLogger configures where and at what level Firecracker logs.
+func (c *Client) SetLogger(ctx context.Context, logger *api.Logger) error {
+	return c.put(ctx, "/logger", logger)
+}
+
+// Balloon
+
+// SetBalloon configures the memory balloon device.
+func (c *Client) SetBalloon(ctx context.Context, balloon *api.Balloon) error {
+	return c.put(ctx, "/balloon", balloon)
+}
+
+// GetBalloon retrieves the balloon configuration.
+func (c *Client) GetBalloon(ctx context.Context) (*api.Balloon, error) {
+	var balloon api.Balloon
+	if err := c.get(ctx, "/balloon", &balloon); err != nil {
+		return nil, err
+	}
+	return &balloon, nil
+}
+
+// GetBalloonStats retrieves balloon statistics.
+func (c *Client) GetBalloonStats(ctx context.Context) (*api.BalloonStats, error) {
+	var stats api.BalloonStats
+	if err := c.get(ctx, "/balloon/statistics", &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// PatchBalloon updates the balloon target size.
+func (c *Client) PatchBalloon(ctx context.Context, amountMib int64) error {
+	return c.patch(ctx, "/balloon", &api.BalloonUpdate{AmountMib: amountMib})
+}
+
+// HTTP helpers
+
+func (c *Client) put(ctx context.Context, path string, body interface{}) error {
+	return c.doRequest(ctx, "PUT", path, body, nil)
+}
+
+func (c *Client) get(ctx context.Context, path string, result interface{}) error {
+	return c.doRequest(ctx, "GET", path, nil, result)
+}
+
+func (c *Client) patch(ctx context.Context, path string, body interface{}) error {
+	return c.doRequest(ctx, "PATCH", path, body, nil)
+}
+
+func (c *Client) delete(ctx context.Context, path string) error {
+	return c.doRequest(ctx, "DELETE", path, nil, nil)
+}
+
+func (c *Client) doRequest(ctx context.Context, method, path string, body, result interface{}) error {
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return apiError(resp)
+	}
+
+	if result != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// apiError turns an error response into an error. Firecracker answers with a
+// fault_message; fc-agent's own failures are plain text.
+func apiError(resp *http.Response) error {
+	data, _ := io.ReadAll(resp.Body)
+	var apiErr api.Error
+	if err := json.Unmarshal(data, &apiErr); err == nil && apiErr.FaultMessage != "" {
+		return fmt.Errorf("API error (%d): %s", resp.StatusCode, apiErr.FaultMessage)
+	}
+	if msg := strings.TrimSpace(string(data)); msg != "" {
+		return fmt.Errorf("API error (%d): %s", resp.StatusCode, msg)
+	}
+	return fmt.Errorf("API error: %s", resp.Status)
+}
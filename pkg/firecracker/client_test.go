@@ -0,0 +1,286 @@
+package firecracker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anthropics/fc-macos/internal/fctest"
+	"github.com/anthropics/fc-macos/pkg/api"
+)
+
+// request is one call seen by recorder.
+type request struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// recorder records the requests it gets and passes them on to the fake
+// Firecracker, so the tests check both what the client sends and that
+// Firecracker accepts it.
+type recorder struct {
+	fc       *fctest.Server
+	mu       sync.Mutex
+	requests []request
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	rec.requests = append(rec.requests, request{r.Method, r.URL.Path, strings.TrimSpace(string(body))})
+	rec.mu.Unlock()
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	rec.fc.ServeHTTP(w, r)
+}
+
+func (rec *recorder) last() request {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.requests[len(rec.requests)-1]
+}
+
+// connTransport writes each request straight to a new connection, the way
+// VsockTransport does.
+type connTransport struct {
+	addr string
+}
+
+func (t connTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, err := net.Dial("tcp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{resp.Body, conn}
+	return resp, nil
+}
+
+// transports runs fn against a new fake Firecracker over both ways of
+// reaching it.
+func transports(t *testing.T, fn func(t *testing.T, rec *recorder, c *Client)) {
+	serve := func(t *testing.T) (*recorder, *httptest.Server) {
+		rec := &recorder{fc: fctest.NewServer()}
+		srv := httptest.NewServer(rec)
+		t.Cleanup(func() {
+			srv.Close()
+			rec.fc.Close()
+		})
+		return rec, srv
+	}
+	t.Run("tcp", func(t *testing.T) {
+		rec, srv := serve(t)
+		fn(t, rec, NewAt(srv.Client(), srv.URL+"/"))
+	})
+	t.Run("conn", func(t *testing.T) {
+		rec, srv := serve(t)
+		fn(t, rec, New(connTransport{addr: srv.Listener.Addr().String()}))
+	})
+}
+
+// touch creates an empty file in dir and returns its path.
+func touch(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	return path
+}
+
+// jsonString quotes s as a JSON string.
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func TestClientRequests(t *testing.T) {
+	ctx := context.Background()
+	transports(t, func(t *testing.T, rec *recorder, c *Client) {
+		dir := t.TempDir()
+		kernel := touch(t, dir, "vmlinux")
+		rootfs := touch(t, dir, "rootfs.ext4")
+		data := touch(t, dir, "data.ext4")
+		swapped := touch(t, dir, "data-v2.ext4")
+		log := touch(t, dir, "fc.log")
+		snap, mem := filepath.Join(dir, "vmstate"), filepath.Join(dir, "memory")
+
+		// In the order a microVM's life goes through them
+		tests := []struct {
+			name string
+			call func() error
+			want request
+		}{
+			{"SetBootSource", func() error {
+				return c.SetBootSource(ctx, &api.BootSource{KernelImagePath: kernel})
+			}, request{"PUT", "/boot-source", `{"kernel_image_path":` + jsonString(kernel) + `}`}},
+			{"SetDrive", func() error {
+				return c.SetDrive(ctx, "rootfs", &api.Drive{DriveID: "rootfs", PathOnHost: rootfs, IsRootDevice: true})
+			}, request{"PUT", "/drives/rootfs", `{"drive_id":"rootfs","path_on_host":` + jsonString(rootfs) + `,"is_root_device":true,"is_read_only":false}`}},
+			{"SetDataDrive", func() error {
+				return c.SetDrive(ctx, "data", &api.Drive{DriveID: "data", PathOnHost: data})
+			}, request{"PUT", "/drives/data", `{"drive_id":"data","path_on_host":` + jsonString(data) + `,"is_root_device":false,"is_read_only":false}`}},
+			{"SetNetworkInterface", func() error {
+				return c.SetNetworkInterface(ctx, "eth0", &api.NetworkInterface{IfaceID: "eth0", HostDevName: "tap0"})
+			}, request{"PUT", "/network-interfaces/eth0", `{"iface_id":"eth0","host_dev_name":"tap0"}`}},
+			{"SetLogger", func() error {
+				return c.SetLogger(ctx, &api.Logger{LogPath: log, Level: "Info"})
+			}, request{"PUT", "/logger", `{"log_path":` + jsonString(log) + `,"level":"Info"}`}},
+			{"StartInstance", func() error {
+				return c.StartInstance(ctx)
+			}, request{"PUT", "/actions", `{"action_type":"InstanceStart"}`}},
+			{"PatchDrive", func() error {
+				return c.PatchDrive(ctx, "data", swapped, nil)
+			}, request{"PATCH", "/drives/data", `{"drive_id":"data","path_on_host":` + jsonString(swapped) + `}`}},
+			{"PatchDriveRateLimiter", func() error {
+				return c.PatchDrive(ctx, "data", "", &api.RateLimiter{Ops: &api.TokenBucket{Size: 100, RefillTime: 1000}})
+			}, request{"PATCH", "/drives/data", `{"drive_id":"data","rate_limiter":{"ops":{"size":100,"refill_time":1000}}}`}},
+			{"PatchNetworkInterface", func() error {
+				return c.PatchNetworkInterface(ctx, "eth0", &api.RateLimiter{Bandwidth: &api.TokenBucket{Size: 1000, RefillTime: 1000}}, nil)
+			}, request{"PATCH", "/network-interfaces/eth0", `{"iface_id":"eth0","rx_rate_limiter":{"bandwidth":{"size":1000,"refill_time":1000}}}`}},
+			{"PauseInstance", func() error {
+				return c.PauseInstance(ctx)
+			}, request{"PATCH", "/vm", `{"state":"Paused"}`}},
+			{"CreateSnapshot", func() error {
+				return c.CreateSnapshot(ctx, &api.SnapshotCreate{SnapshotPath: snap, MemFilePath: mem})
+			}, request{"PUT", "/snapshot/create", `{"snapshot_path":` + jsonString(snap) + `,"mem_file_path":` + jsonString(mem) + `}`}},
+			{"ResumeInstance", func() error {
+				return c.ResumeInstance(ctx)
+			}, request{"PATCH", "/vm", `{"state":"Resumed"}`}},
+			{"StopInstance", func() error {
+				return c.StopInstance(ctx)
+			}, request{"PUT", "/actions", `{"action_type":"SendCtrlAltDel"}`}},
+		}
+		for _, tt := range tests {
+			require.NoError(t, tt.call(), tt.name)
+			assert.Equal(t, tt.want, rec.last(), tt.name)
+		}
+
+		// Firecracker applied the updates
+		cfg, err := c.GetVMConfig(ctx)
+		require.NoError(t, err)
+		require.Len(t, cfg.Drives, 2)
+		assert.Equal(t, swapped, cfg.Drives[0].PathOnHost)
+		assert.Equal(t, &api.RateLimiter{Ops: &api.TokenBucket{Size: 100, RefillTime: 1000}}, cfg.Drives[0].RateLimiter)
+		require.Len(t, cfg.NetworkInterfaces, 1)
+		assert.NotNil(t, cfg.NetworkInterfaces[0].RxRateLimiter)
+		assert.FileExists(t, snap)
+	})
+}
+
+func TestClientResponses(t *testing.T) {
+	ctx := context.Background()
+	transports(t, func(t *testing.T, rec *recorder, c *Client) {
+		dir := t.TempDir()
+		kernel := touch(t, dir, "vmlinux")
+		rootfs := touch(t, dir, "rootfs.ext4")
+
+		// Nothing is configured yet
+		bs, err := c.GetBootSource(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &api.BootSource{}, bs)
+		drives, err := c.GetDrives(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, drives)
+
+		require.NoError(t, c.SetMachineConfig(ctx, &api.MachineConfig{VCPUCount: 2, MemSizeMib: 512}))
+		require.NoError(t, c.SetBootSource(ctx, &api.BootSource{KernelImagePath: kernel, BootArgs: "console=ttyS0"}))
+		require.NoError(t, c.SetDrive(ctx, "rootfs", &api.Drive{DriveID: "rootfs", PathOnHost: rootfs, IsRootDevice: true}))
+		require.NoError(t, c.SetNetworkInterface(ctx, "eth0", &api.NetworkInterface{IfaceID: "eth0", HostDevName: "tap0", GuestMAC: "06:00:ac:10:00:02"}))
+		require.NoError(t, c.SetBalloon(ctx, &api.Balloon{AmountMib: 48, StatsPollingIntervalS: 1}))
+		require.NoError(t, c.StartInstance(ctx))
+
+		bs, err = c.GetBootSource(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &api.BootSource{KernelImagePath: kernel, BootArgs: "console=ttyS0"}, bs)
+
+		drives, err = c.GetDrives(ctx)
+		require.NoError(t, err)
+		require.Len(t, drives, 1)
+		assert.Equal(t, "rootfs", drives[0].DriveID)
+		assert.True(t, drives[0].IsRootDevice)
+
+		ifaces, err := c.GetNetworkInterfaces(ctx)
+		require.NoError(t, err)
+		require.Len(t, ifaces, 1)
+		assert.Equal(t, "tap0", ifaces[0].HostDevName)
+
+		cfg, err := c.GetMachineConfig(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, cfg.VCPUCount)
+		assert.Equal(t, 512, cfg.MemSizeMib)
+
+		full, err := c.GetVMConfig(ctx)
+		require.NoError(t, err)
+		require.Len(t, full.Drives, 1)
+		assert.Equal(t, rootfs, full.Drives[0].PathOnHost)
+		assert.Equal(t, 512, full.MachineConfig.MemSizeMib)
+
+		version, err := c.GetVersion(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, fctest.Version, version.FirecrackerVersion)
+
+		balloon, err := c.GetBalloon(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(48), balloon.AmountMib)
+
+		stats, err := c.GetBalloonStats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(48), stats.ActualMib)
+	})
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+	transports(t, func(t *testing.T, rec *recorder, c *Client) {
+		err := c.SetBootSource(ctx, &api.BootSource{KernelImagePath: "/nonexistent/vmlinux"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "API error (400): ")
+		assert.Contains(t, err.Error(), "Unable to open the kernel file /nonexistent/vmlinux")
+
+		_, err = c.GetBalloon(ctx)
+		require.Error(t, err)
+		assert.Equal(t, "API error (400): Invalid request: the balloon device is not configured.", err.Error())
+
+		// Firecracker can't remove devices, and only writes metrics to
+		// the sink set with SetMetricsSink
+		err = c.DeleteDrive(ctx, "data")
+		require.Error(t, err)
+		assert.Equal(t, "API error (400): Invalid request method and/or path: DELETE /drives/data.", err.Error())
+		_, err = c.GetMetrics(ctx)
+		require.Error(t, err)
+		assert.Equal(t, "API error (400): Invalid request method and/or path: GET /metrics.", err.Error())
+	})
+
+	// fc-agent's own errors are plain text
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "microVM not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+	err := NewAt(srv.Client(), srv.URL).PatchBalloon(ctx, 128)
+	require.Error(t, err)
+	assert.Equal(t, "API error (404): microVM not found", err.Error())
+}